@@ -3,19 +3,37 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 	"github.com/robfig/cron/v3"
 	"github.com/shopspring/decimal"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/attachments"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/auth"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/bankstatement"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/blobstore"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/csvimport"
 	"github.com/valeriaulyamaeva/personal-finance-app/internal/database"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/dataexport"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/mail"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/ofx"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/oidc"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/passwords"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/recurrence"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/rules"
 	"github.com/valeriaulyamaeva/personal-finance-app/models"
 	"github.com/valeriaulyamaeva/personal-finance-app/utils"
-	"golang.org/x/crypto/bcrypt"
+	"io"
 	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -46,6 +64,82 @@ func ScheduleTransactionArchival(pool *pgxpool.Pool) {
 	c.Start()
 }
 
+func ScheduleLoginUnlocks(pool *pgxpool.Pool) {
+	c := cron.New()
+	_, err := c.AddFunc("* * * * *", func() {
+		if err := auth.ReleaseExpiredLockouts(pool); err != nil {
+			log.Printf("Ошибка снятия блокировок входа: %v", err)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Ошибка настройки CRON-задачи для снятия блокировок входа: %v", err)
+	}
+	c.Start()
+}
+
+func ScheduleDataExports(pool *pgxpool.Pool, store blobstore.Store) {
+	c := cron.New()
+	_, err := c.AddFunc("* * * * *", func() {
+		dataexport.ProcessPending(pool, store)
+	})
+	if err != nil {
+		log.Fatalf("Ошибка настройки CRON-задачи для выгрузки данных: %v", err)
+	}
+	_, err = c.AddFunc("@hourly", func() {
+		dataexport.RemoveExpired(pool)
+	})
+	if err != nil {
+		log.Fatalf("Ошибка настройки CRON-задачи для очистки выгрузок данных: %v", err)
+	}
+	c.Start()
+}
+
+func ScheduleAccountDeletions(pool *pgxpool.Pool) {
+	c := cron.New()
+	_, err := c.AddFunc("@hourly", func() {
+		if err := auth.PurgeDueAccounts(pool); err != nil {
+			log.Printf("Ошибка удаления аккаунтов: %v", err)
+		}
+	})
+	if err != nil {
+		log.Fatalf("Ошибка настройки CRON-задачи для удаления аккаунтов: %v", err)
+	}
+	c.Start()
+}
+
+func ScheduleRecurringTransactions(pool *pgxpool.Pool) {
+	run := func() {
+		created, err := database.ProcessRecurringTransactions(pool)
+		if err != nil {
+			log.Printf("Ошибка создания повторяющихся транзакций: %v", err)
+			return
+		}
+		if created > 0 {
+			log.Printf("Создано повторяющихся транзакций: %d", created)
+		}
+	}
+	// Повторения, пропущенные, пока сервер был остановлен, создаются сразу после запуска
+	go run()
+
+	c := cron.New()
+	_, err := c.AddFunc("@hourly", run)
+	if err != nil {
+		log.Fatalf("Ошибка настройки CRON-задачи для повторяющихся транзакций: %v", err)
+	}
+	c.Start()
+}
+
+func ScheduleAttachmentCleanup(pool *pgxpool.Pool, store blobstore.Store) {
+	c := cron.New()
+	_, err := c.AddFunc("@hourly", func() {
+		attachments.RemoveDeleted(pool, store)
+	})
+	if err != nil {
+		log.Fatalf("Ошибка настройки CRON-задачи для очистки хранилища файлов: %v", err)
+	}
+	c.Start()
+}
+
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Получаем исходный домен из заголовка
@@ -79,6 +173,741 @@ func CORSMiddleware() gin.HandlerFunc {
 	}
 }
 
+// requireSelfOrPermission пропускает владельца данных или пользователя с правом permission
+func requireSelfOrPermission(c *gin.Context, pool *pgxpool.Pool, userID int, permission string) bool {
+	if userID == auth.CurrentUserID(c) {
+		return true
+	}
+	allowed, err := auth.HasPermission(c, pool, permission)
+	if err != nil {
+		log.Printf("Ошибка проверки права %s: %v", permission, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки прав доступа"})
+		return false
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав"})
+		return false
+	}
+	return true
+}
+
+// requireCredentialsAccess пропускает смену пароля или email пользователя userID. Свои данные меняет
+// каждый, чужие — только с правом users.credentials и если у цели нет прав, которых нет у текущего
+// пользователя: иначе можно было бы войти под аккаунтом с большими правами.
+func requireCredentialsAccess(c *gin.Context, pool *pgxpool.Pool, userID int) bool {
+	if userID == auth.CurrentUserID(c) {
+		return true
+	}
+	if !requireSelfOrPermission(c, pool, userID, database.PermissionUsersCredentials) {
+		return false
+	}
+	targetPermissions, err := database.GetUserPermissions(pool, userID)
+	if err != nil {
+		log.Printf("Ошибка получения прав пользователя %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки прав доступа"})
+		return false
+	}
+	for _, permission := range targetPermissions {
+		allowed, err := auth.HasPermission(c, pool, permission)
+		if err != nil {
+			log.Printf("Ошибка проверки права %s: %v", permission, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки прав доступа"})
+			return false
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Нельзя менять пароль или email пользователя с большими правами"})
+			return false
+		}
+	}
+	return true
+}
+
+// accountDeletionError отвечает на ошибку удаления аккаунта
+func accountDeletionError(c *gin.Context, userID int, err error) {
+	switch {
+	case errors.Is(err, auth.ErrUnknownFamilyAction), errors.Is(err, auth.ErrTransferTargetNotMember):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, auth.ErrLastAdminCannotBeDeleted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Error deleting user with ID %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при удалении пользователя"})
+	}
+}
+
+// userDataError отвечает 400 на ошибки проверки данных пользователя и пароля; false — ошибка другого рода
+func userDataError(c *gin.Context, err error) bool {
+	var policyErr *passwords.PolicyError
+	switch {
+	case errors.As(err, &policyErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": passwords.ErrWeakPassword.Error(), "problems": policyErr.Problems})
+	case errors.Is(err, database.ErrMissingUserFields), errors.Is(err, database.ErrInvalidEmail):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		return false
+	}
+	return true
+}
+
+// recordAudit пишет событие о пользователе userID в журнал безопасности от имени текущего пользователя
+func recordAudit(c *gin.Context, pool *pgxpool.Pool, eventType string, userID int, details gin.H) {
+	recordAuditAs(c, pool, eventType, userID, auth.CurrentUserID(c), details)
+}
+
+// recordAuditAs пишет событие в журнал с явно указанным инициатором; 0 — инициатор неизвестен
+func recordAuditAs(c *gin.Context, pool *pgxpool.Pool, eventType string, userID, actorID int, details gin.H) {
+	event := models.AuditEvent{
+		EventType: eventType,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Details:   details,
+	}
+	if userID > 0 {
+		event.UserID = &userID
+	}
+	if actorID > 0 {
+		event.ActorID = &actorID
+	}
+	if err := database.InsertAuditEvent(pool, &event); err != nil {
+		log.Printf("Ошибка записи события %s в журнал безопасности: %v", eventType, err)
+	}
+}
+
+// parseQueryTime разбирает границу периода в формате RFC3339 или ГГГГ-ММ-ДД.
+// Дата без времени в конце периода (rangeEnd) означает весь этот день включительно.
+func parseQueryTime(value string, rangeEnd bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if rangeEnd {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// bindAuditFilter заполняет фильтр журнала из параметров запроса; при ошибке сам отвечает 400
+func bindAuditFilter(c *gin.Context, filter *database.AuditFilter) bool {
+	for name, target := range map[string]*int{"user_id": &filter.UserID, "actor_id": &filter.ActorID, "limit": &filter.Limit} {
+		if value := c.Query(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Некорректное значение параметра %s", name)})
+				return false
+			}
+			*target = parsed
+		}
+	}
+	if value := c.Query("before_id"); value != "" {
+		beforeID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || beforeID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректное значение параметра before_id"})
+			return false
+		}
+		filter.BeforeID = beforeID
+	}
+	if !bindPeriod(c, &filter.From, &filter.To) {
+		return false
+	}
+	filter.EventType = c.Query("event_type")
+	filter.IPAddress = c.Query("ip")
+	return true
+}
+
+// bindPeriod читает границы периода из параметров from и to; при ошибке сам отвечает 400
+func bindPeriod(c *gin.Context, from, to *time.Time) bool {
+	for name, target := range map[string]*time.Time{"from": from, "to": to} {
+		if value := c.Query(name); value != "" {
+			parsed, err := parseQueryTime(value, name == "to")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Некорректная дата в параметре %s", name)})
+				return false
+			}
+			*target = parsed
+		}
+	}
+	return true
+}
+
+// bindTransactionFilter заполняет фильтр списка транзакций из параметров запроса; при ошибке сам отвечает 400
+func bindTransactionFilter(c *gin.Context, filter *database.TransactionFilter) bool {
+	badRequest := func(name string) bool {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Некорректное значение параметра %s", name)})
+		return false
+	}
+
+	if !bindPeriod(c, &filter.From, &filter.To) {
+		return false
+	}
+	if value := c.Query("category_id"); value != "" {
+		for _, part := range strings.Split(value, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || id <= 0 {
+				return badRequest("category_id")
+			}
+			filter.CategoryIDs = append(filter.CategoryIDs, id)
+		}
+	}
+	if value := c.Query("tag_id"); value != "" {
+		seen := map[int]bool{}
+		for _, part := range strings.Split(value, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || id <= 0 {
+				return badRequest("tag_id")
+			}
+			if !seen[id] {
+				seen[id] = true
+				filter.TagIDs = append(filter.TagIDs, id)
+			}
+		}
+	}
+	switch filter.Type = c.Query("type"); filter.Type {
+	case "", "income", "expense", "goal", "transfer":
+	default:
+		return badRequest("type")
+	}
+	for name, target := range map[string]**float64{"min_amount": &filter.MinAmount, "max_amount": &filter.MaxAmount} {
+		if value := c.Query(name); value != "" {
+			amount, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return badRequest(name)
+			}
+			*target = &amount
+		}
+	}
+	for name, target := range map[string]*int{"goal_id": &filter.GoalID, "account_id": &filter.AccountID, "limit": &filter.Limit} {
+		if value := c.Query(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				return badRequest(name)
+			}
+			*target = parsed
+		}
+	}
+	filter.Currency = strings.ToUpper(c.Query("currency"))
+
+	// По умолчанию — сначала новые; order действует и на сортировку по сумме
+	switch filter.Sort = c.DefaultQuery("sort", database.TransactionSortDate); filter.Sort {
+	case database.TransactionSortDate, database.TransactionSortAmount:
+	default:
+		return badRequest("sort")
+	}
+	switch c.DefaultQuery("order", "desc") {
+	case "desc":
+		filter.Descending = true
+	case "asc":
+		filter.Descending = false
+	default:
+		return badRequest("order")
+	}
+	filter.Cursor = c.Query("cursor")
+	return true
+}
+
+// transactionInputError отвечает 400, если транзакцию не удалось сохранить из-за ошибки во вводе
+func transactionInputError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, database.ErrCategoryRequired),
+		errors.Is(err, database.ErrCategoryNotFound),
+		errors.Is(err, database.ErrGoalNotFound),
+		errors.Is(err, database.ErrInvalidSplits),
+		errors.Is(err, database.ErrInvalidTag),
+		errors.Is(err, database.ErrInvalidTransfer),
+		errors.Is(err, database.ErrAccountNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return true
+	}
+	return false
+}
+
+// accountError отвечает на ошибку операции со счётом; message — для непредвиденных ошибок
+func accountError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, database.ErrInvalidAccount):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrAccountNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrAccountInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// tagError отвечает на ошибку операции с тегом; message — для непредвиденных ошибок
+func tagError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, database.ErrInvalidTag):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrTagNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrTagExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// bindRecurringTransaction читает шаблон повторяющейся транзакции из запроса и проверяет принадлежность
+// категории, счетов и цели. Даты — в формате 2006-01-02. При ошибке сам отвечает клиенту.
+func bindRecurringTransaction(c *gin.Context, pool *pgxpool.Pool, template *models.RecurringTransaction) bool {
+	var request struct {
+		Name              string   `json:"name"`
+		Type              string   `json:"type"`
+		Amount            float64  `json:"amount"`
+		Currency          string   `json:"currency"`
+		Description       string   `json:"description"`
+		CategoryID        int      `json:"category_id"`
+		AccountID         int      `json:"account_id"`
+		TransferAccountID *int     `json:"transfer_account_id"`
+		TransferAmount    *float64 `json:"transfer_amount"`
+		GoalID            *int     `json:"goal_id"`
+		Frequency         string   `json:"frequency"`
+		Interval          int      `json:"interval"`
+		DayOfMonth        int      `json:"day_of_month"`
+		WorkingDay        string   `json:"working_day"`
+		StartDate         string   `json:"start_date"`
+		EndDate           string   `json:"end_date"`
+		Enabled           *bool    `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ввод"})
+		return false
+	}
+
+	startDate, err := time.Parse("2006-01-02", request.StartDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите дату начала start_date в формате ГГГГ-ММ-ДД"})
+		return false
+	}
+	template.EndDate = nil
+	if request.EndDate != "" {
+		endDate, err := time.Parse("2006-01-02", request.EndDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректная дата окончания end_date"})
+			return false
+		}
+		template.EndDate = &endDate
+	}
+
+	template.Name = request.Name
+	template.Type = request.Type
+	template.Amount = request.Amount
+	template.Currency = request.Currency
+	template.Description = request.Description
+	template.CategoryID = request.CategoryID
+	template.AccountID = request.AccountID
+	template.TransferAccountID = request.TransferAccountID
+	template.TransferAmount = request.TransferAmount
+	template.GoalID = request.GoalID
+	template.Frequency = request.Frequency
+	template.Interval = request.Interval
+	template.DayOfMonth = request.DayOfMonth
+	template.WorkingDay = request.WorkingDay
+	template.StartDate = startDate
+	template.Enabled = request.Enabled == nil || *request.Enabled
+
+	if template.CategoryID != 0 && !requireOwnership(c, pool, "categories", template.CategoryID) {
+		return false
+	}
+	if template.AccountID != 0 && !requireOwnership(c, pool, "accounts", template.AccountID) {
+		return false
+	}
+	if template.GoalID != nil && !requireOwnership(c, pool, "goals", *template.GoalID) {
+		return false
+	}
+	return true
+}
+
+// recurringError отвечает на ошибку операции с повторяющейся транзакцией; message — для непредвиденных ошибок
+func recurringError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, database.ErrInvalidRecurring),
+		errors.Is(err, recurrence.ErrInvalidSchedule),
+		errors.Is(err, database.ErrInvalidTransfer),
+		errors.Is(err, database.ErrAccountNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrRecurringNotFound),
+		errors.Is(err, database.ErrOccurrenceNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrOccurrenceProcessed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// recurringOccurrenceParams читает ID шаблона и дату повторения из пути; при ошибке сам отвечает 400
+func recurringOccurrenceParams(c *gin.Context) (int, time.Time, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор повторяющейся транзакции"})
+		return 0, time.Time{}, false
+	}
+	date, err := time.Parse("2006-01-02", c.Param("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Дата повторения должна быть в формате ГГГГ-ММ-ДД"})
+		return 0, time.Time{}, false
+	}
+	return id, date, true
+}
+
+// attachmentError отвечает на ошибку загрузки или получения вложения; message — для непредвиденных ошибок
+func attachmentError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, attachments.ErrEmpty),
+		errors.Is(err, attachments.ErrInvalidImage):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, attachments.ErrTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, attachments.ErrUnsupportedType):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrAttachmentNotFound),
+		errors.Is(err, database.ErrAttachmentTarget),
+		errors.Is(err, blobstore.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrTooManyAttachments):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		log.Printf("%s: %v", message, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// serveAttachment отдаёт файл вложения или его миниатюру из хранилища
+func serveAttachment(c *gin.Context, pool *pgxpool.Pool, store blobstore.Store, thumbnail bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор вложения"})
+		return
+	}
+	attachment, err := database.GetAttachment(pool, auth.CurrentUserID(c), id)
+	if err != nil {
+		attachmentError(c, err, "Ошибка получения вложения")
+		return
+	}
+
+	key, contentType, size, fileName := attachment.StorageKey, attachment.ContentType, attachment.Size, attachment.FileName
+	if thumbnail {
+		if attachment.ThumbnailKey == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "У вложения нет миниатюры"})
+			return
+		}
+		key, contentType, size = *attachment.ThumbnailKey, "image/jpeg", -1
+		fileName = strings.TrimSuffix(fileName, filepath.Ext(fileName)) + "-thumbnail.jpg"
+	}
+
+	reader, err := store.Get(c.Request.Context(), key)
+	if err != nil {
+		attachmentError(c, err, "Ошибка чтения вложения")
+		return
+	}
+	defer reader.Close()
+	// Типы вложений проверены при загрузке; nosniff не даёт браузеру счесть файл чем-то другим
+	c.DataFromReader(http.StatusOK, size, contentType, reader, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("inline", map[string]string{"filename": fileName}),
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, max-age=3600",
+	})
+}
+
+// maxImportFileSize — предельный размер загружаемой выписки
+const maxImportFileSize = 10 << 20
+
+// openStatementUpload открывает файл выписки из формы и проверяет категорию для импортируемых операций.
+// При ошибке сам отвечает клиенту; открытый файл закрывает вызывающий.
+func openStatementUpload(c *gin.Context, pool *pgxpool.Pool) (multipart.File, int, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize)
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Приложите файл выписки до %d МБ в поле file", maxImportFileSize>>20)})
+		return nil, 0, false
+	}
+	categoryID, err := strconv.Atoi(c.PostForm("category_id"))
+	if err != nil || categoryID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите категорию для импортируемых операций в поле category_id"})
+		return nil, 0, false
+	}
+	if !requireOwnership(c, pool, "categories", categoryID) {
+		return nil, 0, false
+	}
+
+	opened, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Не удалось прочитать файл"})
+		return nil, 0, false
+	}
+	return opened, categoryID, true
+}
+
+// bindImportAccount читает из формы счёт, на который загружаются операции: account_id, без него — основной счёт.
+// При ошибке сам отвечает клиенту.
+func bindImportAccount(c *gin.Context, pool *pgxpool.Pool) (int, bool) {
+	value := c.PostForm("account_id")
+	if value == "" {
+		return 0, true
+	}
+	accountID, err := strconv.Atoi(value)
+	if err != nil || accountID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор счёта"})
+		return 0, false
+	}
+	if !requireOwnership(c, pool, "accounts", accountID) {
+		return 0, false
+	}
+	return accountID, true
+}
+
+// importStatement загружает операции выписки и отвечает итогами импорта, дополняя response.
+// dry_run=true в форме — посчитать результат без сохранения, account_id — счёт для операций.
+func importStatement(c *gin.Context, pool *pgxpool.Pool, items []database.ExternalTransaction, response gin.H) {
+	userID := auth.CurrentUserID(c)
+	accountID, ok := bindImportAccount(c, pool)
+	if !ok {
+		return
+	}
+	dryRun := c.PostForm("dry_run") == "true"
+	result, err := database.ImportExternalTransactions(pool, userID, accountID, items, dryRun)
+	if err != nil {
+		if transactionInputError(c, err) {
+			return
+		}
+		log.Printf("Ошибка импорта выписки пользователя %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка импорта, ни одна операция не загружена"})
+		return
+	}
+
+	response["created"] = result.Created
+	response["skipped"] = result.Skipped
+	response["possible_duplicates"] = result.PossibleDuplicates
+	response["categorized"] = result.Categorized
+	response["dry_run"] = dryRun
+	status := http.StatusCreated
+	if dryRun {
+		status = http.StatusOK
+	}
+	c.JSON(status, response)
+}
+
+// importBankStatement — обработчик импорта выписки camt.053 или MT940 (multipart): file, category_id, dry_run.
+// Остатки сверяются с суммой проводок; расхождение не мешает импорту, но возвращается в ответе.
+func importBankStatement(pool *pgxpool.Pool, source string, parse func(io.Reader) ([]bankstatement.Statement, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		opened, categoryID, ok := openStatementUpload(c, pool)
+		if !ok {
+			return
+		}
+		defer opened.Close()
+
+		statements, err := parse(opened)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var items []database.ExternalTransaction
+		failures := []bankstatement.EntryError{}
+		accounts := []gin.H{}
+		mismatches := 0
+		for _, statement := range statements {
+			check := statement.CheckBalance()
+			if check != nil && !check.Matches {
+				mismatches++
+			}
+			accounts = append(accounts, gin.H{
+				"account_id":      statement.AccountID,
+				"statement_id":    statement.ID,
+				"currency":        statement.Currency,
+				"opening_balance": statement.Opening,
+				"closing_balance": statement.Closing,
+				"balance_check":   check,
+				"entries":         len(statement.Entries),
+			})
+			failures = append(failures, statement.Errors...)
+			for _, entry := range statement.Entries {
+				items = append(items, database.ExternalTransaction{
+					Source:      source,
+					AccountID:   statement.AccountID,
+					ExternalID:  entry.ID,
+					Transaction: entry.Model(categoryID),
+				})
+			}
+		}
+
+		importStatement(c, pool, items, gin.H{
+			"accounts":           accounts,
+			"balance_mismatches": mismatches,
+			"failed":             len(failures),
+			"errors":             failures,
+		})
+	}
+}
+
+// saveImportMapping проверяет и сохраняет настройки импорта; при ошибке сам отвечает клиенту
+func saveImportMapping(c *gin.Context, pool *pgxpool.Pool, mapping *models.ImportMapping) bool {
+	if err := csvimport.ValidateMapping(mapping); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if mapping.BankName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите название банка"})
+		return false
+	}
+	if mapping.DefaultCategoryID != nil && !requireOwnership(c, pool, "categories", *mapping.DefaultCategoryID) {
+		return false
+	}
+	if err := database.SaveImportMapping(pool, mapping); err != nil {
+		log.Printf("Ошибка сохранения настроек импорта: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сохранения настроек импорта"})
+		return false
+	}
+	return true
+}
+
+// bindCategorizationRule читает правило из запроса, проверяет его и принадлежность категории и цели.
+// При ошибке сам отвечает клиенту.
+func bindCategorizationRule(c *gin.Context, pool *pgxpool.Pool, rule *models.CategorizationRule) bool {
+	var request struct {
+		Name                string   `json:"name"`
+		Enabled             *bool    `json:"enabled"`
+		DescriptionContains string   `json:"description_contains"`
+		DescriptionRegex    string   `json:"description_regex"`
+		MinAmount           *float64 `json:"min_amount"`
+		MaxAmount           *float64 `json:"max_amount"`
+		Type                string   `json:"type"`
+		SetCategoryID       *int     `json:"set_category_id"`
+		SetDescription      string   `json:"set_description"`
+		SetGoalID           *int     `json:"set_goal_id"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ввод"})
+		return false
+	}
+
+	rule.Name = strings.TrimSpace(request.Name)
+	rule.Enabled = request.Enabled == nil || *request.Enabled
+	rule.DescriptionContains = request.DescriptionContains
+	rule.DescriptionRegex = request.DescriptionRegex
+	rule.MinAmount = request.MinAmount
+	rule.MaxAmount = request.MaxAmount
+	rule.Type = request.Type
+	rule.SetCategoryID = request.SetCategoryID
+	rule.SetDescription = request.SetDescription
+	rule.SetGoalID = request.SetGoalID
+	if err := rules.Validate(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if rule.SetCategoryID != nil && !requireOwnership(c, pool, "categories", *rule.SetCategoryID) {
+		return false
+	}
+	if rule.SetGoalID != nil && !requireOwnership(c, pool, "goals", *rule.SetGoalID) {
+		return false
+	}
+	return true
+}
+
+// respondWithAuditEvents отдаёт страницу журнала и курсор для следующей
+func respondWithAuditEvents(c *gin.Context, pool *pgxpool.Pool, filter database.AuditFilter) {
+	events, err := database.GetAuditEvents(pool, filter)
+	if err != nil {
+		log.Printf("Ошибка получения журнала безопасности: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения журнала безопасности"})
+		return
+	}
+	response := gin.H{"events": events}
+	if len(events) > 0 {
+		response["next_before_id"] = events[len(events)-1].ID
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// requireOwnership отвечает 404, если запись таблицы не принадлежит текущему пользователю
+func requireOwnership(c *gin.Context, pool *pgxpool.Pool, table string, recordID int) bool {
+	owned, err := database.IsRecordOwnedBy(pool, table, recordID, auth.CurrentUserID(c))
+	if err != nil {
+		log.Printf("Ошибка проверки владельца записи %s #%d: %v", table, recordID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки прав доступа"})
+		return false
+	}
+	if !owned {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Запись не найдена"})
+		return false
+	}
+	return true
+}
+
+// respondWithSession открывает сессию для пользователя и отвечает токенами; method — способ входа для журнала
+func respondWithSession(c *gin.Context, pool *pgxpool.Pool, user *models.User, method string) {
+	tokens, err := auth.StartSession(pool, user, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		log.Printf("Ошибка создания сессии для пользователя %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка авторизации"})
+		return
+	}
+	recordAuditAs(c, pool, database.AuditLoginSucceeded, user.ID, user.ID, gin.H{
+		"method":     method,
+		"session_id": tokens.SessionID,
+	})
+
+	// Возвращаем is_admin для проверки роли
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Авторизация успешна",
+		"user":     user,
+		"is_admin": user.IsAdmin,
+		"tokens":   tokens,
+	})
+}
+
+// completeLogin завершает вход пользователя: выдаёт сессию или, при включённом втором факторе, запрашивает код
+func completeLogin(c *gin.Context, pool *pgxpool.Pool, user *models.User, method string) {
+	twoFactor, err := database.IsTOTPEnabled(pool, user.ID)
+	if err != nil {
+		log.Printf("Ошибка проверки второго фактора для пользователя %d: %v", user.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка авторизации"})
+		return
+	}
+	if twoFactor {
+		challenge, expiresAt, err := auth.StartLoginChallenge(pool, user.ID)
+		if err != nil {
+			log.Printf("Ошибка создания запроса второго фактора для пользователя %d: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка авторизации"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message":              "Введите код из приложения-аутентификатора",
+			"two_factor_required":  true,
+			"challenge":            challenge,
+			"challenge_expires_at": expiresAt,
+		})
+		return
+	}
+
+	respondWithSession(c, pool, user, method)
+}
+
+// secondFactorError отвечает на ошибку проверки кода второго фактора
+func secondFactorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidSecondFactor):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Неверный код подтверждения"})
+	case errors.Is(err, database.ErrTOTPNotConfigured):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Двухфакторная аутентификация не настроена"})
+	case errors.Is(err, database.ErrTOTPAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": "Двухфакторная аутентификация уже включена"})
+	default:
+		log.Printf("Ошибка проверки второго фактора: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки кода подтверждения"})
+	}
+}
+
 func ScheduleDailyReminderNotifications(pool *pgxpool.Pool) {
 	c := cron.New()
 
@@ -147,22 +976,55 @@ func convertAllDataToNewCurrency(pool *pgxpool.Pool, userID int, oldCurrency str
 		}
 	}
 
-	// Конвертируем и обновляем валюту для всех транзакций
-	transactions, err := database.GetTransactionsByUserID(pool, userID)
+	// Счета в прежней валюте пересчитываются вместе с их операциями; у счетов в других валютах суммы не меняются
+	accounts, err := database.GetAccountsByUserID(pool, userID)
 	if err != nil {
-		log.Printf("Ошибка при получении транзакций для пользователя с ID %d: %v", userID, err)
+		log.Printf("Ошибка при получении счетов для пользователя с ID %d: %v", userID, err)
+		return fmt.Errorf("ошибка при получении счетов для пользователя с ID %d: %v", userID, err)
+	}
+
+	convertedAccounts := make(map[int]bool)
+	for _, account := range accounts {
+		if account.Currency != oldCurrency {
+			continue
+		}
+		if err := database.ConvertAccountCurrency(pool, userID, account.ID, newCurrency, conversionRate); err != nil {
+			log.Printf("Ошибка при обновлении счёта с ID %d: %v", account.ID, err)
+			return fmt.Errorf("ошибка при обновлении счёта с ID %d: %v", account.ID, err)
+		}
+		convertedAccounts[account.ID] = true
+	}
+
+	// Конвертируем и обновляем валюту для всех транзакций
+	transactions, err := database.GetTransactionsByUserID(pool, userID)
+	if err != nil {
+		log.Printf("Ошибка при получении транзакций для пользователя с ID %d: %v", userID, err)
 		return fmt.Errorf("ошибка при получении транзакций для пользователя с ID %d: %v", userID, err)
 	}
 
 	for _, transaction := range transactions {
-		if transaction.Currency != newCurrency {
+		if transaction.Currency == newCurrency {
+			continue
+		}
+		// У перевода сумма зачисления пересчитывается, только если пересчитан счёт зачисления
+		source := convertedAccounts[transaction.AccountID]
+		target := transaction.TransferAccountID != nil && transaction.TransferAmount != nil && convertedAccounts[*transaction.TransferAccountID]
+		if !source && !target {
+			continue
+		}
+		if source {
 			convertedAmount := transaction.Amount * conversionRate
 			transaction.Amount = convertedAmount
+			transaction.ScaleSplits(conversionRate)
 			transaction.Currency = newCurrency
-			if err := database.UpdateTransaction(pool, &transaction); err != nil {
-				log.Printf("Ошибка при обновлении транзакции с ID %d: %v", transaction.ID, err)
-				return fmt.Errorf("ошибка при обновлении транзакции с ID %d: %v", transaction.ID, err)
-			}
+		}
+		if target {
+			convertedTransfer := *transaction.TransferAmount * conversionRate
+			transaction.TransferAmount = &convertedTransfer
+		}
+		if err := database.UpdateTransaction(pool, &transaction); err != nil {
+			log.Printf("Ошибка при обновлении транзакции с ID %d: %v", transaction.ID, err)
+			return fmt.Errorf("ошибка при обновлении транзакции с ID %d: %v", transaction.ID, err)
 		}
 	}
 
@@ -197,6 +1059,21 @@ func main() {
 	}
 	defer pool.Close()
 
+	mailer := mail.NewSenderFromEnv()
+
+	// Вложения транзакций хранятся в локальном каталоге или в S3-совместимом хранилище
+	blobs, err := blobstore.NewStoreFromEnv()
+	if err != nil {
+		log.Fatalf("Ошибка настройки хранилища файлов: %v", err)
+	}
+
+	// Вход через SSO включается, только если провайдер задан в окружении
+	var oidcProvider *oidc.Provider
+	if config, ok := oidc.ConfigFromEnv(); ok {
+		oidcProvider = oidc.NewProvider(config, nil)
+		log.Printf("Вход через OIDC включён, провайдер %s", config.Issuer)
+	}
+
 	r := gin.Default()
 	r.Use(CORSMiddleware())
 
@@ -215,261 +1092,1500 @@ func main() {
 	ScheduleBudgetRenewal(pool)
 	ScheduleTransactionArchival(pool)
 	ScheduleDailyReminderNotifications(pool)
+	ScheduleLoginUnlocks(pool)
+	ScheduleDataExports(pool, blobs)
+	ScheduleAccountDeletions(pool)
+	ScheduleRecurringTransactions(pool)
+	ScheduleAttachmentCleanup(pool, blobs)
 
 	r.POST("/register", func(c *gin.Context) {
-		var user models.User
+		// Пароль в models.User скрыт от JSON, поэтому принимаем данные отдельной структурой
+		var request struct {
+			Name     string `json:"name"`
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}
 
-		if err := c.ShouldBindJSON(&user); err != nil {
+		if err := c.ShouldBindJSON(&request); err != nil {
 			log.Printf("Ошибка привязки JSON: %v\n", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат данных. Проверьте введённые значения."})
 			return
 		}
+		user := models.User{Name: request.Name, Email: request.Email, Password: request.Password}
 
-		log.Printf("Полученные данные для регистрации: %+v\n", user)
+		log.Printf("Полученные данные для регистрации: name=%s, email=%s\n", user.Name, user.Email)
 
 		if err := database.RegisterUser(pool, &user); err != nil {
 			log.Printf("Ошибка при регистрации пользователя: %v\n", err)
+			if userDataError(c, err) {
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Ошибка регистрации: %v", err)})
 			return
 		}
 
 		log.Printf("Пользователь успешно зарегистрирован: ID = %d\n", user.ID)
-		c.JSON(http.StatusOK, gin.H{"message": "Пользователь успешно зарегистрирован", "user_id": user.ID})
+		recordAuditAs(c, pool, database.AuditRegistered, user.ID, user.ID, nil)
+
+		// Регистрация уже состоялась, поэтому сбой отправки не ломает ответ: письмо можно запросить повторно
+		if err := auth.SendEmailVerification(pool, mailer, &user); err != nil {
+			log.Printf("Ошибка отправки письма подтверждения пользователю %d: %v\n", user.ID, err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Пользователь успешно зарегистрирован. Подтвердите email по ссылке из письма",
+			"user_id": user.ID,
+		})
+	})
+
+	r.POST("/email/verify", func(c *gin.Context) {
+		var request struct {
+			Token string `json:"token"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil || request.Token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Не передан токен подтверждения"})
+			return
+		}
+
+		userID, err := auth.VerifyEmail(pool, request.Token)
+		if err != nil {
+			if errors.Is(err, database.ErrUserTokenInvalid) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Ссылка недействительна или устарела"})
+				return
+			}
+			log.Printf("Ошибка подтверждения email: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка подтверждения email"})
+			return
+		}
+		recordAuditAs(c, pool, database.AuditEmailVerified, userID, userID, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "Email подтверждён"})
+	})
+
+	r.POST("/password/forgot", func(c *gin.Context) {
+		var request struct {
+			Email string `json:"email"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil || request.Email == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите email"})
+			return
+		}
+
+		// Ответ одинаковый независимо от того, есть ли такой аккаунт
+		userID, err := auth.RequestPasswordReset(pool, mailer, request.Email)
+		if err != nil {
+			log.Printf("Ошибка запроса сброса пароля: %v", err)
+		}
+		if userID > 0 {
+			recordAuditAs(c, pool, database.AuditPasswordResetRequested, userID, 0, nil)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Если аккаунт с таким email существует, мы отправили на него ссылку для сброса пароля"})
+	})
+
+	r.POST("/password/reset", func(c *gin.Context) {
+		var request struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil || request.Token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка ввода данных"})
+			return
+		}
+
+		userID, err := auth.ResetPassword(pool, request.Token, request.Password)
+		if err != nil {
+			if userDataError(c, err) {
+				return
+			}
+			switch {
+			case errors.Is(err, database.ErrUserTokenInvalid):
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Ссылка недействительна или устарела"})
+			case errors.Is(err, auth.ErrEmptyPassword):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			default:
+				log.Printf("Ошибка сброса пароля: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сброса пароля"})
+			}
+			return
+		}
+
+		log.Printf("Пароль пользователя %d сброшен по ссылке из письма", userID)
+		recordAuditAs(c, pool, database.AuditPasswordReset, userID, userID, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "Пароль изменён, войдите с новым паролем"})
 	})
 
 	r.POST("/login", func(c *gin.Context) {
-		var credentials models.User
+		var credentials struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}
 		if err := c.ShouldBindJSON(&credentials); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка ввода данных"})
 			return
 		}
 
+		// Пока действует задержка, пароль даже не проверяем
+		retryAfter, err := auth.LoginRetryAfter(pool, credentials.Email, c.ClientIP())
+		if err != nil {
+			log.Printf("Ошибка проверки блокировки входа: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка авторизации"})
+			return
+		}
+		if retryAfter > 0 {
+			seconds := int(retryAfter.Seconds()) + 1
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       "Слишком много попыток входа. Повторите позже",
+				"retry_after": seconds,
+			})
+			return
+		}
+
 		user, err := database.AuthenticateUser(pool, credentials.Email, credentials.Password)
 		if err != nil {
+			if !errors.Is(err, database.ErrInvalidCredentials) {
+				log.Printf("Ошибка аутентификации: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка авторизации"})
+				return
+			}
+			locked, err := auth.RegisterLoginFailure(pool, credentials.Email, c.ClientIP())
+			if err != nil {
+				log.Printf("Ошибка учёта неудачного входа: %v", err)
+			}
+			// Попытку входа в существующий аккаунт пишем в журнал его владельца
+			targetID := 0
+			if target, err := database.GetUserByEmail(pool, credentials.Email); err == nil {
+				targetID = target.ID
+			}
+			email := auth.NormalizeEmail(credentials.Email)
+			recordAuditAs(c, pool, database.AuditLoginFailed, targetID, 0, gin.H{
+				"email":  email,
+				"reason": "invalid_credentials",
+			})
+			if locked {
+				recordAuditAs(c, pool, database.AuditLoginLocked, targetID, 0, gin.H{"email": email})
+			}
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Ошибка авторизации: неверный email или пароль"})
 			return
 		}
 
+		if err := auth.RegisterLoginSuccess(pool, credentials.Email); err != nil {
+			log.Printf("Ошибка сброса счётчика неудачных входов: %v", err)
+		}
+
 		user.Password = "" // Убираем пароль из ответа для безопасности
+		completeLogin(c, pool, user, "password")
+	})
+
+	r.GET("/oidc/login", func(c *gin.Context) {
+		if oidcProvider == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Вход через SSO не настроен"})
+			return
+		}
+
+		authorizationURL, err := auth.BeginOIDCLogin(pool, oidcProvider)
+		if err != nil {
+			log.Printf("Ошибка начала входа через OIDC: %v", err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Провайдер входа недоступен"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"authorization_url": authorizationURL})
+	})
+
+	r.POST("/oidc/callback", func(c *gin.Context) {
+		if oidcProvider == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Вход через SSO не настроен"})
+			return
+		}
+
+		var request struct {
+			Code  string `json:"code"`
+			State string `json:"state"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil || request.Code == "" || request.State == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка ввода данных"})
+			return
+		}
+
+		user, err := auth.CompleteOIDCLogin(pool, oidcProvider, request.Code, request.State, time.Now())
+		if err != nil {
+			switch {
+			case errors.Is(err, database.ErrOIDCStateInvalid):
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Запрос на вход истёк, начните вход заново"})
+			case errors.Is(err, auth.ErrOIDCEmailNotVerified):
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			case errors.Is(err, oidc.ErrInvalidIDToken):
+				log.Printf("Отклонён ID-токен провайдера: %v", err)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Ошибка входа через SSO"})
+			default:
+				log.Printf("Ошибка входа через OIDC: %v", err)
+				c.JSON(http.StatusBadGateway, gin.H{"error": "Ошибка входа через SSO"})
+			}
+			return
+		}
+
+		completeLogin(c, pool, user, "oidc")
+	})
+
+	r.POST("/login/2fa", func(c *gin.Context) {
+		var request struct {
+			Challenge    string `json:"challenge"`
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil || request.Challenge == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка ввода данных"})
+			return
+		}
+
+		userID, err := auth.CompleteLoginChallenge(pool, request.Challenge, request.Code, request.RecoveryCode, time.Now())
+		if err != nil {
+			if errors.Is(err, database.ErrLoginChallengeGone) || errors.Is(err, database.ErrLoginChallengeLimit) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Запрос на вход истёк, выполните вход заново"})
+				return
+			}
+			if errors.Is(err, auth.ErrInvalidSecondFactor) {
+				recordAuditAs(c, pool, database.AuditLoginFailed, userID, 0, gin.H{"reason": "invalid_second_factor"})
+			}
+			secondFactorError(c, err)
+			return
+		}
+
+		user, err := database.GetUserByID(pool, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка авторизации"})
+			return
+		}
+		method := "totp"
+		if request.RecoveryCode != "" {
+			method = "recovery_code"
+		}
+		respondWithSession(c, pool, user, method)
+	})
 
-		// Возвращаем is_admin для проверки роли
+	r.POST("/token/refresh", func(c *gin.Context) {
+		var request struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil || request.RefreshToken == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Не передан refresh-токен"})
+			return
+		}
+
+		tokens, err := auth.RefreshSession(pool, request.RefreshToken, c.ClientIP())
+		if err != nil {
+			if errors.Is(err, database.ErrRefreshTokenReused) {
+				log.Printf("Повторное использование refresh-токена с IP %s, сессия завершена", c.ClientIP())
+			} else if !errors.Is(err, database.ErrSessionNotFound) {
+				log.Printf("Ошибка обновления токенов: %v", err)
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Сессия недействительна, выполните вход заново"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+	})
+
+	// Остальные маршруты доступны только с действующим токеном доступа
+	api := r.Group("/")
+	api.Use(auth.Middleware(pool))
+
+	// Управление аккаунтом доступно только из интерактивной сессии, но не по персональному токену
+	account := api.Group("/")
+	account.Use(auth.RequireSession())
+
+	account.POST("/logout", func(c *gin.Context) {
+		if err := database.RevokeSession(pool, auth.CurrentSessionID(c), auth.CurrentUserID(c)); err != nil {
+			log.Printf("Ошибка завершения сессии: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при выходе"})
+			return
+		}
+		recordAudit(c, pool, database.AuditLogout, auth.CurrentUserID(c), gin.H{"session_id": auth.CurrentSessionID(c)})
+		c.JSON(http.StatusOK, gin.H{"message": "Выход выполнен"})
+	})
+
+	account.GET("/sessions", func(c *gin.Context) {
+		sessions, err := database.GetSessionsByUserID(pool, auth.CurrentUserID(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения списка сессий"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"sessions":           sessions,
+			"current_session_id": auth.CurrentSessionID(c),
+		})
+	})
+
+	account.DELETE("/sessions/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор сессии"})
+			return
+		}
+		if err := database.RevokeSession(pool, id, auth.CurrentUserID(c)); err != nil {
+			if errors.Is(err, database.ErrSessionNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Сессия не найдена"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка завершения сессии"})
+			return
+		}
+		recordAudit(c, pool, database.AuditSessionRevoked, auth.CurrentUserID(c), gin.H{"session_id": id})
+		c.JSON(http.StatusOK, gin.H{"message": "Сессия завершена"})
+	})
+
+	account.GET("/2fa", func(c *gin.Context) {
+		userID := auth.CurrentUserID(c)
+		enabled, err := database.IsTOTPEnabled(pool, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения настроек двухфакторной аутентификации"})
+			return
+		}
+		remaining := 0
+		if enabled {
+			if remaining, err = database.CountUnusedRecoveryCodes(pool, userID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения настроек двухфакторной аутентификации"})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"enabled": enabled, "recovery_codes_left": remaining})
+	})
+
+	account.POST("/2fa/enroll", func(c *gin.Context) {
+		secret, uri, err := auth.BeginTOTPEnrollment(pool, auth.CurrentUser(c))
+		if err != nil {
+			secondFactorError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"secret":           secret,
+			"provisioning_uri": uri,
+			"message":          "Добавьте ключ в приложение-аутентификатор и подтвердите его кодом",
+		})
+	})
+
+	account.POST("/2fa/confirm", func(c *gin.Context) {
+		var request struct {
+			Code string `json:"code"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка ввода данных"})
+			return
+		}
+
+		codes, err := auth.ConfirmTOTPEnrollment(pool, auth.CurrentUserID(c), request.Code, time.Now())
+		if err != nil {
+			secondFactorError(c, err)
+			return
+		}
+		recordAudit(c, pool, database.AuditTwoFactorEnabled, auth.CurrentUserID(c), nil)
 		c.JSON(http.StatusOK, gin.H{
-			"message":  "Авторизация успешна",
-			"user":     user,
-			"is_admin": user.IsAdmin,
+			"message":        "Двухфакторная аутентификация включена. Сохраните коды восстановления",
+			"recovery_codes": codes,
+		})
+	})
+
+	account.POST("/2fa/disable", func(c *gin.Context) {
+		var request struct {
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка ввода данных"})
+			return
+		}
+
+		userID := auth.CurrentUserID(c)
+		if err := auth.VerifySecondFactor(pool, userID, request.Code, request.RecoveryCode, time.Now()); err != nil {
+			secondFactorError(c, err)
+			return
+		}
+		if err := database.DisableTOTP(pool, userID); err != nil {
+			log.Printf("Ошибка отключения второго фактора для пользователя %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка отключения двухфакторной аутентификации"})
+			return
+		}
+		recordAudit(c, pool, database.AuditTwoFactorDisabled, userID, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "Двухфакторная аутентификация отключена"})
+	})
+
+	account.POST("/2fa/recovery_codes", func(c *gin.Context) {
+		var request struct {
+			Code string `json:"code"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка ввода данных"})
+			return
+		}
+
+		userID := auth.CurrentUserID(c)
+		if err := auth.VerifySecondFactor(pool, userID, request.Code, "", time.Now()); err != nil {
+			secondFactorError(c, err)
+			return
+		}
+		codes, err := auth.RegenerateRecoveryCodes(pool, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания кодов восстановления"})
+			return
+		}
+		recordAudit(c, pool, database.AuditRecoveryCodesRegenerated, userID, nil)
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	})
+
+	// Собственный журнал: события об аккаунте пользователя, включая действия администраторов над ним
+	account.GET("/audit/events", func(c *gin.Context) {
+		var filter database.AuditFilter
+		if !bindAuditFilter(c, &filter) {
+			return
+		}
+		filter.UserID = auth.CurrentUserID(c)
+		filter.ActorID = 0
+		respondWithAuditEvents(c, pool, filter)
+	})
+
+	account.POST("/email/verify/resend", func(c *gin.Context) {
+		user := auth.CurrentUser(c)
+		if user.EmailVerified {
+			c.JSON(http.StatusOK, gin.H{"message": "Email уже подтверждён"})
+			return
+		}
+		if err := auth.SendEmailVerification(pool, mailer, user); err != nil {
+			log.Printf("Ошибка отправки письма подтверждения пользователю %d: %v", user.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Не удалось отправить письмо"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Письмо для подтверждения отправлено"})
+	})
+
+	account.GET("/api_tokens", func(c *gin.Context) {
+		tokens, err := database.GetAPITokensByUserID(pool, auth.CurrentUserID(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения списка токенов"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tokens": tokens, "available_scopes": auth.AvailableScopes()})
+	})
+
+	account.POST("/api_tokens", func(c *gin.Context) {
+		var request struct {
+			Name          string   `json:"name"`
+			Scopes        []string `json:"scopes"`
+			ExpiresInDays int      `json:"expires_in_days"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil || request.ExpiresInDays < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Ошибка ввода данных"})
+			return
+		}
+
+		expiresIn := time.Duration(request.ExpiresInDays) * 24 * time.Hour
+		token, apiToken, err := auth.CreateAPIToken(pool, auth.CurrentUserID(c), request.Name, request.Scopes, expiresIn)
+		if err != nil {
+			if errors.Is(err, auth.ErrEmptyTokenName) || errors.Is(err, auth.ErrNoScopes) || errors.Is(err, auth.ErrUnknownScope) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("Ошибка создания персонального токена: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания токена"})
+			return
+		}
+		recordAudit(c, pool, database.AuditAPITokenCreated, apiToken.UserID, gin.H{
+			"token_id": apiToken.ID,
+			"name":     apiToken.Name,
+			"scopes":   apiToken.Scopes,
 		})
+		c.JSON(http.StatusCreated, gin.H{
+			"message":   "Токен создан. Сохраните его: повторно он показан не будет",
+			"token":     token,
+			"api_token": apiToken,
+		})
+	})
+
+	account.DELETE("/api_tokens/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор токена"})
+			return
+		}
+		if err := database.RevokeAPIToken(pool, id, auth.CurrentUserID(c)); err != nil {
+			if errors.Is(err, database.ErrAPITokenNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Токен не найден"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка отзыва токена"})
+			return
+		}
+		recordAudit(c, pool, database.AuditAPITokenRevoked, auth.CurrentUserID(c), gin.H{"token_id": id})
+		c.JSON(http.StatusOK, gin.H{"message": "Токен отозван"})
 	})
 
-	r.POST("/categories", func(c *gin.Context) {
+	// Работа с финансовыми данными доступна только после подтверждения email
+	verified := api.Group("/")
+	verified.Use(auth.RequireVerifiedEmail())
+
+	// Персональному токену доступны только те группы маршрутов, на которые ему выданы права
+	categoryRoutes := verified.Group("/", auth.RequireScope("categories"))
+	budgetRoutes := verified.Group("/", auth.RequireScope("budgets"))
+	transactionRoutes := verified.Group("/", auth.RequireScope("transactions"))
+	dashboardRoutes := verified.Group("/", auth.RequireScope("dashboard"))
+	notificationRoutes := verified.Group("/", auth.RequireScope("notifications"))
+	reminderRoutes := verified.Group("/", auth.RequireScope("reminders"))
+	settingsRoutes := verified.Group("/", auth.RequireScope("settings"))
+	goalRoutes := verified.Group("/", auth.RequireScope("goals"))
+	accountRoutes := verified.Group("/", auth.RequireScope("accounts"))
+	// Пользователи, администрирование и семейные счета — только из сессии
+	sessionRoutes := verified.Group("/", auth.RequireSession())
+
+	categoryRoutes.POST("/categories", func(c *gin.Context) {
 		var category models.Category
 		if err := c.ShouldBindJSON(&category); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат категории"})
 			return
 		}
-		if err := database.CreateCategory(pool, &category); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при создании категории"})
-			return
+		category.UserID = auth.CurrentUserID(c)
+		if err := database.CreateCategory(pool, &category); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при создании категории"})
+			return
+		}
+		c.JSON(http.StatusCreated, category)
+	})
+
+	categoryRoutes.GET("/categories", func(c *gin.Context) {
+		categories, err := database.GetCategoriesByUserID(pool, auth.CurrentUserID(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении списка категорий"})
+			return
+		}
+		c.JSON(http.StatusOK, categories)
+	})
+
+	categoryRoutes.PUT("/categories/:id", func(c *gin.Context) {
+		var category models.Category
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор категории"})
+			return
+		}
+		if !requireOwnership(c, pool, "categories", id) {
+			return
+		}
+		if err := c.ShouldBindJSON(&category); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат данных для категории"})
+			return
+		}
+		category.ID = id
+		if err := database.UpdateCategory(pool, &category); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления категории"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Категория успешно обновлена"})
+	})
+
+	categoryRoutes.DELETE("/categories/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор категории"})
+			return
+		}
+		if !requireOwnership(c, pool, "categories", id) {
+			return
+		}
+		if err := database.DeleteCategory(pool, id); err != nil {
+			log.Printf("Ошибка удаления категории с ID %d: %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при удалении категории", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Категория успешно удалена"})
+	})
+
+	budgetRoutes.POST("/budgets", func(c *gin.Context) {
+		var budget models.Budget
+		if err := c.ShouldBindJSON(&budget); err != nil {
+			log.Printf("Ошибка привязки JSON: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ввод данных"})
+			return
+		}
+		budget.UserID = auth.CurrentUserID(c)
+		log.Printf("Полученные данные для создания бюджета: %+v", budget)
+
+		if err := database.CreateBudget(pool, &budget); err != nil {
+			log.Printf("Ошибка при создании бюджета: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при создании бюджета"})
+			return
+		}
+		c.JSON(http.StatusCreated, budget)
+	})
+
+	budgetRoutes.GET("/budgets", func(c *gin.Context) {
+		budgets, err := database.GetBudgetsByUserID(pool, auth.CurrentUserID(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении списка бюджетов"})
+			return
+		}
+		c.JSON(http.StatusOK, budgets)
+	})
+
+	budgetRoutes.PUT("/budgets/:id", func(c *gin.Context) {
+		var budget models.Budget
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			log.Printf("Некорректный идентификатор бюджета: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор бюджета"})
+			return
+		}
+		if !requireOwnership(c, pool, "budgets", id) {
+			return
+		}
+
+		if err := c.ShouldBindJSON(&budget); err != nil {
+			log.Printf("Ошибка привязки JSON: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ввод данных"})
+			return
+		}
+
+		budget.ID = id
+		log.Printf("Обновляем бюджет с данными: %+v", budget)
+
+		if err := database.UpdateBudget(pool, &budget); err != nil {
+			log.Printf("Ошибка обновления бюджета: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при обновлении бюджета"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Бюджет успешно обновлён"})
+	})
+
+	budgetRoutes.DELETE("/budgets/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор бюджета"})
+			return
+		}
+		if !requireOwnership(c, pool, "budgets", id) {
+			return
+		}
+		if err := database.DeleteBudget(pool, id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при удалении бюджета"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Бюджет успешно удалён"})
+	})
+
+	transactionRoutes.POST("/transactions", func(c *gin.Context) {
+		var transaction models.Transaction
+		log.Printf("Необработанные данные транзакции: %v", c.Request.Body)
+
+		// Привязка JSON данных к структуре
+		if err := c.ShouldBindJSON(&transaction); err != nil {
+			log.Printf("Ошибка привязки JSON: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ввод", "details": err.Error()})
+			return
+		}
+
+		transaction.UserID = auth.CurrentUserID(c)
+		log.Printf("Полученные данные для создания транзакции: %+v", transaction)
+
+		// Создание транзакции в базе данных; без category_id категорию подбирают правила автокатегоризации.
+		// Владельца цели проверяет и цель пополняет CreateTransaction — в том числе цель, заданную правилом
+		if err := database.CreateTransaction(pool, &transaction); err != nil {
+			if transactionInputError(c, err) {
+				return
+			}
+			log.Printf("Ошибка при создании транзакции: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания транзакции"})
+			return
+		}
+		// Расход списывается из бюджетов своих категорий, разделённый — по частям; транзакция уже сохранена
+		if err := database.DeductTransactionFromBudgets(pool, transaction); err != nil {
+			log.Printf("Ошибка при списании транзакции %d из бюджетов: %v", transaction.ID, err)
+		}
+
+		c.JSON(http.StatusCreated, transaction)
+	})
+
+	// Список постраничный: следующую страницу запрашивают с cursor=next_cursor и теми же фильтрами
+	transactionRoutes.GET("/transactions", func(c *gin.Context) {
+		var filter database.TransactionFilter
+		if !bindTransactionFilter(c, &filter) {
+			return
+		}
+		filter.UserID = auth.CurrentUserID(c)
+
+		page, err := database.GetAllTransactions(pool, filter)
+		if err != nil {
+			if errors.Is(err, database.ErrInvalidCursor) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("Ошибка получения транзакций: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения транзакций"})
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	})
+
+	// Поиск по описаниям текущих и архивных транзакций; принимает те же фильтры, что и список
+	transactionRoutes.GET("/transactions/search", func(c *gin.Context) {
+		var filter database.TransactionFilter
+		if !bindTransactionFilter(c, &filter) {
+			return
+		}
+		filter.UserID = auth.CurrentUserID(c)
+
+		offset := 0
+		if value := c.Query("offset"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректное значение параметра offset"})
+				return
+			}
+			offset = parsed
+		}
+
+		page, err := database.SearchTransactions(pool, c.Query("q"), filter, offset)
+		if err != nil {
+			if errors.Is(err, database.ErrEmptySearchQuery) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите поисковый запрос в параметре q"})
+				return
+			}
+			log.Printf("Ошибка поиска транзакций: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка поиска транзакций"})
+			return
+		}
+		c.JSON(http.StatusOK, page)
+	})
+
+	// Подсказка категории по истории пользователя: ?description=&amount=&type=&limit=
+	transactionRoutes.GET("/transactions/suggestions", func(c *gin.Context) {
+		transaction := models.Transaction{Description: c.Query("description"), Type: c.Query("type")}
+		if value := c.Query("amount"); value != "" {
+			amount, err := strconv.ParseFloat(value, 64)
+			if err != nil || amount < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректное значение параметра amount"})
+				return
+			}
+			transaction.Amount = amount
+		}
+		if strings.TrimSpace(transaction.Description) == "" && transaction.Amount == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите описание или сумму транзакции"})
+			return
+		}
+		limit := database.DefaultSuggestionCount
+		if value := c.Query("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 || parsed > 20 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Параметр limit должен быть от 1 до 20"})
+				return
+			}
+			limit = parsed
+		}
+
+		suggestions, err := database.SuggestCategories(pool, auth.CurrentUserID(c), transaction, limit)
+		if err != nil {
+			log.Printf("Ошибка подсказки категорий: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка подсказки категорий"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+	})
+
+	// Очередь вероятных дубликатов: ?status=pending (по умолчанию) или kept
+	transactionRoutes.GET("/transactions/duplicates", func(c *gin.Context) {
+		status := c.DefaultQuery("status", database.DuplicatePending)
+		if status != database.DuplicatePending && status != database.DuplicateKept {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Статус должен быть pending или kept"})
+			return
+		}
+		items, err := database.GetTransactionDuplicates(pool, auth.CurrentUserID(c), status)
+		if err != nil {
+			log.Printf("Ошибка получения очереди дубликатов: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения очереди дубликатов"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"duplicates": items})
+	})
+
+	// Объединение пары: по умолчанию остаётся существовавшая транзакция, {"keep": "new"} — добавленная позже
+	transactionRoutes.POST("/transactions/duplicates/:id/merge", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор записи"})
+			return
+		}
+		var request struct {
+			Keep string `json:"keep"`
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ввод"})
+				return
+			}
+		}
+		if request.Keep != "" && request.Keep != "new" && request.Keep != "existing" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Поле keep должно быть new или existing"})
+			return
+		}
+
+		transactionID, err := database.MergeTransactionDuplicate(pool, auth.CurrentUserID(c), id, request.Keep == "new")
+		if err != nil {
+			if errors.Is(err, database.ErrDuplicateNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("Ошибка объединения дубликатов: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка объединения транзакций"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Транзакции объединены", "transaction_id": transactionID})
+	})
+
+	// Обе транзакции настоящие: пара убирается из очереди и больше не предлагается
+	transactionRoutes.POST("/transactions/duplicates/:id/keep", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор записи"})
+			return
+		}
+		if err := database.KeepTransactionDuplicate(pool, auth.CurrentUserID(c), id); err != nil {
+			if errors.Is(err, database.ErrDuplicateNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("Ошибка обработки дубликата: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обработки дубликата"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Обе транзакции сохранены"})
+	})
+
+	// Правила автокатегоризации применяются по порядку при создании и импорте транзакций
+	transactionRoutes.GET("/rules", func(c *gin.Context) {
+		list, err := database.GetCategorizationRules(pool, auth.CurrentUserID(c))
+		if err != nil {
+			log.Printf("Ошибка получения правил: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения правил"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"rules": list})
+	})
+
+	transactionRoutes.POST("/rules", func(c *gin.Context) {
+		rule := models.CategorizationRule{UserID: auth.CurrentUserID(c)}
+		if !bindCategorizationRule(c, pool, &rule) {
+			return
+		}
+		if err := database.CreateCategorizationRule(pool, &rule); err != nil {
+			log.Printf("Ошибка создания правила: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания правила"})
+			return
+		}
+		c.JSON(http.StatusCreated, rule)
+	})
+
+	// Новый порядок применения: {"rule_ids": [...]} — все правила пользователя
+	transactionRoutes.PUT("/rules/order", func(c *gin.Context) {
+		var request struct {
+			RuleIDs []int `json:"rule_ids" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ввод"})
+			return
+		}
+		if err := database.ReorderCategorizationRules(pool, auth.CurrentUserID(c), request.RuleIDs); err != nil {
+			if errors.Is(err, database.ErrInvalidRuleOrder) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("Ошибка изменения порядка правил: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка изменения порядка правил"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Порядок правил сохранён"})
+	})
+
+	transactionRoutes.PUT("/rules/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор правила"})
+			return
+		}
+		rule := models.CategorizationRule{ID: id, UserID: auth.CurrentUserID(c)}
+		if !bindCategorizationRule(c, pool, &rule) {
+			return
+		}
+		if err := database.UpdateCategorizationRule(pool, &rule); err != nil {
+			if errors.Is(err, database.ErrRuleNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("Ошибка обновления правила: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления правила"})
+			return
+		}
+		c.JSON(http.StatusOK, rule)
+	})
+
+	transactionRoutes.DELETE("/rules/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор правила"})
+			return
+		}
+		if err := database.DeleteCategorizationRule(pool, auth.CurrentUserID(c), id); err != nil {
+			if errors.Is(err, database.ErrRuleNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			log.Printf("Ошибка удаления правила: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления правила"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Правило удалено"})
+	})
+
+	// Повторный прогон правил по текущим транзакциям; принимает фильтры списка транзакций.
+	// GET /rules/preview показывает, какие транзакции изменятся, POST /rules/run применяет изменения.
+	runRules := func(dryRun bool) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			var filter database.TransactionFilter
+			if !bindTransactionFilter(c, &filter) {
+				return
+			}
+			filter.UserID = auth.CurrentUserID(c)
+
+			changes, err := database.RunCategorizationRules(pool, filter, dryRun)
+			if err != nil {
+				// Правило ссылается на цель, которой у пользователя больше нет
+				if errors.Is(err, database.ErrGoalNotFound) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+					return
+				}
+				log.Printf("Ошибка применения правил: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка применения правил"})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"changes": changes, "count": len(changes), "dry_run": dryRun})
+		}
+	}
+	transactionRoutes.GET("/rules/preview", runRules(true))
+	transactionRoutes.POST("/rules/run", runRules(false))
+
+	// Теги транзакций. Новые теги создаются и при сохранении транзакции с полем tags,
+	// список транзакций фильтруется по ним параметром tag_id
+	transactionRoutes.GET("/tags", func(c *gin.Context) {
+		tags, err := database.GetTags(pool, auth.CurrentUserID(c))
+		if err != nil {
+			tagError(c, err, "Ошибка получения тегов")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tags": tags})
+	})
+
+	transactionRoutes.POST("/tags", func(c *gin.Context) {
+		var request struct {
+			Name string `json:"name"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ввод"})
+			return
+		}
+		tag := models.Tag{UserID: auth.CurrentUserID(c), Name: request.Name}
+		if err := database.CreateTag(pool, &tag); err != nil {
+			tagError(c, err, "Ошибка создания тега")
+			return
+		}
+		c.JSON(http.StatusCreated, tag)
+	})
+
+	transactionRoutes.PUT("/tags/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор тега"})
+			return
+		}
+		var request struct {
+			Name string `json:"name"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ввод"})
+			return
+		}
+		tag := models.Tag{ID: id, UserID: auth.CurrentUserID(c), Name: request.Name}
+		if err := database.UpdateTag(pool, &tag); err != nil {
+			tagError(c, err, "Ошибка обновления тега")
+			return
+		}
+		c.JSON(http.StatusOK, tag)
+	})
+
+	transactionRoutes.DELETE("/tags/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор тега"})
+			return
+		}
+		if err := database.DeleteTag(pool, auth.CurrentUserID(c), id); err != nil {
+			tagError(c, err, "Ошибка удаления тега")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Тег удалён"})
+	})
+
+	// Повторяющиеся транзакции: шаблоны, по которым планировщик создаёт транзакции по расписанию
+	transactionRoutes.GET("/recurring", func(c *gin.Context) {
+		list, err := database.GetRecurringTransactions(pool, auth.CurrentUserID(c))
+		if err != nil {
+			log.Printf("Ошибка получения повторяющихся транзакций: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения повторяющихся транзакций"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"recurring": list})
+	})
+
+	transactionRoutes.POST("/recurring", func(c *gin.Context) {
+		template := models.RecurringTransaction{UserID: auth.CurrentUserID(c)}
+		if !bindRecurringTransaction(c, pool, &template) {
+			return
+		}
+		if err := database.CreateRecurringTransaction(pool, &template); err != nil {
+			recurringError(c, err, "Ошибка создания повторяющейся транзакции")
+			return
+		}
+		c.JSON(http.StatusCreated, template)
+	})
+
+	transactionRoutes.PUT("/recurring/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор повторяющейся транзакции"})
+			return
+		}
+		template := models.RecurringTransaction{ID: id, UserID: auth.CurrentUserID(c)}
+		if !bindRecurringTransaction(c, pool, &template) {
+			return
+		}
+		if err := database.UpdateRecurringTransaction(pool, &template); err != nil {
+			recurringError(c, err, "Ошибка обновления повторяющейся транзакции")
+			return
+		}
+		c.JSON(http.StatusOK, template)
+	})
+
+	transactionRoutes.DELETE("/recurring/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор повторяющейся транзакции"})
+			return
+		}
+		if err := database.DeleteRecurringTransaction(pool, auth.CurrentUserID(c), id); err != nil {
+			recurringError(c, err, "Ошибка удаления повторяющейся транзакции")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Повторяющаяся транзакция удалена, созданные по ней транзакции сохранены"})
+	})
+
+	// Повторения шаблона за период from–to, по умолчанию — на три месяца вперёд
+	transactionRoutes.GET("/recurring/:id/occurrences", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор повторяющейся транзакции"})
+			return
+		}
+		from := time.Now()
+		to := from.AddDate(0, 3, 0)
+		if !bindPeriod(c, &from, &to) {
+			return
+		}
+		// bindPeriod делает границу to исключающей, а повторения выбираются по дням включительно
+		if c.Query("to") != "" {
+			to = to.AddDate(0, 0, -1)
+		}
+		list, err := database.GetRecurringOccurrences(pool, auth.CurrentUserID(c), id, from, to, 100)
+		if err != nil {
+			recurringError(c, err, "Ошибка получения повторений")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"occurrences": list})
+	})
+
+	// Пропуск одного повторения ({"skip": true}) или изменение суммы, описания и категории только для него
+	transactionRoutes.PUT("/recurring/:id/occurrences/:date", func(c *gin.Context) {
+		id, date, ok := recurringOccurrenceParams(c)
+		if !ok {
+			return
+		}
+		var request struct {
+			Skip        bool     `json:"skip"`
+			Amount      *float64 `json:"amount"`
+			Description *string  `json:"description"`
+			CategoryID  *int     `json:"category_id"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ввод"})
+			return
+		}
+		if request.CategoryID != nil && !requireOwnership(c, pool, "categories", *request.CategoryID) {
+			return
+		}
+
+		occurrence := models.RecurringOccurrence{
+			Date:        date,
+			Status:      database.OccurrenceScheduled,
+			Amount:      request.Amount,
+			Description: request.Description,
+			CategoryID:  request.CategoryID,
+		}
+		if request.Skip {
+			occurrence.Status = database.OccurrenceSkipped
+		}
+		if err := database.SetRecurringOccurrence(pool, auth.CurrentUserID(c), id, &occurrence); err != nil {
+			recurringError(c, err, "Ошибка сохранения повторения")
+			return
+		}
+		c.JSON(http.StatusOK, occurrence)
+	})
+
+	// Отмена пропуска или изменений: повторение создастся по шаблону
+	transactionRoutes.DELETE("/recurring/:id/occurrences/:date", func(c *gin.Context) {
+		id, date, ok := recurringOccurrenceParams(c)
+		if !ok {
+			return
+		}
+		if err := database.ResetRecurringOccurrence(pool, auth.CurrentUserID(c), id, date); err != nil {
+			recurringError(c, err, "Ошибка сброса повторения")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Повторение создастся по шаблону"})
+	})
+
+	transactionRoutes.PUT("/transactions/:id", func(c *gin.Context) {
+		var transaction models.Transaction
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор транзакции"})
+			return
+		}
+		if !requireOwnership(c, pool, "transactions", id) {
+			return
+		}
+		if err := c.ShouldBindJSON(&transaction); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ввод"})
+			return
+		}
+		transaction.ID = id
+		// Прежние сумма, дата и части нужны, чтобы вернуть их в бюджеты
+		old, err := database.GetTransactionByID(pool, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления транзакции"})
+			return
+		}
+
+		// Части и теги заменяются, только если переданы; "splits": [] снимает разделение, "tags": [] — все теги
+		if err := database.UpdateTransaction(pool, &transaction); err != nil {
+			if transactionInputError(c, err) {
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления транзакции"})
+			return
+		}
+		if err := database.UpdateTransactionBudgets(pool, *old, transaction); err != nil {
+			log.Printf("Ошибка при пересчёте бюджетов по транзакции %d: %v", id, err)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Транзакция успешно обновлена"})
+	})
+
+	transactionRoutes.DELETE("/transactions/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор транзакции"})
+			return
+		}
+		if !requireOwnership(c, pool, "transactions", id) {
+			return
+		}
+		old, err := database.GetTransactionByID(pool, id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления транзакции"})
+			return
+		}
+		if err := database.DeleteTransaction(pool, id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления транзакции"})
+			return
+		}
+		if err := database.ReturnTransactionToBudgets(pool, *old); err != nil {
+			log.Printf("Ошибка при возврате транзакции %d в бюджеты: %v", id, err)
 		}
-		c.JSON(http.StatusCreated, category)
+		// Записи вложений удалились вместе с транзакцией, их файлы убираем из хранилища сразу
+		attachments.RemoveDeleted(pool, blobs)
+		c.JSON(http.StatusOK, gin.H{"message": "Транзакция успешно удалена"})
 	})
 
-	r.GET("/categories", func(c *gin.Context) {
-		categories, err := database.GetAllCategories(pool)
+	// Вложения транзакции: фото чеков, PDF, гарантийные талоны. Файл загружается в поле file формы.
+	transactionRoutes.POST("/transactions/:id/attachments", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении списка категорий"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор транзакции"})
 			return
 		}
-		c.JSON(http.StatusOK, categories)
-	})
-
-	r.PUT("/categories/:id", func(c *gin.Context) {
-		var category models.Category
-		id, err := strconv.Atoi(c.Param("id"))
+		// Запас сверх размера файла — на остальные части формы
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, attachments.MaxSize+1<<20)
+		header, err := c.FormFile("file")
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор категории"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Приложите файл до %d МБ в поле file", attachments.MaxSize>>20)})
 			return
 		}
-		if err := c.ShouldBindJSON(&category); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат данных для категории"})
+		if header.Size > attachments.MaxSize {
+			attachmentError(c, attachments.ErrTooLarge, "")
 			return
 		}
-		category.ID = id
-		if err := database.UpdateCategory(pool, &category); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления категории"})
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Не удалось прочитать файл"})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "Категория успешно обновлена"})
-	})
-
-	r.DELETE("/categories/:id", func(c *gin.Context) {
-		id, err := strconv.Atoi(c.Param("id"))
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, attachments.MaxSize+1))
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор категории"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Не удалось прочитать файл"})
 			return
 		}
-		if err := database.DeleteCategory(pool, id); err != nil {
-			log.Printf("Ошибка удаления категории с ID %d: %v", id, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при удалении категории", "details": err.Error()})
+
+		attachment, err := attachments.Upload(pool, blobs, auth.CurrentUserID(c), id, header.Filename, data)
+		if err != nil {
+			attachmentError(c, err, "Ошибка сохранения вложения")
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "Категория успешно удалена"})
+		c.JSON(http.StatusCreated, attachment)
 	})
 
-	r.POST("/budgets", func(c *gin.Context) {
-		var budget models.Budget
-		if err := c.ShouldBindJSON(&budget); err != nil {
-			log.Printf("Ошибка привязки JSON: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ввод данных"})
+	transactionRoutes.GET("/transactions/:id/attachments", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор транзакции"})
 			return
 		}
-		log.Printf("Полученные данные для создания бюджета: %+v", budget)
-
-		if err := database.CreateBudget(pool, &budget); err != nil {
-			log.Printf("Ошибка при создании бюджета: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при создании бюджета"})
+		if !requireOwnership(c, pool, "transactions", id) {
 			return
 		}
-		c.JSON(http.StatusCreated, budget)
+		list, err := database.GetTransactionAttachments(pool, auth.CurrentUserID(c), id)
+		if err != nil {
+			attachmentError(c, err, "Ошибка получения вложений")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"attachments": list})
+	})
+
+	transactionRoutes.GET("/attachments/:id", func(c *gin.Context) {
+		serveAttachment(c, pool, blobs, false)
+	})
+
+	transactionRoutes.GET("/attachments/:id/thumbnail", func(c *gin.Context) {
+		serveAttachment(c, pool, blobs, true)
 	})
 
-	r.GET("/budgets", func(c *gin.Context) {
-		userID, err := strconv.Atoi(c.Query("user_id"))
+	transactionRoutes.DELETE("/attachments/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор пользователя"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор вложения"})
 			return
 		}
-		budgets, err := database.GetBudgetsByUserID(pool, userID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении списка бюджетов"})
+		if err := database.DeleteAttachment(pool, auth.CurrentUserID(c), id); err != nil {
+			attachmentError(c, err, "Ошибка удаления вложения")
 			return
 		}
-		c.JSON(http.StatusOK, budgets)
+		attachments.RemoveDeleted(pool, blobs)
+		c.JSON(http.StatusOK, gin.H{"message": "Вложение удалено"})
 	})
 
-	r.PUT("/budgets/:id", func(c *gin.Context) {
-		var budget models.Budget
-		id, err := strconv.Atoi(c.Param("id"))
+	transactionRoutes.GET("/import/mappings", func(c *gin.Context) {
+		mappings, err := database.GetImportMappings(pool, auth.CurrentUserID(c))
 		if err != nil {
-			log.Printf("Некорректный идентификатор бюджета: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор бюджета"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения настроек импорта"})
 			return
 		}
+		c.JSON(http.StatusOK, mappings)
+	})
 
-		if err := c.ShouldBindJSON(&budget); err != nil {
-			log.Printf("Ошибка привязки JSON: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ввод данных"})
+	transactionRoutes.POST("/import/mappings", func(c *gin.Context) {
+		var mapping models.ImportMapping
+		if err := c.ShouldBindJSON(&mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
 			return
 		}
-
-		budget.ID = id
-		log.Printf("Обновляем бюджет с данными: %+v", budget)
-
-		if err := database.UpdateBudget(pool, &budget); err != nil {
-			log.Printf("Ошибка обновления бюджета: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при обновлении бюджета"})
+		mapping.UserID = auth.CurrentUserID(c)
+		if !saveImportMapping(c, pool, &mapping) {
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "Бюджет успешно обновлён"})
+		c.JSON(http.StatusOK, mapping)
 	})
 
-	r.DELETE("/budgets/:id", func(c *gin.Context) {
+	transactionRoutes.DELETE("/import/mappings/:id", func(c *gin.Context) {
 		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор бюджета"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор настроек"})
 			return
 		}
-		if err := database.DeleteBudget(pool, id); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при удалении бюджета"})
+		if err := database.DeleteImportMapping(pool, id, auth.CurrentUserID(c)); err != nil {
+			if errors.Is(err, database.ErrImportMappingNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления настроек импорта"})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "Бюджет успешно удалён"})
+		c.JSON(http.StatusOK, gin.H{"message": "Настройки импорта удалены"})
 	})
 
-	r.POST("/transactions", func(c *gin.Context) {
-		var transaction models.Transaction
-		log.Printf("Необработанные данные транзакции: %v", c.Request.Body)
+	// Импорт CSV-выписки (multipart): file — файл, mapping_id или mapping (JSON) — настройки колонок,
+	// save_as — сохранить настройки под названием банка, account_id — счёт, dry_run=true — только предпросмотр.
+	// Строки с ошибками не загружаются; без skip_invalid=true любая ошибка отменяет импорт целиком.
+	transactionRoutes.POST("/import/csv", func(c *gin.Context) {
+		userID := auth.CurrentUserID(c)
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize)
 
-		// Привязка JSON данных к структуре
-		if err := c.ShouldBindJSON(&transaction); err != nil {
-			log.Printf("Ошибка привязки JSON: %v", err)
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ввод", "details": err.Error()})
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Приложите файл выписки до %d МБ в поле file", maxImportFileSize>>20)})
 			return
 		}
 
-		log.Printf("Полученные данные для создания транзакции: %+v", transaction)
-
-		// Проверка типа транзакции и наличие GoalID
-		if transaction.Type == "goal" && transaction.GoalID != nil && *transaction.GoalID != 0 {
-			// Преобразование float64 в decimal.Decimal
-			amountDecimal := decimal.NewFromFloat(transaction.Amount)
-
-			// Обновление прогресса цели
-			if err := database.UpdateGoalProgress(pool, *transaction.GoalID, amountDecimal); err != nil {
-				log.Printf("Ошибка при обновлении прогресса для цели %d: %v", *transaction.GoalID, err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при обновлении прогресса цели"})
+		var mapping *models.ImportMapping
+		if value := c.PostForm("mapping_id"); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор настроек"})
+				return
+			}
+			if mapping, err = database.GetImportMapping(pool, id, userID); err != nil {
+				if errors.Is(err, database.ErrImportMappingNotFound) {
+					c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения настроек импорта"})
 				return
 			}
+		} else {
+			mapping = &models.ImportMapping{}
+			if err := json.Unmarshal([]byte(c.PostForm("mapping")), mapping); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите mapping_id или настройки колонок в поле mapping"})
+				return
+			}
+			mapping.UserID = userID
+			if bankName := c.PostForm("save_as"); bankName != "" {
+				mapping.BankName = bankName
+				if !saveImportMapping(c, pool, mapping) {
+					return
+				}
+			}
 		}
-
-		// Создание транзакции в базе данных
-		if err := database.CreateTransaction(pool, &transaction); err != nil {
-			log.Printf("Ошибка при создании транзакции: %v", err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания транзакции"})
+		if mapping.DefaultCategoryID != nil && !requireOwnership(c, pool, "categories", *mapping.DefaultCategoryID) {
+			return
+		}
+		accountID, ok := bindImportAccount(c, pool)
+		if !ok {
 			return
 		}
 
-		c.JSON(http.StatusCreated, transaction)
-	})
-
-	r.GET("/transactions", func(c *gin.Context) {
-		userID, err := strconv.Atoi(c.Query("user_id"))
+		categories, err := database.GetCategoriesByUserID(pool, userID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор пользователя"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения категорий"})
 			return
 		}
-		transactions, err := database.GetTransactionsByUserID(pool, userID)
+
+		opened, err := file.Open()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения транзакций"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Не удалось прочитать файл"})
 			return
 		}
-		c.JSON(http.StatusOK, transactions)
-	})
+		defer opened.Close()
 
-	r.PUT("/transactions/:id", func(c *gin.Context) {
-		var transaction models.Transaction
-		id, err := strconv.Atoi(c.Param("id"))
+		result, err := csvimport.Parse(opened, mapping, categories)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор транзакции"})
+			if errors.Is(err, csvimport.ErrInvalidMapping) || errors.Is(err, csvimport.ErrEmptyFile) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
 			return
 		}
-		if err := c.ShouldBindJSON(&transaction); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ввод"})
+
+		response := gin.H{
+			"columns": result.Columns,
+			"valid":   result.Valid,
+			"invalid": result.Invalid,
+			"errors":  result.Errors(),
+		}
+		if mapping.ID > 0 {
+			response["mapping_id"] = mapping.ID
+		}
+		if c.PostForm("dry_run") == "true" {
+			response["preview"] = result.Preview()
+			c.JSON(http.StatusOK, response)
 			return
 		}
-		transaction.ID = id
-
-		if err := database.UpdateTransaction(pool, &transaction); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обновления транзакции"})
+		if result.Invalid > 0 && c.PostForm("skip_invalid") != "true" {
+			response["error"] = "В файле есть строки с ошибками: исправьте их или загрузите с skip_invalid=true"
+			c.JSON(http.StatusUnprocessableEntity, response)
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "Транзакция успешно обновлена"})
-	})
 
-	r.DELETE("/transactions/:id", func(c *gin.Context) {
-		id, err := strconv.Atoi(c.Param("id"))
+		imported, err := database.ImportTransactions(pool, userID, accountID, result.Transactions())
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор транзакции"})
+			if transactionInputError(c, err) {
+				return
+			}
+			log.Printf("Ошибка импорта выписки пользователя %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка импорта, ни одна строка не загружена"})
 			return
 		}
-		if err := database.DeleteTransaction(pool, id); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления транзакции"})
+		response["created"] = imported.Created
+		response["possible_duplicates"] = imported.PossibleDuplicates
+		response["categorized"] = imported.Categorized
+		c.JSON(http.StatusCreated, response)
+	})
+
+	// Импорт выписки OFX/QFX (multipart): file — файл, category_id — категория для всех операций,
+	// dry_run=true — посчитать результат без сохранения. Повторно загруженные операции пропускаются по FITID.
+	transactionRoutes.POST("/import/ofx", func(c *gin.Context) {
+		opened, categoryID, ok := openStatementUpload(c, pool)
+		if !ok {
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "Транзакция успешно удалена"})
+		defer opened.Close()
+
+		statements, err := ofx.Parse(opened)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var items []database.ExternalTransaction
+		failures := []ofx.TransactionError{}
+		accounts := []gin.H{}
+		for _, statement := range statements {
+			accounts = append(accounts, gin.H{"account_id": statement.AccountID, "currency": statement.Currency})
+			failures = append(failures, statement.Errors...)
+			for _, transaction := range statement.Transactions {
+				items = append(items, database.ExternalTransaction{
+					Source:      "ofx",
+					AccountID:   statement.AccountID,
+					ExternalID:  transaction.FITID,
+					Transaction: transaction.Model(categoryID),
+				})
+			}
+		}
+
+		importStatement(c, pool, items, gin.H{
+			"accounts": accounts,
+			"failed":   len(failures),
+			"errors":   failures,
+		})
 	})
 
-	r.GET("/dashboard/total_balance", func(c *gin.Context) {
-		userID, _ := strconv.Atoi(c.Query("user_id"))
+	// Импорт выписок для юридических лиц: ISO 20022 camt.053 (XML) и SWIFT MT940.
+	// Повторно загруженные проводки пропускаются по референсу банка или отпечатку проводки.
+	transactionRoutes.POST("/import/camt053", importBankStatement(pool, "camt053", bankstatement.ParseCAMT053))
+	transactionRoutes.POST("/import/mt940", importBankStatement(pool, "mt940", bankstatement.ParseMT940))
+
+	dashboardRoutes.GET("/dashboard/total_balance", func(c *gin.Context) {
+		userID := auth.CurrentUserID(c)
 		balance, err := database.GetTotalBalance(pool, userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -478,8 +2594,8 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"total_balance": balance})
 	})
 
-	r.GET("/dashboard/monthly_expenses", func(c *gin.Context) {
-		userID, _ := strconv.Atoi(c.Query("user_id"))
+	dashboardRoutes.GET("/dashboard/monthly_expenses", func(c *gin.Context) {
+		userID := auth.CurrentUserID(c)
 		expenses, err := database.GetMonthlyExpenses(pool, userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -488,8 +2604,8 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"expenses": expenses})
 	})
 
-	r.GET("/dashboard/income_expense_summary", func(c *gin.Context) {
-		userID, _ := strconv.Atoi(c.Query("user_id"))
+	dashboardRoutes.GET("/dashboard/income_expense_summary", func(c *gin.Context) {
+		userID := auth.CurrentUserID(c)
 		summary, err := database.GetIncomeExpenseSummary(pool, userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -498,8 +2614,8 @@ func main() {
 		c.JSON(http.StatusOK, summary)
 	})
 
-	r.GET("/dashboard/category_expenses", func(c *gin.Context) {
-		userID, _ := strconv.Atoi(c.Query("user_id"))
+	dashboardRoutes.GET("/dashboard/category_expenses", func(c *gin.Context) {
+		userID := auth.CurrentUserID(c)
 		categoryExpenses, err := database.GetCategoryWiseExpenses(pool, userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -508,12 +2624,29 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"category_expenses": categoryExpenses})
 	})
 
-	r.POST("/notifications", func(c *gin.Context) {
+	// Расходы по тегам за период from–to, по умолчанию за текущий месяц
+	dashboardRoutes.GET("/dashboard/tag_expenses", func(c *gin.Context) {
+		now := time.Now()
+		from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		to := from.AddDate(0, 1, 0)
+		if !bindPeriod(c, &from, &to) {
+			return
+		}
+		tagExpenses, err := database.GetTagWiseExpenses(pool, auth.CurrentUserID(c), from, to)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"tag_expenses": tagExpenses})
+	})
+
+	notificationRoutes.POST("/notifications", func(c *gin.Context) {
 		var notification models.Notification
 		if err := c.ShouldBindJSON(&notification); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ввод"})
 			return
 		}
+		notification.UserID = auth.CurrentUserID(c)
 		if err := database.CreateNotification(pool, &notification); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания уведомления"})
 			return
@@ -521,13 +2654,8 @@ func main() {
 		c.JSON(http.StatusCreated, notification)
 	})
 
-	r.GET("/notifications", func(c *gin.Context) {
-		userID, err := strconv.Atoi(c.Query("user_id"))
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор пользователя"})
-			return
-		}
-		notifications, err := database.GetNotificationsByUserID(pool, userID)
+	notificationRoutes.GET("/notifications", func(c *gin.Context) {
+		notifications, err := database.GetNotificationsByUserID(pool, auth.CurrentUserID(c))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения уведомлений"})
 			return
@@ -535,12 +2663,15 @@ func main() {
 		c.JSON(http.StatusOK, notifications)
 	})
 
-	r.PUT("/notifications/{id}/read", func(c *gin.Context) {
+	notificationRoutes.PUT("/notifications/{id}/read", func(c *gin.Context) {
 		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор уведомления"})
 			return
 		}
+		if !requireOwnership(c, pool, "notifications", id) {
+			return
+		}
 		err = database.MarkNotificationAsRead(pool, id)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка пометки уведомления как прочитанного"})
@@ -549,12 +2680,15 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"message": "Уведомление помечено как прочитанное"})
 	})
 
-	r.DELETE("/notifications/{id}", func(c *gin.Context) {
+	notificationRoutes.DELETE("/notifications/{id}", func(c *gin.Context) {
 		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор уведомления"})
 			return
 		}
+		if !requireOwnership(c, pool, "notifications", id) {
+			return
+		}
 		err = database.DeleteNotification(pool, id)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления уведомления"})
@@ -563,7 +2697,7 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"message": "Уведомление успешно удалено"})
 	})
 
-	r.DELETE("/notifications/by-notification-id/:id", func(c *gin.Context) {
+	notificationRoutes.DELETE("/notifications/by-notification-id/:id", func(c *gin.Context) {
 		notificationID := c.Param("id")
 
 		// Преобразуем ID в int
@@ -573,6 +2707,9 @@ func main() {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор уведомления"})
 			return
 		}
+		if !requireOwnership(c, pool, "notifications", id) {
+			return
+		}
 		log.Printf("Получен запрос на удаление уведомления с ID: %d", id)
 
 		// Пытаемся удалить уведомление
@@ -587,7 +2724,7 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"message": "Уведомление успешно удалено"})
 	})
 
-	r.POST("/payment_reminders", func(c *gin.Context) {
+	reminderRoutes.POST("/payment_reminders", func(c *gin.Context) {
 		var reminder models.PaymentReminder
 		if err := c.ShouldBindJSON(&reminder); err != nil {
 			// Логируем ошибку валидации данных
@@ -595,6 +2732,7 @@ func main() {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ввод"})
 			return
 		}
+		reminder.UserID = auth.CurrentUserID(c)
 
 		if err := database.CreatePaymentReminder(pool, &reminder); err != nil {
 			// Логируем ошибку при создании напоминания
@@ -606,16 +2744,13 @@ func main() {
 		c.JSON(http.StatusCreated, reminder)
 	})
 
-	r.GET("/payment_reminders", func(c *gin.Context) {
-		userID, err := strconv.Atoi(c.Query("user_id"))
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор пользователя"})
-			return
-		}
+	reminderRoutes.GET("/payment_reminders", func(c *gin.Context) {
+		userID := auth.CurrentUserID(c)
 
 		// Получаем дату для фильтрации, если указана
 		dateFilter := c.DefaultQuery("date", "")
 		var reminders []models.PaymentReminder
+		var err error
 		if dateFilter == "" {
 			reminders, err = database.GetPaymentRemindersByUserID(pool, userID)
 		} else {
@@ -636,13 +2771,17 @@ func main() {
 		c.JSON(http.StatusOK, reminders)
 	})
 
-	r.GET("/payment_reminders/:id", func(c *gin.Context) {
+	reminderRoutes.GET("/payment_reminders/:id", func(c *gin.Context) {
 		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор напоминания"})
 			return
 		}
 
+		if !requireSelfOrPermission(c, pool, id, database.PermissionUsersData) {
+			return
+		}
+
 		log.Printf("Получение напоминаний для пользователя с ID: %d", id)
 
 		reminder, err := database.GetPaymentRemindersByUserID(pool, id)
@@ -659,7 +2798,7 @@ func main() {
 		c.JSON(http.StatusOK, reminder)
 	})
 
-	r.PUT("/payment_reminders/:id", func(c *gin.Context) {
+	reminderRoutes.PUT("/payment_reminders/:id", func(c *gin.Context) {
 		var reminder models.PaymentReminder
 		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
@@ -668,6 +2807,9 @@ func main() {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор напоминания"})
 			return
 		}
+		if !requireOwnership(c, pool, "payment_reminders", id) {
+			return
+		}
 
 		if err := c.ShouldBindJSON(&reminder); err != nil {
 			// Логируем ошибку валидации данных
@@ -687,12 +2829,15 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"message": "Напоминание о платеже успешно обновлено"})
 	})
 
-	r.DELETE("/payment_reminders/:id", func(c *gin.Context) {
+	reminderRoutes.DELETE("/payment_reminders/:id", func(c *gin.Context) {
 		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор напоминания"})
 			return
 		}
+		if !requireOwnership(c, pool, "payment_reminders", id) {
+			return
+		}
 		if err := database.DeletePaymentReminder(pool, id); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка удаления напоминания о платеже"})
 			return
@@ -700,13 +2845,16 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"message": "Напоминание о платеже успешно удалено"})
 	})
 
-	r.GET("/usersettings/:id", func(c *gin.Context) {
+	settingsRoutes.GET("/usersettings/:id", func(c *gin.Context) {
 		// Получаем ID пользователя из параметра запроса
 		userID, err := strconv.Atoi(c.Param("id"))
 		if err != nil || userID <= 0 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный или отсутствующий идентификатор пользователя"})
 			return
 		}
+		if !requireSelfOrPermission(c, pool, userID, database.PermissionUsersData) {
+			return
+		}
 
 		// Получаем настройки пользователя из базы данных
 		settings, err := database.GetUserSettingsByID(pool, userID)
@@ -723,7 +2871,7 @@ func main() {
 		c.JSON(http.StatusOK, settings)
 	})
 
-	r.PUT("/usersettings/:id", func(c *gin.Context) {
+	settingsRoutes.PUT("/usersettings/:id", func(c *gin.Context) {
 		// Получаем ID пользователя из параметра запроса
 		userID, err := strconv.Atoi(c.Param("id"))
 		if err != nil || userID <= 0 {
@@ -731,6 +2879,9 @@ func main() {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный или отсутствующий идентификатор пользователя"})
 			return
 		}
+		if !requireSelfOrPermission(c, pool, userID, database.PermissionUsersData) {
+			return
+		}
 
 		// Создаем структуру для хранения обновленных настроек пользователя
 		var settings models.UserSettings
@@ -779,16 +2930,20 @@ func main() {
 			}
 		}
 
+		recordAudit(c, pool, database.AuditSettingsUpdated, userID, gin.H{"currency": settings.Currency})
 		c.JSON(http.StatusOK, gin.H{"message": "Настройки пользователя успешно обновлены"})
 	})
 
-	r.GET("/usersettings/:id/convert", func(c *gin.Context) {
+	settingsRoutes.GET("/usersettings/:id/convert", func(c *gin.Context) {
 		// Получаем ID пользователя из параметра запроса
 		userID, err := strconv.Atoi(c.Param("id"))
 		if err != nil || userID <= 0 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный или отсутствующий идентификатор пользователя"})
 			return
 		}
+		if !requireSelfOrPermission(c, pool, userID, database.PermissionUsersData) {
+			return
+		}
 
 		amountParam := c.DefaultQuery("amount", "0")
 		amount, err := strconv.ParseFloat(amountParam, 64)
@@ -841,64 +2996,139 @@ func main() {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Ошибка получения курса для валюты %s: %v", transactionCurrency, errFromRate)})
 			return
 		}
-		if errToRate != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Ошибка получения курса для валюты %s: %v", userCurrency, errToRate)})
+		if errToRate != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Ошибка получения курса для валюты %s: %v", userCurrency, errToRate)})
+			return
+		}
+
+		// Конвертируем сумму
+		convertedAmount := amount * (toRate / fromRate)
+
+		// Отправляем результат
+		c.JSON(http.StatusOK, gin.H{
+			"original_amount":  amount,
+			"from_currency":    transactionCurrency,
+			"to_currency":      userCurrency,
+			"converted_amount": convertedAmount,
+		})
+
+		// Дополнительно конвертировать сумму бюджета, если валюта отличается от валюты пользователя
+		if transactionCurrency != userCurrency {
+			// Конвертировать бюджеты
+			budgets, err := database.GetBudgetsByUserID(pool, userID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении бюджета"})
+				return
+			}
+
+			for _, budget := range budgets {
+				// Если валюта бюджета отличается от валюты пользователя, конвертируем бюджет
+				if budget.Currency != userCurrency {
+					convertedBudgetAmount := budget.Amount * (toRate / fromRate)
+					updatedBudget := budget
+					updatedBudget.Amount = convertedBudgetAmount
+
+					// Обновить в базе данных
+					err := database.UpdateBudget(pool, &updatedBudget)
+					if err != nil {
+						c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Ошибка обновления бюджета: %v", err)})
+						return
+					}
+				}
+			}
+		}
+	})
+
+	accountRoutes.GET("/accounts", func(c *gin.Context) {
+		accounts, err := database.GetAccountsByUserID(pool, auth.CurrentUserID(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения счетов"})
+			return
+		}
+		c.JSON(http.StatusOK, accounts)
+	})
+
+	accountRoutes.POST("/accounts", func(c *gin.Context) {
+		var account models.Account
+		if err := c.ShouldBindJSON(&account); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат счёта"})
+			return
+		}
+		account.UserID = auth.CurrentUserID(c)
+		if err := database.CreateAccount(pool, &account); err != nil {
+			accountError(c, err, "Ошибка при создании счёта")
+			return
+		}
+		c.JSON(http.StatusCreated, account)
+	})
+
+	// Остатки всех счетов: начальный остаток плюс доходы, минус расходы и отчисления на цели, с учётом переводов
+	accountRoutes.GET("/accounts/balances", func(c *gin.Context) {
+		balances, err := database.GetAccountBalances(pool, auth.CurrentUserID(c), 0)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка расчёта остатков счетов"})
+			return
+		}
+		c.JSON(http.StatusOK, balances)
+	})
+
+	accountRoutes.GET("/accounts/:id/balance", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор счёта"})
+			return
+		}
+		balances, err := database.GetAccountBalances(pool, auth.CurrentUserID(c), id)
+		if err != nil {
+			accountError(c, err, "Ошибка расчёта остатка счёта")
+			return
+		}
+		c.JSON(http.StatusOK, balances[0])
+	})
+
+	accountRoutes.PUT("/accounts/:id", func(c *gin.Context) {
+		var account models.Account
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор счёта"})
+			return
+		}
+		if err := c.ShouldBindJSON(&account); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный формат счёта"})
+			return
+		}
+		account.ID = id
+		account.UserID = auth.CurrentUserID(c)
+		if err := database.UpdateAccount(pool, &account); err != nil {
+			accountError(c, err, "Ошибка обновления счёта")
+			return
+		}
+		c.JSON(http.StatusOK, account)
+	})
+
+	accountRoutes.DELETE("/accounts/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор счёта"})
+			return
+		}
+		if err := database.DeleteAccount(pool, auth.CurrentUserID(c), id); err != nil {
+			accountError(c, err, "Ошибка удаления счёта")
 			return
 		}
-
-		// Конвертируем сумму
-		convertedAmount := amount * (toRate / fromRate)
-
-		// Отправляем результат
-		c.JSON(http.StatusOK, gin.H{
-			"original_amount":  amount,
-			"from_currency":    transactionCurrency,
-			"to_currency":      userCurrency,
-			"converted_amount": convertedAmount,
-		})
-
-		// Дополнительно конвертировать сумму бюджета, если валюта отличается от валюты пользователя
-		if transactionCurrency != userCurrency {
-			// Конвертировать бюджеты
-			budgets, err := database.GetBudgetsByUserID(pool, userID)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении бюджета"})
-				return
-			}
-
-			for _, budget := range budgets {
-				// Если валюта бюджета отличается от валюты пользователя, конвертируем бюджет
-				if budget.Currency != userCurrency {
-					convertedBudgetAmount := budget.Amount * (toRate / fromRate)
-					updatedBudget := budget
-					updatedBudget.Amount = convertedBudgetAmount
-
-					// Обновить в базе данных
-					err := database.UpdateBudget(pool, &updatedBudget)
-					if err != nil {
-						c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Ошибка обновления бюджета: %v", err)})
-						return
-					}
-				}
-			}
-		}
+		c.JSON(http.StatusOK, gin.H{"message": "Счёт удалён"})
 	})
 
-	r.POST("/goals", func(c *gin.Context) {
+	goalRoutes.POST("/goals", func(c *gin.Context) {
 		var goal models.Goal
 		if err := c.ShouldBindJSON(&goal); err != nil {
 			log.Printf("Ошибка привязки JSON: %v", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный ввод данных"})
 			return
 		}
+		goal.UserID = auth.CurrentUserID(c)
 		log.Printf("Полученные данные для создания цели: %+v", goal)
 
-		// Проверка существования пользователя
-		if goal.UserID == 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Не указан ID пользователя"})
-			return
-		}
-
 		// Создание цели
 		if err := database.CreateGoal(pool, &goal); err != nil {
 			log.Printf("Ошибка при создании цели: %v", err)
@@ -909,14 +3139,8 @@ func main() {
 	})
 
 	// Получение списка целей по user_id
-	r.GET("/goals", func(c *gin.Context) {
-		userID, err := strconv.Atoi(c.DefaultQuery("user_id", "0"))
-		if err != nil || userID == 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор пользователя"})
-			return
-		}
-
-		goals, err := database.GetAllGoals(pool, userID) // Используем GetAllGoals
+	goalRoutes.GET("/goals", func(c *gin.Context) {
+		goals, err := database.GetAllGoals(pool, auth.CurrentUserID(c)) // Используем GetAllGoals
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении списка целей"})
 			return
@@ -925,7 +3149,7 @@ func main() {
 	})
 
 	// Обновление существующей цели
-	r.PUT("/goals/:id", func(c *gin.Context) {
+	goalRoutes.PUT("/goals/:id", func(c *gin.Context) {
 		var goal models.Goal
 		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
@@ -933,6 +3157,9 @@ func main() {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор цели"})
 			return
 		}
+		if !requireOwnership(c, pool, "goals", id) {
+			return
+		}
 
 		if err := c.ShouldBindJSON(&goal); err != nil {
 			log.Printf("Ошибка привязки JSON: %v", err)
@@ -952,12 +3179,15 @@ func main() {
 	})
 
 	// Удаление цели
-	r.DELETE("/goals/:id", func(c *gin.Context) {
+	goalRoutes.DELETE("/goals/:id", func(c *gin.Context) {
 		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор цели"})
 			return
 		}
+		if !requireOwnership(c, pool, "goals", id) {
+			return
+		}
 
 		if err := database.DeleteGoal(pool, id); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при удалении цели"})
@@ -966,12 +3196,15 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"message": "Цель успешно удалена"})
 	})
 
-	r.PATCH("/goals/:id/progress", func(c *gin.Context) {
+	goalRoutes.PATCH("/goals/:id/progress", func(c *gin.Context) {
 		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный идентификатор цели"})
 			return
 		}
+		if !requireOwnership(c, pool, "goals", id) {
+			return
+		}
 
 		var progress struct {
 			Amount decimal.Decimal `json:"amount"` // Сумма прогресса в формате decimal
@@ -1000,7 +3233,7 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"message": "Прогресс успешно обновлен"})
 	})
 
-	r.GET("/users", func(c *gin.Context) {
+	sessionRoutes.GET("/users", auth.RequirePermission(pool, database.PermissionUsersRead), func(c *gin.Context) {
 		users, err := database.GetAllUsers(pool)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении списка пользователей"})
@@ -1009,63 +3242,261 @@ func main() {
 		c.JSON(http.StatusOK, users)
 	})
 
-	r.PUT("/users/:id", func(c *gin.Context) {
-		var user models.User
-		if err := c.ShouldBindJSON(&user); err != nil {
+	sessionRoutes.PUT("/users/:id", func(c *gin.Context) {
+		// Пароль необязателен: если он не передан, остаётся прежний. Свои пароль и email меняются только с текущим паролем
+		var request struct {
+			Name            string `json:"name"`
+			Email           string `json:"email"`
+			Password        string `json:"password"`
+			CurrentPassword string `json:"current_password"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
 			return
 		}
+		user := models.User{Name: request.Name, Email: strings.TrimSpace(request.Email)}
 
 		userID, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID пользователя"})
 			return
 		}
+		// Свой профиль может менять каждый, чужой — только с правом users.write
+		if !requireSelfOrPermission(c, pool, userID, database.PermissionUsersWrite) {
+			return
+		}
 		user.ID = userID
 
+		current, err := database.GetUserByID(pool, userID)
+		if err != nil {
+			if errors.Is(err, database.ErrUserNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при получении пользователя"})
+			return
+		}
+		emailChanged := !strings.EqualFold(user.Email, current.Email)
+		if emailChanged {
+			if err := database.ValidateEmail(user.Email); err != nil {
+				userDataError(c, err)
+				return
+			}
+		}
+		// Чужие пароль и email меняются по отдельному праву: с ними можно войти под этим аккаунтом
+		if (request.Password != "" || emailChanged) && !requireCredentialsAccess(c, pool, userID) {
+			return
+		}
+		// Без текущего пароля украденный токен доступа позволял бы захватить аккаунт
+		self := userID == auth.CurrentUserID(c)
+		if self && (request.Password != "" || emailChanged) {
+			if request.CurrentPassword == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите текущий пароль"})
+				return
+			}
+			if err := database.CheckUserPassword(pool, userID, request.CurrentPassword); err != nil {
+				if errors.Is(err, database.ErrInvalidCredentials) {
+					c.JSON(http.StatusForbidden, gin.H{"error": "Неверный текущий пароль"})
+					return
+				}
+				log.Printf("Ошибка проверки пароля пользователя %d: %v", userID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при обновлении пользователя"})
+				return
+			}
+		}
+
+		if request.Password != "" {
+			if err := passwords.Validate(request.Password, user.Email, user.Name); err != nil {
+				userDataError(c, err)
+				return
+			}
+			hashedPassword, err := passwords.Hash(request.Password)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка хэширования пароля"})
+				return
+			}
+			user.Password = hashedPassword
+		}
+
 		if err := database.UpdateUser(pool, &user); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при обновлении пользователя"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Пользователь успешно обновлен"})
+		// Новый адрес не подтверждён: до перехода по ссылке из письма действуют ограничения неподтверждённого аккаунта
+		message := "Пользователь успешно обновлен"
+		if emailChanged {
+			message = "Пользователь успешно обновлен. Подтвердите новый email по ссылке из письма"
+			if err := auth.SendEmailVerification(pool, mailer, &user); err != nil {
+				log.Printf("Ошибка отправки письма подтверждения пользователю %d: %v", userID, err)
+				message = "Пользователь обновлен, но письмо для подтверждения email отправить не удалось; запросите его повторно"
+			}
+		}
+
+		recordAudit(c, pool, database.AuditUserUpdated, userID, gin.H{
+			"name":             user.Name,
+			"email":            user.Email,
+			"email_changed":    emailChanged,
+			"password_changed": request.Password != "",
+		})
+
+		// Со сменой пароля завершаются остальные сессии; сменивший свой пароль остаётся в текущей
+		if request.Password != "" {
+			keepSessionID := 0
+			if self {
+				keepSessionID = auth.CurrentSessionID(c)
+			}
+			revoked, err := database.RevokeOtherSessions(pool, userID, keepSessionID)
+			if err != nil {
+				log.Printf("Ошибка завершения сессий пользователя %d после смены пароля: %v", userID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Пароль изменён, но не удалось завершить другие сессии"})
+				return
+			}
+			recordAudit(c, pool, database.AuditPasswordChanged, userID, gin.H{"sessions_revoked": revoked})
+		}
+		c.JSON(http.StatusOK, gin.H{"message": message, "email_verified": user.EmailVerified})
 	})
 
-	r.DELETE("/users/:id", func(c *gin.Context) {
+	// Удаление аккаунта откладывается на срок ожидания; немедленно удалить может только администратор
+	sessionRoutes.DELETE("/users/:id", func(c *gin.Context) {
 		userID, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
 			log.Printf("Invalid user ID: %v", c.Param("id"))
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID пользователя"})
 			return
 		}
+		if !requireSelfOrPermission(c, pool, userID, database.PermissionUsersDelete) {
+			return
+		}
+
+		var request struct {
+			FamilyAction     string `json:"family_action"`
+			TransferToUserID *int   `json:"transfer_to_user_id"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
+			return
+		}
 
-		log.Printf("Attempting to delete user with ID: %d", userID)
-		if err := database.DeleteUser(pool, userID); err != nil {
-			log.Printf("Error deleting user with ID %d: %v", userID, err)
+		user, err := database.GetUserByID(pool, userID)
+		if err != nil {
+			if errors.Is(err, database.ErrUserNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка при удалении пользователя"})
 			return
 		}
 
-		log.Printf("User with ID %d successfully deleted", userID)
-		c.JSON(http.StatusOK, gin.H{"message": "Пользователь успешно удален"})
+		if c.Query("immediate") == "true" {
+			allowed, err := auth.HasPermission(c, pool, database.PermissionUsersDelete)
+			if err != nil || !allowed {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Немедленное удаление доступно только администратору"})
+				return
+			}
+			if err := auth.DeleteAccountNow(pool, userID, request.FamilyAction, request.TransferToUserID); err != nil {
+				accountDeletionError(c, userID, err)
+				return
+			}
+			log.Printf("User with ID %d successfully deleted", userID)
+			// Записи об удалённом пользователе стёрты вместе с ним, поэтому событие пишется только от инициатора
+			recordAudit(c, pool, database.AuditAccountDeleted, 0, gin.H{"deleted_user_id": userID})
+			c.JSON(http.StatusOK, gin.H{"message": "Пользователь успешно удален"})
+			return
+		}
+
+		deletion, err := auth.ScheduleAccountDeletion(pool, mailer, user, request.FamilyAction, request.TransferToUserID, auth.CurrentUserID(c))
+		if err != nil {
+			accountDeletionError(c, userID, err)
+			return
+		}
+
+		log.Printf("Deletion of user %d scheduled for %s", userID, deletion.ScheduledFor.Format(time.RFC3339))
+		recordAudit(c, pool, database.AuditDeletionScheduled, userID, gin.H{
+			"scheduled_for": deletion.ScheduledFor,
+			"family_action": deletion.FamilyAction,
+		})
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":  "Аккаунт будет удалён по истечении срока ожидания. До этого удаление можно отменить",
+			"deletion": deletion,
+		})
+	})
+
+	sessionRoutes.GET("/users/:id/deletion", func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID пользователя"})
+			return
+		}
+		if !requireSelfOrPermission(c, pool, userID, database.PermissionUsersRead) {
+			return
+		}
+
+		deletion, err := database.GetAccountDeletion(pool, userID)
+		if err != nil {
+			if errors.Is(err, database.ErrDeletionNotScheduled) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Удаление аккаунта не запланировано"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения данных об удалении"})
+			return
+		}
+		c.JSON(http.StatusOK, deletion)
 	})
 
-	r.POST("/users", func(c *gin.Context) {
-		var newUser models.User
+	sessionRoutes.DELETE("/users/:id/deletion", func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID пользователя"})
+			return
+		}
+		if !requireSelfOrPermission(c, pool, userID, database.PermissionUsersDelete) {
+			return
+		}
+
+		user, err := database.GetUserByID(pool, userID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+			return
+		}
+		if err := auth.CancelAccountDeletion(pool, mailer, user); err != nil {
+			if errors.Is(err, database.ErrDeletionNotScheduled) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Удаление аккаунта не запланировано"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка отмены удаления"})
+			return
+		}
+		recordAudit(c, pool, database.AuditDeletionCancelled, userID, nil)
+		c.JSON(http.StatusOK, gin.H{"message": "Удаление аккаунта отменено"})
+	})
 
-		// Парсим тело запроса в структуру `newUser`
-		if err := c.ShouldBindJSON(&newUser); err != nil {
+	sessionRoutes.POST("/users", auth.RequirePermission(pool, database.PermissionUsersWrite), func(c *gin.Context) {
+		// Пароль в models.User скрыт от JSON, поэтому принимаем данные отдельной структурой
+		var request struct {
+			Name     string `json:"name"`
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат данных"})
 			return
 		}
+		newUser := models.User{Name: request.Name, Email: request.Email, Password: request.Password}
+
+		// Пароль, заданный администратором, проходит те же проверки, что и при регистрации
+		if err := database.ValidateUserData(&newUser); err != nil {
+			userDataError(c, err)
+			return
+		}
 
 		// Хэшируем пароль перед сохранением
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newUser.Password), bcrypt.DefaultCost)
+		hashedPassword, err := passwords.Hash(newUser.Password)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка хэширования пароля"})
 			return
 		}
-		newUser.Password = string(hashedPassword)
+		newUser.Password = hashedPassword
 
 		// Создаем пользователя через функцию CreateUser
 		err = database.CreateUser(pool, &newUser)
@@ -1074,6 +3505,8 @@ func main() {
 			return
 		}
 
+		recordAudit(c, pool, database.AuditUserCreated, newUser.ID, gin.H{"email": newUser.Email})
+
 		// Возвращаем успешный ответ с данными нового пользователя
 		c.JSON(http.StatusCreated, gin.H{
 			"message": "Пользователь успешно создан",
@@ -1085,13 +3518,112 @@ func main() {
 		})
 	})
 
-	r.GET("/admin/user_stats", database.GetUserStats(pool))
+	sessionRoutes.GET("/roles", auth.RequirePermission(pool, database.PermissionUsersRead), func(c *gin.Context) {
+		roles, err := database.GetRoles(pool)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения списка ролей"})
+			return
+		}
+		c.JSON(http.StatusOK, roles)
+	})
+
+	sessionRoutes.GET("/users/:id/roles", func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID пользователя"})
+			return
+		}
+		// Свои роли видит каждый, чужие — только с правом users.read
+		if !requireSelfOrPermission(c, pool, userID, database.PermissionUsersRead) {
+			return
+		}
+
+		roles, err := database.GetUserRoleNames(pool, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения ролей пользователя"})
+			return
+		}
+		permissions, err := database.GetUserPermissions(pool, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения ролей пользователя"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"user_id": userID, "roles": roles, "permissions": permissions})
+	})
+
+	sessionRoutes.POST("/users/:id/roles", auth.RequirePermission(pool, database.PermissionRolesManage), func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID пользователя"})
+			return
+		}
+		var request struct {
+			Role string `json:"role"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil || request.Role == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Укажите роль"})
+			return
+		}
+
+		if _, err := database.GetUserByID(pool, userID); err != nil {
+			if errors.Is(err, database.ErrUserNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Пользователь не найден"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка назначения роли"})
+			return
+		}
+		if err := database.GrantRole(pool, userID, request.Role, auth.CurrentUserID(c)); err != nil {
+			if errors.Is(err, database.ErrRoleNotFound) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Роль не найдена"})
+				return
+			}
+			log.Printf("Ошибка назначения роли %s пользователю %d: %v", request.Role, userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка назначения роли"})
+			return
+		}
+		recordAudit(c, pool, database.AuditRoleGranted, userID, gin.H{"role": request.Role})
+		c.JSON(http.StatusOK, gin.H{"message": "Роль назначена"})
+	})
+
+	sessionRoutes.DELETE("/users/:id/roles/:role", auth.RequirePermission(pool, database.PermissionRolesManage), func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID пользователя"})
+			return
+		}
+
+		if err := database.RevokeRole(pool, userID, c.Param("role")); err != nil {
+			switch {
+			case errors.Is(err, database.ErrRoleNotFound), errors.Is(err, database.ErrRoleNotAssigned):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, database.ErrLastAdmin):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				log.Printf("Ошибка отзыва роли %s у пользователя %d: %v", c.Param("role"), userID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка отзыва роли"})
+			}
+			return
+		}
+		recordAudit(c, pool, database.AuditRoleRevoked, userID, gin.H{"role": c.Param("role")})
+		c.JSON(http.StatusOK, gin.H{"message": "Роль отозвана"})
+	})
+
+	sessionRoutes.GET("/admin/user_stats", auth.RequirePermission(pool, database.PermissionStatsRead), database.GetUserStats(pool))
+
+	sessionRoutes.GET("/admin/registrations_by_month", auth.RequirePermission(pool, database.PermissionStatsRead), database.GetRegistrationsByMonth(pool))
 
-	r.GET("/admin/registrations_by_month", database.GetRegistrationsByMonth(pool))
+	sessionRoutes.GET("/admin/user_roles", auth.RequirePermission(pool, database.PermissionStatsRead), database.GetUserRoles(pool))
 
-	r.GET("/admin/user_roles", database.GetUserRoles(pool))
+	sessionRoutes.GET("/admin/audit/events", auth.RequirePermission(pool, database.PermissionAuditRead), func(c *gin.Context) {
+		var filter database.AuditFilter
+		if !bindAuditFilter(c, &filter) {
+			return
+		}
+		respondWithAuditEvents(c, pool, filter)
+	})
 
-	r.POST("/family_accounts", func(c *gin.Context) {
+	sessionRoutes.POST("/family_accounts", func(c *gin.Context) {
 		var request struct {
 			Nickname    string `json:"nickname"`
 			OwnerUserID int    `json:"owner_user_id"`
@@ -1102,12 +3634,19 @@ func main() {
 			return
 		}
 
+		request.OwnerUserID = auth.CurrentUserID(c)
+
 		familyID, err := database.CreateFamilyAccount(pool, request.Nickname, request.OwnerUserID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Ошибка создания семейного аккаунта: %v", err)})
 			return
 		}
 
+		recordAudit(c, pool, database.AuditFamilyCreated, request.OwnerUserID, gin.H{
+			"family_account_id": familyID,
+			"nickname":          request.Nickname,
+		})
+
 		c.JSON(http.StatusCreated, gin.H{
 			"message": "Семейный аккаунт успешно создан",
 			"family_account": gin.H{
@@ -1117,7 +3656,7 @@ func main() {
 		})
 	})
 
-	r.POST("/family_accounts/join", func(c *gin.Context) {
+	sessionRoutes.POST("/family_accounts/join", func(c *gin.Context) {
 		var request struct {
 			UserID   int    `json:"user_id"`
 			Nickname string `json:"nickname"`
@@ -1129,21 +3668,35 @@ func main() {
 			return
 		}
 
+		request.UserID = auth.CurrentUserID(c)
+
 		if err := database.JoinFamilyAccount(pool, request.UserID, request.Nickname, request.Role); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Ошибка присоединения к семейному аккаунту: %v", err)})
 			return
 		}
 
+		recordAudit(c, pool, database.AuditFamilyJoined, request.UserID, gin.H{
+			"nickname": request.Nickname,
+			"role":     request.Role,
+		})
+
 		c.JSON(http.StatusOK, gin.H{"message": "Пользователь успешно присоединился к семейному аккаунту"})
 	})
 
-	r.GET("/family_accounts/:id/members", func(c *gin.Context) {
+	sessionRoutes.GET("/family_accounts/:id/members", func(c *gin.Context) {
 		familyAccountID, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID семейного аккаунта"})
 			return
 		}
 
+		// Участников семьи видят только её члены
+		userFamilyID, err := database.GetFamilyAccountByUser(pool, auth.CurrentUserID(c))
+		if err != nil || userFamilyID != familyAccountID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Доступ запрещён"})
+			return
+		}
+
 		members, err := database.GetFamilyMembers(pool, familyAccountID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Ошибка получения участников семейного аккаунта: %v", err)})
@@ -1153,12 +3706,15 @@ func main() {
 		c.JSON(http.StatusOK, members)
 	})
 
-	r.GET("/users/:id/family_account", func(c *gin.Context) {
+	sessionRoutes.GET("/users/:id/family_account", func(c *gin.Context) {
 		userID, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID пользователя"})
 			return
 		}
+		if !requireSelfOrPermission(c, pool, userID, database.PermissionUsersData) {
+			return
+		}
 
 		familyAccountID, err := database.GetFamilyAccountByUser(pool, userID)
 		if err != nil {
@@ -1169,12 +3725,15 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"family_account_id": familyAccountID})
 	})
 
-	r.GET("/users/:id/family_account/check", func(c *gin.Context) {
+	sessionRoutes.GET("/users/:id/family_account/check", func(c *gin.Context) {
 		userID, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID пользователя"})
 			return
 		}
+		if !requireSelfOrPermission(c, pool, userID, database.PermissionUsersData) {
+			return
+		}
 
 		familyAccountID, err := database.GetFamilyAccountByUser(pool, userID)
 		if err != nil {
@@ -1197,6 +3756,80 @@ func main() {
 		}
 	})
 
+	// startDataExport ставит выгрузку в очередь и сразу запускает обработку, не дожидаясь планировщика
+	startDataExport := func(c *gin.Context, userID int) {
+		export, err := database.CreateDataExport(pool, userID)
+		if err != nil {
+			log.Printf("Ошибка создания выгрузки данных пользователя %d: %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка запуска выгрузки данных"})
+			return
+		}
+		recordAudit(c, pool, database.AuditDataExportRequested, userID, gin.H{"export_id": export.ID})
+		go dataexport.ProcessPending(pool, blobs)
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "Архив готовится, по готовности придёт уведомление",
+			"export":  export,
+		})
+	}
+
+	// Готовый архив отдаётся файлом; если его нет или он устарел, запускается новая выгрузка
+	sessionRoutes.GET("/users/:id/export", func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID пользователя"})
+			return
+		}
+		if !requireSelfOrPermission(c, pool, userID, database.PermissionUsersData) {
+			return
+		}
+
+		export, err := database.GetLatestDataExport(pool, userID)
+		if err != nil && !errors.Is(err, database.ErrDataExportNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения выгрузки данных"})
+			return
+		}
+
+		switch {
+		case export == nil, export.Status == database.ExportStatusFailed, export.Status == database.ExportStatusExpired:
+			startDataExport(c, userID)
+		case export.Status == database.ExportStatusReady && export.ExpiresAt != nil && export.ExpiresAt.After(time.Now()):
+			c.FileAttachment(export.FilePath, fmt.Sprintf("personal-data-%s.zip", export.CreatedAt.Format("2006-01-02")))
+		case export.Status == database.ExportStatusReady:
+			startDataExport(c, userID)
+		default:
+			c.JSON(http.StatusAccepted, gin.H{
+				"message": "Архив готовится, по готовности придёт уведомление",
+				"export":  export,
+			})
+		}
+	})
+
+	// Новая выгрузка по запросу, например если данные изменились после прошлой
+	sessionRoutes.POST("/users/:id/export", func(c *gin.Context) {
+		userID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный ID пользователя"})
+			return
+		}
+		if !requireSelfOrPermission(c, pool, userID, database.PermissionUsersData) {
+			return
+		}
+
+		export, err := database.GetLatestDataExport(pool, userID)
+		if err != nil && !errors.Is(err, database.ErrDataExportNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения выгрузки данных"})
+			return
+		}
+		if export != nil && (export.Status == database.ExportStatusPending || export.Status == database.ExportStatusRunning) {
+			c.JSON(http.StatusAccepted, gin.H{
+				"message": "Архив уже готовится, по готовности придёт уведомление",
+				"export":  export,
+			})
+			return
+		}
+		startDataExport(c, userID)
+	})
+
 	if err := r.Run("localhost:8080"); err != nil {
 		log.Fatalf("Ошибка при запуске сервера: %v", err)
 	}
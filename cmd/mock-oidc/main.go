@@ -0,0 +1,38 @@
+// Локальный OpenID-провайдер для проверки входа через SSO без настоящего провайдера.
+//
+//	go run ./cmd/mock-oidc -email user@example.com
+//
+// В .env приложения: OIDC_ISSUER=http://localhost:9400, OIDC_CLIENT_ID=personal-finance.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:9400", "адрес, на котором слушает провайдер")
+	clientID := flag.String("client-id", "personal-finance", "идентификатор клиента")
+	subject := flag.String("subject", "mock-user-1", "идентификатор пользователя у провайдера (sub)")
+	email := flag.String("email", "user@example.com", "email пользователя")
+	name := flag.String("name", "Тестовый пользователь", "имя пользователя")
+	unverified := flag.Bool("unverified", false, "выдавать email_verified=false")
+	flag.Parse()
+
+	issuer, err := oidctest.NewIssuer(*clientID, oidctest.Identity{
+		Subject:       *subject,
+		Email:         *email,
+		EmailVerified: !*unverified,
+		Name:          *name,
+	})
+	if err != nil {
+		log.Fatalf("Ошибка создания провайдера: %v", err)
+	}
+	issuer.URL = "http://" + *addr
+
+	log.Printf("OIDC-провайдер запущен: %s (вход от имени %s)", issuer.URL, *email)
+	log.Fatal(http.ListenAndServe(*addr, issuer))
+}
@@ -0,0 +1,179 @@
+// Package attachments принимает файлы, приложенные к транзакциям, и хранит их в blobstore:
+// проверяет тип и размер, делает миниатюры изображений и удаляет файлы удалённых вложений.
+package attachments
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/blobstore"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/database"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// MaxSize — предельный размер одного файла
+const MaxSize = 10 << 20
+
+// maxFileNameLength ограничивает длину сохраняемого имени файла в символах
+const maxFileNameLength = 200
+
+// deletionBatch — сколько файлов удаляется из хранилища за один запрос к очереди
+const deletionBatch = 100
+
+var (
+	ErrEmpty           = errors.New("файл пустой")
+	ErrTooLarge        = fmt.Errorf("файл больше %d МБ", MaxSize>>20)
+	ErrUnsupportedType = errors.New("можно приложить изображение JPEG, PNG, GIF или WebP либо документ PDF")
+	ErrInvalidImage    = errors.New("не удалось прочитать изображение")
+)
+
+// allowedTypes — допустимые типы содержимого и расширения для ключей в хранилище
+var allowedTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+// thumbnailTypes — изображения, которые умеет декодировать стандартная библиотека
+var thumbnailTypes = map[string]bool{"image/jpeg": true, "image/png": true, "image/gif": true}
+
+// DetectType определяет тип файла по содержимому: заголовку Content-Type от клиента не доверяем
+func DetectType(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if _, ok := allowedTypes[contentType]; !ok {
+		return "", ErrUnsupportedType
+	}
+	return contentType, nil
+}
+
+// cleanFileName оставляет от присланного имени только само имя файла без пути и управляющих символов
+func cleanFileName(name, extension string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" || name == "." || name == ".." || name == "/" {
+		name = "attachment" + extension
+	}
+	if utf8.RuneCountInString(name) > maxFileNameLength {
+		name = string([]rune(name)[:maxFileNameLength])
+	}
+	return name
+}
+
+// newKey возвращает ключ файла в хранилище; случайная часть не даёт угадать ключ чужого вложения
+func newKey(userID int, extension string) (string, error) {
+	suffix := make([]byte, 16)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("ошибка генерации имени файла: %v", err)
+	}
+	return fmt.Sprintf("attachments/%d/%s%s", userID, hex.EncodeToString(suffix), extension), nil
+}
+
+// Upload проверяет файл, сохраняет его и миниатюру в хранилище и прикладывает к транзакции пользователя.
+// Если описание сохранить не удалось, загруженные файлы удаляются.
+func Upload(pool *pgxpool.Pool, store blobstore.Store, userID, transactionID int, fileName string, data []byte) (*models.Attachment, error) {
+	if len(data) == 0 {
+		return nil, ErrEmpty
+	}
+	if len(data) > MaxSize {
+		return nil, ErrTooLarge
+	}
+	contentType, err := DetectType(data)
+	if err != nil {
+		return nil, err
+	}
+	extension := allowedTypes[contentType]
+
+	var thumbnail []byte
+	if thumbnailTypes[contentType] {
+		if thumbnail, err = makeThumbnail(data); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+		}
+	}
+
+	key, err := newKey(userID, extension)
+	if err != nil {
+		return nil, err
+	}
+	attachment := &models.Attachment{
+		UserID:        userID,
+		TransactionID: &transactionID,
+		FileName:      cleanFileName(fileName, extension),
+		ContentType:   contentType,
+		Size:          int64(len(data)),
+		StorageKey:    key,
+	}
+
+	ctx := context.Background()
+	if err := store.Put(ctx, key, data, contentType); err != nil {
+		return nil, err
+	}
+	uploaded := []string{key}
+	if thumbnail != nil {
+		thumbnailKey := strings.TrimSuffix(key, extension) + ".thumb.jpg"
+		if err := store.Put(ctx, thumbnailKey, thumbnail, "image/jpeg"); err != nil {
+			discard(store, uploaded)
+			return nil, err
+		}
+		uploaded = append(uploaded, thumbnailKey)
+		attachment.ThumbnailKey = &thumbnailKey
+	}
+
+	if err := database.CreateAttachment(pool, attachment); err != nil {
+		discard(store, uploaded)
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// discard удаляет файлы, загруженные для вложения, которое так и не было сохранено
+func discard(store blobstore.Store, keys []string) {
+	for _, key := range keys {
+		if err := store.Delete(context.Background(), key); err != nil {
+			log.Printf("Ошибка удаления несохранённого вложения %s: %v", key, err)
+		}
+	}
+}
+
+// RemoveDeleted удаляет из хранилища файлы вложений, записи которых удалены: вместе с транзакцией,
+// по запросу пользователя или при удалении аккаунта. Файл, который не удалось удалить,
+// остаётся в очереди до следующего запуска.
+func RemoveDeleted(pool *pgxpool.Pool, store blobstore.Store) {
+	for {
+		keys, err := database.GetBlobDeletions(pool, deletionBatch)
+		if err != nil {
+			log.Printf("Ошибка очистки хранилища файлов: %v", err)
+			return
+		}
+		failed := false
+		for _, key := range keys {
+			if err := store.Delete(context.Background(), key); err != nil {
+				log.Printf("Ошибка удаления файла %s из хранилища: %v", key, err)
+				failed = true
+				continue
+			}
+			if err := database.CompleteBlobDeletion(pool, key); err != nil {
+				log.Printf("Ошибка очистки хранилища файлов: %v", err)
+				return
+			}
+		}
+		if failed || len(keys) < deletionBatch {
+			return
+		}
+	}
+}
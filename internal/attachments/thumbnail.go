@@ -0,0 +1,82 @@
+package attachments
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+)
+
+const (
+	// thumbnailSize — наибольшая сторона миниатюры в пикселях
+	thumbnailSize = 320
+	// maxImagePixels не даёт распаковать в память изображение огромного разрешения,
+	// которое при малом размере файла заняло бы гигабайты
+	maxImagePixels = 40_000_000
+	// maxSamples — сколько пикселей исходника по каждой оси усредняется в один пиксель миниатюры
+	maxSamples = 4
+)
+
+// makeThumbnail уменьшает изображение JPEG, PNG или GIF до thumbnailSize по большей стороне
+// и возвращает его в JPEG. Прозрачные области заливаются белым.
+func makeThumbnail(data []byte) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать изображение: %v", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxImagePixels {
+		return nil, fmt.Errorf("изображение %dx%d слишком большое", config.Width, config.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать изображение: %v", err)
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	thumbWidth, thumbHeight := width, height
+	if width > thumbnailSize || height > thumbnailSize {
+		if width >= height {
+			thumbWidth, thumbHeight = thumbnailSize, max(1, height*thumbnailSize/width)
+		} else {
+			thumbWidth, thumbHeight = max(1, width*thumbnailSize/height), thumbnailSize
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	for y := 0; y < thumbHeight; y++ {
+		y0, y1 := bounds.Min.Y+y*height/thumbHeight, bounds.Min.Y+(y+1)*height/thumbHeight
+		for x := 0; x < thumbWidth; x++ {
+			x0, x1 := bounds.Min.X+x*width/thumbWidth, bounds.Min.X+(x+1)*width/thumbWidth
+			dst.Set(x, y, averageColor(src, x0, max(x1, x0+1), y0, max(y1, y0+1)))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, fmt.Errorf("ошибка создания миниатюры: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// averageColor усредняет не больше maxSamples×maxSamples равномерно расположенных пикселей
+// прямоугольника [x0, x1) × [y0, y1), накладывая их на белый фон
+func averageColor(src image.Image, x0, x1, y0, y1 int) color.RGBA {
+	stepX, stepY := max(1, (x1-x0)/maxSamples), max(1, (y1-y0)/maxSamples)
+	var r, g, b, n uint64
+	for y := y0; y < y1; y += stepY {
+		for x := x0; x < x1; x += stepX {
+			// RGBA возвращает цвет, уже умноженный на прозрачность
+			cr, cg, cb, ca := src.At(x, y).RGBA()
+			white := uint64(0xffff - ca)
+			r += uint64(cr) + white
+			g += uint64(cg) + white
+			b += uint64(cb) + white
+			n++
+		}
+	}
+	return color.RGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(b / n >> 8), A: 0xff}
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/database"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/mail"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// AccountDeletionGracePeriod — сколько аккаунт ждёт удаления; за это время удаление можно отменить
+const AccountDeletionGracePeriod = 14 * 24 * time.Hour
+
+var (
+	ErrUnknownFamilyAction      = errors.New("неизвестное действие с семейными аккаунтами")
+	ErrTransferTargetNotMember  = errors.New("новый владелец должен состоять в вашем семейном аккаунте")
+	ErrLastAdminCannotBeDeleted = errors.New("нельзя удалить аккаунт последнего администратора")
+)
+
+// checkAccountDeletion проверяет параметры удаления и возвращает действие с семейными аккаунтами
+func checkAccountDeletion(pool *pgxpool.Pool, userID int, familyAction string, transferTo *int) (string, error) {
+	if familyAction == "" {
+		familyAction = database.FamilyActionTransfer
+	}
+	if familyAction != database.FamilyActionTransfer && familyAction != database.FamilyActionDissolve {
+		return "", ErrUnknownFamilyAction
+	}
+	if transferTo != nil {
+		member, err := database.IsMemberOfOwnedFamily(pool, userID, *transferTo)
+		if err != nil {
+			return "", err
+		}
+		if !member {
+			return "", ErrTransferTargetNotMember
+		}
+	}
+
+	lastAdmin, err := database.IsLastAdmin(pool, userID)
+	if err != nil {
+		return "", err
+	}
+	if lastAdmin {
+		return "", ErrLastAdminCannotBeDeleted
+	}
+	return familyAction, nil
+}
+
+// ScheduleAccountDeletion планирует удаление аккаунта и сообщает об этом владельцу
+func ScheduleAccountDeletion(pool *pgxpool.Pool, sender mail.Sender, user *models.User, familyAction string, transferTo *int, requestedBy int) (*models.AccountDeletion, error) {
+	familyAction, err := checkAccountDeletion(pool, user.ID, familyAction, transferTo)
+	if err != nil {
+		return nil, err
+	}
+
+	deletion := &models.AccountDeletion{
+		UserID:           user.ID,
+		RequestedBy:      &requestedBy,
+		ScheduledFor:     time.Now().Add(AccountDeletionGracePeriod),
+		FamilyAction:     familyAction,
+		TransferToUserID: transferTo,
+	}
+	if err := database.ScheduleAccountDeletion(pool, deletion); err != nil {
+		return nil, err
+	}
+
+	err = sender.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Удаление аккаунта",
+		Body: fmt.Sprintf("Здравствуйте, %s!\n\n"+
+			"Ваш аккаунт и все данные будут удалены %s.\n"+
+			"До этого момента удаление можно отменить в настройках профиля.\n"+
+			"Если вы не запрашивали удаление, войдите в аккаунт, отмените его и смените пароль.\n",
+			user.Name, deletion.ScheduledFor.Format("02.01.2006 15:04")),
+	})
+	if err != nil {
+		log.Printf("Ошибка отправки письма об удалении аккаунта пользователю %d: %v", user.ID, err)
+	}
+	return deletion, nil
+}
+
+// CancelAccountDeletion отменяет запланированное удаление аккаунта
+func CancelAccountDeletion(pool *pgxpool.Pool, sender mail.Sender, user *models.User) error {
+	if err := database.CancelAccountDeletion(pool, user.ID); err != nil {
+		return err
+	}
+
+	err := sender.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Удаление аккаунта отменено",
+		Body:    fmt.Sprintf("Здравствуйте, %s!\n\nУдаление вашего аккаунта отменено, все данные сохранены.\n", user.Name),
+	})
+	if err != nil {
+		log.Printf("Ошибка отправки письма об отмене удаления пользователю %d: %v", user.ID, err)
+	}
+	return nil
+}
+
+// DeleteAccountNow удаляет аккаунт без срока ожидания
+func DeleteAccountNow(pool *pgxpool.Pool, userID int, familyAction string, transferTo *int) error {
+	familyAction, err := checkAccountDeletion(pool, userID, familyAction, transferTo)
+	if err != nil {
+		return err
+	}
+	return purgeAccount(pool, userID, familyAction, transferTo)
+}
+
+// purgeAccount безвозвратно удаляет пользователя и все его данные
+func purgeAccount(pool *pgxpool.Pool, userID int, familyAction string, transferTo *int) error {
+	files, err := database.PurgeUser(pool, userID, familyAction, transferTo)
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Ошибка удаления архива %s: %v", path, err)
+		}
+	}
+	return nil
+}
+
+// PurgeDueAccounts удаляет аккаунты, срок ожидания удаления которых истёк
+func PurgeDueAccounts(pool *pgxpool.Pool) error {
+	deletions, err := database.GetDueAccountDeletions(pool)
+	if err != nil {
+		return err
+	}
+	for _, deletion := range deletions {
+		if err := purgeAccount(pool, deletion.UserID, deletion.FamilyAction, deletion.TransferToUserID); err != nil {
+			log.Printf("Ошибка удаления аккаунта пользователя %d: %v", deletion.UserID, err)
+			continue
+		}
+		log.Printf("Аккаунт пользователя %d удалён", deletion.UserID)
+	}
+	return nil
+}
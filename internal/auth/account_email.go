@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/database"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/mail"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/passwords"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// Сроки действия ссылок из писем
+const (
+	EmailVerificationTTL = 48 * time.Hour
+	PasswordResetTTL     = time.Hour
+)
+
+var ErrEmptyPassword = errors.New("пароль не может быть пустым")
+
+// appLink строит ссылку на страницу фронтенда с токеном в параметре
+func appLink(path, token string) string {
+	base := strings.TrimRight(os.Getenv("APP_BASE_URL"), "/")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	return base + path + "?token=" + url.QueryEscape(token)
+}
+
+// issueUserToken создаёт одноразовый токен указанного назначения
+func issueUserToken(pool *pgxpool.Pool, userID int, purpose string, ttl time.Duration) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if err := database.CreateUserToken(pool, userID, purpose, HashToken(token), time.Now().Add(ttl)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// SendEmailVerification отправляет пользователю ссылку для подтверждения email
+func SendEmailVerification(pool *pgxpool.Pool, sender mail.Sender, user *models.User) error {
+	token, err := issueUserToken(pool, user.ID, database.TokenPurposeEmailVerification, EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return sender.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Подтверждение email",
+		Body: fmt.Sprintf("Здравствуйте, %s!\n\n"+
+			"Чтобы подтвердить адрес электронной почты, перейдите по ссылке:\n%s\n\n"+
+			"Ссылка действует %d ч. Если вы не регистрировались, просто проигнорируйте это письмо.\n",
+			user.Name, appLink("/verify-email", token), int(EmailVerificationTTL.Hours())),
+	})
+}
+
+// VerifyEmail подтверждает email по токену из письма
+func VerifyEmail(pool *pgxpool.Pool, token string) (int, error) {
+	return database.VerifyEmailWithToken(pool, HashToken(token))
+}
+
+// RequestPasswordReset отправляет ссылку для сброса пароля и возвращает ID владельца email.
+// Для неизвестного email ничего не делает и возвращает 0, чтобы ответ не выдавал существование аккаунта.
+func RequestPasswordReset(pool *pgxpool.Pool, sender mail.Sender, email string) (int, error) {
+	user, err := database.GetUserByEmail(pool, email)
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	token, err := issueUserToken(pool, user.ID, database.TokenPurposePasswordReset, PasswordResetTTL)
+	if err != nil {
+		return user.ID, err
+	}
+
+	return user.ID, sender.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Сброс пароля",
+		Body: fmt.Sprintf("Здравствуйте, %s!\n\n"+
+			"Для вашего аккаунта запрошен сброс пароля. Чтобы задать новый пароль, перейдите по ссылке:\n%s\n\n"+
+			"Ссылка действует %d мин и может быть использована один раз. "+
+			"Если вы не запрашивали сброс, просто проигнорируйте это письмо.\n",
+			user.Name, appLink("/reset-password", token), int(PasswordResetTTL.Minutes())),
+	})
+}
+
+// ResetPassword задаёт новый пароль по токену из письма и завершает все сессии пользователя
+func ResetPassword(pool *pgxpool.Pool, token, newPassword string) (int, error) {
+	if newPassword == "" {
+		return 0, ErrEmptyPassword
+	}
+	if err := passwords.Validate(newPassword); err != nil {
+		return 0, err
+	}
+
+	hashedPassword, err := passwords.Hash(newPassword)
+	if err != nil {
+		return 0, err
+	}
+
+	return database.ResetPasswordWithToken(pool, HashToken(token), hashedPassword)
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/database"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// APITokenPrefix отличает персональные токены от токенов доступа сессий
+const APITokenPrefix = "pfa_"
+
+// Группы данных, к которым выдаются права токенам; у каждой есть права :read и :write
+var scopeResources = []string{
+	"accounts",
+	"budgets",
+	"categories",
+	"dashboard",
+	"goals",
+	"notifications",
+	"reminders",
+	"settings",
+	"transactions",
+}
+
+var (
+	ErrEmptyTokenName = errors.New("укажите название токена")
+	ErrNoScopes       = errors.New("укажите хотя бы одно право доступа")
+	ErrUnknownScope   = errors.New("неизвестное право доступа")
+)
+
+// AvailableScopes возвращает все права, которые можно выдать токену
+func AvailableScopes() []string {
+	scopes := make([]string, 0, len(scopeResources)*2)
+	for _, resource := range scopeResources {
+		scopes = append(scopes, resource+":read", resource+":write")
+	}
+	return scopes
+}
+
+// normalizeScopes проверяет права и убирает повторы
+func normalizeScopes(scopes []string) ([]string, error) {
+	known := make(map[string]bool)
+	for _, scope := range AvailableScopes() {
+		known[scope] = true
+	}
+
+	seen := make(map[string]bool)
+	var result []string
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !known[scope] {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownScope, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	if len(result) == 0 {
+		return nil, ErrNoScopes
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// CreateAPIToken выпускает персональный токен. Сам токен возвращается только здесь, в базе хранится его хеш.
+// Нулевой expiresIn означает бессрочный токен.
+func CreateAPIToken(pool *pgxpool.Pool, userID int, name string, scopes []string, expiresIn time.Duration) (string, *models.APIToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, ErrEmptyTokenName
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	token := APITokenPrefix + secret
+
+	apiToken := &models.APIToken{
+		UserID: userID,
+		Name:   name,
+		Prefix: token[:len(APITokenPrefix)+6],
+		Scopes: scopes,
+	}
+	if expiresIn > 0 {
+		expiresAt := time.Now().Add(expiresIn)
+		apiToken.ExpiresAt = &expiresAt
+	}
+
+	if err := database.CreateAPIToken(pool, apiToken, HashToken(token)); err != nil {
+		return "", nil, err
+	}
+	return token, apiToken, nil
+}
+
+// IsAPIToken сообщает, является ли строка персональным токеном
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// CurrentScopes возвращает права персонального токена; nil — запрос выполнен из сессии
+func CurrentScopes(c *gin.Context) []string {
+	value, ok := c.Get(scopesContextKey)
+	if !ok {
+		return nil
+	}
+	scopes, _ := value.([]string)
+	return scopes
+}
+
+// hasScope сообщает, выдано ли текущему запросу право scope
+func hasScope(c *gin.Context, scope string) bool {
+	if _, ok := c.Get(scopesContextKey); !ok {
+		return true
+	}
+	for _, granted := range CurrentScopes(c) {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope проверяет права персонального токена на группу данных resource:
+// чтение требует resource:read, изменение — resource:write. Сессии имеют полный доступ.
+func RequireScope(resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := resource + ":write"
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			scope = resource + ":read"
+		}
+
+		if !hasScope(c, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Недостаточно прав у токена",
+				"scope": scope,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSession пропускает только запросы из интерактивной сессии, но не по персональному токену
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get(scopesContextKey); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Действие недоступно для персональных токенов"})
+			return
+		}
+		c.Next()
+	}
+}
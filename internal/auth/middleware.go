@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/database"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// Ключи, под которыми данные аутентификации хранятся в контексте gin
+const (
+	userContextKey    = "auth_user"
+	sessionContextKey = "auth_session_id"
+	scopesContextKey  = "auth_scopes"
+)
+
+// bearerToken извлекает токен из заголовка Authorization
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
+
+// Middleware проверяет токен доступа сессии или персональный токен и кладёт пользователя в контекст запроса
+func Middleware(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := bearerToken(c)
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Требуется авторизация"})
+			return
+		}
+
+		if IsAPIToken(token) {
+			authenticateAPIToken(c, pool, token)
+			return
+		}
+
+		claims, err := ParseAccessToken(token)
+		if err != nil {
+			if errors.Is(err, ErrExpiredToken) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Срок действия токена истёк"})
+				return
+			}
+			log.Printf("Отклонён токен доступа: %v", err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Недействительный токен"})
+			return
+		}
+
+		if _, err := database.GetActiveSession(pool, claims.SessionID, claims.UserID); err != nil {
+			if !errors.Is(err, database.ErrSessionNotFound) {
+				log.Printf("Ошибка проверки сессии %d: %v", claims.SessionID, err)
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Сессия завершена"})
+			return
+		}
+
+		user, err := database.GetUserByID(pool, claims.UserID)
+		if err != nil {
+			log.Printf("Пользователь из токена не найден (ID %d): %v", claims.UserID, err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Недействительный токен"})
+			return
+		}
+
+		c.Set(userContextKey, user)
+		c.Set(sessionContextKey, claims.SessionID)
+		c.Next()
+	}
+}
+
+// authenticateAPIToken пропускает запрос по персональному токену с его набором прав
+func authenticateAPIToken(c *gin.Context, pool *pgxpool.Pool, token string) {
+	apiToken, err := database.GetActiveAPIToken(pool, HashToken(token))
+	if err != nil {
+		if !errors.Is(err, database.ErrAPITokenNotFound) {
+			log.Printf("Ошибка проверки персонального токена: %v", err)
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Недействительный токен"})
+		return
+	}
+
+	user, err := database.GetUserByID(pool, apiToken.UserID)
+	if err != nil {
+		log.Printf("Владелец персонального токена %d не найден: %v", apiToken.ID, err)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Недействительный токен"})
+		return
+	}
+
+	c.Set(userContextKey, user)
+	c.Set(scopesContextKey, apiToken.Scopes)
+	c.Next()
+}
+
+// CurrentUser возвращает аутентифицированного пользователя или nil
+func CurrentUser(c *gin.Context) *models.User {
+	value, ok := c.Get(userContextKey)
+	if !ok {
+		return nil
+	}
+	user, _ := value.(*models.User)
+	return user
+}
+
+// CurrentUserID возвращает ID аутентифицированного пользователя или 0
+func CurrentUserID(c *gin.Context) int {
+	if user := CurrentUser(c); user != nil {
+		return user.ID
+	}
+	return 0
+}
+
+// CurrentSessionID возвращает ID сессии, которой выдан токен текущего запроса
+func CurrentSessionID(c *gin.Context) int {
+	return c.GetInt(sessionContextKey)
+}
+
+// RequireVerifiedEmail пропускает только пользователей с подтверждённым email
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := CurrentUser(c)
+		if user == nil || !user.EmailVerified {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":          "Подтвердите email, чтобы продолжить",
+				"email_verified": false,
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/database"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/oidc"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// OIDCLoginTTL — сколько ждём возврата пользователя от провайдера
+const OIDCLoginTTL = 10 * time.Minute
+
+var ErrOIDCEmailNotVerified = errors.New("провайдер не подтвердил email, привязать аккаунт нельзя")
+
+// BeginOIDCLogin запоминает state, nonce и code_verifier и возвращает адрес страницы входа провайдера
+func BeginOIDCLogin(pool *pgxpool.Pool, provider *oidc.Provider) (string, error) {
+	var values [3]string
+	for i := range values {
+		value, err := oidc.RandomString()
+		if err != nil {
+			return "", err
+		}
+		values[i] = value
+	}
+	state, nonce, codeVerifier := values[0], values[1], values[2]
+
+	if err := database.CreateOIDCLoginState(pool, HashToken(state), nonce, codeVerifier, time.Now().Add(OIDCLoginTTL)); err != nil {
+		return "", err
+	}
+	return provider.AuthCodeURL(context.Background(), state, nonce, codeVerifier)
+}
+
+// CompleteOIDCLogin обменивает код провайдера и возвращает пользователя: привязанного ранее,
+// найденного по подтверждённому email или созданного заново
+func CompleteOIDCLogin(pool *pgxpool.Pool, provider *oidc.Provider, code, state string, t time.Time) (*models.User, error) {
+	nonce, codeVerifier, err := database.ConsumeOIDCLoginState(pool, HashToken(state))
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := provider.Exchange(context.Background(), code, codeVerifier, nonce, t)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := database.GetUserIDByIdentity(pool, provider.Issuer(), claims.Subject)
+	if err == nil {
+		return database.GetUserByID(pool, userID)
+	}
+	if !errors.Is(err, database.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	// Без подтверждения email провайдером по нему нельзя ни привязать, ни создать аккаунт
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrOIDCEmailNotVerified
+	}
+
+	user, err := database.GetUserByEmail(pool, claims.Email)
+	if err == nil {
+		if err := database.LinkIdentity(pool, user.ID, provider.Issuer(), claims.Subject, claims.Email); err != nil {
+			return nil, err
+		}
+		user.EmailVerified = true
+		return user, nil
+	}
+	if !errors.Is(err, database.ErrUserNotFound) {
+		return nil, err
+	}
+
+	user = &models.User{Name: strings.TrimSpace(claims.Name), Email: claims.Email}
+	if user.Name == "" {
+		user.Name = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	if err := database.ProvisionOIDCUser(pool, user, provider.Issuer(), claims.Subject); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
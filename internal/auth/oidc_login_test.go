@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/database"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/oidc"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/oidc/oidctest"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+func startOIDCIssuer(t *testing.T, identity oidctest.Identity) (*oidctest.Issuer, *oidc.Provider) {
+	t.Helper()
+	issuer, err := oidctest.NewIssuer("finance-test", identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := issuer.Start()
+	t.Cleanup(server.Close)
+
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:      issuer.URL,
+		ClientID:    "finance-test",
+		RedirectURL: "http://app.example/oidc/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+	}, server.Client())
+	return issuer, provider
+}
+
+// oidcLogin проходит вход целиком: начало на нашей стороне, страница провайдера и обработка возврата
+func oidcLogin(t *testing.T, pool *pgxpool.Pool, provider *oidc.Provider) (*models.User, string, string, error) {
+	t.Helper()
+	authURL, err := BeginOIDCLogin(pool, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("страница входа: %d, %v", resp.StatusCode, err)
+	}
+
+	code, state := location.Query().Get("code"), location.Query().Get("state")
+	user, err := CompleteOIDCLogin(pool, provider, code, state, time.Now())
+	return user, code, state, err
+}
+
+func TestOIDCLoginLinksVerifiedEmail(t *testing.T) {
+	pool := testPool(t)
+	existing := testUser(t, pool)
+	subject := fmt.Sprintf("linked-%d", time.Now().UnixNano())
+
+	// Провайдер не подтвердил email — привязывать по нему нельзя
+	issuer, provider := startOIDCIssuer(t, oidctest.Identity{Subject: subject, Email: existing.Email})
+	if _, _, _, err := oidcLogin(t, pool, provider); !errors.Is(err, ErrOIDCEmailNotVerified) {
+		t.Fatalf("неподтверждённый email: %v", err)
+	}
+
+	// Подтверждённый email находит аккаунт без учёта регистра и привязывает к нему провайдера
+	issuer.SetIdentity(oidctest.Identity{Subject: subject, Email: strings.ToUpper(existing.Email), EmailVerified: true})
+	user, code, state, err := oidcLogin(t, pool, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != existing.ID || !user.EmailVerified {
+		t.Errorf("вошли как %d (verified=%v), ожидался %d", user.ID, user.EmailVerified, existing.ID)
+	}
+
+	// state одноразовый
+	if _, err := CompleteOIDCLogin(pool, provider, code, state, time.Now()); !errors.Is(err, database.ErrOIDCStateInvalid) {
+		t.Errorf("повтор state: %v", err)
+	}
+
+	// Дальше аккаунт находится по привязке, даже если email у провайдера сменился
+	issuer.SetIdentity(oidctest.Identity{Subject: subject, Email: "renamed@example.com"})
+	user, _, _, err = oidcLogin(t, pool, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != existing.ID {
+		t.Errorf("по привязке вошли как %d, ожидался %d", user.ID, existing.ID)
+	}
+}
+
+func TestOIDCLoginProvisionsNewUser(t *testing.T) {
+	pool := testPool(t)
+	identity := oidctest.Identity{
+		Subject:       fmt.Sprintf("new-%d", time.Now().UnixNano()),
+		Email:         fmt.Sprintf("oidc-new-%d@example.com", time.Now().UnixNano()),
+		EmailVerified: true,
+		Name:          "  Новый Пользователь ",
+	}
+	_, provider := startOIDCIssuer(t, identity)
+
+	user, _, _, err := oidcLogin(t, pool, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := database.PurgeUser(pool, user.ID, database.FamilyActionDissolve, nil); err != nil {
+			t.Logf("ошибка удаления тестового пользователя: %v", err)
+		}
+	})
+	if user.ID == 0 || user.Email != identity.Email || user.Name != "Новый Пользователь" {
+		t.Errorf("создан пользователь %+v", user)
+	}
+
+	stored, err := database.GetUserByEmail(pool, identity.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ID != user.ID || !stored.EmailVerified || stored.IsAdmin {
+		t.Errorf("в базе %+v", stored)
+	}
+
+	// Повторный вход не создаёт второго пользователя
+	again, _, _, err := oidcLogin(t, pool, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != user.ID {
+		t.Errorf("повторный вход как %d, ожидался %d", again.ID, user.ID)
+	}
+}
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/database"
+)
+
+const permissionsContextKey = "auth_permissions"
+
+// currentPermissions загружает права текущего пользователя один раз за запрос
+func currentPermissions(c *gin.Context, pool *pgxpool.Pool) (map[string]bool, error) {
+	if value, ok := c.Get(permissionsContextKey); ok {
+		return value.(map[string]bool), nil
+	}
+
+	permissions, err := database.GetUserPermissions(pool, CurrentUserID(c))
+	if err != nil {
+		return nil, err
+	}
+	granted := make(map[string]bool, len(permissions))
+	for _, permission := range permissions {
+		granted[permission] = true
+	}
+	c.Set(permissionsContextKey, granted)
+	return granted, nil
+}
+
+// HasPermission сообщает, есть ли у текущего пользователя право permission
+func HasPermission(c *gin.Context, pool *pgxpool.Pool, permission string) (bool, error) {
+	if CurrentUser(c) == nil {
+		return false, nil
+	}
+	granted, err := currentPermissions(c, pool)
+	if err != nil {
+		return false, err
+	}
+	return granted[permission], nil
+}
+
+// RequirePermission пропускает только пользователей, чьи роли дают право permission
+func RequirePermission(pool *pgxpool.Pool, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, err := HasPermission(c, pool, permission)
+		if err != nil {
+			log.Printf("Ошибка проверки права %s: %v", permission, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Ошибка проверки прав доступа"})
+			return
+		}
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Недостаточно прав"})
+			return
+		}
+		c.Next()
+	}
+}
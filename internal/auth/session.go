@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/database"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// RefreshTokenTTL — время жизни refresh-токена; продлевается при каждой ротации
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+// TokenPair — токены, выдаваемые клиенту после входа или обновления
+type TokenPair struct {
+	AccessToken           string    `json:"access_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+	TokenType             string    `json:"token_type"`
+	SessionID             int       `json:"session_id"`
+}
+
+// randomToken возвращает криптостойкую случайную строку из size байт
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("ошибка генерации токена: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken возвращает хеш токена для хранения в базе данных
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func issuePair(user *models.User, session *models.Session, refreshToken string) (*TokenPair, error) {
+	accessToken, accessExpiresAt, err := IssueAccessToken(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessExpiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: session.ExpiresAt,
+		TokenType:             "Bearer",
+		SessionID:             session.ID,
+	}, nil
+}
+
+// StartSession открывает сессию для устройства и выдаёт первую пару токенов
+func StartSession(pool *pgxpool.Pool, user *models.User, device, ipAddress string) (*TokenPair, error) {
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &models.Session{
+		UserID:    user.ID,
+		Device:    device,
+		IPAddress: ipAddress,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}
+	if err := database.CreateSession(pool, session, HashToken(refreshToken)); err != nil {
+		return nil, err
+	}
+
+	return issuePair(user, session, refreshToken)
+}
+
+// RefreshSession обменивает refresh-токен на новую пару токенов той же сессии
+func RefreshSession(pool *pgxpool.Pool, refreshToken, ipAddress string) (*TokenPair, error) {
+	newRefreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := database.RotateSessionToken(pool, HashToken(refreshToken), HashToken(newRefreshToken), ipAddress, time.Now().Add(RefreshTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := database.GetUserByID(pool, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return issuePair(user, session, newRefreshToken)
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/database"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// throttlePolicy описывает реакцию на серию неудачных входов
+type throttlePolicy struct {
+	freeAttempts    int           // ошибок без задержки
+	baseDelay       time.Duration // задержка после первой «платной» ошибки, дальше удваивается
+	maxDelay        time.Duration
+	lockoutAfter    int // после стольких ошибок вход блокируется целиком
+	lockoutDuration time.Duration
+	window          time.Duration // через столько после последней ошибки счёт начинается заново
+}
+
+var (
+	accountThrottle = throttlePolicy{
+		freeAttempts:    3,
+		baseDelay:       time.Second,
+		maxDelay:        5 * time.Minute,
+		lockoutAfter:    10,
+		lockoutDuration: 30 * time.Minute,
+		window:          24 * time.Hour,
+	}
+	// С одного адреса могут входить несколько человек, поэтому пороги выше
+	ipThrottle = throttlePolicy{
+		freeAttempts:    10,
+		baseDelay:       time.Second,
+		maxDelay:        5 * time.Minute,
+		lockoutAfter:    50,
+		lockoutDuration: time.Hour,
+		window:          24 * time.Hour,
+	}
+)
+
+// delayFor возвращает задержку после failures-й ошибки подряд и признак полной блокировки
+func (p throttlePolicy) delayFor(failures int) (time.Duration, bool) {
+	if failures >= p.lockoutAfter {
+		return p.lockoutDuration, true
+	}
+	if failures <= p.freeAttempts {
+		return 0, false
+	}
+
+	delay := p.baseDelay
+	for i := p.freeAttempts + 1; i < failures && delay < p.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+	return delay, false
+}
+
+// NormalizeEmail приводит email к виду, по которому ведётся учёт попыток входа
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// LoginRetryAfter возвращает, сколько ещё нужно ждать перед очередной попыткой входа
+func LoginRetryAfter(pool *pgxpool.Pool, email, ip string) (time.Duration, error) {
+	var wait time.Duration
+	for _, lock := range []database.LoginLock{
+		{Scope: database.ThrottleScopeAccount, Key: NormalizeEmail(email)},
+		{Scope: database.ThrottleScopeIP, Key: ip},
+	} {
+		lockedUntil, err := database.GetLoginLockedUntil(pool, lock.Scope, lock.Key)
+		if err != nil {
+			return 0, err
+		}
+		if remaining := time.Until(lockedUntil); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait, nil
+}
+
+// RegisterLoginFailure учитывает неудачный вход по аккаунту и по IP.
+// Счёт ведётся по введённому email, существует аккаунт или нет, чтобы поведение не выдавало его наличие.
+// Возвращает true, если эта ошибка привела к полной блокировке входа в аккаунт.
+func RegisterLoginFailure(pool *pgxpool.Pool, email, ip string) (bool, error) {
+	email = NormalizeEmail(email)
+
+	failures, err := database.RecordLoginFailure(pool, database.ThrottleScopeAccount, email, accountThrottle.window)
+	if err != nil {
+		return false, err
+	}
+	delay, accountLocked := accountThrottle.delayFor(failures)
+	if delay > 0 {
+		until := time.Now().Add(delay)
+		if err := database.LockLogin(pool, database.ThrottleScopeAccount, email, until, accountLocked); err != nil {
+			return false, err
+		}
+		if accountLocked {
+			log.Printf("Вход в аккаунт заблокирован после %d неудачных попыток", failures)
+			notifyAccountOwner(pool, email, fmt.Sprintf(
+				"Зафиксировано %d неудачных попыток входа в ваш аккаунт. Вход временно заблокирован до %s. "+
+					"Если это были не вы, смените пароль.", failures, until.Format("02.01.2006 15:04")))
+		}
+	}
+
+	failures, err = database.RecordLoginFailure(pool, database.ThrottleScopeIP, ip, ipThrottle.window)
+	if err != nil {
+		return accountLocked, err
+	}
+	if delay, lockout := ipThrottle.delayFor(failures); delay > 0 {
+		if lockout {
+			log.Printf("Вход с адреса %s заблокирован после %d неудачных попыток", ip, failures)
+		}
+		if err := database.LockLogin(pool, database.ThrottleScopeIP, ip, time.Now().Add(delay), lockout); err != nil {
+			return accountLocked, err
+		}
+	}
+	return accountLocked, nil
+}
+
+// RegisterLoginSuccess сбрасывает счётчик ошибок аккаунта после успешного входа
+func RegisterLoginSuccess(pool *pgxpool.Pool, email string) error {
+	return database.ResetLoginFailures(pool, database.ThrottleScopeAccount, NormalizeEmail(email))
+}
+
+// ReleaseExpiredLockouts снимает истёкшие блокировки и уведомляет владельцев аккаунтов
+func ReleaseExpiredLockouts(pool *pgxpool.Pool) error {
+	locks, err := database.ReleaseExpiredLockouts(pool)
+	if err != nil {
+		return err
+	}
+	for _, lock := range locks {
+		if lock.Scope == database.ThrottleScopeAccount {
+			notifyAccountOwner(pool, lock.Key, "Временная блокировка входа в ваш аккаунт снята.")
+		}
+	}
+	return nil
+}
+
+// notifyAccountOwner создаёт уведомление владельцу email, если такой аккаунт есть
+func notifyAccountOwner(pool *pgxpool.Pool, email, message string) {
+	user, err := database.GetUserByEmail(pool, email)
+	if err != nil {
+		if !errors.Is(err, database.ErrUserNotFound) {
+			log.Printf("Ошибка поиска владельца аккаунта для уведомления: %v", err)
+		}
+		return
+	}
+
+	notification := models.Notification{
+		UserID:   user.ID,
+		Message:  message,
+		DateWhen: time.Now(),
+	}
+	if err := database.CreateNotification(pool, &notification); err != nil {
+		log.Printf("Ошибка создания уведомления о блокировке для пользователя %d: %v", user.ID, err)
+	}
+}
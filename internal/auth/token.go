@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// AccessTokenTTL — время жизни токена доступа; дальше клиент обновляет его refresh-токеном
+const AccessTokenTTL = 15 * time.Minute
+
+var (
+	ErrInvalidToken = errors.New("некорректный токен")
+	ErrExpiredToken = errors.New("срок действия токена истёк")
+)
+
+// Claims — полезная нагрузка токена доступа
+type Claims struct {
+	UserID    int   `json:"sub"`
+	SessionID int   `json:"sid"`
+	IsAdmin   bool  `json:"adm"`
+	IssuedAt  int64 `json:"iat"`
+	ExpiresAt int64 `json:"exp"`
+}
+
+// Заголовок токена неизменен: подписываем только HMAC-SHA256
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func secretKey() ([]byte, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return nil, errors.New("переменная окружения JWT_SECRET не задана")
+	}
+	return []byte(secret), nil
+}
+
+func sign(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// IssueAccessToken выпускает подписанный токен доступа для сессии пользователя
+func IssueAccessToken(user *models.User, sessionID int) (string, time.Time, error) {
+	secret, err := secretKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	issuedAt := time.Now()
+	expiresAt := issuedAt.Add(AccessTokenTTL)
+	claims := Claims{
+		UserID:    user.ID,
+		SessionID: sessionID,
+		IsAdmin:   user.IsAdmin,
+		IssuedAt:  issuedAt.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("ошибка сериализации токена: %v", err)
+	}
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + sign(secret, unsigned), expiresAt, nil
+}
+
+// ParseAccessToken проверяет подпись и срок действия токена и возвращает его содержимое
+func ParseAccessToken(token string) (*Claims, error) {
+	secret, err := secretKey()
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return nil, ErrInvalidToken
+	}
+
+	expected := sign(secret, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(expected), []byte(parts[2])) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.UserID <= 0 || claims.SessionID <= 0 {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+
+	return &claims, nil
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Секрет из приложения B RFC 6238 ("12345678901234567890") в base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Векторы RFC 6238 для SHA1; в RFC коды из 8 цифр, у нас — последние 6
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		code, err := TOTPCode(rfcSecret, time.Unix(v.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != v.code {
+			t.Errorf("TOTPCode(%d) = %s, ожидался %s", v.unix, code, v.code)
+		}
+
+		step, ok := ValidateTOTP(rfcSecret, v.code, time.Unix(v.unix, 0))
+		if !ok || step != v.unix/totpPeriod {
+			t.Errorf("ValidateTOTP(%d) = %d, %v", v.unix, step, ok)
+		}
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111109, 0) // шаг 37037036
+	code, err := TOTPCode(rfcSecret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		shift time.Duration
+		ok    bool
+	}{
+		{0, true},
+		{-totpPeriod * time.Second, true}, // часы сервера отстали на шаг
+		{totpPeriod * time.Second, true},  // часы сервера ушли вперёд на шаг
+		{-2 * totpPeriod * time.Second, false},
+		{2 * totpPeriod * time.Second, false},
+	}
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfcSecret, code, now.Add(tt.shift))
+		if ok != tt.ok {
+			t.Errorf("сдвиг %v: ok = %v, ожидалось %v", tt.shift, ok, tt.ok)
+		}
+		// Возвращается шаг, на котором код выдан, а не текущий: по нему запрещается повтор
+		if ok && step != TOTPStep(now) {
+			t.Errorf("сдвиг %v: шаг %d, ожидался %d", tt.shift, step, TOTPStep(now))
+		}
+	}
+}
+
+func TestValidateTOTPRejects(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	for _, code := range []string{"", "00592", "0059240", "005925", "abcdef"} {
+		if _, ok := ValidateTOTP(rfcSecret, code, now); ok {
+			t.Errorf("код %q принят", code)
+		}
+	}
+	if _, ok := ValidateTOTP("не base32!", "005924", now); ok {
+		t.Error("принят код для некорректного секрета")
+	}
+	// Пробелы вокруг кода и секрет в нижнем регистре с пробелами допустимы
+	if _, ok := ValidateTOTP(strings.ToLower("GEZD GNBV GY3T QOJQ GEZD GNBV GY3T QOJQ"), " 005924 ", now); !ok {
+		t.Error("не принят код для секрета в нижнем регистре")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := decodeTOTPSecret(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("секрет %q: %d байт, %v", secret, len(key), err)
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(TOTPProvisioningURI(rfcSecret, "user@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/"+TOTPIssuer+":user@example.com" {
+		t.Errorf("ссылка %s", uri)
+	}
+	query := uri.Query()
+	if query.Get("secret") != rfcSecret || query.Get("issuer") != TOTPIssuer ||
+		query.Get("digits") != "6" || query.Get("period") != "30" || query.Get("algorithm") != "SHA1" {
+		t.Errorf("параметры %v", query)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("кодов %d, хешей %d", len(codes), len(hashes))
+	}
+
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		if len(code) != 11 || code[5] != '-' || strings.Trim(strings.Replace(code, "-", "", 1), recoveryCodeChars) != "" {
+			t.Errorf("код %q не в формате xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("код %q повторяется", code)
+		}
+		seen[code] = true
+
+		// Хеш не зависит от регистра, дефиса и пробелов во введённом коде
+		typed := strings.ToUpper(code[:5] + " " + code[6:])
+		if HashToken(normalizeRecoveryCode(typed)) != hashes[i] {
+			t.Errorf("введённый %q не совпадает с кодом %q", typed, code)
+		}
+	}
+}
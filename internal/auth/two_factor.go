@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/database"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+const (
+	// LoginChallengeTTL — сколько ждём код второго фактора после верного пароля
+	LoginChallengeTTL = 5 * time.Minute
+	recoveryCodeCount = 10
+	// 32 символа без легко путаемых i, l, o — индекс берётся из младших 5 бит
+	recoveryCodeChars = "abcdefghjkmnpqrstuvwxyz023456789"
+)
+
+var ErrInvalidSecondFactor = errors.New("неверный код подтверждения")
+
+// normalizeRecoveryCode приводит введённый код к виду, в котором хранится его хеш
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// generateRecoveryCodes возвращает коды для показа пользователю и их хеши для хранения
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	buf := make([]byte, 10)
+	for i := 0; i < recoveryCodeCount; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, fmt.Errorf("ошибка генерации кодов восстановления: %v", err)
+		}
+		raw := make([]byte, len(buf))
+		for j, b := range buf {
+			raw[j] = recoveryCodeChars[b&31]
+		}
+		code := string(raw[:5]) + "-" + string(raw[5:])
+		codes = append(codes, code)
+		hashes = append(hashes, HashToken(normalizeRecoveryCode(code)))
+	}
+	return codes, hashes, nil
+}
+
+// BeginTOTPEnrollment создаёт секрет и ссылку для подключения приложения-аутентификатора
+func BeginTOTPEnrollment(pool *pgxpool.Pool, user *models.User) (string, string, error) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := database.SaveTOTPSecret(pool, user.ID, secret); err != nil {
+		return "", "", err
+	}
+	return secret, TOTPProvisioningURI(secret, user.Email), nil
+}
+
+// ConfirmTOTPEnrollment включает второй фактор по первому верному коду и выдаёт коды восстановления
+func ConfirmTOTPEnrollment(pool *pgxpool.Pool, userID int, code string, t time.Time) ([]string, error) {
+	totp, err := database.GetUserTOTP(pool, userID)
+	if err != nil {
+		return nil, err
+	}
+	if totp.Enabled {
+		return nil, database.ErrTOTPAlreadyEnabled
+	}
+
+	step, ok := ValidateTOTP(totp.Secret, code, t)
+	if !ok {
+		return nil, ErrInvalidSecondFactor
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := database.EnableTOTP(pool, userID, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifySecondFactor проверяет код из приложения или одноразовый код восстановления
+func VerifySecondFactor(pool *pgxpool.Pool, userID int, code, recoveryCode string, t time.Time) error {
+	if recoveryCode != "" {
+		ok, err := database.UseRecoveryCode(pool, userID, HashToken(normalizeRecoveryCode(recoveryCode)))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidSecondFactor
+		}
+		return nil
+	}
+
+	totp, err := database.GetUserTOTP(pool, userID)
+	if err != nil {
+		return err
+	}
+	if !totp.Enabled {
+		return database.ErrTOTPNotConfigured
+	}
+
+	step, ok := ValidateTOTP(totp.Secret, code, t)
+	if !ok {
+		return ErrInvalidSecondFactor
+	}
+	fresh, err := database.MarkTOTPStepUsed(pool, userID, step)
+	if err != nil {
+		return err
+	}
+	if !fresh {
+		return ErrInvalidSecondFactor
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes заменяет коды восстановления новым набором
+func RegenerateRecoveryCodes(pool *pgxpool.Pool, userID int) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := database.ReplaceRecoveryCodes(pool, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// StartLoginChallenge создаёт одноразовый идентификатор входа, ожидающего второго фактора
+func StartLoginChallenge(pool *pgxpool.Pool, userID int) (string, time.Time, error) {
+	challenge, err := randomToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(LoginChallengeTTL)
+	if err := database.CreateLoginChallenge(pool, userID, HashToken(challenge), expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+	return challenge, expiresAt, nil
+}
+
+// CompleteLoginChallenge проверяет второй фактор для незавершённого входа и возвращает ID пользователя.
+// При неверном коде ID тоже возвращается, чтобы попытку можно было записать в журнал владельца.
+func CompleteLoginChallenge(pool *pgxpool.Pool, challenge, code, recoveryCode string, t time.Time) (int, error) {
+	challengeHash := HashToken(challenge)
+
+	userID, err := database.GetLoginChallengeUserID(pool, challengeHash)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := VerifySecondFactor(pool, userID, code, recoveryCode, t); err != nil {
+		if errors.Is(err, ErrInvalidSecondFactor) {
+			if regErr := database.RegisterLoginChallengeFailure(pool, challengeHash); regErr != nil {
+				return 0, regErr
+			}
+			return userID, err
+		}
+		return 0, err
+	}
+
+	if err := database.DeleteLoginChallenge(pool, challengeHash); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
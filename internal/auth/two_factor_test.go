@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/database"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// testPool подключается к базе из TEST_DATABASE_URL со всеми миграциями.
+// Без переменной тесты, которым нужна база, пропускаются.
+func testPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL не задан")
+	}
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("ошибка подключения к базе: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// testUser регистрирует пользователя, которого тест удалит за собой
+func testUser(t *testing.T, pool *pgxpool.Pool) *models.User {
+	t.Helper()
+	user := &models.User{
+		Name:     "Тест",
+		Email:    fmt.Sprintf("auth-test-%d@example.com", time.Now().UnixNano()),
+		Password: "Correct-Horse-Battery-42",
+	}
+	if err := database.RegisterUser(pool, user); err != nil {
+		t.Fatalf("ошибка регистрации: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := database.PurgeUser(pool, user.ID, database.FamilyActionDissolve, nil); err != nil {
+			t.Logf("ошибка удаления тестового пользователя: %v", err)
+		}
+	})
+	return user
+}
+
+// enrollTOTP подключает второй фактор с часами, остановленными на now, и возвращает секрет и коды восстановления
+func enrollTOTP(t *testing.T, pool *pgxpool.Pool, user *models.User, now time.Time) (string, []string) {
+	t.Helper()
+	secret, _, err := BeginTOTPEnrollment(pool, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := ConfirmTOTPEnrollment(pool, user.ID, code, now)
+	if err != nil {
+		t.Fatalf("ошибка подтверждения TOTP: %v", err)
+	}
+	return secret, codes
+}
+
+func TestVerifySecondFactorTOTPSingleUse(t *testing.T) {
+	pool := testPool(t)
+	user := testUser(t, pool)
+	now := time.Unix(1700000000, 0)
+	secret, _ := enrollTOTP(t, pool, user, now)
+
+	verify := func(at time.Time, checkAt time.Time) error {
+		code, err := TOTPCode(secret, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return VerifySecondFactor(pool, user.ID, code, "", checkAt)
+	}
+
+	// Код, которым подтвердили подключение, для входа уже не годится
+	if err := verify(now, now); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Errorf("повтор кода подтверждения: %v", err)
+	}
+
+	next := now.Add(totpPeriod * time.Second)
+	if err := verify(next, next); err != nil {
+		t.Fatalf("код следующего шага: %v", err)
+	}
+	if err := verify(next, next); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Errorf("повтор кода: %v", err)
+	}
+
+	// Код из окна допуска, но не новее последнего использованного, тоже отклоняется
+	later := next.Add(totpPeriod * time.Second)
+	if err := verify(next, later); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Errorf("старый код в окне допуска: %v", err)
+	}
+	// А код шага, на который клиент отстаёт, принимается
+	muchLater := later.Add(totpPeriod * time.Second)
+	if err := verify(later, muchLater); err != nil {
+		t.Errorf("код отстающего клиента: %v", err)
+	}
+}
+
+func TestVerifySecondFactorRecoveryCodeSingleUse(t *testing.T) {
+	pool := testPool(t)
+	user := testUser(t, pool)
+	_, codes := enrollTOTP(t, pool, user, time.Unix(1700000000, 0))
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("кодов восстановления %d", len(codes))
+	}
+
+	if err := VerifySecondFactor(pool, user.ID, "", codes[0], time.Now()); err != nil {
+		t.Fatalf("код восстановления: %v", err)
+	}
+	if err := VerifySecondFactor(pool, user.ID, "", codes[0], time.Now()); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Errorf("повтор кода восстановления: %v", err)
+	}
+
+	// Код можно ввести без дефиса и в верхнем регистре
+	typed := strings.ToUpper(strings.ReplaceAll(codes[1], "-", ""))
+	if err := VerifySecondFactor(pool, user.ID, "", typed, time.Now()); err != nil {
+		t.Errorf("код в верхнем регистре: %v", err)
+	}
+
+	remaining, err := database.CountUnusedRecoveryCodes(pool, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != recoveryCodeCount-2 {
+		t.Errorf("осталось кодов %d, ожидалось %d", remaining, recoveryCodeCount-2)
+	}
+
+	// После перевыпуска старые коды больше не действуют
+	fresh, err := RegenerateRecoveryCodes(pool, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySecondFactor(pool, user.ID, "", codes[2], time.Now()); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Errorf("старый код после перевыпуска: %v", err)
+	}
+	if err := VerifySecondFactor(pool, user.ID, "", fresh[0], time.Now()); err != nil {
+		t.Errorf("новый код после перевыпуска: %v", err)
+	}
+}
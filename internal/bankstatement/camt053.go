@@ -0,0 +1,312 @@
+package bankstatement
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+// Структура camt.053 в объёме, нужном для импорта. Пространства имён не указаны,
+// поэтому подходят все версии схемы от camt.053.001.02 до 001.10.
+type camtDocument struct {
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	ID      string `xml:"Id"`
+	Account struct {
+		IBAN     string `xml:"Id>IBAN"`
+		Other    string `xml:"Id>Othr>Id"`
+		Currency string `xml:"Ccy"`
+	} `xml:"Acct"`
+	Balances []camtBalance `xml:"Bal"`
+	Entries  []camtEntry   `xml:"Ntry"`
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+type camtBalance struct {
+	Code        string     `xml:"Tp>CdOrPrtry>Cd"`
+	Amount      camtAmount `xml:"Amt"`
+	CreditDebit string     `xml:"CdtDbtInd"`
+	Date        camtDate   `xml:"Dt"`
+}
+
+// camtStatus — в версиях до 001.08 статус записан текстом, начиная с 001.08 — в элементе Cd
+type camtStatus struct {
+	Text string `xml:",chardata"`
+	Code string `xml:"Cd"`
+}
+
+type camtEntry struct {
+	Reference      string          `xml:"NtryRef"`
+	Amount         camtAmount      `xml:"Amt"`
+	CreditDebit    string          `xml:"CdtDbtInd"`
+	Status         camtStatus      `xml:"Sts"`
+	BookingDate    camtDate        `xml:"BookgDt"`
+	ValueDate      camtDate        `xml:"ValDt"`
+	ServicerRef    string          `xml:"AcctSvcrRef"`
+	Details        []camtTxDetails `xml:"NtryDtls>TxDtls"`
+	AdditionalInfo string          `xml:"AddtlNtryInf"`
+}
+
+// camtParty — в версиях до 001.08 имя лежит прямо в Dbtr/Cdtr, начиная с 001.08 — в Pty
+type camtParty struct {
+	Name      string `xml:"Nm"`
+	PartyName string `xml:"Pty>Nm"`
+}
+
+func (p camtParty) name() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return p.PartyName
+}
+
+type camtTxDetails struct {
+	ServicerRef    string      `xml:"Refs>AcctSvcrRef"`
+	EndToEndID     string      `xml:"Refs>EndToEndId"`
+	TransactionID  string      `xml:"Refs>TxId"`
+	Amount         *camtAmount `xml:"Amt"`
+	DetailsAmount  *camtAmount `xml:"AmtDtls>TxAmt>Amt"`
+	CreditDebit    string      `xml:"CdtDbtInd"`
+	Debtor         camtParty   `xml:"RltdPties>Dbtr"`
+	Creditor       camtParty   `xml:"RltdPties>Cdtr"`
+	Unstructured   []string    `xml:"RmtInf>Ustrd"`
+	CreditorRef    string      `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	AdditionalInfo string      `xml:"AddtlTxInf"`
+}
+
+func (d camtTxDetails) amount() *camtAmount {
+	if d.Amount != nil {
+		return d.Amount
+	}
+	return d.DetailsAmount
+}
+
+func (d camtTxDetails) reference() string {
+	for _, reference := range []string{d.CreditorRef, d.EndToEndID, d.TransactionID} {
+		if reference = usableReference(reference); reference != "" {
+			return reference
+		}
+	}
+	return ""
+}
+
+// ParseCAMT053 читает выписку camt.053 и возвращает выписки по всем счетам в ней.
+// Учитываются только проведённые проводки (статус BOOK): остатки строятся по ним же.
+func ParseCAMT053(r io.Reader) ([]Statement, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла: %v", err)
+	}
+	if !bytes.Contains(data, []byte("BkToCstmrStmt")) {
+		return nil, ErrNotCAMT
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = func(label string, input io.Reader) (io.Reader, error) {
+		encoding, err := ianaindex.IANA.Encoding(label)
+		if err != nil || encoding == nil {
+			return nil, fmt.Errorf("неизвестная кодировка %s", label)
+		}
+		return encoding.NewDecoder().Reader(input), nil
+	}
+	var document camtDocument
+	if err := decoder.Decode(&document); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotCAMT, err)
+	}
+	if len(document.Statements) == 0 {
+		return nil, fmt.Errorf("%w: нет ни одной выписки по счёту", ErrNotCAMT)
+	}
+
+	statements := make([]Statement, 0, len(document.Statements))
+	for _, stmt := range document.Statements {
+		statements = append(statements, readCAMTStatement(stmt))
+	}
+	return statements, nil
+}
+
+func readCAMTStatement(stmt camtStatement) Statement {
+	statement := Statement{
+		ID:        strings.TrimSpace(stmt.ID),
+		AccountID: strings.TrimSpace(stmt.Account.IBAN),
+		Currency:  strings.ToUpper(strings.TrimSpace(stmt.Account.Currency)),
+		Entries:   []Entry{},
+		Errors:    []EntryError{},
+	}
+	if statement.AccountID == "" {
+		statement.AccountID = strings.TrimSpace(stmt.Account.Other)
+	}
+
+	for _, balance := range stmt.Balances {
+		amount, err := camtSignedAmount(balance.Amount.Value, balance.CreditDebit)
+		if err != nil {
+			statement.Errors = append(statement.Errors, EntryError{Message: "остаток " + balance.Code + ": " + err.Error()})
+			continue
+		}
+		date, _ := balance.Date.parse()
+		if statement.Currency == "" {
+			statement.Currency = strings.ToUpper(balance.Amount.Currency)
+		}
+		switch code := strings.ToUpper(balance.Code); code {
+		case "OPBD", "PRCD": // входящий остаток; PRCD — исходящий остаток предыдущей выписки
+			if statement.Opening == nil || code == "OPBD" {
+				statement.Opening = &Balance{Date: date, Amount: amount}
+			}
+		case "CLBD":
+			statement.Closing = &Balance{Date: date, Amount: amount}
+		}
+	}
+
+	for _, ntry := range stmt.Entries {
+		status := strings.ToUpper(strings.TrimSpace(ntry.Status.Code + ntry.Status.Text))
+		if status != "" && status != "BOOK" {
+			continue
+		}
+		entries, err := readCAMTEntry(ntry, statement.Currency)
+		if err != nil {
+			reference := usableReference(ntry.ServicerRef)
+			if reference == "" {
+				reference = ntry.Reference
+			}
+			statement.Errors = append(statement.Errors, EntryError{Reference: reference, Message: err.Error()})
+			continue
+		}
+		statement.Entries = append(statement.Entries, entries...)
+	}
+	assignIDs(statement.Entries)
+	return statement
+}
+
+// readCAMTEntry разбирает проводку. Пакетная проводка, у которой каждая операция имеет свою сумму,
+// раскладывается на отдельные транзакции; иначе проводка импортируется целиком.
+func readCAMTEntry(ntry camtEntry, defaultCurrency string) ([]Entry, error) {
+	amount, err := camtSignedAmount(ntry.Amount.Value, ntry.CreditDebit)
+	if err != nil {
+		return nil, err
+	}
+	booking, err := ntry.BookingDate.parse()
+	if err != nil {
+		return nil, err
+	}
+	value, err := ntry.ValueDate.parse()
+	if err != nil {
+		value = booking
+	}
+
+	currency := strings.ToUpper(ntry.Amount.Currency)
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	base := Entry{
+		ID:          usableReference(ntry.ServicerRef),
+		BookingDate: booking,
+		ValueDate:   value,
+		Amount:      amount,
+		Currency:    currency,
+	}
+
+	split := len(ntry.Details) > 1
+	for _, details := range ntry.Details {
+		if details.amount() == nil {
+			split = false
+		}
+	}
+	if !split {
+		entry := base
+		if len(ntry.Details) == 1 {
+			fillCAMTDetails(&entry, ntry.Details[0], amount)
+		}
+		if entry.Details == "" {
+			entry.Details = strings.TrimSpace(ntry.AdditionalInfo)
+		}
+		if entry.Reference == "" {
+			entry.Reference = usableReference(ntry.Reference)
+		}
+		return []Entry{entry}, nil
+	}
+
+	entries := make([]Entry, 0, len(ntry.Details))
+	for i, details := range ntry.Details {
+		indicator := details.CreditDebit
+		if indicator == "" {
+			indicator = ntry.CreditDebit
+		}
+		partAmount, err := camtSignedAmount(details.amount().Value, indicator)
+		if err != nil {
+			return nil, err
+		}
+		entry := base
+		entry.Amount = partAmount
+		if entry.ID == "" {
+			entry.ID = usableReference(details.ServicerRef)
+		} else {
+			entry.ID = fmt.Sprintf("%s/%d", base.ID, i+1)
+		}
+		fillCAMTDetails(&entry, details, partAmount)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func fillCAMTDetails(entry *Entry, details camtTxDetails, amount float64) {
+	// Для поступления контрагент — плательщик, для списания — получатель
+	if amount < 0 {
+		entry.Counterparty = strings.TrimSpace(details.Creditor.name())
+	} else {
+		entry.Counterparty = strings.TrimSpace(details.Debtor.name())
+	}
+	entry.Reference = details.reference()
+	entry.Details = usableReference(strings.Join(details.Unstructured, " "))
+	if entry.Details == "" {
+		entry.Details = usableReference(details.AdditionalInfo)
+	}
+}
+
+func camtSignedAmount(value, indicator string) (float64, error) {
+	amount, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("некорректная сумма «%s»", value)
+	}
+	switch strings.ToUpper(strings.TrimSpace(indicator)) {
+	case "CRDT":
+		return amount, nil
+	case "DBIT":
+		return -amount, nil
+	default:
+		return 0, fmt.Errorf("неизвестный признак дебета/кредита «%s»", indicator)
+	}
+}
+
+func (d camtDate) parse() (time.Time, error) {
+	if date := strings.TrimSpace(d.Date); date != "" {
+		if t, err := time.Parse("2006-01-02", date); err == nil {
+			return t, nil
+		}
+		return time.Time{}, fmt.Errorf("некорректная дата «%s»", date)
+	}
+	if dateTime := strings.TrimSpace(d.DateTime); dateTime != "" {
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05"} {
+			if t, err := time.Parse(layout, dateTime); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("некорректная дата «%s»", dateTime)
+	}
+	return time.Time{}, fmt.Errorf("не указана дата проводки")
+}
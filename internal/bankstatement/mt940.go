@@ -0,0 +1,261 @@
+package bankstatement
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// mtField — поле сообщения MT940: тег и значение со всеми строками продолжения
+type mtField struct {
+	tag   string
+	value string
+}
+
+var mtFieldStart = regexp.MustCompile(`^:(\d{2}[A-Z]?):`)
+
+// Строка :61: — дата валютирования ГГММДД, [дата проводки ММДД], признак D/C/RD/RC,
+// [третья буква кода валюты], сумма с запятой, код операции, референс клиента, [//референс банка]
+var mtStatementLine = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?(\d+,\d*)([A-Z][A-Z0-9]{3})(.*)$`)
+
+// Остаток :60F:/:62F: — признак C/D, дата ГГММДД, валюта, сумма
+var mtBalance = regexp.MustCompile(`^(C|D)(\d{6})([A-Z]{3})(\d+,\d*)$`)
+
+// ParseMT940 читает выписку MT940 и возвращает выписки из всех сообщений в файле.
+// Понимает как голый блок 4, так и сообщения в конверте {1:...}{2:...}{4:...-}.
+// Файлы не в UTF-8 считаются выгруженными в Windows-1251, как принято у банков СНГ.
+func ParseMT940(r io.Reader) ([]Statement, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла: %v", err)
+	}
+	if !utf8.Valid(data) {
+		if data, err = charmap.Windows1251.NewDecoder().Bytes(data); err != nil {
+			return nil, fmt.Errorf("ошибка перекодирования файла: %v", err)
+		}
+	}
+
+	var statements []Statement
+	for _, message := range splitMTMessages(string(data)) {
+		fields := readMTFields(message)
+		if len(fields) == 0 {
+			continue
+		}
+		statements = append(statements, readMTStatement(fields))
+	}
+	if len(statements) == 0 {
+		return nil, ErrNotMT940
+	}
+	return statements, nil
+}
+
+// splitMTMessages делит файл на сообщения: каждое начинается с поля :20:
+func splitMTMessages(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	var messages []string
+	var current []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		// Конверт SWIFT: {1:...}{2:...}{4: перед полями и -} после них
+		if i := strings.Index(line, "{4:"); i >= 0 {
+			line = line[i+len("{4:"):]
+		}
+		if strings.HasPrefix(line, "-}") || line == "-" {
+			continue
+		}
+		if strings.HasPrefix(line, ":20:") && len(current) > 0 {
+			messages = append(messages, strings.Join(current, "\n"))
+			current = nil
+		}
+		if line != "" {
+			current = append(current, line)
+		}
+	}
+	if len(current) > 0 {
+		messages = append(messages, strings.Join(current, "\n"))
+	}
+	return messages
+}
+
+func readMTFields(message string) []mtField {
+	var fields []mtField
+	for _, line := range strings.Split(message, "\n") {
+		if match := mtFieldStart.FindStringSubmatch(line); match != nil {
+			fields = append(fields, mtField{tag: match[1], value: line[len(match[0]):]})
+			continue
+		}
+		// Строки до первого поля (заголовки выгрузки) пропускаются
+		if len(fields) > 0 {
+			fields[len(fields)-1].value += "\n" + line
+		}
+	}
+	return fields
+}
+
+func readMTStatement(fields []mtField) Statement {
+	statement := Statement{Entries: []Entry{}, Errors: []EntryError{}}
+
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		switch field.tag {
+		case "20":
+			statement.ID = strings.TrimSpace(field.value)
+		case "25":
+			statement.AccountID = strings.TrimSpace(field.value)
+		case "60F", "60M":
+			balance, currency, err := parseMTBalance(field.value)
+			if err != nil {
+				statement.Errors = append(statement.Errors, EntryError{Message: "входящий остаток: " + err.Error()})
+				continue
+			}
+			statement.Opening = balance
+			statement.Currency = currency
+		case "62F", "62M":
+			balance, currency, err := parseMTBalance(field.value)
+			if err != nil {
+				statement.Errors = append(statement.Errors, EntryError{Message: "исходящий остаток: " + err.Error()})
+				continue
+			}
+			statement.Closing = balance
+			if statement.Currency == "" {
+				statement.Currency = currency
+			}
+		case "61":
+			information := ""
+			if i+1 < len(fields) && fields[i+1].tag == "86" {
+				information = fields[i+1].value
+				i++
+			}
+			entry, err := parseMTEntry(field.value, information, statement.Currency)
+			if err != nil {
+				statement.Errors = append(statement.Errors, EntryError{Reference: entry.Reference, Message: err.Error()})
+				continue
+			}
+			statement.Entries = append(statement.Entries, entry)
+		}
+	}
+	assignIDs(statement.Entries)
+	return statement
+}
+
+func parseMTBalance(value string) (*Balance, string, error) {
+	match := mtBalance.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return nil, "", fmt.Errorf("некорректный остаток «%s»", value)
+	}
+	date, err := time.Parse("060102", match[2])
+	if err != nil {
+		return nil, "", fmt.Errorf("некорректная дата «%s»", match[2])
+	}
+	amount, err := parseMTAmount(match[4])
+	if err != nil {
+		return nil, "", err
+	}
+	if match[1] == "D" {
+		amount = -amount
+	}
+	return &Balance{Date: date, Amount: amount}, match[3], nil
+}
+
+// parseMTEntry разбирает строку :61: и следующее за ней поле :86: с назначением платежа
+func parseMTEntry(line, information, currency string) (Entry, error) {
+	entry := Entry{Currency: currency}
+
+	first, supplementary, _ := strings.Cut(line, "\n")
+	match := mtStatementLine.FindStringSubmatch(strings.TrimSpace(first))
+	if match == nil {
+		return entry, fmt.Errorf("некорректная строка выписки «%s»", first)
+	}
+
+	customerRef, bankRef, _ := strings.Cut(match[7], "//")
+	entry.Reference = usableReference(customerRef)
+	entry.ID = usableReference(bankRef)
+
+	valueDate, err := time.Parse("060102", match[1])
+	if err != nil {
+		return entry, fmt.Errorf("некорректная дата валютирования «%s»", match[1])
+	}
+	entry.ValueDate = valueDate
+	entry.BookingDate = valueDate
+	if match[2] != "" {
+		// Год у даты проводки не указан: берётся год валютирования с поправкой на переход через Новый год
+		booking, err := time.Parse("20060102", fmt.Sprintf("%d%s", valueDate.Year(), match[2]))
+		if err != nil {
+			return entry, fmt.Errorf("некорректная дата проводки «%s»", match[2])
+		}
+		switch {
+		case booking.Sub(valueDate) > 180*24*time.Hour:
+			booking = booking.AddDate(-1, 0, 0)
+		case valueDate.Sub(booking) > 180*24*time.Hour:
+			booking = booking.AddDate(1, 0, 0)
+		}
+		entry.BookingDate = booking
+	}
+
+	amount, err := parseMTAmount(match[5])
+	if err != nil {
+		return entry, err
+	}
+	// RC — сторно кредита, уменьшает остаток; RD — сторно дебета, увеличивает его
+	switch match[3] {
+	case "D", "RC":
+		amount = -amount
+	}
+	entry.Amount = amount
+
+	entry.Counterparty, entry.Details = parseMTInformation(information)
+	if entry.Details == "" {
+		entry.Details = strings.TrimSpace(supplementary)
+	}
+	return entry, nil
+}
+
+func parseMTAmount(value string) (float64, error) {
+	amount, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+	if err != nil {
+		return 0, fmt.Errorf("некорректная сумма «%s»", value)
+	}
+	return amount, nil
+}
+
+// parseMTInformation разбирает поле :86:. Структурированный вариант (код операции и подполя ?NN,
+// как у немецких банков) даёт имя контрагента из ?32–?33 и назначение из ?20–?29 и ?60–?63.
+// Остальные варианты считаются свободным текстом назначения.
+func parseMTInformation(value string) (counterparty, details string) {
+	if len(value) < 4 || !isDigits(value[:3]) || value[3] != '?' {
+		return "", strings.Join(strings.Fields(value), " ")
+	}
+	// Подполя переносятся по 27 символов, поэтому строки склеиваются без пробела
+	value = strings.ReplaceAll(value, "\n", "")
+
+	var name, purpose []string
+	for _, part := range strings.Split(value[3:], "?") {
+		if len(part) < 2 || !isDigits(part[:2]) {
+			continue
+		}
+		code, _ := strconv.Atoi(part[:2])
+		text := part[2:]
+		switch {
+		case code == 32 || code == 33:
+			name = append(name, text)
+		case code >= 20 && code <= 29 || code >= 60 && code <= 63:
+			purpose = append(purpose, text)
+		}
+	}
+	return strings.TrimSpace(strings.Join(name, "")), strings.TrimSpace(strings.Join(purpose, ""))
+}
+
+func isDigits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return value != ""
+}
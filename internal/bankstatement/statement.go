@@ -0,0 +1,146 @@
+// Package bankstatement разбирает выписки для юридических лиц: ISO 20022 camt.053 (XML) и SWIFT MT940 (текст)
+package bankstatement
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+var (
+	ErrNotCAMT  = errors.New("файл не похож на выписку camt.053")
+	ErrNotMT940 = errors.New("файл не похож на выписку MT940")
+)
+
+// Entry — проводка выписки
+type Entry struct {
+	ID           string    `json:"id"` // идентификатор для повторного импорта, уникален в пределах счёта
+	BookingDate  time.Time `json:"booking_date"`
+	ValueDate    time.Time `json:"value_date"`
+	Amount       float64   `json:"amount"` // со знаком: отрицательная сумма — списание
+	Currency     string    `json:"currency"`
+	Counterparty string    `json:"counterparty"`
+	Reference    string    `json:"reference"`
+	Details      string    `json:"details"` // назначение платежа
+}
+
+// Description возвращает описание операции: контрагент, назначение и референс
+func (e Entry) Description() string {
+	var parts []string
+	if e.Counterparty != "" {
+		parts = append(parts, e.Counterparty)
+	}
+	if e.Details != "" {
+		parts = append(parts, e.Details)
+	}
+	if e.Reference != "" && !strings.Contains(e.Details, e.Reference) {
+		parts = append(parts, "реф. "+e.Reference)
+	}
+	return strings.Join(parts, " — ")
+}
+
+// Model переводит проводку в транзакцию приложения: сумма без знака, направление — в типе
+func (e Entry) Model(categoryID int) models.Transaction {
+	transaction := models.Transaction{
+		CategoryID:  categoryID,
+		Amount:      math.Abs(e.Amount),
+		Date:        e.BookingDate,
+		Type:        "income",
+		Description: e.Description(),
+		Currency:    e.Currency,
+	}
+	if e.Amount < 0 {
+		transaction.Type = "expense"
+	}
+	return transaction
+}
+
+// EntryError — проводка, которую не удалось разобрать
+type EntryError struct {
+	Reference string `json:"reference,omitempty"`
+	Message   string `json:"error"`
+}
+
+// Balance — остаток на дату
+type Balance struct {
+	Date   time.Time `json:"date"`
+	Amount float64   `json:"amount"`
+}
+
+// BalanceCheck — сверка остатков: входящий остаток плюс сумма проводок должен дать исходящий
+type BalanceCheck struct {
+	Opening    float64 `json:"opening"`
+	Closing    float64 `json:"closing"`
+	Turnover   float64 `json:"turnover"` // сумма разобранных проводок
+	Difference float64 `json:"difference"`
+	Matches    bool    `json:"matches"`
+}
+
+// Statement — выписка по одному счёту
+type Statement struct {
+	ID        string       `json:"id"`
+	AccountID string       `json:"account_id"` // IBAN или номер счёта
+	Currency  string       `json:"currency"`
+	Opening   *Balance     `json:"opening_balance"`
+	Closing   *Balance     `json:"closing_balance"`
+	Entries   []Entry      `json:"entries"`
+	Errors    []EntryError `json:"errors"`
+}
+
+// CheckBalance сверяет остатки с проводками. Без одного из остатков сверка невозможна и возвращается nil.
+// Суммы сравниваются в копейках, чтобы не накапливать ошибку округления.
+func (s Statement) CheckBalance() *BalanceCheck {
+	if s.Opening == nil || s.Closing == nil {
+		return nil
+	}
+	var turnover int64
+	for _, entry := range s.Entries {
+		turnover += cents(entry.Amount)
+	}
+	difference := cents(s.Closing.Amount) - cents(s.Opening.Amount) - turnover
+	return &BalanceCheck{
+		Opening:    s.Opening.Amount,
+		Closing:    s.Closing.Amount,
+		Turnover:   float64(turnover) / 100,
+		Difference: float64(difference) / 100,
+		Matches:    difference == 0,
+	}
+}
+
+func cents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// assignIDs заполняет идентификаторы проводок, для которых банк не передал собственный референс.
+// Отпечаток строится по содержимому проводки, поэтому совпадает в пересекающихся выписках;
+// одинаковые проводки внутри выписки различаются порядковым номером.
+func assignIDs(entries []Entry) {
+	seen := map[string]int{}
+	for i := range entries {
+		entry := &entries[i]
+		if entry.ID != "" {
+			continue
+		}
+		key := fmt.Sprintf("%s|%d|%s|%s|%s|%s", entry.BookingDate.Format("2006-01-02"), cents(entry.Amount),
+			entry.Currency, entry.Counterparty, entry.Reference, entry.Details)
+		seen[key]++
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s#%d", key, seen[key])))
+		entry.ID = "fp:" + hex.EncodeToString(sum[:12])
+	}
+}
+
+// usableReference отбрасывает пустые значения и заглушки банков вроде NONREF и NOTPROVIDED
+func usableReference(reference string) string {
+	reference = strings.TrimSpace(reference)
+	switch strings.ToUpper(reference) {
+	case "", "NONREF", "NOTPROVIDED", "NOT PROVIDED":
+		return ""
+	}
+	return reference
+}
@@ -0,0 +1,218 @@
+package bankstatement
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseFile(t *testing.T, name string, parse func(io.Reader) ([]Statement, error)) []Statement {
+	t.Helper()
+	file, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	statements, err := parse(file)
+	if err != nil {
+		t.Fatalf("разбор %s: %v", name, err)
+	}
+	return statements
+}
+
+func parseCAMTFile(t *testing.T) []Statement {
+	return parseFile(t, "camt053.xml", ParseCAMT053)
+}
+
+func parseMT940File(t *testing.T) []Statement {
+	return parseFile(t, "mt940.sta", ParseMT940)
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// checkEntries сравнивает проводки; у ожидаемых с ID "fp:" проверяется только то, что это отпечаток
+func checkEntries(t *testing.T, got, want []Entry) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("проводок: %d, ожидалось %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if w.ID == "fp:" && strings.HasPrefix(g.ID, "fp:") {
+			w.ID = g.ID
+		}
+		if !g.BookingDate.Equal(w.BookingDate) || !g.ValueDate.Equal(w.ValueDate) {
+			t.Errorf("проводка %d: даты %v / %v, ожидались %v / %v", i, g.BookingDate, g.ValueDate, w.BookingDate, w.ValueDate)
+		}
+		g.BookingDate, g.ValueDate, w.BookingDate, w.ValueDate = time.Time{}, time.Time{}, time.Time{}, time.Time{}
+		if g != w {
+			t.Errorf("проводка %d:\n получено  %+v\n ожидалось %+v", i, g, w)
+		}
+	}
+}
+
+func checkBalance(t *testing.T, statement Statement, want BalanceCheck) {
+	t.Helper()
+	check := statement.CheckBalance()
+	if check == nil {
+		t.Fatalf("выписка %s: сверка остатков невозможна", statement.ID)
+	}
+	if *check != want {
+		t.Errorf("выписка %s: сверка %+v, ожидалась %+v", statement.ID, *check, want)
+	}
+}
+
+func TestParseCAMT053(t *testing.T) {
+	statements := parseCAMTFile(t)
+	if len(statements) != 2 {
+		t.Fatalf("выписок: %d, ожидалось 2", len(statements))
+	}
+
+	eur := statements[0]
+	if eur.ID != "STMT-2024-03" || eur.AccountID != "DE89370400440532013000" || eur.Currency != "EUR" {
+		t.Errorf("выписка %s, счёт %s, валюта %s", eur.ID, eur.AccountID, eur.Currency)
+	}
+	// Проводка в статусе PDNG пропущена, пакетная проводка разложена на две операции
+	checkEntries(t, eur.Entries, []Entry{
+		{ID: "BANKREF-0001", BookingDate: date(2024, 3, 5), ValueDate: date(2024, 3, 5), Amount: 1500, Currency: "EUR",
+			Counterparty: "ACME GmbH", Reference: "E2E-INV-42", Details: "Invoice 42"},
+		{ID: "fp:", BookingDate: date(2024, 3, 10), ValueDate: date(2024, 3, 11), Amount: -120, Currency: "EUR",
+			Counterparty: "Stadtwerke", Details: "Strom März"},
+		{ID: "TX-2", BookingDate: date(2024, 3, 10), ValueDate: date(2024, 3, 11), Amount: -80, Currency: "EUR",
+			Counterparty: "Telekom", Details: "Mobilfunk"},
+		{ID: "fp:", BookingDate: date(2024, 3, 20), ValueDate: date(2024, 3, 20), Amount: -49.5, Currency: "EUR",
+			Details: "Kontoführung"},
+		{ID: "fp:", BookingDate: date(2024, 3, 20), ValueDate: date(2024, 3, 20), Amount: -49.5, Currency: "EUR",
+			Details: "Kontoführung"},
+	})
+	if len(eur.Errors) != 0 {
+		t.Errorf("ошибки: %+v", eur.Errors)
+	}
+	checkBalance(t, eur, BalanceCheck{Opening: 1000, Closing: 2201, Turnover: 1201, Matches: true})
+
+	rub := statements[1]
+	if rub.AccountID != "40702810900000000001" || rub.Currency != "RUB" {
+		t.Errorf("счёт %s, валюта %s", rub.AccountID, rub.Currency)
+	}
+	booked := time.Date(2024, 3, 15, 7, 30, 0, 0, time.UTC)
+	checkEntries(t, rub.Entries, []Entry{
+		{ID: "RUB-0001", BookingDate: booked, ValueDate: booked, Amount: -90, Currency: "RUB", Details: "Комиссия банка"},
+	})
+	if len(rub.Errors) != 1 || rub.Errors[0].Reference != "BAD-1" {
+		t.Errorf("ошибки: %+v", rub.Errors)
+	}
+	// Входящий остаток взят из PRCD; проводка с ошибкой не учтена, поэтому остатки расходятся
+	checkBalance(t, rub, BalanceCheck{Opening: 500, Closing: 400, Turnover: -90, Difference: -10})
+}
+
+func TestParseMT940(t *testing.T) {
+	statements := parseMT940File(t)
+	if len(statements) != 2 {
+		t.Fatalf("выписок: %d, ожидалось 2", len(statements))
+	}
+
+	eur := statements[0]
+	if eur.ID != "STMT240301" || eur.AccountID != "DE89370400440532013000" || eur.Currency != "EUR" {
+		t.Errorf("выписка %s, счёт %s, валюта %s", eur.ID, eur.AccountID, eur.Currency)
+	}
+	if !eur.Opening.Date.Equal(date(2024, 2, 29)) || !eur.Closing.Date.Equal(date(2024, 3, 31)) {
+		t.Errorf("даты остатков %v, %v", eur.Opening.Date, eur.Closing.Date)
+	}
+	checkEntries(t, eur.Entries, []Entry{
+		{ID: "BANKREF1", BookingDate: date(2024, 3, 1), ValueDate: date(2024, 3, 1), Amount: 1500, Currency: "EUR",
+			Counterparty: "ACME GmbH", Reference: "INV42", Details: "Invoice 42"},
+		{ID: "fp:", BookingDate: date(2024, 3, 5), ValueDate: date(2024, 3, 5), Amount: -120, Currency: "EUR",
+			Details: "Strom Maerz Stadtwerke"},
+		{ID: "fp:", BookingDate: date(2024, 3, 5), ValueDate: date(2024, 3, 5), Amount: -120, Currency: "EUR",
+			Details: "Strom Maerz Stadtwerke"},
+	})
+	checkBalance(t, eur, BalanceCheck{Opening: 1000, Closing: 2260, Turnover: 1260, Matches: true})
+
+	// Второе сообщение без конверта, в Windows-1251; дата проводки переходит на следующий год
+	rub := statements[1]
+	if rub.AccountID != "40702810900000000001" || rub.Currency != "RUB" {
+		t.Errorf("счёт %s, валюта %s", rub.AccountID, rub.Currency)
+	}
+	checkEntries(t, rub.Entries, []Entry{
+		{ID: "fp:", BookingDate: date(2025, 1, 2), ValueDate: date(2024, 12, 31), Amount: -90, Currency: "RUB",
+			Details: "Комиссия банка"},
+	})
+	if len(rub.Errors) != 1 {
+		t.Errorf("ошибки: %+v", rub.Errors)
+	}
+	checkBalance(t, rub, BalanceCheck{Opening: 500, Closing: 400, Turnover: -90, Difference: -10})
+}
+
+func TestCheckBalanceWithoutBalances(t *testing.T) {
+	statement := Statement{Closing: &Balance{Amount: 10}, Entries: []Entry{{Amount: 10}}}
+	if check := statement.CheckBalance(); check != nil {
+		t.Errorf("сверка без входящего остатка: %+v", check)
+	}
+
+	// Суммы сверяются в копейках: 0.1 + 0.2 не даёт ложного расхождения
+	statement.Opening = &Balance{Amount: 0}
+	statement.Closing = &Balance{Amount: 0.3}
+	statement.Entries = []Entry{{Amount: 0.1}, {Amount: 0.2}}
+	if check := statement.CheckBalance(); check == nil || !check.Matches || check.Difference != 0 {
+		t.Errorf("сверка %+v", check)
+	}
+}
+
+func TestFingerprintIDs(t *testing.T) {
+	first := parseMT940File(t)[0].Entries
+	second := parseMT940File(t)[0].Entries
+	for i := range first {
+		if first[i].ID != second[i].ID {
+			t.Errorf("проводка %d: ID %s при повторном разборе стал %s", i, first[i].ID, second[i].ID)
+		}
+	}
+	// Одинаковые проводки внутри выписки различаются
+	if first[1].ID == first[2].ID {
+		t.Errorf("одинаковые проводки получили один ID %s", first[1].ID)
+	}
+
+	// Следующая выписка, пересекающаяся с первой, даёт той же проводке тот же ID
+	overlap := ":20:STMT240305\n:25:DE89370400440532013000\n:60F:C240304EUR2500,00\n" +
+		":61:2403050305D120,00NDDTNONREF\n:86:Strom Maerz Stadtwerke\n" +
+		":61:2403060306D10,00NDDTNONREF\n:86:Zinsen\n:62F:C240306EUR2370,00\n"
+	statements, err := ParseMT940(strings.NewReader(overlap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := statements[0].Entries
+	if len(entries) != 2 || entries[0].ID != first[1].ID {
+		t.Errorf("ID проводки в пересекающейся выписке %+v, ожидался %s", entries, first[1].ID)
+	}
+	if entries[1].ID == first[1].ID || entries[1].ID == first[2].ID {
+		t.Errorf("другая проводка получила тот же ID %s", entries[1].ID)
+	}
+
+	// Отпечаток зависит от содержимого проводки, а не от формата выписки
+	a := []Entry{{BookingDate: date(2024, 3, 5), Amount: -120, Currency: "EUR", Details: "Strom"}}
+	b := []Entry{{BookingDate: date(2024, 3, 5), Amount: -120.001, Currency: "EUR", Details: "Strom", ValueDate: date(2024, 3, 6)}}
+	c := []Entry{{BookingDate: date(2024, 3, 5), Amount: -120, Currency: "EUR", Details: "Gas"}}
+	assignIDs(a)
+	assignIDs(b)
+	assignIDs(c)
+	if a[0].ID != b[0].ID || a[0].ID == c[0].ID {
+		t.Errorf("отпечатки %s, %s, %s", a[0].ID, b[0].ID, c[0].ID)
+	}
+}
+
+func TestParseRejectsOtherFormats(t *testing.T) {
+	if _, err := ParseCAMT053(strings.NewReader(":20:STMT\n:25:ACC\n")); !errors.Is(err, ErrNotCAMT) {
+		t.Errorf("camt.053 из MT940: %v", err)
+	}
+	if _, err := ParseCAMT053(strings.NewReader("<Document><BkToCstmrStmt></BkToCstmrStmt></Document>")); !errors.Is(err, ErrNotCAMT) {
+		t.Errorf("camt.053 без выписок: %v", err)
+	}
+	if _, err := ParseMT940(strings.NewReader("<Document><BkToCstmrStmt/></Document>")); !errors.Is(err, ErrNotMT940) {
+		t.Errorf("MT940 из camt.053: %v", err)
+	}
+}
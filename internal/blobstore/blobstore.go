@@ -0,0 +1,65 @@
+// Package blobstore хранит файлы пользователей (вложения транзакций) вне базы данных.
+// Реализация выбирается конфигурацией: локальный каталог или S3-совместимое хранилище.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var ErrNotFound = errors.New("файл не найден в хранилище")
+
+// Store сохраняет, отдаёт и удаляет файлы по ключу вида "12/3f9a…". Удаление отсутствующего файла не ошибка.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// NewStoreFromEnv выбирает хранилище по переменной BLOB_STORE: s3 или local (по умолчанию)
+func NewStoreFromEnv() (Store, error) {
+	switch strings.ToLower(os.Getenv("BLOB_STORE")) {
+	case "s3":
+		pathStyle, _ := strconv.ParseBool(os.Getenv("S3_PATH_STYLE"))
+		store := &S3Store{
+			Endpoint:  strings.TrimRight(os.Getenv("S3_ENDPOINT"), "/"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle: pathStyle,
+		}
+		if store.Region == "" {
+			store.Region = "us-east-1"
+		}
+		if store.Endpoint == "" {
+			store.Endpoint = "https://s3." + store.Region + ".amazonaws.com"
+		}
+		if store.Bucket == "" || store.AccessKey == "" || store.SecretKey == "" {
+			return nil, fmt.Errorf("для хранилища s3 укажите S3_BUCKET, S3_ACCESS_KEY_ID и S3_SECRET_ACCESS_KEY")
+		}
+		return store, nil
+	case "", "local":
+		return &LocalStore{Dir: os.Getenv("BLOB_DIR")}, nil
+	default:
+		return nil, fmt.Errorf("неизвестное хранилище файлов BLOB_STORE=%s", os.Getenv("BLOB_STORE"))
+	}
+}
+
+// validKey отсекает ключи, которые могут выйти за пределы каталога или бакета
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("некорректный ключ файла %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("некорректный ключ файла %q", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStorePutGetDelete(t *testing.T) {
+	dir := t.TempDir()
+	store := &LocalStore{Dir: dir}
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "12/3f9a", []byte("первая версия"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	// Повторная запись заменяет файл целиком
+	if err := store.Put(ctx, "12/3f9a", []byte("вторая"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := store.Get(ctx, "12/3f9a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(data) != "вторая" {
+		t.Errorf("прочитано %q, %v", data, err)
+	}
+
+	// Временные файлы после записи не остаются
+	entries, err := os.ReadDir(filepath.Join(dir, "12"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "3f9a" {
+		t.Errorf("в каталоге %v", entries)
+	}
+
+	if err := store.Delete(ctx, "12/3f9a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "12/3f9a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("после удаления: %v", err)
+	}
+	if err := store.Delete(ctx, "12/3f9a"); err != nil {
+		t.Errorf("повторное удаление: %v", err)
+	}
+}
+
+func TestLocalStoreRejectsEscapingKeys(t *testing.T) {
+	dir := t.TempDir()
+	store := &LocalStore{Dir: filepath.Join(dir, "blobs")}
+	ctx := context.Background()
+
+	for _, key := range []string{"", "/etc/passwd", "../outside", "12/../../outside", "12//a", `12\a`, "./a"} {
+		if err := store.Put(ctx, key, []byte("x"), ""); err == nil {
+			t.Errorf("Put(%q) прошёл", key)
+		}
+		if _, err := store.Get(ctx, key); err == nil || errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q): %v", key, err)
+		}
+		if err := store.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) прошёл", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "outside")); !os.IsNotExist(err) {
+		t.Errorf("файл записан за пределами каталога: %v", err)
+	}
+}
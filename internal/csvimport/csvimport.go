@@ -0,0 +1,445 @@
+// Package csvimport разбирает CSV-выписки банков по сохранённым настройкам колонок
+package csvimport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Способы определить направление операции
+const (
+	SignSigned   = "signed"   // отрицательная сумма — расход
+	SignInverted = "inverted" // отрицательная сумма — доход (так пишут выписки по кредитным картам)
+	SignSplit    = "split"    // расход и доход в разных колонках
+)
+
+// Поддерживаемые кодировки файла
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingCP1251  = "windows-1251"
+	previewRowLimit = 50
+)
+
+var (
+	ErrInvalidMapping = errors.New("некорректные настройки импорта")
+	ErrEmptyFile      = errors.New("файл не содержит данных")
+)
+
+// Распространённые форматы дат в выписках, если формат не задан явно
+var defaultDateLayouts = []string{
+	"2006-01-02",
+	"02.01.2006",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"02.01.06",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"02/01/2006",
+	"2006/01/02",
+}
+
+// Row — разобранная строка файла; при ошибке Transaction пуст, а Error объясняет причину
+type Row struct {
+	Line        int                 `json:"line"`
+	Transaction *models.Transaction `json:"transaction,omitempty"`
+	Error       string              `json:"error,omitempty"`
+}
+
+// Result — итог разбора файла
+type Result struct {
+	Columns []string `json:"columns"`
+	Rows    []Row    `json:"-"`
+	Valid   int      `json:"valid"`
+	Invalid int      `json:"invalid"`
+}
+
+// Transactions возвращает транзакции из строк без ошибок
+func (r *Result) Transactions() []models.Transaction {
+	transactions := make([]models.Transaction, 0, r.Valid)
+	for _, row := range r.Rows {
+		if row.Transaction != nil {
+			transactions = append(transactions, *row.Transaction)
+		}
+	}
+	return transactions
+}
+
+// Preview возвращает первые строки файла для предпросмотра
+func (r *Result) Preview() []Row {
+	if len(r.Rows) > previewRowLimit {
+		return r.Rows[:previewRowLimit]
+	}
+	return r.Rows
+}
+
+// Errors возвращает все строки с ошибками
+func (r *Result) Errors() []Row {
+	rows := []Row{}
+	for _, row := range r.Rows {
+		if row.Error != "" {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// ValidateMapping проверяет настройки и заполняет значения по умолчанию
+func ValidateMapping(mapping *models.ImportMapping) error {
+	mapping.BankName = strings.TrimSpace(mapping.BankName)
+	if mapping.Encoding == "" {
+		mapping.Encoding = EncodingUTF8
+	}
+	mapping.Encoding = strings.ToLower(mapping.Encoding)
+	if mapping.SignConvention == "" {
+		mapping.SignConvention = SignSigned
+	}
+	if mapping.DecimalSeparator == "" {
+		mapping.DecimalSeparator = "."
+	}
+	mapping.DefaultCurrency = strings.ToUpper(strings.TrimSpace(mapping.DefaultCurrency))
+
+	switch {
+	case mapping.Encoding != EncodingUTF8 && mapping.Encoding != EncodingCP1251:
+		return fmt.Errorf("%w: неизвестная кодировка %s", ErrInvalidMapping, mapping.Encoding)
+	case len([]rune(mapping.Delimiter)) > 1:
+		return fmt.Errorf("%w: разделитель должен быть одним символом", ErrInvalidMapping)
+	case mapping.SkipRows < 0:
+		return fmt.Errorf("%w: число пропускаемых строк не может быть отрицательным", ErrInvalidMapping)
+	case mapping.DecimalSeparator != "." && mapping.DecimalSeparator != ",":
+		return fmt.Errorf("%w: десятичный разделитель может быть только точкой или запятой", ErrInvalidMapping)
+	case mapping.DateColumn == "":
+		return fmt.Errorf("%w: не указана колонка с датой", ErrInvalidMapping)
+	}
+
+	switch mapping.SignConvention {
+	case SignSigned, SignInverted:
+		if mapping.AmountColumn == "" {
+			return fmt.Errorf("%w: не указана колонка с суммой", ErrInvalidMapping)
+		}
+	case SignSplit:
+		if mapping.DebitColumn == "" || mapping.CreditColumn == "" {
+			return fmt.Errorf("%w: для раздельных сумм нужны колонки расхода и дохода", ErrInvalidMapping)
+		}
+	default:
+		return fmt.Errorf("%w: неизвестное правило знака %s", ErrInvalidMapping, mapping.SignConvention)
+	}
+	if mapping.CategoryColumn == "" && mapping.DefaultCategoryID == nil {
+		return fmt.Errorf("%w: укажите колонку категории или категорию по умолчанию", ErrInvalidMapping)
+	}
+	return nil
+}
+
+// Parse читает файл по настройкам и сопоставляет категории по названию среди категорий пользователя.
+// Ошибки отдельных строк не прерывают разбор, а попадают в Row.Error.
+func Parse(r io.Reader, mapping *models.ImportMapping, categories []models.Category) (*Result, error) {
+	if err := ValidateMapping(mapping); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла: %v", err)
+	}
+	if mapping.Encoding == EncodingCP1251 {
+		if data, err = charmap.Windows1251.NewDecoder().Bytes(data); err != nil {
+			return nil, fmt.Errorf("ошибка перекодирования файла: %v", err)
+		}
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	lines := bufio.NewReader(bytes.NewReader(data))
+	for i := 0; i < mapping.SkipRows; i++ {
+		if _, err := lines.ReadString('\n'); err != nil {
+			return nil, ErrEmptyFile
+		}
+	}
+	rest, _ := io.ReadAll(lines)
+
+	delimiter := mapping.Delimiter
+	if delimiter == "" {
+		delimiter = detectDelimiter(rest)
+	}
+	reader := csv.NewReader(bytes.NewReader(rest))
+	reader.Comma = []rune(delimiter)[0]
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	result := &Result{}
+	if mapping.HasHeader {
+		if result.Columns, err = reader.Read(); err != nil {
+			if err == io.EOF {
+				return nil, ErrEmptyFile
+			}
+			return nil, fmt.Errorf("ошибка разбора CSV: %v", err)
+		}
+	}
+
+	columns, err := resolveColumns(mapping, result.Columns)
+	if err != nil {
+		return nil, err
+	}
+
+	categoryIDs := make(map[string]int, len(categories))
+	for _, category := range categories {
+		categoryIDs[strings.ToLower(strings.TrimSpace(category.Name))] = category.ID
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ошибка разбора CSV: %v", err)
+		}
+		if isBlank(record) {
+			continue
+		}
+
+		// Номер строки в исходном файле, чтобы ошибку было легко найти
+		line, _ := reader.FieldPos(0)
+		row := Row{Line: mapping.SkipRows + line}
+		transaction, err := parseRecord(record, mapping, columns, categoryIDs)
+		if err != nil {
+			row.Error = err.Error()
+			result.Invalid++
+		} else {
+			row.Transaction = transaction
+			result.Valid++
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	if len(result.Rows) == 0 {
+		return nil, ErrEmptyFile
+	}
+	return result, nil
+}
+
+// detectDelimiter выбирает самый частый из распространённых разделителей в первой строке
+func detectDelimiter(data []byte) string {
+	firstLine := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		firstLine = data[:i]
+	}
+	best, bestCount := ",", 0
+	for _, candidate := range []string{";", ",", "\t", "|"} {
+		if count := bytes.Count(firstLine, []byte(candidate)); count > bestCount {
+			best, bestCount = candidate, count
+		}
+	}
+	return best
+}
+
+// columnIndexes — номера колонок (с нуля); -1 означает, что колонка не используется
+type columnIndexes struct {
+	date, amount, debit, credit, description, currency, category int
+}
+
+func resolveColumns(mapping *models.ImportMapping, header []string) (columnIndexes, error) {
+	resolve := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		for i, column := range header {
+			if strings.EqualFold(strings.TrimSpace(column), strings.TrimSpace(name)) {
+				return i, nil
+			}
+		}
+		if number, err := strconv.Atoi(name); err == nil && number > 0 {
+			return number - 1, nil
+		}
+		return -1, fmt.Errorf("%w: колонка «%s» не найдена в файле", ErrInvalidMapping, name)
+	}
+
+	var columns columnIndexes
+	var err error
+	for _, field := range []struct {
+		name   string
+		target *int
+	}{
+		{mapping.DateColumn, &columns.date},
+		{mapping.AmountColumn, &columns.amount},
+		{mapping.DebitColumn, &columns.debit},
+		{mapping.CreditColumn, &columns.credit},
+		{mapping.DescriptionColumn, &columns.description},
+		{mapping.CurrencyColumn, &columns.currency},
+		{mapping.CategoryColumn, &columns.category},
+	} {
+		if *field.target, err = resolve(field.name); err != nil {
+			return columns, err
+		}
+	}
+	return columns, nil
+}
+
+func isBlank(record []string) bool {
+	for _, field := range record {
+		if strings.TrimSpace(field) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// field возвращает значение колонки; отсутствующая в строке колонка даёт пустую строку
+func field(record []string, index int) string {
+	if index < 0 || index >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[index])
+}
+
+func parseRecord(record []string, mapping *models.ImportMapping, columns columnIndexes, categoryIDs map[string]int) (*models.Transaction, error) {
+	date, err := ParseDate(field(record, columns.date), mapping.DateFormat)
+	if err != nil {
+		return nil, err
+	}
+
+	var amount float64
+	switch mapping.SignConvention {
+	case SignSplit:
+		debit, err := parseOptionalAmount(field(record, columns.debit), mapping.DecimalSeparator)
+		if err != nil {
+			return nil, err
+		}
+		credit, err := parseOptionalAmount(field(record, columns.credit), mapping.DecimalSeparator)
+		if err != nil {
+			return nil, err
+		}
+		// В колонке расхода сумма бывает и со знаком минус, и без него
+		amount = credit - math.Abs(debit)
+	default:
+		raw := field(record, columns.amount)
+		if raw == "" {
+			return nil, errors.New("не указана сумма")
+		}
+		if amount, err = ParseAmount(raw, mapping.DecimalSeparator); err != nil {
+			return nil, err
+		}
+		if mapping.SignConvention == SignInverted {
+			amount = -amount
+		}
+	}
+	if amount == 0 {
+		return nil, errors.New("нулевая сумма")
+	}
+
+	transaction := &models.Transaction{
+		Amount:      math.Abs(amount),
+		Date:        date,
+		Type:        "income",
+		Description: field(record, columns.description),
+		Currency:    strings.ToUpper(field(record, columns.currency)),
+	}
+	if amount < 0 {
+		transaction.Type = "expense"
+	}
+	if transaction.Currency == "" {
+		transaction.Currency = mapping.DefaultCurrency
+	}
+
+	if name := field(record, columns.category); name != "" {
+		if id, ok := categoryIDs[strings.ToLower(name)]; ok {
+			transaction.CategoryID = id
+		}
+	}
+	if transaction.CategoryID == 0 {
+		if mapping.DefaultCategoryID == nil {
+			return nil, fmt.Errorf("категория «%s» не найдена", field(record, columns.category))
+		}
+		transaction.CategoryID = *mapping.DefaultCategoryID
+	}
+	return transaction, nil
+}
+
+// dateFormatTokens переводит привычную запись формата (DD.MM.YYYY) в раскладку Go
+var dateFormatTokens = strings.NewReplacer(
+	"YYYY", "2006",
+	"YY", "06",
+	"MM", "01",
+	"DD", "02",
+	"HH", "15",
+	"mm", "04",
+	"ss", "05",
+)
+
+// ParseDate разбирает дату по формату вида DD.MM.YYYY или, если формат пуст, по распространённым форматам
+func ParseDate(value, format string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("не указана дата")
+	}
+	layouts := defaultDateLayouts
+	if format != "" {
+		layouts = []string{dateFormatTokens.Replace(format)}
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("не удалось разобрать дату «%s»", value)
+}
+
+// ParseAmount разбирает сумму с учётом десятичного разделителя, пробелов между разрядами,
+// символов валют и записи отрицательных сумм в скобках
+func ParseAmount(value, decimalSeparator string) (float64, error) {
+	original := value
+	// Обозначения валют вроде «руб.», «USD» или «₽» рядом с числом отбрасываем
+	value = strings.TrimFunc(value, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsSpace(r) || r == '.' || strings.ContainsRune("$€£₽¥", r)
+	})
+	negative := false
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		negative = true
+		value = value[1 : len(value)-1]
+	}
+
+	thousandsSeparator := ','
+	if decimalSeparator == "," {
+		thousandsSeparator = '.'
+	}
+
+	var b strings.Builder
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case string(r) == decimalSeparator:
+			b.WriteRune('.')
+		case r == '-' || r == '\u2212':
+			negative = !negative
+		case r == '+', r == thousandsSeparator, r == '\'', unicode.IsSpace(r):
+		default:
+			return 0, fmt.Errorf("не удалось разобрать сумму «%s»", original)
+		}
+	}
+
+	amount, err := strconv.ParseFloat(b.String(), 64)
+	if err != nil {
+		return 0, fmt.Errorf("не удалось разобрать сумму «%s»", original)
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+func parseOptionalAmount(value, decimalSeparator string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return ParseAmount(value, decimalSeparator)
+}
@@ -0,0 +1,350 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// Что делать с семейными аккаунтами, которыми владеет удаляемый пользователь
+const (
+	FamilyActionTransfer = "transfer" // передать другому участнику, а если их нет — распустить
+	FamilyActionDissolve = "dissolve"
+)
+
+var ErrDeletionNotScheduled = errors.New("удаление аккаунта не запланировано")
+
+// purgeTables — таблицы с user_id в порядке удаления: сначала зависимые записи, потом те, на которые они ссылаются.
+// Таблицы с user_id, которых здесь нет, удаляются перед ними, чтобы ни одна запись пользователя не осталась.
+var purgeTables = []string{
+	"audit_events",
+	"transaction_imports",
+	"transaction_duplicates",
+	"transaction_attachments",
+	"transaction_splits",
+	"transaction_tags",
+	"recurring_occurrences",
+	"recurring_transactions",
+	"transactionhistory",
+	"transactions",
+	"accounts",
+	"budgets",
+	"goals",
+	"payment_reminders",
+	"notifications",
+	"reports",
+	"import_mappings",
+	"categorization_rules",
+	"categories",
+	"tags",
+	"usersettings",
+	"family_memberships",
+	"sessions",
+	"user_tokens",
+	"login_challenges",
+	"totp_recovery_codes",
+	"user_totp",
+	"api_tokens",
+	"user_identities",
+	"data_exports",
+	"user_roles",
+	"account_deletions",
+}
+
+const accountDeletionColumns = `user_id, requested_at, requested_by, scheduled_for, family_action, transfer_to_user_id`
+
+func scanAccountDeletion(row pgx.Row) (*models.AccountDeletion, error) {
+	deletion := &models.AccountDeletion{}
+	err := row.Scan(
+		&deletion.UserID,
+		&deletion.RequestedAt,
+		&deletion.RequestedBy,
+		&deletion.ScheduledFor,
+		&deletion.FamilyAction,
+		&deletion.TransferToUserID,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrDeletionNotScheduled
+		}
+		return nil, fmt.Errorf("ошибка при получении запроса на удаление: %v", err)
+	}
+	return deletion, nil
+}
+
+// ScheduleAccountDeletion планирует удаление аккаунта; повторный запрос заменяет предыдущий
+func ScheduleAccountDeletion(pool *pgxpool.Pool, deletion *models.AccountDeletion) error {
+	query := `
+		INSERT INTO account_deletions (user_id, requested_by, scheduled_for, family_action, transfer_to_user_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id) DO UPDATE
+		SET requested_at = NOW(),
+			requested_by = EXCLUDED.requested_by,
+			scheduled_for = EXCLUDED.scheduled_for,
+			family_action = EXCLUDED.family_action,
+			transfer_to_user_id = EXCLUDED.transfer_to_user_id
+		RETURNING ` + accountDeletionColumns
+
+	saved, err := scanAccountDeletion(pool.QueryRow(context.Background(), query,
+		deletion.UserID,
+		deletion.RequestedBy,
+		deletion.ScheduledFor,
+		deletion.FamilyAction,
+		deletion.TransferToUserID))
+	if err != nil {
+		return err
+	}
+	*deletion = *saved
+	return nil
+}
+
+// GetAccountDeletion возвращает запланированное удаление аккаунта
+func GetAccountDeletion(pool *pgxpool.Pool, userID int) (*models.AccountDeletion, error) {
+	query := `SELECT ` + accountDeletionColumns + ` FROM account_deletions WHERE user_id = $1`
+	return scanAccountDeletion(pool.QueryRow(context.Background(), query, userID))
+}
+
+// CancelAccountDeletion отменяет запланированное удаление
+func CancelAccountDeletion(pool *pgxpool.Pool, userID int) error {
+	result, err := pool.Exec(context.Background(), `DELETE FROM account_deletions WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при отмене удаления аккаунта: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrDeletionNotScheduled
+	}
+	return nil
+}
+
+// GetDueAccountDeletions возвращает удаления, у которых истёк срок ожидания
+func GetDueAccountDeletions(pool *pgxpool.Pool) ([]models.AccountDeletion, error) {
+	query := `SELECT ` + accountDeletionColumns + ` FROM account_deletions WHERE scheduled_for <= NOW() ORDER BY scheduled_for`
+
+	rows, err := pool.Query(context.Background(), query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении удалений аккаунтов: %v", err)
+	}
+	defer rows.Close()
+
+	var deletions []models.AccountDeletion
+	for rows.Next() {
+		deletion, err := scanAccountDeletion(rows)
+		if err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, *deletion)
+	}
+	return deletions, nil
+}
+
+// IsMemberOfOwnedFamily сообщает, состоит ли memberID в семейном аккаунте, которым владеет ownerID
+func IsMemberOfOwnedFamily(pool *pgxpool.Pool, ownerID, memberID int) (bool, error) {
+	query := `
+		SELECT EXISTS(
+			SELECT 1
+			FROM family_memberships fm
+			JOIN family_accounts fa ON fa.id = fm.family_account_id
+			WHERE fa.owner_user_id = $1 AND fm.user_id = $2 AND fm.user_id <> $1
+		)`
+
+	var member bool
+	if err := pool.QueryRow(context.Background(), query, ownerID, memberID).Scan(&member); err != nil {
+		return false, fmt.Errorf("ошибка при проверке участника семьи: %v", err)
+	}
+	return member, nil
+}
+
+// PurgeUser в одной транзакции передаёт или распускает семейные аккаунты пользователя и удаляет
+// все его записи. Возвращает пути файлов выгрузок, которые нужно удалить после фиксации.
+func PurgeUser(pool *pgxpool.Pool, userID int, familyAction string, transferTo *int) ([]string, error) {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	var email string
+	err = tx.QueryRow(context.Background(), `SELECT email FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("ошибка при блокировке пользователя: %v", err)
+	}
+
+	// Журнал безопасности защищён от удаления; снимаем защиту только в этой транзакции
+	if _, err := tx.Exec(context.Background(), `SELECT set_config('app.allow_audit_purge', 'on', true)`); err != nil {
+		return nil, fmt.Errorf("ошибка при подготовке удаления журнала: %v", err)
+	}
+
+	files, err := collectExportFiles(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := releaseOwnedFamilies(tx, userID, familyAction, transferTo); err != nil {
+		return nil, err
+	}
+
+	extraTables, err := unlistedUserTables(tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, table := range append(extraTables, purgeTables...) {
+		query := `DELETE FROM ` + pgx.Identifier{table}.Sanitize() + ` WHERE user_id = $1`
+		if _, err := tx.Exec(context.Background(), query, userID); err != nil {
+			return nil, fmt.Errorf("ошибка при удалении данных из %s: %v", table, err)
+		}
+	}
+
+	throttleQuery := `DELETE FROM login_throttle WHERE scope = $1 AND key = LOWER($2)`
+	if _, err := tx.Exec(context.Background(), throttleQuery, ThrottleScopeAccount, email); err != nil {
+		return nil, fmt.Errorf("ошибка при удалении счётчиков входа: %v", err)
+	}
+
+	if _, err := tx.Exec(context.Background(), `DELETE FROM users WHERE id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("ошибка удаления пользователя: %v", err)
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return nil, fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	forgetCategoryModel(userID)
+	return files, nil
+}
+
+func collectExportFiles(tx pgx.Tx, userID int) ([]string, error) {
+	rows, err := tx.Query(context.Background(), `SELECT file_path FROM data_exports WHERE user_id = $1 AND file_path <> ''`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении выгрузок пользователя: %v", err)
+	}
+	defer rows.Close()
+
+	var files []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании выгрузки: %v", err)
+		}
+		files = append(files, path)
+	}
+	return files, rows.Err()
+}
+
+// unlistedUserTables находит таблицы со столбцом user_id, не перечисленные в purgeTables
+func unlistedUserTables(tx pgx.Tx) ([]string, error) {
+	query := `
+		SELECT table_name
+		FROM information_schema.columns
+		WHERE table_schema = current_schema()
+			AND column_name = 'user_id'
+			AND table_name <> ALL($1)
+			AND table_name IN (SELECT table_name FROM information_schema.tables
+				WHERE table_schema = current_schema() AND table_type = 'BASE TABLE')
+		ORDER BY table_name`
+
+	rows, err := tx.Query(context.Background(), query, purgeTables)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при поиске таблиц пользователя: %v", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании таблицы: %v", err)
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+// releaseOwnedFamilies передаёт семейные аккаунты пользователя другим участникам или распускает их
+func releaseOwnedFamilies(tx pgx.Tx, userID int, familyAction string, transferTo *int) error {
+	rows, err := tx.Query(context.Background(), `SELECT id, nickname FROM family_accounts WHERE owner_user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при получении семейных аккаунтов: %v", err)
+	}
+	var families []models.FamilyAccount
+	for rows.Next() {
+		var family models.FamilyAccount
+		if err := rows.Scan(&family.ID, &family.Nickname); err != nil {
+			rows.Close()
+			return fmt.Errorf("ошибка при сканировании семейного аккаунта: %v", err)
+		}
+		families = append(families, family)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка при получении семейных аккаунтов: %v", err)
+	}
+
+	for _, family := range families {
+		if familyAction == FamilyActionTransfer {
+			heirID, err := chooseFamilyHeir(tx, family.ID, userID, transferTo)
+			if err != nil {
+				return err
+			}
+			if heirID != 0 {
+				if _, err := tx.Exec(context.Background(), `UPDATE family_accounts SET owner_user_id = $1 WHERE id = $2`, heirID, family.ID); err != nil {
+					return fmt.Errorf("ошибка при передаче семейного аккаунта: %v", err)
+				}
+				message := fmt.Sprintf("Вы стали владельцем семейного аккаунта «%s»: прежний владелец удалил свой аккаунт.", family.Nickname)
+				if _, err := tx.Exec(context.Background(),
+					`INSERT INTO notifications (user_id, message, is_read, datewhen) VALUES ($1, $2, FALSE, NOW())`,
+					heirID, message); err != nil {
+					return fmt.Errorf("ошибка при создании уведомления: %v", err)
+				}
+				continue
+			}
+		}
+
+		// Распускаем семью: участников предупреждаем до удаления их членства
+		message := fmt.Sprintf("Семейный аккаунт «%s» распущен: его владелец удалил свой аккаунт.", family.Nickname)
+		notifyQuery := `
+			INSERT INTO notifications (user_id, message, is_read, datewhen)
+			SELECT user_id, $2, FALSE, NOW() FROM family_memberships
+			WHERE family_account_id = $1 AND user_id <> $3`
+		if _, err := tx.Exec(context.Background(), notifyQuery, family.ID, message, userID); err != nil {
+			return fmt.Errorf("ошибка при создании уведомлений: %v", err)
+		}
+		if _, err := tx.Exec(context.Background(), `DELETE FROM family_memberships WHERE family_account_id = $1`, family.ID); err != nil {
+			return fmt.Errorf("ошибка при удалении участников семьи: %v", err)
+		}
+		if _, err := tx.Exec(context.Background(), `DELETE FROM family_accounts WHERE id = $1`, family.ID); err != nil {
+			return fmt.Errorf("ошибка при удалении семейного аккаунта: %v", err)
+		}
+	}
+	return nil
+}
+
+// chooseFamilyHeir выбирает нового владельца: указанного пользователя, если он участник семьи,
+// иначе взрослого участника с самым ранним аккаунтом. 0 — других участников нет.
+func chooseFamilyHeir(tx pgx.Tx, familyID, ownerID int, transferTo *int) (int, error) {
+	query := `
+		SELECT user_id
+		FROM family_memberships
+		WHERE family_account_id = $1 AND user_id <> $2
+		ORDER BY (user_id = $3) DESC, (role = 'adult') DESC, user_id
+		LIMIT 1`
+
+	preferred := 0
+	if transferTo != nil {
+		preferred = *transferTo
+	}
+
+	var heirID int
+	err := tx.QueryRow(context.Background(), query, familyID, ownerID, preferred).Scan(&heirID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("ошибка при выборе нового владельца семьи: %v", err)
+	}
+	return heirID, nil
+}
@@ -0,0 +1,376 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+var (
+	ErrAccountNotFound = errors.New("счёт не найден")
+	ErrAccountInUse    = errors.New("по счёту есть операции: его нельзя удалить или сменить ему валюту")
+	ErrInvalidAccount  = errors.New("некорректный счёт")
+	ErrInvalidTransfer = errors.New("некорректный перевод")
+)
+
+var accountTypes = map[string]bool{"cash": true, "debit_card": true, "credit_card": true, "savings": true, "deposit": true}
+
+// Основной счёт заводится автоматически для операций, у которых счёт не указан
+const (
+	defaultAccountName = "Основной счёт"
+	defaultAccountType = "cash"
+)
+
+const accountColumns = `id, user_id, name, type, currency, opening_balance, created_at, updated_at`
+
+func scanAccount(row pgx.Row) (*models.Account, error) {
+	account := &models.Account{}
+	err := row.Scan(
+		&account.ID,
+		&account.UserID,
+		&account.Name,
+		&account.Type,
+		&account.Currency,
+		&account.OpeningBalance,
+		&account.CreatedAt,
+		&account.UpdatedAt,
+	)
+	return account, err
+}
+
+// validateAccount проверяет и нормализует название, тип и валюту счёта
+func validateAccount(account *models.Account) error {
+	account.Name = strings.TrimSpace(account.Name)
+	account.Currency = strings.ToUpper(strings.TrimSpace(account.Currency))
+	if account.Name == "" {
+		return fmt.Errorf("%w: укажите название", ErrInvalidAccount)
+	}
+	if !accountTypes[account.Type] {
+		return fmt.Errorf("%w: тип должен быть cash, debit_card, credit_card, savings или deposit", ErrInvalidAccount)
+	}
+	if len(account.Currency) != 3 {
+		return fmt.Errorf("%w: укажите трёхбуквенный код валюты", ErrInvalidAccount)
+	}
+	return nil
+}
+
+// GetAccountsByUserID возвращает счета пользователя в порядке создания; первый из них — основной
+func GetAccountsByUserID(pool *pgxpool.Pool, userID int) ([]models.Account, error) {
+	query := `SELECT ` + accountColumns + ` FROM accounts WHERE user_id = $1 ORDER BY id`
+	rows, err := pool.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении счетов: %v", err)
+	}
+	defer rows.Close()
+
+	accounts := []models.Account{}
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании счёта: %v", err)
+		}
+		accounts = append(accounts, *account)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при получении счетов: %v", err)
+	}
+	return accounts, nil
+}
+
+// CreateAccount добавляет счёт пользователю
+func CreateAccount(pool *pgxpool.Pool, account *models.Account) error {
+	if err := validateAccount(account); err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO accounts (user_id, name, type, currency, opening_balance)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at`
+	err := pool.QueryRow(context.Background(), query,
+		account.UserID,
+		account.Name,
+		account.Type,
+		account.Currency,
+		account.OpeningBalance).Scan(&account.ID, &account.CreatedAt, &account.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании счёта: %v", err)
+	}
+	return nil
+}
+
+// UpdateAccount меняет название, тип, валюту и начальный остаток. Валюту можно сменить,
+// только пока по счёту нет операций: суммы операций записаны в прежней валюте.
+func UpdateAccount(pool *pgxpool.Pool, account *models.Account) error {
+	if err := validateAccount(account); err != nil {
+		return err
+	}
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	var currency string
+	err = tx.QueryRow(context.Background(), `SELECT currency FROM accounts WHERE id = $1 AND user_id = $2 FOR UPDATE`,
+		account.ID, account.UserID).Scan(&currency)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrAccountNotFound
+		}
+		return fmt.Errorf("ошибка при получении счёта: %v", err)
+	}
+	if currency != account.Currency {
+		used, err := accountInUse(tx, account.ID)
+		if err != nil {
+			return err
+		}
+		if used {
+			return ErrAccountInUse
+		}
+	}
+
+	query := `
+		UPDATE accounts SET name = $3, type = $4, currency = $5, opening_balance = $6, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+		RETURNING created_at, updated_at`
+	err = tx.QueryRow(context.Background(), query,
+		account.ID,
+		account.UserID,
+		account.Name,
+		account.Type,
+		account.Currency,
+		account.OpeningBalance).Scan(&account.CreatedAt, &account.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении счёта: %v", err)
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return nil
+}
+
+// DeleteAccount удаляет счёт без операций, в том числе архивных
+func DeleteAccount(pool *pgxpool.Pool, userID, accountID int) error {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	var exists bool
+	err = tx.QueryRow(context.Background(), `SELECT EXISTS(SELECT 1 FROM accounts WHERE id = $1 AND user_id = $2)`,
+		accountID, userID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("ошибка при получении счёта: %v", err)
+	}
+	if !exists {
+		return ErrAccountNotFound
+	}
+	used, err := accountInUse(tx, accountID)
+	if err != nil {
+		return err
+	}
+	if used {
+		return ErrAccountInUse
+	}
+
+	if _, err := tx.Exec(context.Background(), `DELETE FROM accounts WHERE id = $1 AND user_id = $2`, accountID, userID); err != nil {
+		return fmt.Errorf("ошибка при удалении счёта: %v", err)
+	}
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return nil
+}
+
+func accountInUse(tx pgx.Tx, accountID int) (bool, error) {
+	query := `
+		SELECT EXISTS(SELECT 1 FROM transactions WHERE account_id = $1 OR transfer_account_id = $1)
+			OR EXISTS(SELECT 1 FROM transactionhistory WHERE account_id = $1 OR transfer_account_id = $1)
+			OR EXISTS(SELECT 1 FROM recurring_transactions WHERE account_id = $1 OR transfer_account_id = $1)`
+	var used bool
+	if err := tx.QueryRow(context.Background(), query, accountID).Scan(&used); err != nil {
+		return false, fmt.Errorf("ошибка при проверке операций по счёту: %v", err)
+	}
+	return used, nil
+}
+
+// defaultAccountID возвращает основной (первый) счёт пользователя, при необходимости заводя его
+// в валюте из настроек пользователя
+func defaultAccountID(tx pgx.Tx, userID int) (int, error) {
+	selectQuery := `SELECT id FROM accounts WHERE user_id = $1 ORDER BY id LIMIT 1`
+	var accountID int
+	err := tx.QueryRow(context.Background(), selectQuery, userID).Scan(&accountID)
+	if err == nil {
+		return accountID, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("ошибка при получении основного счёта: %v", err)
+	}
+
+	// Блокировка пользователя не даёт параллельным запросам завести два основных счёта
+	if _, err := tx.Exec(context.Background(), `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return 0, fmt.Errorf("ошибка при создании основного счёта: %v", err)
+	}
+	err = tx.QueryRow(context.Background(), selectQuery, userID).Scan(&accountID)
+	if err == nil {
+		return accountID, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("ошибка при получении основного счёта: %v", err)
+	}
+	insertQuery := `
+		INSERT INTO accounts (user_id, name, type, currency)
+		VALUES ($1, $2, $3,
+			COALESCE((SELECT NULLIF(s.currency, '') FROM usersettings s WHERE s.user_id = $1 LIMIT 1), 'USD'))
+		RETURNING id`
+	if err := tx.QueryRow(context.Background(), insertQuery, userID, defaultAccountName, defaultAccountType).Scan(&accountID); err != nil {
+		return 0, fmt.Errorf("ошибка при создании основного счёта: %v", err)
+	}
+	return accountID, nil
+}
+
+// accountCurrency возвращает валюту счёта, если он принадлежит пользователю
+func accountCurrency(tx pgx.Tx, userID, accountID int) (string, error) {
+	var currency string
+	err := tx.QueryRow(context.Background(), `SELECT currency FROM accounts WHERE id = $1 AND user_id = $2`,
+		accountID, userID).Scan(&currency)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", ErrAccountNotFound
+		}
+		return "", fmt.Errorf("ошибка при получении счёта: %v", err)
+	}
+	return currency, nil
+}
+
+// prepareTransactionAccount проверяет счёт транзакции (без счёта — основной) и поля перевода.
+// Валюта транзакции по умолчанию — валюта счёта. Сумма зачисления перевода между счетами
+// в одной валюте по умолчанию равна сумме списания, между разными валютами её нужно указать.
+func prepareTransactionAccount(tx pgx.Tx, transaction *models.Transaction) error {
+	var err error
+	if transaction.AccountID == 0 {
+		if transaction.AccountID, err = defaultAccountID(tx, transaction.UserID); err != nil {
+			return err
+		}
+	}
+	currency, err := accountCurrency(tx, transaction.UserID, transaction.AccountID)
+	if err != nil {
+		return err
+	}
+	if transaction.Currency == "" {
+		transaction.Currency = currency
+	}
+
+	if transaction.Type != "transfer" {
+		transaction.TransferAccountID = nil
+		transaction.TransferAmount = nil
+		return nil
+	}
+
+	if len(transaction.Splits) > 0 {
+		return fmt.Errorf("%w: перевод нельзя разделить по категориям", ErrInvalidTransfer)
+	}
+	if transaction.TransferAccountID == nil || *transaction.TransferAccountID == transaction.AccountID {
+		return fmt.Errorf("%w: укажите другой счёт зачисления в transfer_account_id", ErrInvalidTransfer)
+	}
+	targetCurrency, err := accountCurrency(tx, transaction.UserID, *transaction.TransferAccountID)
+	if err != nil {
+		if errors.Is(err, ErrAccountNotFound) {
+			return fmt.Errorf("%w: счёт зачисления не найден", ErrInvalidTransfer)
+		}
+		return err
+	}
+	if transaction.TransferAmount == nil {
+		if targetCurrency != currency {
+			return fmt.Errorf("%w: счета в разных валютах, укажите сумму зачисления в transfer_amount", ErrInvalidTransfer)
+		}
+		amount := transaction.Amount
+		transaction.TransferAmount = &amount
+	}
+	if toCents(transaction.Amount) <= 0 || toCents(*transaction.TransferAmount) <= 0 {
+		return fmt.Errorf("%w: суммы перевода должны быть положительными", ErrInvalidTransfer)
+	}
+	return nil
+}
+
+// AccountBalance — остаток счёта и обороты, из которых он складывается, в валюте счёта
+type AccountBalance struct {
+	AccountID      int     `json:"account_id"`
+	Name           string  `json:"name"`
+	Type           string  `json:"type"`
+	Currency       string  `json:"currency"`
+	OpeningBalance float64 `json:"opening_balance"`
+	Income         float64 `json:"income"`
+	Expense        float64 `json:"expense"` // расходы и отчисления на цели
+	TransfersIn    float64 `json:"transfers_in"`
+	TransfersOut   float64 `json:"transfers_out"`
+	Balance        float64 `json:"balance"`
+}
+
+// GetAccountBalances считает остатки счетов пользователя по текущим и архивным операциям.
+// accountID > 0 ограничивает расчёт одним счётом.
+func GetAccountBalances(pool *pgxpool.Pool, userID, accountID int) ([]AccountBalance, error) {
+	query := `
+		WITH moves AS (
+			SELECT account_id, transfer_account_id, type, amount, transfer_amount FROM transactions WHERE user_id = $1
+			UNION ALL
+			SELECT account_id, transfer_account_id, type, amount, transfer_amount FROM transactionhistory WHERE user_id = $1
+		)
+		SELECT a.id, a.name, a.type, a.currency, a.opening_balance,
+			COALESCE(SUM(m.amount) FILTER (WHERE m.account_id = a.id AND m.type = 'income'), 0),
+			COALESCE(SUM(m.amount) FILTER (WHERE m.account_id = a.id AND m.type IN ('expense', 'goal')), 0),
+			COALESCE(SUM(m.transfer_amount) FILTER (WHERE m.transfer_account_id = a.id AND m.type = 'transfer'), 0),
+			COALESCE(SUM(m.amount) FILTER (WHERE m.account_id = a.id AND m.type = 'transfer'), 0)
+		FROM accounts a
+		LEFT JOIN moves m ON m.account_id = a.id OR m.transfer_account_id = a.id
+		WHERE a.user_id = $1 AND ($2 = 0 OR a.id = $2)
+		GROUP BY a.id
+		ORDER BY a.id`
+	rows, err := pool.Query(context.Background(), query, userID, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при расчёте остатков счетов: %v", err)
+	}
+	defer rows.Close()
+
+	balances := []AccountBalance{}
+	for rows.Next() {
+		var b AccountBalance
+		if err := rows.Scan(&b.AccountID, &b.Name, &b.Type, &b.Currency, &b.OpeningBalance,
+			&b.Income, &b.Expense, &b.TransfersIn, &b.TransfersOut); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании остатка счёта: %v", err)
+		}
+		b.Balance = float64(toCents(b.OpeningBalance)+toCents(b.Income)-toCents(b.Expense)+
+			toCents(b.TransfersIn)-toCents(b.TransfersOut)) / 100
+		balances = append(balances, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при расчёте остатков счетов: %v", err)
+	}
+	if accountID > 0 && len(balances) == 0 {
+		return nil, ErrAccountNotFound
+	}
+	return balances, nil
+}
+
+// ConvertAccountCurrency переводит счёт в другую валюту с пересчётом начального остатка по курсу.
+// Операции по счёту пересчитывает вызывающий, как при смене валюты пользователя.
+func ConvertAccountCurrency(pool *pgxpool.Pool, userID, accountID int, currency string, rate float64) error {
+	query := `
+		UPDATE accounts SET currency = $3, opening_balance = ROUND(opening_balance * $4::NUMERIC, 2), updated_at = NOW()
+		WHERE id = $1 AND user_id = $2`
+	result, err := pool.Exec(context.Background(), query, accountID, userID, currency, rate)
+	if err != nil {
+		return fmt.Errorf("ошибка при пересчёте счёта: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrAccountNotFound
+	}
+	return nil
+}
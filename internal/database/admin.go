@@ -85,13 +85,12 @@ func GetUserRoles(pool *pgxpool.Pool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		query := `
 			SELECT 
-				CASE 
-					WHEN is_admin = true THEN 'admin'
-					ELSE 'user'
-				END AS role,
-				COUNT(*) 
-			FROM users 
-			GROUP BY role
+				r.name AS role,
+				COUNT(ur.user_id) 
+			FROM roles r
+			LEFT JOIN user_roles ur ON ur.role_id = r.id
+			GROUP BY r.id, r.name
+			ORDER BY r.id
 		`
 
 		rows, err := pool.Query(context.Background(), query)
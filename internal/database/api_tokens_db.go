@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+var ErrAPITokenNotFound = errors.New("токен не найден или отозван")
+
+// CreateAPIToken сохраняет персональный токен; в базе хранится только его хеш
+func CreateAPIToken(pool *pgxpool.Pool, token *models.APIToken, tokenHash string) error {
+	query := `
+		INSERT INTO api_tokens (user_id, name, token_hash, token_prefix, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+	err := pool.QueryRow(context.Background(), query,
+		token.UserID,
+		token.Name,
+		tokenHash,
+		token.Prefix,
+		token.Scopes,
+		token.ExpiresAt).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании токена: %v", err)
+	}
+	return nil
+}
+
+// GetActiveAPIToken находит действующий токен по хешу и отмечает его использование
+func GetActiveAPIToken(pool *pgxpool.Pool, tokenHash string) (*models.APIToken, error) {
+	query := `
+		UPDATE api_tokens
+		SET last_used_at = CASE
+				WHEN last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute' THEN NOW()
+				ELSE last_used_at
+			END
+		WHERE token_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+		RETURNING id, user_id, name, token_prefix, scopes, created_at, last_used_at, expires_at`
+
+	token := &models.APIToken{}
+	err := pool.QueryRow(context.Background(), query, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.Prefix,
+		&token.Scopes,
+		&token.CreatedAt,
+		&token.LastUsedAt,
+		&token.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAPITokenNotFound
+		}
+		return nil, fmt.Errorf("ошибка при проверке токена: %v", err)
+	}
+	return token, nil
+}
+
+// GetAPITokensByUserID возвращает неотозванные токены пользователя
+func GetAPITokensByUserID(pool *pgxpool.Pool, userID int) ([]models.APIToken, error) {
+	query := `
+		SELECT id, user_id, name, token_prefix, scopes, created_at, last_used_at, expires_at
+		FROM api_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC`
+
+	rows, err := pool.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении токенов: %v", err)
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		var token models.APIToken
+		if err := rows.Scan(
+			&token.ID,
+			&token.UserID,
+			&token.Name,
+			&token.Prefix,
+			&token.Scopes,
+			&token.CreatedAt,
+			&token.LastUsedAt,
+			&token.ExpiresAt,
+		); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании токена: %v", err)
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// RevokeAPIToken отзывает токен пользователя
+func RevokeAPIToken(pool *pgxpool.Pool, tokenID, userID int) error {
+	query := `
+		UPDATE api_tokens
+		SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+
+	result, err := pool.Exec(context.Background(), query, tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при отзыве токена: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// MaxAttachmentsPerTransaction ограничивает число вложений одной транзакции
+const MaxAttachmentsPerTransaction = 20
+
+var (
+	ErrAttachmentNotFound = errors.New("вложение не найдено")
+	ErrAttachmentTarget   = errors.New("транзакция для вложения не найдена")
+	ErrTooManyAttachments = fmt.Errorf("к транзакции можно приложить не больше %d файлов", MaxAttachmentsPerTransaction)
+)
+
+const attachmentColumns = `id, user_id, transaction_id, history_id, file_name, content_type, size_bytes, storage_key,
+	thumbnail_key, created_at`
+
+func scanAttachment(row pgx.Row) (*models.Attachment, error) {
+	var attachment models.Attachment
+	err := row.Scan(
+		&attachment.ID,
+		&attachment.UserID,
+		&attachment.TransactionID,
+		&attachment.HistoryID,
+		&attachment.FileName,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.StorageKey,
+		&attachment.ThumbnailKey,
+		&attachment.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	attachment.HasThumbnail = attachment.ThumbnailKey != nil
+	return &attachment, nil
+}
+
+// CreateAttachment сохраняет описание уже загруженного в хранилище файла. Транзакция блокируется,
+// чтобы параллельные загрузки не превысили MaxAttachmentsPerTransaction.
+func CreateAttachment(pool *pgxpool.Pool, attachment *models.Attachment) error {
+	if attachment.TransactionID == nil {
+		return ErrAttachmentTarget
+	}
+
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	var transactionID int
+	err = tx.QueryRow(context.Background(), `SELECT id FROM transactions WHERE id = $1 AND user_id = $2 FOR UPDATE`,
+		*attachment.TransactionID, attachment.UserID).Scan(&transactionID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrAttachmentTarget
+		}
+		return fmt.Errorf("ошибка при получении транзакции: %v", err)
+	}
+	var count int
+	err = tx.QueryRow(context.Background(), `SELECT COUNT(*) FROM transaction_attachments WHERE transaction_id = $1`,
+		transactionID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке вложений транзакции: %v", err)
+	}
+	if count >= MaxAttachmentsPerTransaction {
+		return ErrTooManyAttachments
+	}
+
+	query := `
+		INSERT INTO transaction_attachments (user_id, transaction_id, file_name, content_type, size_bytes, storage_key, thumbnail_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+	err = tx.QueryRow(context.Background(), query,
+		attachment.UserID,
+		attachment.TransactionID,
+		attachment.FileName,
+		attachment.ContentType,
+		attachment.Size,
+		attachment.StorageKey,
+		attachment.ThumbnailKey).Scan(&attachment.ID, &attachment.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении вложения: %v", err)
+	}
+	attachment.HasThumbnail = attachment.ThumbnailKey != nil
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return nil
+}
+
+// GetTransactionAttachments возвращает вложения текущей транзакции пользователя в порядке загрузки
+func GetTransactionAttachments(pool *pgxpool.Pool, userID, transactionID int) ([]models.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM transaction_attachments WHERE user_id = $1 AND transaction_id = $2 ORDER BY id`
+	rows, err := pool.Query(context.Background(), query, userID, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении вложений: %v", err)
+	}
+	defer rows.Close()
+
+	list := []models.Attachment{}
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании вложения: %v", err)
+		}
+		list = append(list, *attachment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при получении вложений: %v", err)
+	}
+	return list, nil
+}
+
+// GetAttachment возвращает вложение пользователя, в том числе приложенное к архивной транзакции
+func GetAttachment(pool *pgxpool.Pool, userID, attachmentID int) (*models.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM transaction_attachments WHERE id = $1 AND user_id = $2`
+	attachment, err := scanAttachment(pool.QueryRow(context.Background(), query, attachmentID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrAttachmentNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении вложения: %v", err)
+	}
+	return attachment, nil
+}
+
+// DeleteAttachment удаляет вложение; его файлы ставит в очередь на удаление триггер БД
+func DeleteAttachment(pool *pgxpool.Pool, userID, attachmentID int) error {
+	result, err := pool.Exec(context.Background(),
+		`DELETE FROM transaction_attachments WHERE id = $1 AND user_id = $2`, attachmentID, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при удалении вложения: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrAttachmentNotFound
+	}
+	return nil
+}
+
+// GetBlobDeletions возвращает ключи файлов из очереди на удаление, самые старые первыми
+func GetBlobDeletions(pool *pgxpool.Pool, limit int) ([]string, error) {
+	rows, err := pool.Query(context.Background(),
+		`SELECT storage_key FROM blob_deletions ORDER BY created_at LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении очереди удаления файлов: %v", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании очереди удаления файлов: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при получении очереди удаления файлов: %v", err)
+	}
+	return keys, nil
+}
+
+// CompleteBlobDeletion убирает из очереди ключ файла, удалённого из хранилища
+func CompleteBlobDeletion(pool *pgxpool.Pool, key string) error {
+	if _, err := pool.Exec(context.Background(), `DELETE FROM blob_deletions WHERE storage_key = $1`, key); err != nil {
+		return fmt.Errorf("ошибка при обновлении очереди удаления файлов: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// Типы событий журнала безопасности
+const (
+	AuditRegistered               = "account.registered"
+	AuditLoginSucceeded           = "login.succeeded"
+	AuditLoginFailed              = "login.failed"
+	AuditLoginLocked              = "login.locked"
+	AuditLogout                   = "logout"
+	AuditSessionRevoked           = "session.revoked"
+	AuditPasswordReset            = "password.reset"
+	AuditPasswordChanged          = "password.changed"
+	AuditPasswordResetRequested   = "password.reset_requested"
+	AuditEmailVerified            = "email.verified"
+	AuditUserUpdated              = "user.updated"
+	AuditUserCreated              = "user.created"
+	AuditRoleGranted              = "role.granted"
+	AuditRoleRevoked              = "role.revoked"
+	AuditSettingsUpdated          = "settings.updated"
+	AuditFamilyCreated            = "family.created"
+	AuditFamilyJoined             = "family.joined"
+	AuditTwoFactorEnabled         = "2fa.enabled"
+	AuditTwoFactorDisabled        = "2fa.disabled"
+	AuditRecoveryCodesRegenerated = "2fa.recovery_codes_regenerated"
+	AuditAPITokenCreated          = "api_token.created"
+	AuditAPITokenRevoked          = "api_token.revoked"
+	AuditDeletionScheduled        = "account.deletion_scheduled"
+	AuditDeletionCancelled        = "account.deletion_cancelled"
+	AuditAccountDeleted           = "account.deleted"
+	AuditDataExportRequested      = "data_export.requested"
+)
+
+// Ограничения на размер страницы журнала
+const (
+	DefaultAuditPageSize = 50
+	MaxAuditPageSize     = 200
+)
+
+// AuditFilter — условия выборки журнала; нулевые поля не ограничивают выборку
+type AuditFilter struct {
+	UserID    int
+	ActorID   int
+	EventType string
+	IPAddress string
+	From      time.Time
+	To        time.Time
+	BeforeID  int64 // постраничный вывод: только записи старше этой
+	Limit     int
+}
+
+// InsertAuditEvent добавляет запись в журнал безопасности
+func InsertAuditEvent(pool *pgxpool.Pool, event *models.AuditEvent) error {
+	if event.Details == nil {
+		event.Details = map[string]interface{}{}
+	}
+
+	query := `
+		INSERT INTO audit_events (event_type, user_id, actor_id, ip_address, user_agent, details)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, occurred_at`
+	err := pool.QueryRow(context.Background(), query,
+		event.EventType,
+		event.UserID,
+		event.ActorID,
+		event.IPAddress,
+		event.UserAgent,
+		event.Details).Scan(&event.ID, &event.OccurredAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при записи в журнал безопасности: %v", err)
+	}
+	return nil
+}
+
+// GetAuditEvents возвращает записи журнала от новых к старым
+func GetAuditEvents(pool *pgxpool.Pool, filter AuditFilter) ([]models.AuditEvent, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.UserID > 0 {
+		addCondition("user_id = $%d", filter.UserID)
+	}
+	if filter.ActorID > 0 {
+		addCondition("actor_id = $%d", filter.ActorID)
+	}
+	if filter.EventType != "" {
+		addCondition("event_type = $%d", filter.EventType)
+	}
+	if filter.IPAddress != "" {
+		addCondition("ip_address = $%d", filter.IPAddress)
+	}
+	if !filter.From.IsZero() {
+		addCondition("occurred_at >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("occurred_at < $%d", filter.To)
+	}
+	if filter.BeforeID > 0 {
+		addCondition("id < $%d", filter.BeforeID)
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultAuditPageSize
+	}
+	if filter.Limit > MaxAuditPageSize {
+		filter.Limit = MaxAuditPageSize
+	}
+
+	query := `SELECT id, occurred_at, event_type, user_id, actor_id, ip_address, user_agent, details FROM audit_events`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(` ORDER BY id DESC LIMIT $%d`, len(args))
+
+	rows, err := pool.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении журнала безопасности: %v", err)
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var event models.AuditEvent
+		if err := rows.Scan(
+			&event.ID,
+			&event.OccurredAt,
+			&event.EventType,
+			&event.UserID,
+			&event.ActorID,
+			&event.IPAddress,
+			&event.UserAgent,
+			&event.Details,
+		); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании записи журнала: %v", err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
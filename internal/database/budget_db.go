@@ -164,6 +164,73 @@ func DeductFromBudget(pool *pgxpool.Pool, categoryID int, amount float64, transa
 	return nil
 }
 
+// DeductTransactionFromBudgets вычитает расход из бюджетов его категорий: разделённую транзакцию —
+// по частям, каждую из бюджета своей категории. Категории без бюджета на дату транзакции пропускаются,
+// перерасход оставляет в бюджете отрицательный остаток. Списание либо проходит для всех категорий, либо ни для одной.
+func DeductTransactionFromBudgets(pool *pgxpool.Pool, transaction models.Transaction) error {
+	return changeTransactionBudgets(pool, nil, &transaction)
+}
+
+// ReturnTransactionToBudgets возвращает в бюджеты то, что списала удалённая транзакция
+func ReturnTransactionToBudgets(pool *pgxpool.Pool, transaction models.Transaction) error {
+	return changeTransactionBudgets(pool, &transaction, nil)
+}
+
+// UpdateTransactionBudgets переносит списание изменённой транзакции: прежние суммы возвращаются
+// в бюджеты своих категорий, новые списываются
+func UpdateTransactionBudgets(pool *pgxpool.Pool, old, updated models.Transaction) error {
+	return changeTransactionBudgets(pool, &old, &updated)
+}
+
+// changeTransactionBudgets возвращает в бюджеты расход returned и списывает расход deducted в одной транзакции БД
+func changeTransactionBudgets(pool *pgxpool.Pool, returned, deducted *models.Transaction) error {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	if returned != nil {
+		if err := addToBudgets(tx, *returned, 1); err != nil {
+			return err
+		}
+	}
+	if deducted != nil {
+		if err := addToBudgets(tx, *deducted, -1); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return nil
+}
+
+// addToBudgets меняет остатки бюджетов на суммы расхода по категориям, умноженные на sign
+func addToBudgets(tx pgx.Tx, transaction models.Transaction, sign float64) error {
+	if transaction.Type != "expense" {
+		return nil
+	}
+	if err := prepareSplits(&transaction); err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE budgets 
+		SET remaining_amount = remaining_amount + $1
+		WHERE user_id = $2
+		AND category_id = $3 
+		AND $4 BETWEEN start_date AND end_date`
+	for categoryID, amount := range categoryAmounts(transaction) {
+		_, err := tx.Exec(context.Background(), query, sign*amount, transaction.UserID, categoryID, transaction.Date)
+		if err != nil {
+			return fmt.Errorf("ошибка при изменении бюджета категории %d: %v", categoryID, err)
+		}
+	}
+	return nil
+}
+
 func RenewBudgetPeriod(budget *models.Budget) {
 	switch budget.Period {
 	case "monthly":
@@ -94,3 +94,23 @@ func GetAllCategories(pool *pgxpool.Pool) ([]models.Category, error) {
 	}
 	return categories, nil
 }
+
+// GetCategoriesByUserID возвращает категории пользователя
+func GetCategoriesByUserID(pool *pgxpool.Pool, userID int) ([]models.Category, error) {
+	query := `SELECT id, user_id, name, type FROM categories WHERE user_id = $1 ORDER BY id`
+	rows, err := pool.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении категорий: %v", err)
+	}
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		var category models.Category
+		if err := rows.Scan(&category.ID, &category.UserID, &category.Name, &category.Type); err != nil {
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, nil
+}
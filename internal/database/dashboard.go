@@ -7,11 +7,12 @@ import (
 	"sort"
 )
 
+// GetTotalBalance — итог текущего месяца; переводы между своими счетами его не меняют
 func GetTotalBalance(pool *pgxpool.Pool, userID int) (float64, error) {
 	query := `
 		SELECT COALESCE(SUM(CASE WHEN type = 'income' THEN amount ELSE -amount END), 0) AS total_balance
 		FROM transactions
-		WHERE user_id = $1 
+		WHERE user_id = $1 AND type <> 'transfer'
 		AND DATE_TRUNC('month', transaction_date) = DATE_TRUNC('month', CURRENT_DATE)`
 	var totalBalance float64
 	err := pool.QueryRow(context.Background(), query, userID).Scan(&totalBalance)
@@ -59,6 +60,8 @@ func GetMonthlyExpenses(pool *pgxpool.Pool, userID int) ([]map[string]interface{
 	return expenses, nil
 }
 
+// GetIncomeExpenseSummary — доходы и расходы текущего месяца. Переводы между счетами пользователя
+// не доход и не расход, поэтому в сводку не попадают.
 func GetIncomeExpenseSummary(pool *pgxpool.Pool, userID int) (map[string]float64, error) {
 	query := `
 		SELECT 
@@ -67,12 +70,12 @@ func GetIncomeExpenseSummary(pool *pgxpool.Pool, userID int) (map[string]float64
 		FROM (
 			SELECT amount, type, transaction_date
 			FROM transactions
-			WHERE user_id = $1
+			WHERE user_id = $1 AND type <> 'transfer'
 			AND DATE_TRUNC('month', transaction_date) = DATE_TRUNC('month', CURRENT_DATE)
 			UNION ALL
 			SELECT amount, type, transaction_date
 			FROM transactionhistory
-			WHERE user_id = $1
+			WHERE user_id = $1 AND type <> 'transfer'
 			AND DATE_TRUNC('month', transaction_date) = DATE_TRUNC('month', CURRENT_DATE)
 		) AS combined`
 	var totalIncome, totalExpense float64
@@ -86,19 +89,23 @@ func GetIncomeExpenseSummary(pool *pgxpool.Pool, userID int) (map[string]float64
 	}, nil
 }
 
+// GetCategoryWiseExpenses — расходы текущего месяца по категориям; разделённая транзакция
+// учитывается по частям, каждая в своей категории
 func GetCategoryWiseExpenses(pool *pgxpool.Pool, userID int) ([]map[string]interface{}, error) {
 	query := `
 		SELECT c.name AS category, COALESCE(SUM(t.amount), 0) AS total
 		FROM (
-			SELECT category_id, amount, transaction_date
-			FROM transactions
-			WHERE user_id = $1 AND type = 'expense'
-			AND DATE_TRUNC('month', transaction_date) = DATE_TRUNC('month', CURRENT_DATE)
+			SELECT COALESCE(s.category_id, tr.category_id) AS category_id, COALESCE(s.amount, tr.amount) AS amount
+			FROM transactions tr
+			LEFT JOIN transaction_splits s ON s.transaction_id = tr.id
+			WHERE tr.user_id = $1 AND tr.type = 'expense'
+			AND DATE_TRUNC('month', tr.transaction_date) = DATE_TRUNC('month', CURRENT_DATE)
 			UNION ALL
-			SELECT category_id, amount, transaction_date
-			FROM transactionhistory
-			WHERE user_id = $1 AND type = 'expense'
-			AND DATE_TRUNC('month', transaction_date) = DATE_TRUNC('month', CURRENT_DATE)
+			SELECT COALESCE(s.category_id, h.category_id), COALESCE(s.amount, h.amount)
+			FROM transactionhistory h
+			LEFT JOIN transaction_splits s ON s.history_id = h.id
+			WHERE h.user_id = $1 AND h.type = 'expense'
+			AND DATE_TRUNC('month', h.transaction_date) = DATE_TRUNC('month', CURRENT_DATE)
 		) AS t
 		JOIN categories c ON t.category_id = c.id
 		GROUP BY c.name
@@ -0,0 +1,260 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// Состояния выгрузки данных
+const (
+	ExportStatusPending = "pending"
+	ExportStatusRunning = "running"
+	ExportStatusReady   = "ready"
+	ExportStatusFailed  = "failed"
+	ExportStatusExpired = "expired"
+)
+
+var ErrDataExportNotFound = errors.New("выгрузка данных не найдена")
+
+// ExportSection — содержимое одной таблицы в выгрузке пользователя
+type ExportSection struct {
+	Name    string // имя файла в архиве без расширения
+	Table   string
+	Records int
+	Data    []byte // JSON-массив записей
+}
+
+// exportSections перечисляет всё, что хранится о пользователе. Секреты (хеш пароля,
+// хеши токенов) в выгрузку не попадают. $1 — ID пользователя.
+var exportSections = []struct {
+	name  string
+	table string
+	query string
+}{
+	{"user", "users", `SELECT id, name, email, is_admin, email_verified, created_at FROM users WHERE id = $1`},
+	{"usersettings", "usersettings", `SELECT * FROM usersettings WHERE user_id = $1`},
+	{"categories", "categories", `SELECT * FROM categories WHERE user_id = $1 ORDER BY id`},
+	{"accounts", "accounts", `SELECT * FROM accounts WHERE user_id = $1 ORDER BY id`},
+	{"transactions", "transactions", `SELECT * FROM transactions WHERE user_id = $1 ORDER BY id`},
+	{"transactionhistory", "transactionhistory", `SELECT * FROM transactionhistory WHERE user_id = $1 ORDER BY id`},
+	{"transaction_splits", "transaction_splits", `SELECT * FROM transaction_splits WHERE user_id = $1 ORDER BY id`},
+	{"transaction_attachments", "transaction_attachments", `
+		SELECT id, transaction_id, history_id, file_name, content_type, size_bytes, created_at
+		FROM transaction_attachments WHERE user_id = $1 ORDER BY id`},
+	{"tags", "tags", `SELECT * FROM tags WHERE user_id = $1 ORDER BY id`},
+	{"transaction_tags", "transaction_tags", `
+		SELECT tag_id, transaction_id, history_id
+		FROM transaction_tags WHERE user_id = $1 ORDER BY tag_id, transaction_id, history_id`},
+	{"recurring_transactions", "recurring_transactions", `SELECT * FROM recurring_transactions WHERE user_id = $1 ORDER BY id`},
+	{"recurring_occurrences", "recurring_occurrences", `SELECT * FROM recurring_occurrences WHERE user_id = $1 ORDER BY recurring_id, occurrence_date`},
+	{"budgets", "budgets", `SELECT * FROM budgets WHERE user_id = $1 ORDER BY id`},
+	{"goals", "goals", `SELECT * FROM goals WHERE user_id = $1 ORDER BY id`},
+	{"payment_reminders", "payment_reminders", `SELECT * FROM payment_reminders WHERE user_id = $1 ORDER BY id`},
+	{"notifications", "notifications", `SELECT * FROM notifications WHERE user_id = $1 ORDER BY id`},
+	{"reports", "reports", `SELECT * FROM reports WHERE user_id = $1 ORDER BY id`},
+	{"import_mappings", "import_mappings", `SELECT * FROM import_mappings WHERE user_id = $1 ORDER BY id`},
+	{"categorization_rules", "categorization_rules", `SELECT * FROM categorization_rules WHERE user_id = $1 ORDER BY position, id`},
+	{"transaction_imports", "transaction_imports", `SELECT * FROM transaction_imports WHERE user_id = $1 ORDER BY imported_at`},
+	{"transaction_duplicates", "transaction_duplicates", `SELECT * FROM transaction_duplicates WHERE user_id = $1 ORDER BY id`},
+	{"family_memberships", "family_memberships", `
+		SELECT fm.*, fa.nickname AS family_nickname, fa.owner_user_id AS family_owner_user_id
+		FROM family_memberships fm
+		JOIN family_accounts fa ON fa.id = fm.family_account_id
+		WHERE fm.user_id = $1
+		ORDER BY fm.family_account_id`},
+	{"family_accounts_owned", "family_accounts", `SELECT * FROM family_accounts WHERE owner_user_id = $1 ORDER BY id`},
+	{"roles", "user_roles", `
+		SELECT r.name AS role, ur.granted_at
+		FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id = $1
+		ORDER BY r.id`},
+	{"sessions", "sessions", `
+		SELECT id, device, ip_address, created_at, last_seen_at, expires_at, revoked_at
+		FROM sessions WHERE user_id = $1 ORDER BY id`},
+	{"api_tokens", "api_tokens", `
+		SELECT id, name, token_prefix, scopes, created_at, last_used_at, expires_at, revoked_at
+		FROM api_tokens WHERE user_id = $1 ORDER BY id`},
+	{"identities", "user_identities", `
+		SELECT issuer, subject, email, created_at, last_login_at
+		FROM user_identities WHERE user_id = $1 ORDER BY id`},
+	{"account_deletion", "account_deletions", `
+		SELECT requested_at, scheduled_for, family_action, transfer_to_user_id
+		FROM account_deletions WHERE user_id = $1`},
+	{"audit_events", "audit_events", `
+		SELECT id, occurred_at, event_type, actor_id, ip_address, user_agent, details
+		FROM audit_events WHERE user_id = $1 ORDER BY id`},
+	{"data_exports", "data_exports", `
+		SELECT id, status, size_bytes, created_at, completed_at, expires_at
+		FROM data_exports WHERE user_id = $1 ORDER BY id`},
+}
+
+// ExportUserData читает все данные пользователя из одного снимка базы. Вместе с таблицами
+// возвращаются вложения: их файлы кладутся в архив рядом с transaction_attachments.json
+func ExportUserData(pool *pgxpool.Pool, userID int) ([]ExportSection, []models.Attachment, error) {
+	tx, err := pool.BeginTx(context.Background(), pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	sections := make([]ExportSection, 0, len(exportSections))
+	for _, section := range exportSections {
+		query := `SELECT COALESCE(json_agg(row_to_json(t)), '[]'::json)::text, COUNT(*) FROM (` + section.query + `) t`
+
+		var data string
+		var records int
+		if err := tx.QueryRow(context.Background(), query, userID).Scan(&data, &records); err != nil {
+			return nil, nil, fmt.Errorf("ошибка при выгрузке таблицы %s: %v", section.table, err)
+		}
+		sections = append(sections, ExportSection{
+			Name:    section.name,
+			Table:   section.table,
+			Records: records,
+			Data:    []byte(data),
+		})
+	}
+
+	attachments, err := exportAttachments(tx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sections, attachments, nil
+}
+
+// exportAttachments возвращает все вложения пользователя, включая приложенные к архивным транзакциям
+func exportAttachments(tx pgx.Tx, userID int) ([]models.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM transaction_attachments WHERE user_id = $1 ORDER BY id`
+	rows, err := tx.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при выгрузке вложений: %v", err)
+	}
+	defer rows.Close()
+
+	list := []models.Attachment{}
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании вложения: %v", err)
+		}
+		list = append(list, *attachment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при выгрузке вложений: %v", err)
+	}
+	return list, nil
+}
+
+const dataExportColumns = `id, user_id, status, file_path, size_bytes, error, created_at, completed_at, expires_at`
+
+func scanDataExport(row pgx.Row) (*models.DataExport, error) {
+	export := &models.DataExport{}
+	err := row.Scan(
+		&export.ID,
+		&export.UserID,
+		&export.Status,
+		&export.FilePath,
+		&export.SizeBytes,
+		&export.Error,
+		&export.CreatedAt,
+		&export.CompletedAt,
+		&export.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrDataExportNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении выгрузки данных: %v", err)
+	}
+	return export, nil
+}
+
+// CreateDataExport ставит выгрузку данных пользователя в очередь
+func CreateDataExport(pool *pgxpool.Pool, userID int) (*models.DataExport, error) {
+	query := `INSERT INTO data_exports (user_id) VALUES ($1) RETURNING ` + dataExportColumns
+	return scanDataExport(pool.QueryRow(context.Background(), query, userID))
+}
+
+// GetLatestDataExport возвращает последнюю выгрузку пользователя
+func GetLatestDataExport(pool *pgxpool.Pool, userID int) (*models.DataExport, error) {
+	query := `SELECT ` + dataExportColumns + ` FROM data_exports WHERE user_id = $1 ORDER BY created_at DESC, id DESC LIMIT 1`
+	return scanDataExport(pool.QueryRow(context.Background(), query, userID))
+}
+
+// ClaimDataExport забирает следующую выгрузку из очереди. Выгрузки, зависшие в работе
+// дольше часа (например, из-за перезапуска сервера), забираются повторно.
+func ClaimDataExport(pool *pgxpool.Pool) (*models.DataExport, error) {
+	query := `
+		UPDATE data_exports
+		SET status = $1, started_at = NOW()
+		WHERE id = (
+			SELECT id FROM data_exports
+			WHERE status = $2 OR (status = $1 AND started_at < NOW() - INTERVAL '1 hour')
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + dataExportColumns
+	return scanDataExport(pool.QueryRow(context.Background(), query, ExportStatusRunning, ExportStatusPending))
+}
+
+// CompleteDataExport отмечает выгрузку готовой
+func CompleteDataExport(pool *pgxpool.Pool, exportID int, filePath string, sizeBytes int64, expiresAt time.Time) error {
+	query := `
+		UPDATE data_exports
+		SET status = $2, file_path = $3, size_bytes = $4, completed_at = NOW(), expires_at = $5
+		WHERE id = $1`
+	if _, err := pool.Exec(context.Background(), query, exportID, ExportStatusReady, filePath, sizeBytes, expiresAt); err != nil {
+		return fmt.Errorf("ошибка при завершении выгрузки данных: %v", err)
+	}
+	return nil
+}
+
+// FailDataExport отмечает выгрузку неудавшейся
+func FailDataExport(pool *pgxpool.Pool, exportID int, message string) error {
+	query := `UPDATE data_exports SET status = $2, error = $3, completed_at = NOW() WHERE id = $1`
+	if _, err := pool.Exec(context.Background(), query, exportID, ExportStatusFailed, message); err != nil {
+		return fmt.Errorf("ошибка при обновлении выгрузки данных: %v", err)
+	}
+	return nil
+}
+
+// ExpireDataExports помечает просроченные архивы и возвращает пути их файлов для удаления
+func ExpireDataExports(pool *pgxpool.Pool) ([]string, error) {
+	query := `
+		WITH expired AS (
+			SELECT id, file_path FROM data_exports
+			WHERE status = $1 AND expires_at <= NOW()
+			FOR UPDATE
+		)
+		UPDATE data_exports d
+		SET status = $2, file_path = ''
+		FROM expired e
+		WHERE d.id = e.id
+		RETURNING e.file_path`
+
+	rows, err := pool.Query(context.Background(), query, ExportStatusReady, ExportStatusExpired)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при очистке выгрузок данных: %v", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании выгрузки данных: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
@@ -0,0 +1,214 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/duplicates"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+const (
+	DuplicatePending = "pending"
+	DuplicateKept    = "kept"
+)
+
+// maxDuplicateCandidates — сколько самых похожих транзакций предлагать для одной новой
+const maxDuplicateCandidates = 3
+
+var ErrDuplicateNotFound = errors.New("запись о дубликате не найдена или уже рассмотрена")
+
+// flagDuplicates сравнивает только что добавленные транзакции с остальными транзакциями пользователя
+// и ставит похожие пары в очередь проверки. Новые транзакции между собой не сравниваются:
+// одинаковые строки одной выписки — это, как правило, разные покупки.
+// Архив не просматривается: запись очереди ссылается на текущие транзакции.
+// Возвращает число новых транзакций, у которых нашлись вероятные дубликаты.
+func flagDuplicates(tx pgx.Tx, userID int, transactionIDs []int) (int, error) {
+	if len(transactionIDs) == 0 {
+		return 0, nil
+	}
+
+	// Сумма и тип сравниваются в запросе, дата — с запасом в день на время внутри суток;
+	// точная оценка считается в duplicates.Score
+	query := `
+		SELECT n.id, n.amount, n.type, COALESCE(n.description, ''), n.transaction_date, COALESCE(n.currency, ''),
+			o.id, o.amount, o.type, COALESCE(o.description, ''), o.transaction_date, COALESCE(o.currency, '')
+		FROM transactions n
+		JOIN transactions o ON o.user_id = n.user_id
+			AND o.type = n.type
+			AND ABS(o.amount - n.amount) < 0.005
+			AND o.transaction_date BETWEEN n.transaction_date - make_interval(days => $3)
+				AND n.transaction_date + make_interval(days => $3)
+			AND o.id <> ALL($2)
+		WHERE n.user_id = $1 AND n.id = ANY($2)`
+
+	rows, err := tx.Query(context.Background(), query, userID, transactionIDs, duplicates.WindowDays+1)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при поиске дубликатов: %v", err)
+	}
+
+	type match struct {
+		duplicateOfID int
+		score         float64
+	}
+	matches := map[int][]match{}
+	for rows.Next() {
+		var added, existing models.Transaction
+		if err := rows.Scan(
+			&added.ID, &added.Amount, &added.Type, &added.Description, &added.Date, &added.Currency,
+			&existing.ID, &existing.Amount, &existing.Type, &existing.Description, &existing.Date, &existing.Currency,
+		); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("ошибка при сканировании кандидата в дубликаты: %v", err)
+		}
+		if score, ok := duplicates.IsLikely(added, existing); ok {
+			matches[added.ID] = append(matches[added.ID], match{duplicateOfID: existing.ID, score: score})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("ошибка при поиске дубликатов: %v", err)
+	}
+
+	insertQuery := `
+		INSERT INTO transaction_duplicates (user_id, transaction_id, duplicate_of_id, score)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (transaction_id, duplicate_of_id) DO NOTHING`
+	for transactionID, found := range matches {
+		sort.Slice(found, func(i, j int) bool { return found[i].score > found[j].score })
+		if len(found) > maxDuplicateCandidates {
+			found = found[:maxDuplicateCandidates]
+		}
+		for _, m := range found {
+			if _, err := tx.Exec(context.Background(), insertQuery, userID, transactionID, m.duplicateOfID, m.score); err != nil {
+				return 0, fmt.Errorf("ошибка при добавлении дубликата в очередь: %v", err)
+			}
+		}
+	}
+	return len(matches), nil
+}
+
+// GetTransactionDuplicates возвращает очередь проверки с обеими транзакциями пары, самые похожие первыми
+func GetTransactionDuplicates(pool *pgxpool.Pool, userID int, status string) ([]models.TransactionDuplicate, error) {
+	query := `
+		SELECT d.id, d.user_id, d.score, d.status, d.created_at, d.resolved_at,
+			n.id, n.user_id, COALESCE(n.category_id, 0), n.amount, COALESCE(n.description, ''), n.transaction_date, n.type, n.goal_id, COALESCE(n.currency, ''),
+			o.id, o.user_id, COALESCE(o.category_id, 0), o.amount, COALESCE(o.description, ''), o.transaction_date, o.type, o.goal_id, COALESCE(o.currency, '')
+		FROM transaction_duplicates d
+		JOIN transactions n ON n.id = d.transaction_id
+		JOIN transactions o ON o.id = d.duplicate_of_id
+		WHERE d.user_id = $1 AND d.status = $2
+		ORDER BY d.score DESC, d.id`
+
+	rows, err := pool.Query(context.Background(), query, userID, status)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении очереди дубликатов: %v", err)
+	}
+	defer rows.Close()
+
+	items := []models.TransactionDuplicate{}
+	for rows.Next() {
+		var item models.TransactionDuplicate
+		added, existing := &item.Transaction, &item.DuplicateOf
+		if err := rows.Scan(
+			&item.ID, &item.UserID, &item.Score, &item.Status, &item.CreatedAt, &item.ResolvedAt,
+			&added.ID, &added.UserID, &added.CategoryID, &added.Amount, &added.Description, &added.Date, &added.Type, &added.GoalID, &added.Currency,
+			&existing.ID, &existing.UserID, &existing.CategoryID, &existing.Amount, &existing.Description, &existing.Date, &existing.Type, &existing.GoalID, &existing.Currency,
+		); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании дубликата: %v", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при получении очереди дубликатов: %v", err)
+	}
+	return items, nil
+}
+
+// KeepTransactionDuplicate отмечает, что обе транзакции настоящие; пара больше не предлагается
+func KeepTransactionDuplicate(pool *pgxpool.Pool, userID, duplicateID int) error {
+	query := `
+		UPDATE transaction_duplicates SET status = $3, resolved_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND status = $4`
+	result, err := pool.Exec(context.Background(), query, duplicateID, userID, DuplicateKept, DuplicatePending)
+	if err != nil {
+		return fmt.Errorf("ошибка при обработке дубликата: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrDuplicateNotFound
+	}
+	return nil
+}
+
+// MergeTransactionDuplicate объединяет пару в одну транзакцию и возвращает ID оставшейся.
+// По умолчанию остаётся существовавшая транзакция, при keepNew — добавленная позже.
+// Пустые описание, валюта и цель оставшейся берутся у удаляемой; привязка к операции
+// банковской выписки переносится, чтобы повторный импорт не создал транзакцию заново,
+// вложения — чтобы не потерять чеки; теги обеих транзакций объединяются.
+func MergeTransactionDuplicate(pool *pgxpool.Pool, userID, duplicateID int, keepNew bool) (int, error) {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	var addedID, existingID int
+	err = tx.QueryRow(context.Background(), `
+		SELECT transaction_id, duplicate_of_id FROM transaction_duplicates
+		WHERE id = $1 AND user_id = $2 AND status = $3
+		FOR UPDATE`, duplicateID, userID, DuplicatePending).Scan(&addedID, &existingID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrDuplicateNotFound
+		}
+		return 0, fmt.Errorf("ошибка при получении дубликата: %v", err)
+	}
+
+	survivorID, removedID := existingID, addedID
+	if keepNew {
+		survivorID, removedID = addedID, existingID
+	}
+
+	mergeQuery := `
+		UPDATE transactions s SET
+			description = CASE WHEN COALESCE(s.description, '') = '' THEN r.description ELSE s.description END,
+			currency = COALESCE(NULLIF(s.currency, ''), r.currency),
+			goal_id = COALESCE(s.goal_id, r.goal_id)
+		FROM transactions r
+		WHERE s.id = $1 AND r.id = $2`
+	if _, err := tx.Exec(context.Background(), mergeQuery, survivorID, removedID); err != nil {
+		return 0, fmt.Errorf("ошибка при объединении транзакций: %v", err)
+	}
+	if _, err := tx.Exec(context.Background(), `
+		UPDATE transaction_imports SET transaction_id = $3
+		WHERE user_id = $1 AND transaction_id = $2`, userID, removedID, survivorID); err != nil {
+		return 0, fmt.Errorf("ошибка при переносе привязки к выписке: %v", err)
+	}
+	if _, err := tx.Exec(context.Background(), `
+		UPDATE transaction_attachments SET transaction_id = $3
+		WHERE user_id = $1 AND transaction_id = $2`, userID, removedID, survivorID); err != nil {
+		return 0, fmt.Errorf("ошибка при переносе вложений: %v", err)
+	}
+	if _, err := tx.Exec(context.Background(), `
+		INSERT INTO transaction_tags (user_id, tag_id, transaction_id)
+		SELECT user_id, tag_id, $3 FROM transaction_tags
+		WHERE user_id = $1 AND transaction_id = $2
+		ON CONFLICT DO NOTHING`, userID, removedID, survivorID); err != nil {
+		return 0, fmt.Errorf("ошибка при переносе тегов: %v", err)
+	}
+	// Записи очереди с удаляемой транзакцией, включая эту, удаляются каскадно
+	if _, err := tx.Exec(context.Background(), `DELETE FROM transactions WHERE id = $1 AND user_id = $2`, removedID, userID); err != nil {
+		return 0, fmt.Errorf("ошибка при удалении дубликата: %v", err)
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return 0, fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	// Объединение меняет сразу две транзакции, проще обучить модель подсказок заново
+	forgetCategoryModel(userID)
+	return survivorID, nil
+}
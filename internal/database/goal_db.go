@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/shopspring/decimal" // Для точных денежных значений
 	"github.com/valeriaulyamaeva/personal-finance-app/models"
@@ -152,6 +153,22 @@ func UpdateGoalProgress(pool *pgxpool.Pool, goalID int, progressAmount decimal.D
 	}
 	defer tx.Rollback(context.Background())
 
+	if err := addGoalProgress(tx, goalID, progressAmount); err != nil {
+		return err
+	}
+
+	// Фиксируем транзакцию
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	log.Printf("Транзакция успешно завершена для цели #%d", goalID)
+
+	return nil
+}
+
+// addGoalProgress прибавляет сумму (в том числе отрицательную) к прогрессу цели внутри транзакции БД
+// и отмечает цель достигнутой, когда накоплено не меньше целевой суммы
+func addGoalProgress(tx pgx.Tx, goalID int, progressAmount decimal.Decimal) error {
 	// Запрос для получения текущего прогресса и целевого значения
 	query := `
         SELECT current_amount, amount, status 
@@ -162,7 +179,7 @@ func UpdateGoalProgress(pool *pgxpool.Pool, goalID int, progressAmount decimal.D
 	var status string
 
 	// Получаем текущие данные цели
-	err = tx.QueryRow(context.Background(), query, goalID).Scan(&currentAmount, &goalAmount, &status)
+	err := tx.QueryRow(context.Background(), query, goalID).Scan(&currentAmount, &goalAmount, &status)
 	if err != nil {
 		return fmt.Errorf("ошибка при получении данных цели: %v", err)
 	}
@@ -198,13 +215,6 @@ func UpdateGoalProgress(pool *pgxpool.Pool, goalID int, progressAmount decimal.D
 		// Логируем успешное обновление статуса
 		log.Printf("Цель #%d: статус изменен на 'achieved'", goalID)
 	}
-
-	// Фиксируем транзакцию
-	if err := tx.Commit(context.Background()); err != nil {
-		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
-	}
-	log.Printf("Транзакция успешно завершена для цели #%d", goalID)
-
 	return nil
 }
 
@@ -0,0 +1,348 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+var ErrImportMappingNotFound = errors.New("настройки импорта не найдены")
+
+const importMappingColumns = `id, user_id, bank_name, delimiter, encoding, has_header, skip_rows, date_column, date_format,
+	amount_column, debit_column, credit_column, sign_convention, decimal_separator, description_column,
+	currency_column, default_currency, category_column, default_category_id, created_at, updated_at`
+
+func scanImportMapping(row pgx.Row) (*models.ImportMapping, error) {
+	mapping := &models.ImportMapping{}
+	err := row.Scan(
+		&mapping.ID,
+		&mapping.UserID,
+		&mapping.BankName,
+		&mapping.Delimiter,
+		&mapping.Encoding,
+		&mapping.HasHeader,
+		&mapping.SkipRows,
+		&mapping.DateColumn,
+		&mapping.DateFormat,
+		&mapping.AmountColumn,
+		&mapping.DebitColumn,
+		&mapping.CreditColumn,
+		&mapping.SignConvention,
+		&mapping.DecimalSeparator,
+		&mapping.DescriptionColumn,
+		&mapping.CurrencyColumn,
+		&mapping.DefaultCurrency,
+		&mapping.CategoryColumn,
+		&mapping.DefaultCategoryID,
+		&mapping.CreatedAt,
+		&mapping.UpdatedAt,
+	)
+	return mapping, err
+}
+
+// SaveImportMapping сохраняет настройки разбора; настройки того же банка перезаписываются
+func SaveImportMapping(pool *pgxpool.Pool, mapping *models.ImportMapping) error {
+	query := `
+		INSERT INTO import_mappings (user_id, bank_name, delimiter, encoding, has_header, skip_rows, date_column,
+			date_format, amount_column, debit_column, credit_column, sign_convention, decimal_separator,
+			description_column, currency_column, default_currency, category_column, default_category_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+		ON CONFLICT (user_id, bank_name) DO UPDATE
+		SET delimiter = EXCLUDED.delimiter,
+			encoding = EXCLUDED.encoding,
+			has_header = EXCLUDED.has_header,
+			skip_rows = EXCLUDED.skip_rows,
+			date_column = EXCLUDED.date_column,
+			date_format = EXCLUDED.date_format,
+			amount_column = EXCLUDED.amount_column,
+			debit_column = EXCLUDED.debit_column,
+			credit_column = EXCLUDED.credit_column,
+			sign_convention = EXCLUDED.sign_convention,
+			decimal_separator = EXCLUDED.decimal_separator,
+			description_column = EXCLUDED.description_column,
+			currency_column = EXCLUDED.currency_column,
+			default_currency = EXCLUDED.default_currency,
+			category_column = EXCLUDED.category_column,
+			default_category_id = EXCLUDED.default_category_id,
+			updated_at = NOW()
+		RETURNING id, created_at, updated_at`
+	err := pool.QueryRow(context.Background(), query,
+		mapping.UserID,
+		mapping.BankName,
+		mapping.Delimiter,
+		mapping.Encoding,
+		mapping.HasHeader,
+		mapping.SkipRows,
+		mapping.DateColumn,
+		mapping.DateFormat,
+		mapping.AmountColumn,
+		mapping.DebitColumn,
+		mapping.CreditColumn,
+		mapping.SignConvention,
+		mapping.DecimalSeparator,
+		mapping.DescriptionColumn,
+		mapping.CurrencyColumn,
+		mapping.DefaultCurrency,
+		mapping.CategoryColumn,
+		mapping.DefaultCategoryID).Scan(&mapping.ID, &mapping.CreatedAt, &mapping.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении настроек импорта: %v", err)
+	}
+	return nil
+}
+
+// GetImportMappings возвращает сохранённые настройки импорта пользователя
+func GetImportMappings(pool *pgxpool.Pool, userID int) ([]models.ImportMapping, error) {
+	query := `SELECT ` + importMappingColumns + ` FROM import_mappings WHERE user_id = $1 ORDER BY bank_name`
+	rows, err := pool.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении настроек импорта: %v", err)
+	}
+	defer rows.Close()
+
+	mappings := []models.ImportMapping{}
+	for rows.Next() {
+		mapping, err := scanImportMapping(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании настроек импорта: %v", err)
+		}
+		mappings = append(mappings, *mapping)
+	}
+	return mappings, nil
+}
+
+// GetImportMapping возвращает настройки импорта, если они принадлежат пользователю
+func GetImportMapping(pool *pgxpool.Pool, id, userID int) (*models.ImportMapping, error) {
+	query := `SELECT ` + importMappingColumns + ` FROM import_mappings WHERE id = $1 AND user_id = $2`
+	mapping, err := scanImportMapping(pool.QueryRow(context.Background(), query, id, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrImportMappingNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении настроек импорта: %v", err)
+	}
+	return mapping, nil
+}
+
+// DeleteImportMapping удаляет настройки импорта пользователя
+func DeleteImportMapping(pool *pgxpool.Pool, id, userID int) error {
+	result, err := pool.Exec(context.Background(), `DELETE FROM import_mappings WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при удалении настроек импорта: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrImportMappingNotFound
+	}
+	return nil
+}
+
+// ImportResult — итоги импорта
+type ImportResult struct {
+	Created            int `json:"created"`
+	Skipped            int `json:"skipped"`             // загружены раньше
+	PossibleDuplicates int `json:"possible_duplicates"` // новые транзакции, поставленные в очередь проверки дубликатов
+	Categorized        int `json:"categorized"`         // транзакции, изменённые правилами автокатегоризации
+}
+
+// importTransactionQuery — вставка импортированной транзакции; цель может назначить правило автокатегоризации
+const importTransactionQuery = `
+	INSERT INTO transactions (user_id, category_id, amount, description, transaction_date, type, currency, goal_id, account_id)
+	VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9)
+	RETURNING id`
+
+// checkImportedTransaction проверяет, что категория и цель, заданные формой или правилом, принадлежат пользователю
+func checkImportedTransaction(tx pgx.Tx, userID int, transaction *models.Transaction) error {
+	transaction.UserID = userID
+	if err := checkTransactionCategory(tx, transaction); err != nil {
+		return err
+	}
+	return checkTransactionGoal(tx, transaction)
+}
+
+// importAccount возвращает счёт, на который загружается выписка (0 — основной счёт), и его валюту
+// для операций, у которых валюта не указана
+func importAccount(tx pgx.Tx, userID, accountID int) (int, string, error) {
+	var err error
+	if accountID == 0 {
+		if accountID, err = defaultAccountID(tx, userID); err != nil {
+			return 0, "", err
+		}
+	}
+	currency, err := accountCurrency(tx, userID, accountID)
+	if err != nil {
+		return 0, "", err
+	}
+	return accountID, currency, nil
+}
+
+// ImportTransactions создаёт транзакции одной транзакцией БД: либо загружаются все строки, либо ни одной.
+// Перед вставкой применяются правила автокатегоризации, категория из файла или формы считается
+// значением по умолчанию. Транзакции, похожие на уже существующие, ставятся в очередь проверки дубликатов.
+// Все строки попадают на счёт accountID, 0 — на основной счёт пользователя.
+func ImportTransactions(pool *pgxpool.Pool, userID, accountID int, transactions []models.Transaction) (*ImportResult, error) {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	accountID, currency, err := importAccount(tx, userID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	engine, err := loadRuleEngine(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{}
+	ids := make([]int, 0, len(transactions))
+	imported := make([]models.Transaction, 0, len(transactions))
+	for i, transaction := range transactions {
+		if engine.Apply(&transaction, false) {
+			result.Categorized++
+		}
+		if err := checkImportedTransaction(tx, userID, &transaction); err != nil {
+			return nil, fmt.Errorf("строка %d: %w", i+1, err)
+		}
+		transaction.AccountID = accountID
+		if transaction.Currency == "" {
+			transaction.Currency = currency
+		}
+		imported = append(imported, transaction)
+		var id int
+		err := tx.QueryRow(context.Background(), importTransactionQuery,
+			userID,
+			transaction.CategoryID,
+			transaction.Amount,
+			transaction.Description,
+			transaction.Date,
+			transaction.Type,
+			transaction.Currency,
+			transaction.GoalID,
+			transaction.AccountID).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при импорте строки %d: %v", i+1, err)
+		}
+		if err := creditTransactionGoal(tx, &transaction); err != nil {
+			return nil, fmt.Errorf("строка %d: %v", i+1, err)
+		}
+		ids = append(ids, id)
+	}
+
+	result.Created = len(ids)
+	if result.PossibleDuplicates, err = flagDuplicates(tx, userID, ids); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return nil, fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	learnCategories(userID, nil, imported)
+	return result, nil
+}
+
+// ExternalTransaction — операция из банковской выписки вместе с её идентификатором в банке
+type ExternalTransaction struct {
+	Source      string // формат выписки: ofx, camt053, mt940
+	AccountID   string // счёт в банке: идентификатор операции уникален только в его пределах
+	ExternalID  string
+	Transaction models.Transaction
+}
+
+// ImportExternalTransactions загружает операции выписки одной транзакцией БД.
+// Операции, загруженные раньше (по тому же источнику, счёту и идентификатору), пропускаются,
+// к новым применяются правила автокатегоризации.
+// При dryRun всё выполняется и откатывается, поэтому счётчики, включая найденные дубликаты,
+// точно совпадают с настоящим импортом. Операции попадают на счёт accountID, 0 — на основной счёт пользователя.
+func ImportExternalTransactions(pool *pgxpool.Pool, userID, accountID int, items []ExternalTransaction, dryRun bool) (*ImportResult, error) {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	claimQuery := `
+		INSERT INTO transaction_imports (user_id, source, account_id, external_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING`
+	linkQuery := `
+		UPDATE transaction_imports SET transaction_id = $5
+		WHERE user_id = $1 AND source = $2 AND account_id = $3 AND external_id = $4`
+
+	accountID, currency, err := importAccount(tx, userID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	engine, err := loadRuleEngine(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{}
+	var ids []int
+	var imported []models.Transaction
+	for _, item := range items {
+		claimed, err := tx.Exec(context.Background(), claimQuery, userID, item.Source, item.AccountID, item.ExternalID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при проверке операции %s: %v", item.ExternalID, err)
+		}
+		if claimed.RowsAffected() == 0 {
+			result.Skipped++
+			continue
+		}
+
+		transaction := item.Transaction
+		if engine.Apply(&transaction, false) {
+			result.Categorized++
+		}
+		if err := checkImportedTransaction(tx, userID, &transaction); err != nil {
+			return nil, fmt.Errorf("операция %s: %w", item.ExternalID, err)
+		}
+		transaction.AccountID = accountID
+		if transaction.Currency == "" {
+			transaction.Currency = currency
+		}
+		var transactionID int
+		err = tx.QueryRow(context.Background(), importTransactionQuery,
+			userID,
+			transaction.CategoryID,
+			transaction.Amount,
+			transaction.Description,
+			transaction.Date,
+			transaction.Type,
+			transaction.Currency,
+			transaction.GoalID,
+			transaction.AccountID).Scan(&transactionID)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при импорте операции %s: %v", item.ExternalID, err)
+		}
+		if _, err := tx.Exec(context.Background(), linkQuery, userID, item.Source, item.AccountID, item.ExternalID, transactionID); err != nil {
+			return nil, fmt.Errorf("ошибка при импорте операции %s: %v", item.ExternalID, err)
+		}
+		// При dryRun пополнение цели откатывается вместе со всей транзакцией БД
+		if err := creditTransactionGoal(tx, &transaction); err != nil {
+			return nil, fmt.Errorf("операция %s: %v", item.ExternalID, err)
+		}
+		result.Created++
+		ids = append(ids, transactionID)
+		imported = append(imported, transaction)
+	}
+
+	if result.PossibleDuplicates, err = flagDuplicates(tx, userID, ids); err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	if err := tx.Commit(context.Background()); err != nil {
+		return nil, fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	learnCategories(userID, nil, imported)
+	return result, nil
+}
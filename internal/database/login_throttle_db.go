@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Области учёта неудачных входов
+const (
+	ThrottleScopeAccount = "account"
+	ThrottleScopeIP      = "ip"
+)
+
+// LoginLock — снятая блокировка входа
+type LoginLock struct {
+	Scope string
+	Key   string
+}
+
+// GetLoginLockedUntil возвращает момент, до которого вход по ключу запрещён
+func GetLoginLockedUntil(pool *pgxpool.Pool, scope, key string) (time.Time, error) {
+	query := `SELECT locked_until FROM login_throttle WHERE scope = $1 AND key = $2`
+
+	var lockedUntil *time.Time
+	err := pool.QueryRow(context.Background(), query, scope, key).Scan(&lockedUntil)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("ошибка при проверке блокировки входа: %v", err)
+	}
+	if lockedUntil == nil {
+		return time.Time{}, nil
+	}
+	return *lockedUntil, nil
+}
+
+// RecordLoginFailure увеличивает счётчик неудачных входов и возвращает его новое значение.
+// Счётчик начинается заново, если предыдущая ошибка была давно.
+func RecordLoginFailure(pool *pgxpool.Pool, scope, key string, window time.Duration) (int, error) {
+	query := `
+		INSERT INTO login_throttle (scope, key, failures, last_failure_at)
+		VALUES ($1, $2, 1, NOW())
+		ON CONFLICT (scope, key) DO UPDATE
+		SET failures = CASE
+				WHEN login_throttle.last_failure_at < NOW() - $3::interval AND NOT login_throttle.lockout THEN 1
+				ELSE login_throttle.failures + 1
+			END,
+			last_failure_at = NOW()
+		RETURNING failures`
+
+	var failures int
+	err := pool.QueryRow(context.Background(), query, scope, key, window).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при учёте неудачного входа: %v", err)
+	}
+	return failures, nil
+}
+
+// LockLogin запрещает вход по ключу до указанного момента; lockout отмечает полноценную блокировку
+func LockLogin(pool *pgxpool.Pool, scope, key string, until time.Time, lockout bool) error {
+	query := `
+		UPDATE login_throttle
+		SET locked_until = $3, lockout = $4
+		WHERE scope = $1 AND key = $2`
+	if _, err := pool.Exec(context.Background(), query, scope, key, until, lockout); err != nil {
+		return fmt.Errorf("ошибка при блокировке входа: %v", err)
+	}
+	return nil
+}
+
+// ResetLoginFailures сбрасывает счётчик после успешного входа
+func ResetLoginFailures(pool *pgxpool.Pool, scope, key string) error {
+	query := `DELETE FROM login_throttle WHERE scope = $1 AND key = $2`
+	if _, err := pool.Exec(context.Background(), query, scope, key); err != nil {
+		return fmt.Errorf("ошибка при сбросе счётчика входов: %v", err)
+	}
+	return nil
+}
+
+// ReleaseExpiredLockouts снимает истёкшие блокировки и возвращает их список
+func ReleaseExpiredLockouts(pool *pgxpool.Pool) ([]LoginLock, error) {
+	query := `
+		DELETE FROM login_throttle
+		WHERE lockout AND locked_until <= NOW()
+		RETURNING scope, key`
+
+	rows, err := pool.Query(context.Background(), query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при снятии блокировок входа: %v", err)
+	}
+	defer rows.Close()
+
+	var locks []LoginLock
+	for rows.Next() {
+		var lock LoginLock
+		if err := rows.Scan(&lock.Scope, &lock.Key); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании блокировки: %v", err)
+		}
+		locks = append(locks, lock)
+	}
+	return locks, rows.Err()
+}
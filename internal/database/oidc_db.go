@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+var (
+	ErrOIDCStateInvalid = errors.New("запрос на вход через SSO не найден или истёк")
+	ErrIdentityNotFound = errors.New("аккаунт провайдера не привязан")
+)
+
+// CreateOIDCLoginState сохраняет параметры начатого входа через провайдер и удаляет просроченные
+func CreateOIDCLoginState(pool *pgxpool.Pool, stateHash, nonce, codeVerifier string, expiresAt time.Time) error {
+	if _, err := pool.Exec(context.Background(), `DELETE FROM oidc_login_states WHERE expires_at <= NOW()`); err != nil {
+		return fmt.Errorf("ошибка при очистке запросов на вход: %v", err)
+	}
+
+	query := `
+		INSERT INTO oidc_login_states (state_hash, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4)`
+	if _, err := pool.Exec(context.Background(), query, stateHash, nonce, codeVerifier, expiresAt); err != nil {
+		return fmt.Errorf("ошибка при сохранении запроса на вход: %v", err)
+	}
+	return nil
+}
+
+// ConsumeOIDCLoginState гасит запрос на вход и возвращает его nonce и code_verifier
+func ConsumeOIDCLoginState(pool *pgxpool.Pool, stateHash string) (string, string, error) {
+	query := `
+		DELETE FROM oidc_login_states
+		WHERE state_hash = $1 AND expires_at > NOW()
+		RETURNING nonce, code_verifier`
+
+	var nonce, codeVerifier string
+	err := pool.QueryRow(context.Background(), query, stateHash).Scan(&nonce, &codeVerifier)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", "", ErrOIDCStateInvalid
+		}
+		return "", "", fmt.Errorf("ошибка при получении запроса на вход: %v", err)
+	}
+	return nonce, codeVerifier, nil
+}
+
+// GetUserIDByIdentity находит пользователя, привязанного к аккаунту провайдера, и отмечает вход
+func GetUserIDByIdentity(pool *pgxpool.Pool, issuer, subject string) (int, error) {
+	query := `
+		UPDATE user_identities
+		SET last_login_at = NOW()
+		WHERE issuer = $1 AND subject = $2
+		RETURNING user_id`
+
+	var userID int
+	err := pool.QueryRow(context.Background(), query, issuer, subject).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrIdentityNotFound
+		}
+		return 0, fmt.Errorf("ошибка при поиске привязанного аккаунта: %v", err)
+	}
+	return userID, nil
+}
+
+// LinkIdentity привязывает аккаунт провайдера к существующему пользователю.
+// Провайдер подтвердил email, поэтому он считается подтверждённым и у нас.
+func LinkIdentity(pool *pgxpool.Pool, userID int, issuer, subject, email string) error {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	if err := insertIdentity(tx, userID, issuer, subject, email); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(context.Background(), `UPDATE users SET email_verified = TRUE WHERE id = $1`, userID); err != nil {
+		return fmt.Errorf("ошибка подтверждения email: %v", err)
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return nil
+}
+
+// ProvisionOIDCUser создаёт пользователя для входа через провайдер: без пароля,
+// с подтверждённым email, настройками по умолчанию и ролью обычного пользователя
+func ProvisionOIDCUser(pool *pgxpool.Pool, user *models.User, issuer, subject string) error {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	// Пустой пароль не совпадёт ни с одним bcrypt-хешем, войти по паролю можно будет только после сброса
+	query := `
+		INSERT INTO users (name, email, password, is_admin, email_verified)
+		VALUES ($1, $2, '', FALSE, TRUE)
+		RETURNING id`
+	if err := tx.QueryRow(context.Background(), query, user.Name, user.Email).Scan(&user.ID); err != nil {
+		return fmt.Errorf("ошибка при добавлении пользователя: %v", err)
+	}
+	user.IsAdmin = false
+	user.EmailVerified = true
+
+	settingsQuery := `
+		INSERT INTO usersettings (user_id, theme, notification_volume, auto_updates, weekly_reports)
+		VALUES ($1, $2, $3, $4, $5)`
+	if _, err := tx.Exec(context.Background(), settingsQuery, user.ID, "light", 50, false, false); err != nil {
+		return fmt.Errorf("ошибка при добавлении настроек пользователя: %v", err)
+	}
+
+	roleQuery := `INSERT INTO user_roles (user_id, role_id) SELECT $1, id FROM roles WHERE name = $2`
+	if _, err := tx.Exec(context.Background(), roleQuery, user.ID, RoleUser); err != nil {
+		return fmt.Errorf("ошибка при назначении роли пользователю: %v", err)
+	}
+
+	if err := insertIdentity(tx, user.ID, issuer, subject, user.Email); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return nil
+}
+
+func insertIdentity(tx pgx.Tx, userID int, issuer, subject, email string) error {
+	query := `
+		INSERT INTO user_identities (user_id, issuer, subject, email, last_login_at)
+		VALUES ($1, $2, $3, $4, NOW())`
+	if _, err := tx.Exec(context.Background(), query, userID, issuer, subject, email); err != nil {
+		return fmt.Errorf("ошибка при привязке аккаунта провайдера: %v", err)
+	}
+	return nil
+}
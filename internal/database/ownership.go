@@ -0,0 +1,33 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Таблицы, записи которых принадлежат пользователю через колонку user_id
+var userOwnedTables = map[string]bool{
+	"accounts":          true,
+	"budgets":           true,
+	"categories":        true,
+	"goals":             true,
+	"notifications":     true,
+	"payment_reminders": true,
+	"transactions":      true,
+}
+
+// IsRecordOwnedBy проверяет, что запись таблицы принадлежит указанному пользователю
+func IsRecordOwnedBy(pool *pgxpool.Pool, table string, recordID, userID int) (bool, error) {
+	if !userOwnedTables[table] {
+		return false, fmt.Errorf("таблица %s не поддерживает проверку владельца", table)
+	}
+
+	query := fmt.Sprintf(`SELECT EXISTS(SELECT 1 FROM %s WHERE id = $1 AND user_id = $2)`, table)
+	var owned bool
+	if err := pool.QueryRow(context.Background(), query, recordID, userID).Scan(&owned); err != nil {
+		return false, fmt.Errorf("ошибка проверки владельца записи: %v", err)
+	}
+	return owned, nil
+}
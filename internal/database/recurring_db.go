@@ -0,0 +1,640 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/recurrence"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// Состояния повторения
+const (
+	OccurrenceScheduled = "scheduled"
+	OccurrenceSkipped   = "skipped"
+	OccurrenceCreated   = "created"
+)
+
+// maxRecurringCatchUp ограничивает, сколько пропущенных повторений одного шаблона создаётся за запуск;
+// остальные догоняются следующими запусками планировщика
+const maxRecurringCatchUp = 100
+
+var (
+	ErrRecurringNotFound   = errors.New("повторяющаяся транзакция не найдена")
+	ErrInvalidRecurring    = errors.New("некорректная повторяющаяся транзакция")
+	ErrOccurrenceNotFound  = errors.New("на эту дату повторение не запланировано")
+	ErrOccurrenceProcessed = errors.New("повторение уже обработано, измените созданную транзакцию")
+)
+
+var recurringTypes = map[string]bool{"income": true, "expense": true, "goal": true, "transfer": true}
+
+const recurringColumns = `id, user_id, name, type, amount, currency, description, COALESCE(category_id, 0), account_id,
+	transfer_account_id, transfer_amount, goal_id, frequency, repeat_interval, day_of_month, working_day,
+	start_date, end_date, enabled, next_date, last_date, last_error, created_at, updated_at`
+
+func scanRecurringTransaction(row pgx.Row) (*models.RecurringTransaction, error) {
+	var t models.RecurringTransaction
+	err := row.Scan(
+		&t.ID,
+		&t.UserID,
+		&t.Name,
+		&t.Type,
+		&t.Amount,
+		&t.Currency,
+		&t.Description,
+		&t.CategoryID,
+		&t.AccountID,
+		&t.TransferAccountID,
+		&t.TransferAmount,
+		&t.GoalID,
+		&t.Frequency,
+		&t.Interval,
+		&t.DayOfMonth,
+		&t.WorkingDay,
+		&t.StartDate,
+		&t.EndDate,
+		&t.Enabled,
+		&t.NextDate,
+		&t.LastDate,
+		&t.LastError,
+		&t.CreatedAt,
+		&t.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// recurringTransaction собирает транзакцию повторения из шаблона и изменений этого повторения
+func recurringTransaction(template *models.RecurringTransaction, occurrence *models.RecurringOccurrence) models.Transaction {
+	transaction := models.Transaction{
+		UserID:            template.UserID,
+		CategoryID:        template.CategoryID,
+		Amount:            template.Amount,
+		Date:              occurrence.Date,
+		Type:              template.Type,
+		Description:       template.Description,
+		GoalID:            template.GoalID,
+		Currency:          template.Currency,
+		AccountID:         template.AccountID,
+		TransferAccountID: template.TransferAccountID,
+		TransferAmount:    template.TransferAmount,
+	}
+	if occurrence.Amount != nil {
+		transaction.Amount = *occurrence.Amount
+	}
+	if occurrence.Description != nil {
+		transaction.Description = *occurrence.Description
+	}
+	if occurrence.CategoryID != nil {
+		transaction.CategoryID = *occurrence.CategoryID
+	}
+	return transaction
+}
+
+// prepareRecurringTransaction проверяет шаблон и его расписание, подставляет основной счёт
+// и вычисляет ближайшее необработанное повторение
+func prepareRecurringTransaction(tx pgx.Tx, template *models.RecurringTransaction) error {
+	template.Name = strings.TrimSpace(template.Name)
+	template.Currency = strings.ToUpper(strings.TrimSpace(template.Currency))
+	if template.Name == "" {
+		return fmt.Errorf("%w: укажите название", ErrInvalidRecurring)
+	}
+	if !recurringTypes[template.Type] {
+		return fmt.Errorf("%w: тип должен быть income, expense, goal или transfer", ErrInvalidRecurring)
+	}
+	if toCents(template.Amount) <= 0 {
+		return fmt.Errorf("%w: сумма должна быть положительной", ErrInvalidRecurring)
+	}
+	if err := recurrence.Validate(template); err != nil {
+		return err
+	}
+
+	// Счёт и поля перевода проверяются так же, как у транзакции, которая будет создана
+	transaction := recurringTransaction(template, &models.RecurringOccurrence{Date: template.StartDate})
+	if err := prepareTransactionAccount(tx, &transaction); err != nil {
+		return err
+	}
+	template.AccountID = transaction.AccountID
+	if template.Type != "transfer" {
+		template.TransferAccountID = nil
+		template.TransferAmount = nil
+	}
+
+	after := template.StartDate.AddDate(0, 0, -1)
+	if template.LastDate != nil && template.LastDate.After(after) {
+		after = *template.LastDate
+	}
+	template.NextDate = recurrence.Next(*template, after)
+	return nil
+}
+
+// GetRecurringTransactions возвращает шаблоны пользователя, ближайшие повторения первыми
+func GetRecurringTransactions(pool *pgxpool.Pool, userID int) ([]models.RecurringTransaction, error) {
+	query := `SELECT ` + recurringColumns + ` FROM recurring_transactions WHERE user_id = $1 ORDER BY next_date NULLS LAST, id`
+	rows, err := pool.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении повторяющихся транзакций: %v", err)
+	}
+	defer rows.Close()
+
+	list := []models.RecurringTransaction{}
+	for rows.Next() {
+		template, err := scanRecurringTransaction(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании повторяющейся транзакции: %v", err)
+		}
+		list = append(list, *template)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при получении повторяющихся транзакций: %v", err)
+	}
+	return list, nil
+}
+
+// GetRecurringTransaction возвращает шаблон пользователя по ID
+func GetRecurringTransaction(pool *pgxpool.Pool, userID, recurringID int) (*models.RecurringTransaction, error) {
+	query := `SELECT ` + recurringColumns + ` FROM recurring_transactions WHERE id = $1 AND user_id = $2`
+	template, err := scanRecurringTransaction(pool.QueryRow(context.Background(), query, recurringID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRecurringNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении повторяющейся транзакции: %v", err)
+	}
+	return template, nil
+}
+
+// CreateRecurringTransaction сохраняет шаблон. Повторения с даты начала, которые уже прошли,
+// создаст ближайший запуск планировщика.
+func CreateRecurringTransaction(pool *pgxpool.Pool, template *models.RecurringTransaction) error {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	template.LastDate = nil
+	if err := prepareRecurringTransaction(tx, template); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO recurring_transactions (user_id, name, type, amount, currency, description, category_id, account_id,
+			transfer_account_id, transfer_amount, goal_id, frequency, repeat_interval, day_of_month, working_day,
+			start_date, end_date, enabled, next_date)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
+		RETURNING id, created_at, updated_at`
+	err = tx.QueryRow(context.Background(), query,
+		template.UserID,
+		template.Name,
+		template.Type,
+		template.Amount,
+		template.Currency,
+		template.Description,
+		template.CategoryID,
+		template.AccountID,
+		template.TransferAccountID,
+		template.TransferAmount,
+		template.GoalID,
+		template.Frequency,
+		template.Interval,
+		template.DayOfMonth,
+		template.WorkingDay,
+		template.StartDate,
+		template.EndDate,
+		template.Enabled,
+		template.NextDate).Scan(&template.ID, &template.CreatedAt, &template.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании повторяющейся транзакции: %v", err)
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return nil
+}
+
+// UpdateRecurringTransaction меняет шаблон и расписание. Уже обработанные повторения остаются как есть,
+// следующее ищется после последнего обработанного. Пропуски и изменения дат, которых нет
+// в новом расписании, удаляются. Включение шаблона сбрасывает ошибку, из-за которой он был приостановлен.
+func UpdateRecurringTransaction(pool *pgxpool.Pool, template *models.RecurringTransaction) error {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	err = tx.QueryRow(context.Background(), `
+		SELECT last_date FROM recurring_transactions WHERE id = $1 AND user_id = $2 FOR UPDATE`,
+		template.ID, template.UserID).Scan(&template.LastDate)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrRecurringNotFound
+		}
+		return fmt.Errorf("ошибка при получении повторяющейся транзакции: %v", err)
+	}
+	if err := prepareRecurringTransaction(tx, template); err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE recurring_transactions SET
+			name = $3, type = $4, amount = $5, currency = $6, description = $7, category_id = NULLIF($8, 0),
+			account_id = $9, transfer_account_id = $10, transfer_amount = $11, goal_id = $12, frequency = $13,
+			repeat_interval = $14, day_of_month = $15, working_day = $16, start_date = $17, end_date = $18,
+			enabled = $19, next_date = $20,
+			last_error = CASE WHEN $19 THEN '' ELSE last_error END,
+			updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+		RETURNING last_error, created_at, updated_at`
+	err = tx.QueryRow(context.Background(), query,
+		template.ID,
+		template.UserID,
+		template.Name,
+		template.Type,
+		template.Amount,
+		template.Currency,
+		template.Description,
+		template.CategoryID,
+		template.AccountID,
+		template.TransferAccountID,
+		template.TransferAmount,
+		template.GoalID,
+		template.Frequency,
+		template.Interval,
+		template.DayOfMonth,
+		template.WorkingDay,
+		template.StartDate,
+		template.EndDate,
+		template.Enabled,
+		template.NextDate).Scan(&template.LastError, &template.CreatedAt, &template.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении повторяющейся транзакции: %v", err)
+	}
+
+	pending, err := getRecurringOccurrences(tx, template.ID, nil, nil)
+	if err != nil {
+		return err
+	}
+	var stale []time.Time
+	for _, occurrence := range pending {
+		if occurrence.Status != OccurrenceCreated && !recurrence.Occurs(*template, occurrence.Date) {
+			stale = append(stale, occurrence.Date)
+		}
+	}
+	if len(stale) > 0 {
+		_, err := tx.Exec(context.Background(), `
+			DELETE FROM recurring_occurrences
+			WHERE recurring_id = $1 AND occurrence_date = ANY($2) AND status <> $3`,
+			template.ID, stale, OccurrenceCreated)
+		if err != nil {
+			return fmt.Errorf("ошибка при удалении устаревших повторений: %v", err)
+		}
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return nil
+}
+
+// DeleteRecurringTransaction удаляет шаблон; уже созданные по нему транзакции остаются
+func DeleteRecurringTransaction(pool *pgxpool.Pool, userID, recurringID int) error {
+	result, err := pool.Exec(context.Background(),
+		`DELETE FROM recurring_transactions WHERE id = $1 AND user_id = $2`, recurringID, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при удалении повторяющейся транзакции: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrRecurringNotFound
+	}
+	return nil
+}
+
+// getRecurringOccurrences возвращает сохранённые повторения шаблона, при from и to — только за этот период
+func getRecurringOccurrences(tx pgx.Tx, recurringID int, from, to *time.Time) ([]models.RecurringOccurrence, error) {
+	query := `
+		SELECT occurrence_date, status, transaction_id, amount, description, category_id
+		FROM recurring_occurrences
+		WHERE recurring_id = $1
+			AND ($2::DATE IS NULL OR occurrence_date >= $2)
+			AND ($3::DATE IS NULL OR occurrence_date <= $3)
+		ORDER BY occurrence_date`
+	rows, err := tx.Query(context.Background(), query, recurringID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении повторений: %v", err)
+	}
+	defer rows.Close()
+
+	list := []models.RecurringOccurrence{}
+	for rows.Next() {
+		var occurrence models.RecurringOccurrence
+		if err := rows.Scan(
+			&occurrence.Date,
+			&occurrence.Status,
+			&occurrence.TransactionID,
+			&occurrence.Amount,
+			&occurrence.Description,
+			&occurrence.CategoryID,
+		); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании повторения: %v", err)
+		}
+		list = append(list, occurrence)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при получении повторений: %v", err)
+	}
+	return list, nil
+}
+
+// GetRecurringOccurrences возвращает повторения шаблона с from по to: даты расписания вместе
+// с пропусками и изменениями, а также уже созданные транзакции
+func GetRecurringOccurrences(pool *pgxpool.Pool, userID, recurringID int, from, to time.Time, limit int) ([]models.RecurringOccurrence, error) {
+	template, err := GetRecurringTransaction(pool, userID, recurringID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	from, to = recurrence.Day(from), recurrence.Day(to)
+	saved, err := getRecurringOccurrences(tx, recurringID, &from, &to)
+	if err != nil {
+		return nil, err
+	}
+	byDate := map[time.Time]models.RecurringOccurrence{}
+	for _, occurrence := range saved {
+		byDate[recurrence.Day(occurrence.Date)] = occurrence
+	}
+
+	list := []models.RecurringOccurrence{}
+	for _, date := range recurrence.Between(*template, from, to, limit) {
+		occurrence, ok := byDate[date]
+		if !ok {
+			occurrence = models.RecurringOccurrence{Date: date, Status: OccurrenceScheduled}
+		}
+		delete(byDate, date)
+		list = append(list, occurrence)
+	}
+	// Транзакции, созданные по прежнему расписанию шаблона
+	for _, occurrence := range saved {
+		if _, ok := byDate[recurrence.Day(occurrence.Date)]; ok && occurrence.Status == OccurrenceCreated {
+			list = append(list, occurrence)
+		}
+	}
+	return list, nil
+}
+
+// lockPendingOccurrence блокирует шаблон и проверяет, что на дату приходится ещё не обработанное повторение
+func lockPendingOccurrence(tx pgx.Tx, userID, recurringID int, date time.Time) (*models.RecurringTransaction, error) {
+	query := `SELECT ` + recurringColumns + ` FROM recurring_transactions WHERE id = $1 AND user_id = $2 FOR UPDATE`
+	template, err := scanRecurringTransaction(tx.QueryRow(context.Background(), query, recurringID, userID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrRecurringNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении повторяющейся транзакции: %v", err)
+	}
+	if !recurrence.Occurs(*template, date) {
+		return nil, ErrOccurrenceNotFound
+	}
+	if template.LastDate != nil && !date.After(*template.LastDate) {
+		return nil, ErrOccurrenceProcessed
+	}
+	return template, nil
+}
+
+// SetRecurringOccurrence пропускает одно повторение (status = skipped) или меняет сумму,
+// описание и категорию только для него (status = scheduled)
+func SetRecurringOccurrence(pool *pgxpool.Pool, userID, recurringID int, occurrence *models.RecurringOccurrence) error {
+	occurrence.Date = recurrence.Day(occurrence.Date)
+	occurrence.TransactionID = nil
+	switch occurrence.Status {
+	case OccurrenceSkipped:
+		occurrence.Amount, occurrence.Description, occurrence.CategoryID = nil, nil, nil
+	case OccurrenceScheduled:
+		if occurrence.Amount != nil && toCents(*occurrence.Amount) <= 0 {
+			return fmt.Errorf("%w: сумма должна быть положительной", ErrInvalidRecurring)
+		}
+	default:
+		return fmt.Errorf("%w: состояние повторения должно быть scheduled или skipped", ErrInvalidRecurring)
+	}
+
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	if _, err := lockPendingOccurrence(tx, userID, recurringID, occurrence.Date); err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO recurring_occurrences (user_id, recurring_id, occurrence_date, status, amount, description, category_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (recurring_id, occurrence_date) DO UPDATE SET
+			status = EXCLUDED.status, amount = EXCLUDED.amount,
+			description = EXCLUDED.description, category_id = EXCLUDED.category_id`
+	_, err = tx.Exec(context.Background(), query,
+		userID,
+		recurringID,
+		occurrence.Date,
+		occurrence.Status,
+		occurrence.Amount,
+		occurrence.Description,
+		occurrence.CategoryID)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении повторения: %v", err)
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return nil
+}
+
+// ResetRecurringOccurrence отменяет пропуск или изменения повторения: оно создастся по шаблону
+func ResetRecurringOccurrence(pool *pgxpool.Pool, userID, recurringID int, date time.Time) error {
+	date = recurrence.Day(date)
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	if _, err := lockPendingOccurrence(tx, userID, recurringID, date); err != nil {
+		return err
+	}
+	_, err = tx.Exec(context.Background(), `
+		DELETE FROM recurring_occurrences WHERE recurring_id = $1 AND occurrence_date = $2 AND status <> $3`,
+		recurringID, date, OccurrenceCreated)
+	if err != nil {
+		return fmt.Errorf("ошибка при сбросе повторения: %v", err)
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return nil
+}
+
+// ProcessRecurringTransactions создаёт транзакции по всем повторениям, срок которых наступил
+// к сегодняшнему дню, включая пропущенные, пока сервер не работал. Каждое повторение
+// обрабатывается в своей транзакции БД, а шаблон блокируется, так что параллельные запуски
+// не создадут транзакцию дважды. Возвращает число созданных транзакций.
+func ProcessRecurringTransactions(pool *pgxpool.Pool) (int, error) {
+	today := recurrence.Day(time.Now())
+	rows, err := pool.Query(context.Background(), `
+		SELECT id FROM recurring_transactions WHERE enabled AND next_date <= $1 ORDER BY next_date, id`, today)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при получении повторяющихся транзакций к созданию: %v", err)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("ошибка при сканировании повторяющейся транзакции: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("ошибка при получении повторяющихся транзакций к созданию: %v", err)
+	}
+
+	created := 0
+	for _, id := range ids {
+		for i := 0; i < maxRecurringCatchUp; i++ {
+			done, ok, err := processNextOccurrence(pool, id, today)
+			if err != nil {
+				log.Printf("Ошибка создания повторяющейся транзакции #%d: %v", id, err)
+				break
+			}
+			if ok {
+				created++
+			}
+			if done {
+				break
+			}
+		}
+	}
+	return created, nil
+}
+
+// processNextOccurrence обрабатывает ближайшее наступившее повторение шаблона: создаёт транзакцию
+// или пропускает его. done — больше обрабатывать нечего, created — транзакция создана.
+func processNextOccurrence(pool *pgxpool.Pool, recurringID int, today time.Time) (done, created bool, err error) {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return false, false, fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	// Шаблон, который обрабатывает другой запуск, пропускается
+	query := `
+		SELECT ` + recurringColumns + ` FROM recurring_transactions
+		WHERE id = $1 AND enabled AND next_date <= $2
+		FOR UPDATE SKIP LOCKED`
+	template, err := scanRecurringTransaction(tx.QueryRow(context.Background(), query, recurringID, today))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return true, false, nil
+		}
+		return false, false, fmt.Errorf("ошибка при получении повторяющейся транзакции: %v", err)
+	}
+	date := recurrence.Day(*template.NextDate)
+
+	occurrence := models.RecurringOccurrence{Date: date, Status: OccurrenceScheduled}
+	err = tx.QueryRow(context.Background(), `
+		SELECT status, transaction_id, amount, description, category_id
+		FROM recurring_occurrences WHERE recurring_id = $1 AND occurrence_date = $2`, recurringID, date).Scan(
+		&occurrence.Status, &occurrence.TransactionID, &occurrence.Amount, &occurrence.Description, &occurrence.CategoryID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return false, false, fmt.Errorf("ошибка при получении повторения: %v", err)
+	}
+
+	var transaction *models.Transaction
+	if occurrence.Status == OccurrenceScheduled {
+		next := recurringTransaction(template, &occurrence)
+		if err := insertTransaction(tx, &next); err != nil {
+			if isTransactionInputError(err) {
+				// Блокировка шаблона снимается до приостановки: та обновляет его через другое соединение
+				if rbErr := tx.Rollback(context.Background()); rbErr != nil {
+					return false, false, fmt.Errorf("ошибка при откате транзакции: %v", rbErr)
+				}
+				return true, false, pauseRecurringTransaction(pool, template, date, err)
+			}
+			return false, false, err
+		}
+		transaction = &next
+
+		_, err = tx.Exec(context.Background(), `
+			INSERT INTO recurring_occurrences (user_id, recurring_id, occurrence_date, status, transaction_id)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (recurring_id, occurrence_date) DO UPDATE SET status = EXCLUDED.status, transaction_id = EXCLUDED.transaction_id`,
+			template.UserID, recurringID, date, OccurrenceCreated, transaction.ID)
+		if err != nil {
+			return false, false, fmt.Errorf("ошибка при сохранении повторения: %v", err)
+		}
+	}
+
+	template.NextDate = recurrence.Next(*template, date)
+	_, err = tx.Exec(context.Background(), `
+		UPDATE recurring_transactions SET last_date = $2, next_date = $3 WHERE id = $1`,
+		recurringID, date, template.NextDate)
+	if err != nil {
+		return false, false, fmt.Errorf("ошибка при переходе к следующему повторению: %v", err)
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return false, false, fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	if transaction != nil {
+		if err := transactionCreated(pool, transaction); err != nil {
+			log.Printf("Ошибка после создания повторяющейся транзакции #%d: %v", recurringID, err)
+		}
+	}
+	done = template.NextDate == nil || template.NextDate.After(today)
+	return done, transaction != nil, nil
+}
+
+// isTransactionInputError отличает ошибки данных транзакции от сбоев БД
+func isTransactionInputError(err error) bool {
+	return errors.Is(err, ErrCategoryRequired) || errors.Is(err, ErrCategoryNotFound) || errors.Is(err, ErrGoalNotFound) ||
+		errors.Is(err, ErrInvalidSplits) || errors.Is(err, ErrInvalidTransfer) || errors.Is(err, ErrAccountNotFound)
+}
+
+// pauseRecurringTransaction приостанавливает шаблон, по которому не получается создать транзакцию
+// (например, удалена категория или счёт зачисления), и сообщает об этом пользователю.
+// Повторять попытки бессмысленно, пока пользователь не исправит шаблон.
+func pauseRecurringTransaction(pool *pgxpool.Pool, template *models.RecurringTransaction, date time.Time, cause error) error {
+	_, err := pool.Exec(context.Background(), `
+		UPDATE recurring_transactions SET enabled = FALSE, last_error = $2, updated_at = NOW() WHERE id = $1`,
+		template.ID, cause.Error())
+	if err != nil {
+		return fmt.Errorf("ошибка при приостановке повторяющейся транзакции: %v", err)
+	}
+	notification := &models.Notification{
+		UserID: template.UserID,
+		Message: fmt.Sprintf("Не удалось создать повторяющуюся транзакцию «%s» за %s: %v. Исправьте её и включите снова.",
+			template.Name, date.Format("02.01.2006"), cause),
+		DateWhen: time.Now(),
+	}
+	if err := CreateNotification(pool, notification); err != nil {
+		log.Printf("Ошибка уведомления о приостановке повторяющейся транзакции #%d: %v", template.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// Встроенные роли
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+	RoleAuditor = "auditor"
+	RoleUser    = "user"
+)
+
+// Права, которые проверяются на маршрутах администрирования
+const (
+	PermissionUsersRead   = "users.read"
+	PermissionUsersWrite  = "users.write"
+	PermissionUsersDelete = "users.delete"
+	PermissionRolesManage = "roles.manage"
+	PermissionStatsRead   = "stats.read"
+	PermissionAuditRead   = "audit.read"
+	// Смена пароля и email другого пользователя: с ней можно войти под его аккаунтом
+	PermissionUsersCredentials = "users.credentials"
+	// Доступ к финансовым данным, настройкам и выгрузкам другого пользователя
+	PermissionUsersData = "users.data"
+)
+
+var (
+	ErrRoleNotFound    = errors.New("роль не найдена")
+	ErrRoleNotAssigned = errors.New("роль не назначена пользователю")
+	ErrLastAdmin       = errors.New("нельзя отозвать роль у последнего администратора")
+)
+
+// GetRoles возвращает все роли вместе с их правами
+func GetRoles(pool *pgxpool.Pool) ([]models.Role, error) {
+	query := `
+		SELECT r.id, r.name, r.description,
+			COALESCE(ARRAY_AGG(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		GROUP BY r.id
+		ORDER BY r.id`
+
+	rows, err := pool.Query(context.Background(), query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении ролей: %v", err)
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.Permissions); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании роли: %v", err)
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+// GetUserRoleNames возвращает названия ролей пользователя
+func GetUserRoleNames(pool *pgxpool.Pool, userID int) ([]string, error) {
+	query := `
+		SELECT r.name
+		FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id = $1
+		ORDER BY r.id`
+
+	rows, err := pool.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении ролей пользователя: %v", err)
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании роли: %v", err)
+		}
+		roles = append(roles, name)
+	}
+	return roles, nil
+}
+
+// GetUserPermissions возвращает права, выданные пользователю через все его роли
+func GetUserPermissions(pool *pgxpool.Pool, userID int) ([]string, error) {
+	query := `
+		SELECT DISTINCT rp.permission
+		FROM user_roles ur
+		JOIN role_permissions rp ON rp.role_id = ur.role_id
+		WHERE ur.user_id = $1`
+
+	rows, err := pool.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении прав пользователя: %v", err)
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании права: %v", err)
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, nil
+}
+
+// getRoleID возвращает ID роли по названию
+func getRoleID(tx pgx.Tx, role string) (int, error) {
+	var roleID int
+	err := tx.QueryRow(context.Background(), `SELECT id FROM roles WHERE name = $1`, role).Scan(&roleID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrRoleNotFound
+		}
+		return 0, fmt.Errorf("ошибка при получении роли: %v", err)
+	}
+	return roleID, nil
+}
+
+// syncAdminFlag приводит users.is_admin в соответствие с наличием роли admin
+func syncAdminFlag(tx pgx.Tx, userID int) error {
+	query := `
+		UPDATE users
+		SET is_admin = EXISTS(
+			SELECT 1 FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+			WHERE ur.user_id = $1 AND r.name = $2
+		)
+		WHERE id = $1`
+	if _, err := tx.Exec(context.Background(), query, userID, RoleAdmin); err != nil {
+		return fmt.Errorf("ошибка при обновлении признака администратора: %v", err)
+	}
+	return nil
+}
+
+// GrantRole назначает роль пользователю; повторное назначение ничего не меняет
+func GrantRole(pool *pgxpool.Pool, userID int, role string, grantedBy int) error {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	roleID, err := getRoleID(tx, role)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO user_roles (user_id, role_id, granted_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, role_id) DO NOTHING`
+	if _, err := tx.Exec(context.Background(), query, userID, roleID, grantedBy); err != nil {
+		return fmt.Errorf("ошибка при назначении роли: %v", err)
+	}
+
+	if err := syncAdminFlag(tx, userID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return nil
+}
+
+// RevokeRole отзывает роль у пользователя. Последнего администратора лишить роли нельзя.
+func RevokeRole(pool *pgxpool.Pool, userID int, role string) error {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	roleID, err := getRoleID(tx, role)
+	if err != nil {
+		return err
+	}
+
+	if role == RoleAdmin {
+		// Блокируем строки администраторов, чтобы два одновременных отзыва не оставили систему без них
+		var others int
+		countQuery := `
+			SELECT COUNT(*) FROM (
+				SELECT user_id FROM user_roles WHERE role_id = $1 AND user_id <> $2 FOR UPDATE
+			) admins`
+		if err := tx.QueryRow(context.Background(), countQuery, roleID, userID).Scan(&others); err != nil {
+			return fmt.Errorf("ошибка при проверке администраторов: %v", err)
+		}
+		if others == 0 {
+			return ErrLastAdmin
+		}
+	}
+
+	result, err := tx.Exec(context.Background(), `DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2`, userID, roleID)
+	if err != nil {
+		return fmt.Errorf("ошибка при отзыве роли: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrRoleNotAssigned
+	}
+
+	if err := syncAdminFlag(tx, userID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return nil
+}
+
+// IsLastAdmin сообщает, является ли пользователь единственным администратором
+func IsLastAdmin(pool *pgxpool.Pool, userID int) (bool, error) {
+	query := `
+		SELECT
+			EXISTS(SELECT 1 FROM user_roles ur JOIN roles r ON r.id = ur.role_id WHERE r.name = $2 AND ur.user_id = $1),
+			EXISTS(SELECT 1 FROM user_roles ur JOIN roles r ON r.id = ur.role_id WHERE r.name = $2 AND ur.user_id <> $1)`
+
+	var isAdmin, hasOthers bool
+	if err := pool.QueryRow(context.Background(), query, userID, RoleAdmin).Scan(&isAdmin, &hasOthers); err != nil {
+		return false, fmt.Errorf("ошибка при проверке администраторов: %v", err)
+	}
+	return isAdmin && !hasOthers, nil
+}
@@ -0,0 +1,333 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/rules"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+var (
+	ErrRuleNotFound     = errors.New("правило не найдено")
+	ErrInvalidRuleOrder = errors.New("в новом порядке должны быть перечислены все правила пользователя ровно по одному разу")
+	ErrCategoryRequired = errors.New("укажите категорию: ни одно правило автокатегоризации не подошло")
+)
+
+const categorizationRuleColumns = `id, user_id, position, name, enabled, description_contains, description_regex,
+	min_amount, max_amount, type, set_category_id, set_description, set_goal_id, created_at, updated_at`
+
+func scanCategorizationRules(rows pgx.Rows) ([]models.CategorizationRule, error) {
+	defer rows.Close()
+	list := []models.CategorizationRule{}
+	for rows.Next() {
+		var rule models.CategorizationRule
+		if err := rows.Scan(
+			&rule.ID,
+			&rule.UserID,
+			&rule.Position,
+			&rule.Name,
+			&rule.Enabled,
+			&rule.DescriptionContains,
+			&rule.DescriptionRegex,
+			&rule.MinAmount,
+			&rule.MaxAmount,
+			&rule.Type,
+			&rule.SetCategoryID,
+			&rule.SetDescription,
+			&rule.SetGoalID,
+			&rule.CreatedAt,
+			&rule.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании правила: %v", err)
+		}
+		list = append(list, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при получении правил: %v", err)
+	}
+	return list, nil
+}
+
+// GetCategorizationRules возвращает правила пользователя в порядке применения
+func GetCategorizationRules(pool *pgxpool.Pool, userID int) ([]models.CategorizationRule, error) {
+	query := `SELECT ` + categorizationRuleColumns + ` FROM categorization_rules WHERE user_id = $1 ORDER BY position, id`
+	rows, err := pool.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении правил: %v", err)
+	}
+	return scanCategorizationRules(rows)
+}
+
+// loadRuleEngine собирает включённые правила пользователя внутри транзакции БД
+func loadRuleEngine(tx pgx.Tx, userID int) (*rules.Engine, error) {
+	query := `SELECT ` + categorizationRuleColumns + ` FROM categorization_rules WHERE user_id = $1 AND enabled ORDER BY position, id`
+	rows, err := tx.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении правил: %v", err)
+	}
+	list, err := scanCategorizationRules(rows)
+	if err != nil {
+		return nil, err
+	}
+	return rules.NewEngine(list)
+}
+
+// CreateCategorizationRule добавляет правило в конец списка
+func CreateCategorizationRule(pool *pgxpool.Pool, rule *models.CategorizationRule) error {
+	query := `
+		INSERT INTO categorization_rules (user_id, position, name, enabled, description_contains, description_regex,
+			min_amount, max_amount, type, set_category_id, set_description, set_goal_id)
+		SELECT $1, COALESCE(MAX(position), 0) + 1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11
+		FROM categorization_rules WHERE user_id = $1
+		RETURNING id, position, created_at, updated_at`
+	err := pool.QueryRow(context.Background(), query,
+		rule.UserID,
+		rule.Name,
+		rule.Enabled,
+		rule.DescriptionContains,
+		rule.DescriptionRegex,
+		rule.MinAmount,
+		rule.MaxAmount,
+		rule.Type,
+		rule.SetCategoryID,
+		rule.SetDescription,
+		rule.SetGoalID).Scan(&rule.ID, &rule.Position, &rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании правила: %v", err)
+	}
+	return nil
+}
+
+// UpdateCategorizationRule меняет условия и действия правила; место в списке не меняется
+func UpdateCategorizationRule(pool *pgxpool.Pool, rule *models.CategorizationRule) error {
+	query := `
+		UPDATE categorization_rules SET
+			name = $3, enabled = $4, description_contains = $5, description_regex = $6, min_amount = $7,
+			max_amount = $8, type = $9, set_category_id = $10, set_description = $11, set_goal_id = $12, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+		RETURNING position, created_at, updated_at`
+	err := pool.QueryRow(context.Background(), query,
+		rule.ID,
+		rule.UserID,
+		rule.Name,
+		rule.Enabled,
+		rule.DescriptionContains,
+		rule.DescriptionRegex,
+		rule.MinAmount,
+		rule.MaxAmount,
+		rule.Type,
+		rule.SetCategoryID,
+		rule.SetDescription,
+		rule.SetGoalID).Scan(&rule.Position, &rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrRuleNotFound
+		}
+		return fmt.Errorf("ошибка при обновлении правила: %v", err)
+	}
+	return nil
+}
+
+// DeleteCategorizationRule удаляет правило пользователя
+func DeleteCategorizationRule(pool *pgxpool.Pool, userID, ruleID int) error {
+	result, err := pool.Exec(context.Background(), `DELETE FROM categorization_rules WHERE id = $1 AND user_id = $2`, ruleID, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при удалении правила: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+// ReorderCategorizationRules задаёт порядок применения: ruleIDs — все правила пользователя в новом порядке
+func ReorderCategorizationRules(pool *pgxpool.Pool, userID int, ruleIDs []int) error {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	var total, listed int
+	err = tx.QueryRow(context.Background(), `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE id = ANY($2))
+		FROM (SELECT id FROM categorization_rules WHERE user_id = $1 FOR UPDATE) AS owned`,
+		userID, ruleIDs).Scan(&total, &listed)
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке правил: %v", err)
+	}
+	seen := map[int]bool{}
+	for _, id := range ruleIDs {
+		seen[id] = true
+	}
+	if total != len(ruleIDs) || listed != total || len(seen) != len(ruleIDs) {
+		return ErrInvalidRuleOrder
+	}
+
+	for i, id := range ruleIDs {
+		if _, err := tx.Exec(context.Background(), `
+			UPDATE categorization_rules SET position = $3, updated_at = NOW()
+			WHERE id = $1 AND user_id = $2`, id, userID, i+1); err != nil {
+			return fmt.Errorf("ошибка при изменении порядка правил: %v", err)
+		}
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return nil
+}
+
+// RuleChangeValues — поля транзакции, которые могут менять правила
+type RuleChangeValues struct {
+	CategoryID  int    `json:"category_id"`
+	Description string `json:"description"`
+	GoalID      *int   `json:"goal_id"`
+}
+
+// RuleChange — транзакция, которую изменит (или изменил) повторный прогон правил
+type RuleChange struct {
+	TransactionID int              `json:"transaction_id"`
+	Date          time.Time        `json:"date"`
+	Amount        float64          `json:"amount"`
+	Type          string           `json:"type"`
+	Before        RuleChangeValues `json:"before"`
+	After         RuleChangeValues `json:"after"`
+	RuleIDs       []int            `json:"rule_ids"`
+}
+
+// RunCategorizationRules заново применяет правила к текущим транзакциям, отобранным фильтром
+// (лимит и курсор фильтра не учитываются). В отличие от ручного ввода, правила перезаписывают
+// категорию, описание и цель. При dryRun ничего не сохраняется — это предпросмотр изменений.
+// Если у транзакции типа goal меняется цель, её сумма переносится со старой цели на новую.
+// Архив, разделённые транзакции и переводы не затрагиваются.
+func RunCategorizationRules(pool *pgxpool.Pool, filter TransactionFilter, dryRun bool) ([]RuleChange, error) {
+	if filter.UserID <= 0 {
+		return nil, errors.New("не указан пользователь")
+	}
+
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	engine, err := loadRuleEngine(tx, filter.UserID)
+	if err != nil {
+		return nil, err
+	}
+	changes := []RuleChange{}
+	if engine.Empty() {
+		return changes, nil
+	}
+
+	var q sqlConditions
+	addTransactionFilter(&q, filter)
+	// Категории разделённой транзакции задают её части, поэтому правила её не трогают; переводы тоже
+	q.add("NOT EXISTS (SELECT 1 FROM transaction_splits s WHERE s.transaction_id = transactions.id)")
+	q.add("type <> 'transfer'")
+	query := `
+		SELECT id, category_id, amount, COALESCE(description, ''), transaction_date, type, goal_id
+		FROM transactions` + q.where() + `
+		ORDER BY transaction_date, id`
+	if !dryRun {
+		query += ` FOR UPDATE`
+	}
+	rows, err := tx.Query(context.Background(), query, q.args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении транзакций: %v", err)
+	}
+	for rows.Next() {
+		var transaction models.Transaction
+		if err := rows.Scan(
+			&transaction.ID,
+			&transaction.CategoryID,
+			&transaction.Amount,
+			&transaction.Description,
+			&transaction.Date,
+			&transaction.Type,
+			&transaction.GoalID,
+		); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("ошибка при сканировании транзакции: %v", err)
+		}
+
+		before := RuleChangeValues{CategoryID: transaction.CategoryID, Description: transaction.Description, GoalID: transaction.GoalID}
+		result := engine.Evaluate(transaction)
+		if !result.ApplyTo(&transaction, false) {
+			continue
+		}
+		changes = append(changes, RuleChange{
+			TransactionID: transaction.ID,
+			Date:          transaction.Date,
+			Amount:        transaction.Amount,
+			Type:          transaction.Type,
+			Before:        before,
+			After:         RuleChangeValues{CategoryID: transaction.CategoryID, Description: transaction.Description, GoalID: transaction.GoalID},
+			RuleIDs:       result.RuleIDs,
+		})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при получении транзакций: %v", err)
+	}
+	if dryRun {
+		return changes, nil
+	}
+
+	updateQuery := `UPDATE transactions SET category_id = $2, description = $3, goal_id = $4 WHERE id = $1`
+	for _, change := range changes {
+		moved := !sameGoal(change.Before.GoalID, change.After.GoalID)
+		if moved {
+			target := models.Transaction{UserID: filter.UserID, GoalID: change.After.GoalID}
+			if err := checkTransactionGoal(tx, &target); err != nil {
+				return nil, fmt.Errorf("транзакция %d: %w", change.TransactionID, err)
+			}
+		}
+		if _, err := tx.Exec(context.Background(), updateQuery,
+			change.TransactionID, change.After.CategoryID, change.After.Description, change.After.GoalID); err != nil {
+			return nil, fmt.Errorf("ошибка при обновлении транзакции %d: %v", change.TransactionID, err)
+		}
+		if !moved || change.Type != "goal" {
+			continue
+		}
+		if change.Before.GoalID != nil {
+			previous := models.Transaction{Type: change.Type, Amount: -change.Amount, GoalID: change.Before.GoalID}
+			if err := creditTransactionGoal(tx, &previous); err != nil {
+				return nil, err
+			}
+		}
+		current := models.Transaction{Type: change.Type, Amount: change.Amount, GoalID: change.After.GoalID}
+		if err := creditTransactionGoal(tx, &current); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(context.Background()); err != nil {
+		return nil, fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+
+	before := make([]models.Transaction, 0, len(changes))
+	after := make([]models.Transaction, 0, len(changes))
+	for _, change := range changes {
+		transaction := models.Transaction{Amount: change.Amount, Type: change.Type}
+		transaction.CategoryID, transaction.Description = change.Before.CategoryID, change.Before.Description
+		before = append(before, transaction)
+		transaction.CategoryID, transaction.Description = change.After.CategoryID, change.After.Description
+		after = append(after, transaction)
+	}
+	learnCategories(filter.UserID, before, after)
+	return changes, nil
+}
+
+// sameGoal сравнивает привязки к цели; отсутствие цели равно только отсутствию
+func sameGoal(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
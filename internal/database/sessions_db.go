@@ -0,0 +1,197 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+var (
+	ErrSessionNotFound    = errors.New("сессия не найдена или завершена")
+	ErrRefreshTokenReused = errors.New("refresh-токен уже был использован")
+)
+
+// CreateSession сохраняет новую сессию с хешем refresh-токена
+func CreateSession(pool *pgxpool.Pool, session *models.Session, refreshTokenHash string) error {
+	query := `
+		INSERT INTO sessions (user_id, refresh_token_hash, device, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, last_seen_at`
+	err := pool.QueryRow(context.Background(), query,
+		session.UserID,
+		refreshTokenHash,
+		session.Device,
+		session.IPAddress,
+		session.ExpiresAt).Scan(&session.ID, &session.CreatedAt, &session.LastSeenAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании сессии: %v", err)
+	}
+	return nil
+}
+
+// GetActiveSession возвращает действующую сессию пользователя и отмечает её активность
+func GetActiveSession(pool *pgxpool.Pool, sessionID, userID int) (*models.Session, error) {
+	query := `
+		UPDATE sessions
+		SET last_seen_at = CASE WHEN last_seen_at < NOW() - INTERVAL '1 minute' THEN NOW() ELSE last_seen_at END
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
+		RETURNING id, user_id, device, ip_address, created_at, last_seen_at, expires_at`
+
+	session := &models.Session{}
+	err := pool.QueryRow(context.Background(), query, sessionID, userID).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.Device,
+		&session.IPAddress,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении сессии: %v", err)
+	}
+	return session, nil
+}
+
+// RotateSessionToken заменяет refresh-токен сессии на новый.
+// Повторное предъявление уже заменённого токена завершает сессию целиком.
+func RotateSessionToken(pool *pgxpool.Pool, oldHash, newHash, ipAddress string, expiresAt time.Time) (*models.Session, error) {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	query := `
+		SELECT id, user_id, device, created_at, expires_at, revoked_at
+		FROM sessions
+		WHERE refresh_token_hash = $1
+		FOR UPDATE`
+
+	session := &models.Session{}
+	err = tx.QueryRow(context.Background(), query, oldHash).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.Device,
+		&session.CreatedAt,
+		&session.ExpiresAt,
+		&session.RevokedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Токен мог быть украден и уже обменян: завершаем сессию, которой он принадлежал
+		revokeQuery := `
+			UPDATE sessions
+			SET revoked_at = NOW()
+			WHERE previous_token_hash = $1 AND revoked_at IS NULL`
+		result, err := tx.Exec(context.Background(), revokeQuery, oldHash)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при завершении сессии: %v", err)
+		}
+		if result.RowsAffected() > 0 {
+			if err := tx.Commit(context.Background()); err != nil {
+				return nil, fmt.Errorf("ошибка при завершении транзакции: %v", err)
+			}
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении сессии: %v", err)
+	}
+	if session.RevokedAt != nil || !session.ExpiresAt.After(time.Now()) {
+		return nil, ErrSessionNotFound
+	}
+
+	updateQuery := `
+		UPDATE sessions
+		SET refresh_token_hash = $1, previous_token_hash = $2, ip_address = $3,
+		    last_seen_at = NOW(), expires_at = $4
+		WHERE id = $5
+		RETURNING ip_address, last_seen_at, expires_at`
+	err = tx.QueryRow(context.Background(), updateQuery, newHash, oldHash, ipAddress, expiresAt, session.ID).Scan(
+		&session.IPAddress,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при обновлении сессии: %v", err)
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return nil, fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return session, nil
+}
+
+// GetSessionsByUserID возвращает действующие сессии пользователя, начиная с последней активной
+func GetSessionsByUserID(pool *pgxpool.Pool, userID int) ([]models.Session, error) {
+	query := `
+		SELECT id, user_id, device, ip_address, created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_seen_at DESC`
+
+	rows, err := pool.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении сессий: %v", err)
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.Device,
+			&session.IPAddress,
+			&session.CreatedAt,
+			&session.LastSeenAt,
+			&session.ExpiresAt,
+		); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании сессии: %v", err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// RevokeOtherSessions завершает все сессии пользователя, кроме exceptSessionID (0 — все),
+// и возвращает число завершённых
+func RevokeOtherSessions(pool *pgxpool.Pool, userID, exceptSessionID int) (int64, error) {
+	query := `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL`
+
+	result, err := pool.Exec(context.Background(), query, userID, exceptSessionID)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при завершении сессий: %v", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// RevokeSession завершает одну сессию пользователя
+func RevokeSession(pool *pgxpool.Pool, sessionID, userID int) error {
+	query := `
+		UPDATE sessions
+		SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+
+	result, err := pool.Exec(context.Background(), query, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при завершении сессии: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
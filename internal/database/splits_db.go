@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+var ErrInvalidSplits = errors.New("некорректное разделение транзакции")
+
+func toCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// prepareSplits проверяет части транзакции: у каждой своя категория и положительная сумма,
+// а вместе они дают сумму транзакции с точностью до копейки. Категорией самой транзакции
+// становится категория наибольшей части — её видят отчёты и фильтры, которые части не учитывают.
+func prepareSplits(transaction *models.Transaction) error {
+	if len(transaction.Splits) == 0 {
+		return nil
+	}
+	if len(transaction.Splits) < 2 {
+		return fmt.Errorf("%w: нужно не меньше двух частей", ErrInvalidSplits)
+	}
+
+	var total int64
+	largest := 0
+	for i := range transaction.Splits {
+		split := &transaction.Splits[i]
+		split.Note = strings.TrimSpace(split.Note)
+		if split.CategoryID <= 0 {
+			return fmt.Errorf("%w: у части %d не указана категория", ErrInvalidSplits, i+1)
+		}
+		if toCents(split.Amount) <= 0 {
+			return fmt.Errorf("%w: сумма части %d должна быть положительной", ErrInvalidSplits, i+1)
+		}
+		total += toCents(split.Amount)
+		if split.Amount > transaction.Splits[largest].Amount {
+			largest = i
+		}
+	}
+	if total != toCents(transaction.Amount) {
+		return fmt.Errorf("%w: сумма частей %.2f не равна сумме транзакции %.2f",
+			ErrInvalidSplits, float64(total)/100, transaction.Amount)
+	}
+	transaction.CategoryID = transaction.Splits[largest].CategoryID
+	return nil
+}
+
+// saveTransactionSplits заменяет части транзакции; категории частей должны принадлежать её владельцу
+func saveTransactionSplits(tx pgx.Tx, transaction *models.Transaction) error {
+	if _, err := tx.Exec(context.Background(), `DELETE FROM transaction_splits WHERE transaction_id = $1`, transaction.ID); err != nil {
+		return fmt.Errorf("ошибка при удалении частей транзакции: %v", err)
+	}
+	if len(transaction.Splits) == 0 {
+		return nil
+	}
+
+	categoryIDs := make([]int, 0, len(transaction.Splits))
+	distinct := map[int]bool{}
+	for _, split := range transaction.Splits {
+		categoryIDs = append(categoryIDs, split.CategoryID)
+		distinct[split.CategoryID] = true
+	}
+	var owned int
+	err := tx.QueryRow(context.Background(), `SELECT COUNT(*) FROM categories WHERE user_id = $1 AND id = ANY($2)`,
+		transaction.UserID, categoryIDs).Scan(&owned)
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке категорий частей: %v", err)
+	}
+	if owned != len(distinct) {
+		return fmt.Errorf("%w: категория части не найдена", ErrInvalidSplits)
+	}
+
+	query := `
+		INSERT INTO transaction_splits (user_id, transaction_id, category_id, amount, note)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id`
+	for i := range transaction.Splits {
+		split := &transaction.Splits[i]
+		err := tx.QueryRow(context.Background(), query,
+			transaction.UserID, transaction.ID, split.CategoryID, split.Amount, split.Note).Scan(&split.ID)
+		if err != nil {
+			return fmt.Errorf("ошибка при сохранении части транзакции: %v", err)
+		}
+	}
+	return nil
+}
+
+// scanTransactionSplits группирует части по ID транзакции; запрос выбирает transaction_id, id, category_id, amount, note
+func scanTransactionSplits(rows pgx.Rows) (map[int][]models.TransactionSplit, error) {
+	defer rows.Close()
+	splits := map[int][]models.TransactionSplit{}
+	for rows.Next() {
+		var transactionID int
+		var split models.TransactionSplit
+		if err := rows.Scan(&transactionID, &split.ID, &split.CategoryID, &split.Amount, &split.Note); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании части транзакции: %v", err)
+		}
+		splits[transactionID] = append(splits[transactionID], split)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при получении частей транзакций: %v", err)
+	}
+	return splits, nil
+}
+
+const transactionSplitsQuery = `
+	SELECT transaction_id, id, category_id, amount, note
+	FROM transaction_splits
+	WHERE transaction_id = ANY($1)
+	ORDER BY id`
+
+// attachTransactionSplits дополняет текущие транзакции их частями
+func attachTransactionSplits(pool *pgxpool.Pool, transactions []models.Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+	ids := make([]int, 0, len(transactions))
+	for _, transaction := range transactions {
+		ids = append(ids, transaction.ID)
+	}
+	rows, err := pool.Query(context.Background(), transactionSplitsQuery, ids)
+	if err != nil {
+		return fmt.Errorf("ошибка при получении частей транзакций: %v", err)
+	}
+	splits, err := scanTransactionSplits(rows)
+	if err != nil {
+		return err
+	}
+	for i := range transactions {
+		transactions[i].Splits = splits[transactions[i].ID]
+	}
+	return nil
+}
+
+// categoryAmounts распределяет сумму транзакции по категориям: по частям, если транзакция разделена
+func categoryAmounts(transaction models.Transaction) map[int]float64 {
+	if len(transaction.Splits) == 0 {
+		return map[int]float64{transaction.CategoryID: transaction.Amount}
+	}
+	amounts := map[int]float64{}
+	for _, split := range transaction.Splits {
+		amounts[split.CategoryID] += split.Amount
+	}
+	return amounts
+}
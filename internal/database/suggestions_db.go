@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/suggest"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// DefaultSuggestionCount — сколько категорий подсказывать, если клиент не указал
+const DefaultSuggestionCount = 3
+
+// CategorySuggestion — подсказанная категория с названием
+type CategorySuggestion struct {
+	CategoryID int     `json:"category_id"`
+	Name       string  `json:"name"`
+	Confidence float64 `json:"confidence"`
+}
+
+// categoryModelEntry — модель пользователя; mu удерживается на время первого обучения,
+// чтобы параллельные запросы не обучали модель дважды
+type categoryModelEntry struct {
+	mu    sync.Mutex
+	model *suggest.Model
+}
+
+// categoryModels хранит модели в памяти процесса. Модель обучается по всей истории при первой подсказке,
+// затем дообучается при создании, смене категории и удалении транзакций. После перезапуска обучается заново.
+var categoryModels = struct {
+	sync.Mutex
+	byUser map[int]*categoryModelEntry
+}{byUser: map[int]*categoryModelEntry{}}
+
+func categoryModelEntryFor(userID int) *categoryModelEntry {
+	categoryModels.Lock()
+	defer categoryModels.Unlock()
+	entry := categoryModels.byUser[userID]
+	if entry == nil {
+		entry = &categoryModelEntry{}
+		categoryModels.byUser[userID] = entry
+	}
+	return entry
+}
+
+// loadedCategoryModel возвращает модель пользователя, только если она уже обучена:
+// дообучать модель, которой ещё нет, незачем — она прочитает изменения из базы при обучении
+func loadedCategoryModel(userID int) *suggest.Model {
+	categoryModels.Lock()
+	entry := categoryModels.byUser[userID]
+	categoryModels.Unlock()
+	if entry == nil {
+		return nil
+	}
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	return entry.model
+}
+
+// categoryModel возвращает модель пользователя, при необходимости обучив её
+// на текущих и архивных транзакциях
+func categoryModel(pool *pgxpool.Pool, userID int) (*suggest.Model, error) {
+	entry := categoryModelEntryFor(userID)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.model != nil {
+		return entry.model, nil
+	}
+
+	query := `
+		SELECT COALESCE(category_id, 0), amount, COALESCE(description, ''), type FROM transactions WHERE user_id = $1
+		UNION ALL
+		SELECT COALESCE(category_id, 0), amount, COALESCE(description, ''), type FROM transactionhistory WHERE user_id = $1`
+	rows, err := pool.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при обучении модели категорий: %v", err)
+	}
+	defer rows.Close()
+
+	model := suggest.NewModel()
+	for rows.Next() {
+		var transaction models.Transaction
+		if err := rows.Scan(&transaction.CategoryID, &transaction.Amount, &transaction.Description, &transaction.Type); err != nil {
+			return nil, fmt.Errorf("ошибка при обучении модели категорий: %v", err)
+		}
+		model.Learn(transaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обучении модели категорий: %v", err)
+	}
+	entry.model = model
+	return model, nil
+}
+
+// learnCategories дообучает модель пользователя: before — транзакции в прежнем виде (их нужно забыть),
+// after — в новом. Вызывается после фиксации изменений в базе.
+func learnCategories(userID int, before, after []models.Transaction) {
+	model := loadedCategoryModel(userID)
+	if model == nil {
+		return
+	}
+	for _, transaction := range before {
+		model.Unlearn(transaction)
+	}
+	for _, transaction := range after {
+		model.Learn(transaction)
+	}
+}
+
+// forgetCategoryModel сбрасывает модель пользователя; при следующей подсказке она обучится заново
+func forgetCategoryModel(userID int) {
+	categoryModels.Lock()
+	defer categoryModels.Unlock()
+	delete(categoryModels.byUser, userID)
+}
+
+// SuggestCategories подсказывает до limit категорий для транзакции по истории пользователя.
+// Удалённые категории не предлагаются; при пустой истории список пуст.
+func SuggestCategories(pool *pgxpool.Pool, userID int, transaction models.Transaction, limit int) ([]CategorySuggestion, error) {
+	model, err := categoryModel(pool, userID)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := GetCategoriesByUserID(pool, userID)
+	if err != nil {
+		return nil, err
+	}
+	names := map[int]string{}
+	allowed := map[int]bool{}
+	for _, category := range categories {
+		names[category.ID] = category.Name
+		allowed[category.ID] = true
+	}
+
+	suggestions := []CategorySuggestion{}
+	for _, suggestion := range model.Suggest(transaction, limit, allowed) {
+		suggestions = append(suggestions, CategorySuggestion{
+			CategoryID: suggestion.CategoryID,
+			Name:       names[suggestion.CategoryID],
+			Confidence: suggestion.Confidence,
+		})
+	}
+	return suggestions, nil
+}
@@ -0,0 +1,302 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+const (
+	// MaxTagsPerTransaction ограничивает число тегов одной транзакции
+	MaxTagsPerTransaction = 20
+	// maxTagNameLength — предельная длина имени тега в символах
+	maxTagNameLength = 50
+)
+
+var (
+	ErrTagNotFound = errors.New("тег не найден")
+	ErrInvalidTag  = errors.New("некорректный тег")
+	ErrTagExists   = errors.New("тег с таким именем уже есть")
+)
+
+// normalizeTagName убирает лишние пробелы из имени тега и проверяет его длину
+func normalizeTagName(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return "", fmt.Errorf("%w: имя тега не может быть пустым", ErrInvalidTag)
+	}
+	if utf8.RuneCountInString(name) > maxTagNameLength {
+		return "", fmt.Errorf("%w: имя тега длиннее %d символов", ErrInvalidTag, maxTagNameLength)
+	}
+	return name, nil
+}
+
+// prepareTags нормализует имена тегов транзакции и убирает повторы без учёта регистра.
+// nil остаётся nil: при изменении транзакции это значит «теги не менять».
+func prepareTags(transaction *models.Transaction) error {
+	if transaction.Tags == nil {
+		return nil
+	}
+	tags := make([]string, 0, len(transaction.Tags))
+	seen := make(map[string]bool, len(transaction.Tags))
+	for _, name := range transaction.Tags {
+		name, err := normalizeTagName(name)
+		if err != nil {
+			return err
+		}
+		if key := strings.ToLower(name); !seen[key] {
+			seen[key] = true
+			tags = append(tags, name)
+		}
+	}
+	if len(tags) > MaxTagsPerTransaction {
+		return fmt.Errorf("%w: у транзакции может быть не больше %d тегов", ErrInvalidTag, MaxTagsPerTransaction)
+	}
+	transaction.Tags = tags
+	return nil
+}
+
+// saveTransactionTags заменяет теги текущей транзакции. Теги, которых у пользователя ещё нет, создаются,
+// а в transaction.Tags записываются имена в том виде, в каком теги уже сохранены.
+func saveTransactionTags(tx pgx.Tx, transaction *models.Transaction) error {
+	if _, err := tx.Exec(context.Background(), `DELETE FROM transaction_tags WHERE transaction_id = $1`, transaction.ID); err != nil {
+		return fmt.Errorf("ошибка при удалении тегов транзакции: %v", err)
+	}
+	if len(transaction.Tags) == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(context.Background(), `
+		INSERT INTO tags (user_id, name)
+		SELECT $1, UNNEST($2::TEXT[])
+		ON CONFLICT (user_id, (LOWER(name))) DO NOTHING`, transaction.UserID, transaction.Tags)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении тегов: %v", err)
+	}
+
+	query := `
+		WITH linked AS (
+			INSERT INTO transaction_tags (user_id, tag_id, transaction_id)
+			SELECT user_id, id, $3 FROM tags
+			WHERE user_id = $1 AND LOWER(name) IN (SELECT LOWER(UNNEST($2::TEXT[])))
+			RETURNING tag_id
+		)
+		SELECT t.name FROM linked JOIN tags t ON t.id = linked.tag_id
+		ORDER BY LOWER(t.name)`
+	rows, err := tx.Query(context.Background(), query, transaction.UserID, transaction.Tags, transaction.ID)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении тегов транзакции: %v", err)
+	}
+	defer rows.Close()
+
+	tags := make([]string, 0, len(transaction.Tags))
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("ошибка при сканировании тега: %v", err)
+		}
+		tags = append(tags, name)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка при сохранении тегов транзакции: %v", err)
+	}
+	transaction.Tags = tags
+	return nil
+}
+
+// attachTransactionTags дополняет текущие транзакции именами их тегов
+func attachTransactionTags(pool *pgxpool.Pool, transactions []models.Transaction) error {
+	if len(transactions) == 0 {
+		return nil
+	}
+	ids := make([]int, 0, len(transactions))
+	for _, transaction := range transactions {
+		ids = append(ids, transaction.ID)
+	}
+	query := `
+		SELECT tt.transaction_id, t.name
+		FROM transaction_tags tt
+		JOIN tags t ON t.id = tt.tag_id
+		WHERE tt.transaction_id = ANY($1)
+		ORDER BY LOWER(t.name)`
+	rows, err := pool.Query(context.Background(), query, ids)
+	if err != nil {
+		return fmt.Errorf("ошибка при получении тегов транзакций: %v", err)
+	}
+	defer rows.Close()
+
+	tags := make(map[int][]string)
+	for rows.Next() {
+		var transactionID int
+		var name string
+		if err := rows.Scan(&transactionID, &name); err != nil {
+			return fmt.Errorf("ошибка при сканировании тега: %v", err)
+		}
+		tags[transactionID] = append(tags[transactionID], name)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("ошибка при получении тегов транзакций: %v", err)
+	}
+	for i := range transactions {
+		transactions[i].Tags = tags[transactions[i].ID]
+	}
+	return nil
+}
+
+// transactionTagsCondition — условие «у транзакции есть все теги из списка» для таблицы transactions
+// или transactionhistory. placeholder — параметр с массивом ID тегов без повторов.
+func transactionTagsCondition(table, placeholder string) string {
+	link := "transaction_id"
+	if table == "transactionhistory" {
+		link = "history_id"
+	}
+	return fmt.Sprintf("(SELECT COUNT(*) FROM transaction_tags tt WHERE tt.%s = %s.id AND tt.tag_id = ANY(%s)) = cardinality(%s::INTEGER[])",
+		link, table, placeholder, placeholder)
+}
+
+// isUniqueViolation сообщает, что запрос нарушил ограничение уникальности
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// GetTags возвращает теги пользователя по алфавиту с числом отмеченных ими транзакций
+func GetTags(pool *pgxpool.Pool, userID int) ([]models.Tag, error) {
+	query := `
+		SELECT t.id, t.user_id, t.name, t.created_at, COUNT(tt.tag_id)
+		FROM tags t
+		LEFT JOIN transaction_tags tt ON tt.tag_id = t.id
+		WHERE t.user_id = $1
+		GROUP BY t.id
+		ORDER BY LOWER(t.name)`
+	rows, err := pool.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении тегов: %v", err)
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.CreatedAt, &tag.TransactionCount); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании тега: %v", err)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при получении тегов: %v", err)
+	}
+	return tags, nil
+}
+
+// CreateTag создаёт тег заранее; обычно теги появляются сами при сохранении транзакции
+func CreateTag(pool *pgxpool.Pool, tag *models.Tag) error {
+	name, err := normalizeTagName(tag.Name)
+	if err != nil {
+		return err
+	}
+	tag.Name = name
+
+	err = pool.QueryRow(context.Background(),
+		`INSERT INTO tags (user_id, name) VALUES ($1, $2) RETURNING id, created_at`,
+		tag.UserID, tag.Name).Scan(&tag.ID, &tag.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrTagExists
+		}
+		return fmt.Errorf("ошибка при создании тега: %v", err)
+	}
+	return nil
+}
+
+// UpdateTag переименовывает тег; новое имя сразу видно у всех отмеченных им транзакций
+func UpdateTag(pool *pgxpool.Pool, tag *models.Tag) error {
+	name, err := normalizeTagName(tag.Name)
+	if err != nil {
+		return err
+	}
+	tag.Name = name
+
+	err = pool.QueryRow(context.Background(),
+		`UPDATE tags SET name = $3 WHERE id = $1 AND user_id = $2 RETURNING created_at`,
+		tag.ID, tag.UserID, tag.Name).Scan(&tag.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrTagNotFound
+		}
+		if isUniqueViolation(err) {
+			return ErrTagExists
+		}
+		return fmt.Errorf("ошибка при обновлении тега: %v", err)
+	}
+	return nil
+}
+
+// DeleteTag удаляет тег и снимает его со всех транзакций; сами транзакции не меняются
+func DeleteTag(pool *pgxpool.Pool, userID, tagID int) error {
+	result, err := pool.Exec(context.Background(), `DELETE FROM tags WHERE id = $1 AND user_id = $2`, tagID, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при удалении тега: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrTagNotFound
+	}
+	return nil
+}
+
+// GetTagWiseExpenses возвращает расходы по тегам за период [from, to) по текущим и архивным транзакциям.
+// Транзакция с несколькими тегами учитывается в каждом из них, поэтому суммы по тегам не складываются
+// в общий расход.
+func GetTagWiseExpenses(pool *pgxpool.Pool, userID int, from, to time.Time) ([]map[string]interface{}, error) {
+	query := `
+		SELECT tg.id, tg.name, SUM(e.amount) AS total, COUNT(*) AS transactions
+		FROM (
+			SELECT tt.tag_id, tr.amount
+			FROM transactions tr
+			JOIN transaction_tags tt ON tt.transaction_id = tr.id
+			WHERE tr.user_id = $1 AND tr.type = 'expense'
+			AND tr.transaction_date >= $2 AND tr.transaction_date < $3
+			UNION ALL
+			SELECT tt.tag_id, h.amount
+			FROM transactionhistory h
+			JOIN transaction_tags tt ON tt.history_id = h.id
+			WHERE h.user_id = $1 AND h.type = 'expense'
+			AND h.transaction_date >= $2 AND h.transaction_date < $3
+		) AS e
+		JOIN tags tg ON tg.id = e.tag_id
+		GROUP BY tg.id, tg.name
+		ORDER BY total DESC, LOWER(tg.name)`
+	rows, err := pool.Query(context.Background(), query, userID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении расходов по тегам: %v", err)
+	}
+	defer rows.Close()
+
+	expenses := []map[string]interface{}{}
+	for rows.Next() {
+		var tagID, count int
+		var tag string
+		var total float64
+		if err := rows.Scan(&tagID, &tag, &total, &count); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании расходов по тегам: %v", err)
+		}
+		expenses = append(expenses, map[string]interface{}{
+			"tag_id":       tagID,
+			"tag":          tag,
+			"total":        total,
+			"transactions": count,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при получении расходов по тегам: %v", err)
+	}
+	return expenses, nil
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// Описания бывают и на русском, и на английском, поэтому текст разбирается обеими конфигурациями.
+// Выражение совпадает с индексами из миграции 012, иначе они не будут использоваться.
+const transactionSearchVector = `(to_tsvector('russian', COALESCE(description, '')) || to_tsvector('english', COALESCE(description, '')))`
+
+// Найденный фрагмент описания: совпадения обрамляются тегами <mark>
+const transactionSearchHeadline = `StartSel=<mark>, StopSel=</mark>, MaxWords=20, MinWords=5, MaxFragments=2, FragmentDelimiter=" … "`
+
+var ErrEmptySearchQuery = errors.New("пустой поисковый запрос")
+
+// TransactionSearchResult — найденная транзакция; Archived означает, что запись из transactionhistory
+type TransactionSearchResult struct {
+	models.Transaction
+	Archived bool    `json:"archived"`
+	Rank     float64 `json:"rank"`
+	Snippet  string  `json:"snippet"`
+}
+
+// TransactionSearchPage — страница результатов поиска и общее число совпадений
+type TransactionSearchPage struct {
+	Results []TransactionSearchResult `json:"results"`
+	Total   int                       `json:"total"`
+}
+
+// SearchTransactions ищет по описанию в текущих и архивных транзакциях с учётом фильтров.
+// Запрос понимает синтаксис websearch: "точная фраза", OR, -исключение.
+// Результаты упорядочены по релевантности, при равной — от новых к старым.
+func SearchTransactions(pool *pgxpool.Pool, text string, filter TransactionFilter, offset int) (*TransactionSearchPage, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, ErrEmptySearchQuery
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultTransactionPageSize
+	}
+	if filter.Limit > MaxTransactionPageSize {
+		filter.Limit = MaxTransactionPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var q sqlConditions
+	tsQuery := q.arg(text)
+	searchQuery := fmt.Sprintf(`(websearch_to_tsquery('russian', %s) || websearch_to_tsquery('english', %s))`, tsQuery, tsQuery)
+	q.add(transactionSearchVector + ` @@ ` + searchQuery)
+	// Теги связаны с текущими и архивными транзакциями разными колонками, поэтому условие по ним у каждой части своё
+	tagIDs := filter.TagIDs
+	filter.TagIDs = nil
+	addTransactionFilter(&q, filter)
+	liveWhere, archiveWhere := q.where(), q.where()
+	if len(tagIDs) > 0 {
+		tags := q.arg(tagIDs)
+		liveWhere = q.whereWith(transactionTagsCondition("transactions", tags))
+		archiveWhere = q.whereWith(transactionTagsCondition("transactionhistory", tags))
+	}
+
+	liveQuery := fmt.Sprintf(`
+		SELECT FALSE AS archived, id, user_id, COALESCE(category_id, 0) AS category_id, amount, description, transaction_date, type,
+			goal_id, COALESCE(currency, '') AS currency, ts_rank_cd(%s, %s) AS rank
+		FROM transactions%s`, transactionSearchVector, searchQuery, liveWhere)
+	matches := liveQuery
+	// В архиве нет привязки к цели, поэтому при фильтре по цели архив не просматривается
+	if filter.GoalID <= 0 {
+		matches += fmt.Sprintf(`
+		UNION ALL
+		SELECT TRUE, id, user_id, COALESCE(category_id, 0), amount, description, transaction_date, type,
+			NULL::INTEGER, COALESCE(currency, ''), ts_rank_cd(%s, %s)
+		FROM transactionhistory%s`, transactionSearchVector, searchQuery, archiveWhere)
+	}
+
+	page := &TransactionSearchPage{Results: []TransactionSearchResult{}}
+	countQuery := `SELECT COUNT(*) FROM (` + matches + `) AS matches`
+	if err := pool.QueryRow(context.Background(), countQuery, q.args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("ошибка при подсчёте результатов поиска: %v", err)
+	}
+	if page.Total == 0 {
+		return page, nil
+	}
+
+	// Фрагменты строятся только для строк выдаваемой страницы: ts_headline заметно дороже ранжирования
+	limit := q.arg(filter.Limit)
+	offsetArg := q.arg(offset)
+	headline := q.arg(transactionSearchHeadline)
+	query := fmt.Sprintf(`
+		SELECT archived, id, user_id, category_id, amount, description, transaction_date, type, goal_id, currency, rank,
+			ts_headline('russian', COALESCE(description, ''), %s, %s)
+		FROM (%s
+			ORDER BY rank DESC, transaction_date DESC, id DESC
+			LIMIT %s OFFSET %s
+		) AS found
+		ORDER BY rank DESC, transaction_date DESC, id DESC`, searchQuery, headline, matches, limit, offsetArg)
+
+	rows, err := pool.Query(context.Background(), query, q.args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при поиске транзакций: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result TransactionSearchResult
+		if err := rows.Scan(
+			&result.Archived,
+			&result.ID,
+			&result.UserID,
+			&result.CategoryID,
+			&result.Amount,
+			&result.Description,
+			&result.Date,
+			&result.Type,
+			&result.GoalID,
+			&result.Currency,
+			&result.Rank,
+			&result.Snippet,
+		); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании результата поиска: %v", err)
+		}
+		page.Results = append(page.Results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при поиске транзакций: %v", err)
+	}
+	return page, nil
+}
@@ -2,49 +2,181 @@ package database
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/shopspring/decimal"
 	"github.com/valeriaulyamaeva/personal-finance-app/models"
 	"log"
+	"strings"
 	"time"
 )
 
+var (
+	// ErrCategoryNotFound — категории транзакции нет или она принадлежит другому пользователю
+	ErrCategoryNotFound = errors.New("категория не найдена")
+	// ErrGoalNotFound — цели транзакции нет или она принадлежит другому пользователю
+	ErrGoalNotFound = errors.New("цель не найдена")
+)
+
 func CreateTransaction(pool *pgxpool.Pool, transaction *models.Transaction) error {
-	// Начинаем с создания транзакции
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	if err := insertTransaction(tx, transaction); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return transactionCreated(pool, transaction)
+}
+
+// insertTransaction проверяет и сохраняет новую транзакцию в рамках переданной транзакции БД:
+// счёт, части, теги, правила автокатегоризации и очередь дубликатов
+func insertTransaction(tx pgx.Tx, transaction *models.Transaction) error {
+	// У разделённой транзакции категорию задают части, правила её уже не меняют
+	if err := prepareSplits(transaction); err != nil {
+		return err
+	}
+	if err := prepareTags(transaction); err != nil {
+		return err
+	}
+
+	if err := prepareTransactionAccount(tx, transaction); err != nil {
+		return err
+	}
+
+	// Правила автокатегоризации заполняют то, что пользователь не указал сам; перевод категории не требует
+	if transaction.Type != "transfer" {
+		engine, err := loadRuleEngine(tx, transaction.UserID)
+		if err != nil {
+			return err
+		}
+		engine.Apply(transaction, true)
+		if transaction.CategoryID == 0 {
+			return ErrCategoryRequired
+		}
+	}
+	if err := checkTransactionCategory(tx, transaction); err != nil {
+		return err
+	}
+	if err := checkTransactionGoal(tx, transaction); err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO transactions (user_id, category_id, amount, description, transaction_date, type, goal_id) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7) 
+		INSERT INTO transactions (user_id, category_id, amount, description, transaction_date, type, goal_id,
+			currency, account_id, transfer_account_id, transfer_amount) 
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5, $6, $7, $8, $9, $10, $11) 
 		RETURNING id`
 
-	err := pool.QueryRow(context.Background(), query,
+	err := tx.QueryRow(context.Background(), query,
 		transaction.UserID,
 		transaction.CategoryID,
 		transaction.Amount,
 		transaction.Description,
 		transaction.Date,
 		transaction.Type,
-		transaction.GoalID).Scan(&transaction.ID)
+		transaction.GoalID,
+		transaction.Currency,
+		transaction.AccountID,
+		transaction.TransferAccountID,
+		transaction.TransferAmount).Scan(&transaction.ID)
 	if err != nil {
 		return fmt.Errorf("ошибка при добавлении транзакции: %v", err)
 	}
-
-	// Если транзакция привязана к цели, обновляем баланс этой цели
-	if transaction.Type == "goal" && transaction.GoalID != nil {
-		// Обновляем баланс цели (расход или доход)
-		err := updateGoalBalance(pool, *transaction.GoalID, transaction.Amount, transaction.Type)
-		if err != nil {
-			return fmt.Errorf("ошибка при обновлении баланса цели: %v", err)
+	if err := saveTransactionSplits(tx, transaction); err != nil {
+		return err
+	}
+	if len(transaction.Tags) > 0 {
+		if err := saveTransactionTags(tx, transaction); err != nil {
+			return err
 		}
 	}
 
+	// Цель пополняется после правил: привязку к ней мог задать и пользователь, и правило
+	if err := creditTransactionGoal(tx, transaction); err != nil {
+		return err
+	}
+
+	// Похожие транзакции ставятся в очередь проверки; сама транзакция создаётся в любом случае
+	flagged, err := flagDuplicates(tx, transaction.UserID, []int{transaction.ID})
+	if err != nil {
+		return err
+	}
+	transaction.PossibleDuplicate = flagged > 0
+	return nil
+}
+
+// checkTransactionCategory проверяет, что категория транзакции принадлежит её владельцу;
+// категории частей проверяет saveTransactionSplits
+func checkTransactionCategory(tx pgx.Tx, transaction *models.Transaction) error {
+	if transaction.CategoryID == 0 {
+		return nil
+	}
+	var owned bool
+	err := tx.QueryRow(context.Background(), `SELECT EXISTS (SELECT 1 FROM categories WHERE id = $1 AND user_id = $2)`,
+		transaction.CategoryID, transaction.UserID).Scan(&owned)
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке категории: %v", err)
+	}
+	if !owned {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
+
+// checkTransactionGoal проверяет, что цель транзакции принадлежит её владельцу, — для любого типа транзакции:
+// изменение и удаление транзакции потом корректируют баланс привязанной цели
+func checkTransactionGoal(tx pgx.Tx, transaction *models.Transaction) error {
+	if transaction.GoalID != nil && *transaction.GoalID == 0 {
+		transaction.GoalID = nil
+	}
+	if transaction.GoalID == nil {
+		return nil
+	}
+	var owned bool
+	err := tx.QueryRow(context.Background(), `SELECT EXISTS (SELECT 1 FROM goals WHERE id = $1 AND user_id = $2)`,
+		*transaction.GoalID, transaction.UserID).Scan(&owned)
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке цели: %v", err)
+	}
+	if !owned {
+		return ErrGoalNotFound
+	}
+	return nil
+}
+
+// creditTransactionGoal пополняет цель, к которой привязана транзакция типа goal
+func creditTransactionGoal(tx pgx.Tx, transaction *models.Transaction) error {
+	if transaction.Type != "goal" || transaction.GoalID == nil {
+		return nil
+	}
+	if err := addGoalProgress(tx, *transaction.GoalID, decimal.NewFromFloat(transaction.Amount)); err != nil {
+		return fmt.Errorf("ошибка при обновлении баланса цели: %v", err)
+	}
+	return nil
+}
+
+// transactionCreated выполняет то, что следует за сохранением транзакции: обучает модель подсказок.
+// Цель пополняется раньше, в той же транзакции БД, что и вставка
+func transactionCreated(pool *pgxpool.Pool, transaction *models.Transaction) error {
+	learnCategories(transaction.UserID, nil, []models.Transaction{*transaction})
 	return nil
 }
 
 func GetTransactionByID(pool *pgxpool.Pool, transactionID int) (*models.Transaction, error) {
 	query := `
-		SELECT id, user_id, category_id, amount, description, transaction_date, type
+		SELECT id, user_id, COALESCE(category_id, 0), amount, description, transaction_date, type,
+			account_id, transfer_account_id, transfer_amount
 		FROM transactions 
 		WHERE id = $1`
 
@@ -57,6 +189,9 @@ func GetTransactionByID(pool *pgxpool.Pool, transactionID int) (*models.Transact
 		&transaction.Description,
 		&transaction.Date,
 		&transaction.Type,
+		&transaction.AccountID,
+		&transaction.TransferAccountID,
+		&transaction.TransferAmount,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -65,12 +200,20 @@ func GetTransactionByID(pool *pgxpool.Pool, transactionID int) (*models.Transact
 		return nil, fmt.Errorf("ошибка при получении транзакции: %v", err)
 	}
 
-	return transaction, nil
+	transactions := []models.Transaction{*transaction}
+	if err := attachTransactionSplits(pool, transactions); err != nil {
+		return nil, err
+	}
+	if err := attachTransactionTags(pool, transactions); err != nil {
+		return nil, err
+	}
+	return &transactions[0], nil
 }
 
 func GetTransactionsByUserID(pool *pgxpool.Pool, userID int) ([]models.Transaction, error) {
 	query := `
-        SELECT id, user_id, category_id, amount, description, transaction_date, type
+        SELECT id, user_id, COALESCE(category_id, 0), amount, description, transaction_date, type,
+            account_id, transfer_account_id, transfer_amount
         FROM transactions
         WHERE user_id = $1`
 
@@ -91,29 +234,236 @@ func GetTransactionsByUserID(pool *pgxpool.Pool, userID int) ([]models.Transacti
 			&transaction.Description,
 			&transaction.Date,
 			&transaction.Type,
+			&transaction.AccountID,
+			&transaction.TransferAccountID,
+			&transaction.TransferAmount,
 		); err != nil {
 			return nil, fmt.Errorf("ошибка при сканировании транзакции: %v", err)
 		}
 		transactions = append(transactions, transaction)
 	}
+	rows.Close()
 
+	if err := attachTransactionSplits(pool, transactions); err != nil {
+		return nil, err
+	}
+	if err := attachTransactionTags(pool, transactions); err != nil {
+		return nil, err
+	}
 	return transactions, nil
 }
 
-func GetAllTransactions(pool *pgxpool.Pool) ([]*models.Transaction, error) {
-	query := `
-		SELECT id, user_id, category_id, amount, description, transaction_date, type
-		FROM transactions`
+// Ограничения на размер страницы списка транзакций
+const (
+	DefaultTransactionPageSize = 50
+	MaxTransactionPageSize     = 500
+)
+
+// Поля, по которым можно сортировать список транзакций
+const (
+	TransactionSortDate   = "date"
+	TransactionSortAmount = "amount"
+)
+
+var ErrInvalidCursor = errors.New("некорректный курсор постраничного вывода")
+
+var transactionSortColumns = map[string]string{
+	TransactionSortDate:   "transaction_date",
+	TransactionSortAmount: "amount",
+}
+
+// TransactionFilter — условия выборки транзакций; нулевые поля не ограничивают выборку
+type TransactionFilter struct {
+	UserID      int
+	From        time.Time // включительно
+	To          time.Time // не включительно
+	CategoryIDs []int
+	TagIDs      []int // транзакция должна быть отмечена всеми тегами; ID без повторов
+	Type        string
+	MinAmount   *float64
+	MaxAmount   *float64
+	GoalID      int
+	AccountID   int // счёт операции, для переводов — счёт списания или зачисления
+	Currency    string
+	Sort        string // TransactionSortDate или TransactionSortAmount
+	Descending  bool
+	Cursor      string // значение NextCursor предыдущей страницы
+	Limit       int
+}
+
+// TransactionPage — страница списка и общее число подходящих под фильтр транзакций
+type TransactionPage struct {
+	Transactions []models.Transaction `json:"transactions"`
+	Total        int                  `json:"total"`
+	NextCursor   string               `json:"next_cursor,omitempty"`
+}
+
+// transactionCursor — позиция последней выданной строки. Сортировка сохраняется в курсоре,
+// чтобы курсор от одной сортировки нельзя было применить к другой.
+type transactionCursor struct {
+	Sort       string    `json:"s"`
+	Descending bool      `json:"d"`
+	Date       time.Time `json:"t,omitempty"`
+	Amount     float64   `json:"a,omitempty"`
+	ID         int       `json:"i"`
+}
+
+func encodeTransactionCursor(cursor transactionCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeTransactionCursor(value string) (transactionCursor, error) {
+	var cursor transactionCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID <= 0 {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
 
-	rows, err := pool.Query(context.Background(), query)
+// sqlConditions накапливает условия WHERE и нумерует их параметры
+type sqlConditions struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg добавляет параметр и возвращает его плейсхолдер
+func (q *sqlConditions) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+// add добавляет условие; каждое %d в нём заменяется номером очередного параметра из values
+func (q *sqlConditions) add(condition string, values ...interface{}) {
+	placeholders := make([]interface{}, len(values))
+	for i, value := range values {
+		q.args = append(q.args, value)
+		placeholders[i] = len(q.args)
+	}
+	q.conditions = append(q.conditions, fmt.Sprintf(condition, placeholders...))
+}
+
+func (q *sqlConditions) where() string {
+	if len(q.conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conditions, " AND ")
+}
+
+// whereWith возвращает WHERE с ещё одним условием, не добавляя его к накопленным
+func (q *sqlConditions) whereWith(condition string) string {
+	conditions := append(q.conditions[:len(q.conditions):len(q.conditions)], condition)
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// addTransactionFilter добавляет условия фильтра; имена колонок общие у transactions и transactionhistory,
+// кроме goal_id, которого в архиве нет. Условие по тегам записано для transactions:
+// архив с тегами SearchTransactions фильтрует сам.
+func addTransactionFilter(q *sqlConditions, filter TransactionFilter) {
+	if filter.UserID > 0 {
+		q.add("user_id = $%d", filter.UserID)
+	}
+	if !filter.From.IsZero() {
+		q.add("transaction_date >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		q.add("transaction_date < $%d", filter.To)
+	}
+	if len(filter.CategoryIDs) > 0 {
+		q.add("category_id = ANY($%d)", filter.CategoryIDs)
+	}
+	if filter.Type != "" {
+		q.add("type = $%d", filter.Type)
+	}
+	if filter.MinAmount != nil {
+		q.add("amount >= $%d", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		q.add("amount <= $%d", *filter.MaxAmount)
+	}
+	if filter.GoalID > 0 {
+		q.add("goal_id = $%d", filter.GoalID)
+	}
+	if filter.AccountID > 0 {
+		q.add("(account_id = $%d OR transfer_account_id = $%d)", filter.AccountID, filter.AccountID)
+	}
+	if filter.Currency != "" {
+		q.add("currency = $%d", filter.Currency)
+	}
+	if len(filter.TagIDs) > 0 {
+		q.conditions = append(q.conditions, transactionTagsCondition("transactions", q.arg(filter.TagIDs)))
+	}
+}
+
+// GetAllTransactions возвращает страницу транзакций по фильтру.
+// Порядок стабилен: при равных значениях поля сортировки строки упорядочены по id.
+func GetAllTransactions(pool *pgxpool.Pool, filter TransactionFilter) (*TransactionPage, error) {
+	if filter.Sort == "" {
+		filter.Sort = TransactionSortDate
+	}
+	sortColumn, ok := transactionSortColumns[filter.Sort]
+	if !ok {
+		return nil, fmt.Errorf("неизвестное поле сортировки: %s", filter.Sort)
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultTransactionPageSize
+	}
+	if filter.Limit > MaxTransactionPageSize {
+		filter.Limit = MaxTransactionPageSize
+	}
+
+	var q sqlConditions
+	addTransactionFilter(&q, filter)
+	where := q.where()
+
+	// Общее число считается без учёта курсора, чтобы оно не менялось от страницы к странице
+	page := &TransactionPage{Transactions: []models.Transaction{}}
+	countQuery := `SELECT COUNT(*) FROM transactions` + where
+	if err := pool.QueryRow(context.Background(), countQuery, q.args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("ошибка при подсчёте транзакций: %v", err)
+	}
+
+	comparison, direction := ">", "ASC"
+	if filter.Descending {
+		comparison, direction = "<", "DESC"
+	}
+
+	if filter.Cursor != "" {
+		cursor, err := decodeTransactionCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != filter.Sort || cursor.Descending != filter.Descending {
+			return nil, ErrInvalidCursor
+		}
+		var sortValue interface{} = cursor.Date
+		if filter.Sort == TransactionSortAmount {
+			sortValue = cursor.Amount
+		}
+		q.add("("+sortColumn+", id) "+comparison+" ($%d, $%d)", sortValue, cursor.ID)
+		where = q.where()
+	}
+
+	limit := q.arg(filter.Limit + 1)
+	query := fmt.Sprintf(`
+		SELECT id, user_id, COALESCE(category_id, 0), amount, description, transaction_date, type, goal_id, COALESCE(currency, ''),
+			account_id, transfer_account_id, transfer_amount
+		FROM transactions%s
+		ORDER BY %s %s, id %s
+		LIMIT %s`, where, sortColumn, direction, direction, limit)
+
+	rows, err := pool.Query(context.Background(), query, q.args...)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при получении списка транзакций: %v", err)
 	}
 	defer rows.Close()
 
-	var transactions []*models.Transaction
 	for rows.Next() {
-		transaction := &models.Transaction{}
+		var transaction models.Transaction
 		if err := rows.Scan(
 			&transaction.ID,
 			&transaction.UserID,
@@ -122,43 +472,142 @@ func GetAllTransactions(pool *pgxpool.Pool) ([]*models.Transaction, error) {
 			&transaction.Description,
 			&transaction.Date,
 			&transaction.Type,
+			&transaction.GoalID,
+			&transaction.Currency,
+			&transaction.AccountID,
+			&transaction.TransferAccountID,
+			&transaction.TransferAmount,
 		); err != nil {
 			return nil, fmt.Errorf("ошибка при сканировании транзакции: %v", err)
 		}
-		transactions = append(transactions, transaction)
+		page.Transactions = append(page.Transactions, transaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при получении списка транзакций: %v", err)
+	}
+	rows.Close()
+
+	// Лишняя строка означает, что есть следующая страница
+	if len(page.Transactions) > filter.Limit {
+		page.Transactions = page.Transactions[:filter.Limit]
+		last := page.Transactions[len(page.Transactions)-1]
+		page.NextCursor = encodeTransactionCursor(transactionCursor{
+			Sort:       filter.Sort,
+			Descending: filter.Descending,
+			Date:       last.Date,
+			Amount:     last.Amount,
+			ID:         last.ID,
+		})
 	}
 
-	return transactions, nil
+	if err := attachTransactionSplits(pool, page.Transactions); err != nil {
+		return nil, err
+	}
+	if err := attachTransactionTags(pool, page.Transactions); err != nil {
+		return nil, err
+	}
+	return page, nil
 }
 
 func UpdateTransaction(pool *pgxpool.Pool, transaction *models.Transaction) error {
-	// Получаем старую сумму для корректировки баланса цели
-	var oldAmount float64
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	// Получаем прежние значения: сумму и цель для корректировки баланса цели, остальное — для дообучения подсказок категорий
+	var old models.Transaction
 	selectQuery := `
-		SELECT amount 
+		SELECT user_id, COALESCE(category_id, 0), amount, COALESCE(description, ''), type, account_id, goal_id
 		FROM transactions 
-		WHERE id = $1`
-	err := pool.QueryRow(context.Background(), selectQuery, transaction.ID).Scan(&oldAmount)
+		WHERE id = $1
+		FOR UPDATE`
+	err = tx.QueryRow(context.Background(), selectQuery, transaction.ID).Scan(
+		&old.UserID,
+		&old.CategoryID,
+		&old.Amount,
+		&old.Description,
+		&old.Type,
+		&old.AccountID,
+		&old.GoalID,
+	)
 	if err != nil {
 		return fmt.Errorf("ошибка при получении старой суммы транзакции: %v", err)
 	}
+	oldAmount := old.Amount
+	transaction.UserID = old.UserID
+	// Цель при изменении не меняется: goal_id из запроса игнорируется, баланс корректируется у сохранённой цели
+	transaction.GoalID = old.GoalID
+	if transaction.AccountID == 0 {
+		transaction.AccountID = old.AccountID
+	}
+
+	// Без поля splits прежние части остаются и должны сойтись с новой суммой; пустой список снимает разделение
+	replaceSplits := transaction.Splits != nil
+	if !replaceSplits {
+		rows, err := tx.Query(context.Background(), transactionSplitsQuery, []int{transaction.ID})
+		if err != nil {
+			return fmt.Errorf("ошибка при получении частей транзакции: %v", err)
+		}
+		splits, err := scanTransactionSplits(rows)
+		if err != nil {
+			return err
+		}
+		transaction.Splits = splits[transaction.ID]
+	}
+	if err := prepareSplits(transaction); err != nil {
+		return err
+	}
+	if err := prepareTags(transaction); err != nil {
+		return err
+	}
+	if err := prepareTransactionAccount(tx, transaction); err != nil {
+		return err
+	}
+	if transaction.CategoryID == 0 && transaction.Type != "transfer" {
+		return ErrCategoryRequired
+	}
+	if err := checkTransactionCategory(tx, transaction); err != nil {
+		return err
+	}
 
 	// Обновляем саму транзакцию
 	query := `
 		UPDATE transactions 
-		SET category_id = $1, amount = $2, description = $3, transaction_date = $4, type = $5
+		SET category_id = NULLIF($1, 0), amount = $2, description = $3, transaction_date = $4, type = $5,
+			account_id = $7, transfer_account_id = $8, transfer_amount = $9
 		WHERE id = $6`
 
-	_, err = pool.Exec(context.Background(), query,
+	_, err = tx.Exec(context.Background(), query,
 		transaction.CategoryID,
 		transaction.Amount,
 		transaction.Description,
 		transaction.Date,
 		transaction.Type,
-		transaction.ID)
+		transaction.ID,
+		transaction.AccountID,
+		transaction.TransferAccountID,
+		transaction.TransferAmount)
 	if err != nil {
 		return fmt.Errorf("ошибка обновления транзакции: %v", err)
 	}
+	if replaceSplits {
+		if err := saveTransactionSplits(tx, transaction); err != nil {
+			return err
+		}
+	}
+	// Без поля tags прежние теги остаются; пустой список снимает все
+	if transaction.Tags != nil {
+		if err := saveTransactionTags(tx, transaction); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	learnCategories(old.UserID, []models.Transaction{old}, []models.Transaction{*transaction})
 
 	// Если транзакция привязана к цели, обновляем баланс цели
 	if transaction.GoalID != nil {
@@ -180,7 +629,7 @@ func DeleteTransaction(pool *pgxpool.Pool, transactionID int) error {
 	// Получаем информацию о транзакции перед удалением
 	var transaction models.Transaction
 	selectQuery := `
-		SELECT user_id, category_id, amount, description, transaction_date, type, goal_id
+		SELECT user_id, COALESCE(category_id, 0), amount, description, transaction_date, type, goal_id
 		FROM transactions 
 		WHERE id = $1`
 	err := pool.QueryRow(context.Background(), selectQuery, transactionID).Scan(
@@ -206,6 +655,7 @@ func DeleteTransaction(pool *pgxpool.Pool, transactionID int) error {
 	if result.RowsAffected() == 0 {
 		return fmt.Errorf("транзакция с ID %d не найдена", transactionID)
 	}
+	learnCategories(transaction.UserID, []models.Transaction{transaction}, nil)
 
 	// Если транзакция привязана к цели, обновляем баланс цели
 	if transaction.GoalID != nil {
@@ -238,9 +688,11 @@ func MoveTransactionsToHistory(pool *pgxpool.Pool) error {
 
 	insertQuery := `
 		INSERT INTO transactionhistory (
-			user_id, category_id, amount, description, transaction_date, type, op_date, op_type, user_name
+			transaction_id, user_id, category_id, amount, description, transaction_date, type, op_date, op_type, user_name,
+			account_id, transfer_account_id, transfer_amount
 		)
 		SELECT 
+			t.id,
 			t.user_id, 
 			t.category_id, 
 			t.amount, 
@@ -249,7 +701,10 @@ func MoveTransactionsToHistory(pool *pgxpool.Pool) error {
 			t.type, 
 			NOW() AS op_date, 
 			'archived' AS op_type, 
-			u.name AS user_name
+			u.name AS user_name,
+			t.account_id,
+			t.transfer_account_id,
+			t.transfer_amount
 		FROM transactions t
 		INNER JOIN users u ON t.user_id = u.id
 		WHERE EXTRACT(MONTH FROM t.transaction_date) != $1 OR EXTRACT(YEAR FROM t.transaction_date) != $2`
@@ -263,6 +718,39 @@ func MoveTransactionsToHistory(pool *pgxpool.Pool) error {
 	insertedCount := res.RowsAffected()
 	log.Printf("Перенесено транзакций: %d", insertedCount)
 
+	// Части разделённых транзакций переходят к архивным записям, иначе их удалило бы каскадом
+	splitsQuery := `
+		UPDATE transaction_splits s
+		SET history_id = h.id, transaction_id = NULL
+		FROM transactionhistory h
+		WHERE h.transaction_id = s.transaction_id AND h.op_type = 'archived'`
+	if _, err := tx.Exec(context.Background(), splitsQuery); err != nil {
+		log.Printf("Ошибка переноса частей транзакций в архив: %v", err)
+		return err
+	}
+
+	// Вложения тоже остаются с архивной записью: их файлы удалятся, только когда удалят саму запись
+	attachmentsQuery := `
+		UPDATE transaction_attachments a
+		SET history_id = h.id, transaction_id = NULL
+		FROM transactionhistory h
+		WHERE h.transaction_id = a.transaction_id AND h.op_type = 'archived'`
+	if _, err := tx.Exec(context.Background(), attachmentsQuery); err != nil {
+		log.Printf("Ошибка переноса вложений транзакций в архив: %v", err)
+		return err
+	}
+
+	// Теги тоже, чтобы архив можно было фильтровать и считать по ним расходы
+	tagsQuery := `
+		UPDATE transaction_tags tt
+		SET history_id = h.id, transaction_id = NULL
+		FROM transactionhistory h
+		WHERE h.transaction_id = tt.transaction_id AND h.op_type = 'archived'`
+	if _, err := tx.Exec(context.Background(), tagsQuery); err != nil {
+		log.Printf("Ошибка переноса тегов транзакций в архив: %v", err)
+		return err
+	}
+
 	// Удаление перенесённых транзакций
 	deleteQuery := `
 		DELETE FROM transactions
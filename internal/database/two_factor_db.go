@@ -0,0 +1,248 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+var (
+	ErrTOTPNotConfigured   = errors.New("двухфакторная аутентификация не настроена")
+	ErrTOTPAlreadyEnabled  = errors.New("двухфакторная аутентификация уже включена")
+	ErrLoginChallengeGone  = errors.New("запрос на вход не найден или истёк")
+	ErrLoginChallengeLimit = errors.New("превышено число попыток ввода кода")
+)
+
+// MaxLoginChallengeAttempts — число неверных кодов, после которого вход нужно начать заново
+const MaxLoginChallengeAttempts = 5
+
+// GetUserTOTP возвращает настройки TOTP пользователя
+func GetUserTOTP(pool *pgxpool.Pool, userID int) (*models.UserTOTP, error) {
+	query := `
+		SELECT user_id, secret, enabled, last_used_step, created_at, confirmed_at
+		FROM user_totp
+		WHERE user_id = $1`
+
+	totp := &models.UserTOTP{}
+	err := pool.QueryRow(context.Background(), query, userID).Scan(
+		&totp.UserID,
+		&totp.Secret,
+		&totp.Enabled,
+		&totp.LastUsedStep,
+		&totp.CreatedAt,
+		&totp.ConfirmedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrTOTPNotConfigured
+		}
+		return nil, fmt.Errorf("ошибка при получении настроек TOTP: %v", err)
+	}
+	return totp, nil
+}
+
+// IsTOTPEnabled сообщает, включён ли у пользователя второй фактор
+func IsTOTPEnabled(pool *pgxpool.Pool, userID int) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM user_totp WHERE user_id = $1 AND enabled = TRUE)`
+	var enabled bool
+	if err := pool.QueryRow(context.Background(), query, userID).Scan(&enabled); err != nil {
+		return false, fmt.Errorf("ошибка при проверке TOTP: %v", err)
+	}
+	return enabled, nil
+}
+
+// SaveTOTPSecret сохраняет новый неподтверждённый секрет, заменяя предыдущую попытку подключения
+func SaveTOTPSecret(pool *pgxpool.Pool, userID int, secret string) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret, enabled)
+		VALUES ($1, $2, FALSE)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW(), confirmed_at = NULL
+		WHERE user_totp.enabled = FALSE`
+
+	result, err := pool.Exec(context.Background(), query, userID, secret)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении секрета TOTP: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+	return nil
+}
+
+// EnableTOTP включает второй фактор и сохраняет хеши кодов восстановления
+func EnableTOTP(pool *pgxpool.Pool, userID int, step int64, recoveryCodeHashes []string) error {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	query := `
+		UPDATE user_totp
+		SET enabled = TRUE, confirmed_at = NOW(), last_used_step = $2
+		WHERE user_id = $1 AND enabled = FALSE`
+	result, err := tx.Exec(context.Background(), query, userID, step)
+	if err != nil {
+		return fmt.Errorf("ошибка при включении TOTP: %v", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return nil
+}
+
+// DisableTOTP отключает второй фактор и удаляет коды восстановления
+func DisableTOTP(pool *pgxpool.Pool, userID int) error {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	if _, err := tx.Exec(context.Background(), `DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("ошибка при удалении кодов восстановления: %v", err)
+	}
+	if _, err := tx.Exec(context.Background(), `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("ошибка при отключении TOTP: %v", err)
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return nil
+}
+
+// MarkTOTPStepUsed запоминает использованный шаг; false означает повторное использование кода
+func MarkTOTPStepUsed(pool *pgxpool.Pool, userID int, step int64) (bool, error) {
+	query := `
+		UPDATE user_totp
+		SET last_used_step = $2
+		WHERE user_id = $1 AND last_used_step < $2`
+	result, err := pool.Exec(context.Background(), query, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при обновлении шага TOTP: %v", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// ReplaceRecoveryCodes заменяет все коды восстановления пользователя новыми
+func ReplaceRecoveryCodes(pool *pgxpool.Pool, userID int, codeHashes []string) error {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(tx pgx.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec(context.Background(), `DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("ошибка при удалении кодов восстановления: %v", err)
+	}
+	for _, hash := range codeHashes {
+		query := `INSERT INTO totp_recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+		if _, err := tx.Exec(context.Background(), query, userID, hash); err != nil {
+			return fmt.Errorf("ошибка при сохранении кода восстановления: %v", err)
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode гасит неиспользованный код восстановления; false — код не подошёл
+func UseRecoveryCode(pool *pgxpool.Pool, userID int, codeHash string) (bool, error) {
+	query := `
+		UPDATE totp_recovery_codes
+		SET used_at = NOW()
+		WHERE id = (
+			SELECT id FROM totp_recovery_codes
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+			LIMIT 1
+		)`
+	result, err := pool.Exec(context.Background(), query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при использовании кода восстановления: %v", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// CountUnusedRecoveryCodes возвращает число оставшихся кодов восстановления
+func CountUnusedRecoveryCodes(pool *pgxpool.Pool, userID int) (int, error) {
+	query := `SELECT COUNT(*) FROM totp_recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+	var count int
+	if err := pool.QueryRow(context.Background(), query, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("ошибка при подсчёте кодов восстановления: %v", err)
+	}
+	return count, nil
+}
+
+// CreateLoginChallenge сохраняет запрос на вход, ожидающий второго фактора
+func CreateLoginChallenge(pool *pgxpool.Pool, userID int, tokenHash string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO login_challenges (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)`
+	if _, err := pool.Exec(context.Background(), query, userID, tokenHash, expiresAt); err != nil {
+		return fmt.Errorf("ошибка при создании запроса на вход: %v", err)
+	}
+	return nil
+}
+
+// GetLoginChallengeUserID возвращает пользователя действующего запроса на вход
+func GetLoginChallengeUserID(pool *pgxpool.Pool, tokenHash string) (int, error) {
+	query := `
+		SELECT user_id, attempts
+		FROM login_challenges
+		WHERE token_hash = $1 AND expires_at > NOW()`
+
+	var userID, attempts int
+	err := pool.QueryRow(context.Background(), query, tokenHash).Scan(&userID, &attempts)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrLoginChallengeGone
+		}
+		return 0, fmt.Errorf("ошибка при получении запроса на вход: %v", err)
+	}
+	if attempts >= MaxLoginChallengeAttempts {
+		return 0, ErrLoginChallengeLimit
+	}
+	return userID, nil
+}
+
+// RegisterLoginChallengeFailure увеличивает счётчик неверных кодов
+func RegisterLoginChallengeFailure(pool *pgxpool.Pool, tokenHash string) error {
+	query := `UPDATE login_challenges SET attempts = attempts + 1 WHERE token_hash = $1`
+	if _, err := pool.Exec(context.Background(), query, tokenHash); err != nil {
+		return fmt.Errorf("ошибка при обновлении запроса на вход: %v", err)
+	}
+	return nil
+}
+
+// DeleteLoginChallenge удаляет запрос на вход и все просроченные запросы
+func DeleteLoginChallenge(pool *pgxpool.Pool, tokenHash string) error {
+	query := `DELETE FROM login_challenges WHERE token_hash = $1 OR expires_at <= NOW()`
+	if _, err := pool.Exec(context.Background(), query, tokenHash); err != nil {
+		return fmt.Errorf("ошибка при удалении запроса на вход: %v", err)
+	}
+	return nil
+}
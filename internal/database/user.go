@@ -6,36 +6,57 @@ import (
 	"fmt"
 	"log"
 	"regexp"
+	"sync"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/passwords"
 	"github.com/valeriaulyamaeva/personal-finance-app/models"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func validateUserData(user *models.User) error {
+var (
+	ErrMissingUserFields = errors.New("все поля обязательны для заполнения")
+	ErrInvalidEmail      = errors.New("некорректный формат email")
+)
+
+// ValidateUserData проверяет обязательные поля, формат email и соответствие пароля политике
+func ValidateUserData(user *models.User) error {
 	if user.Name == "" || user.Email == "" || user.Password == "" {
-		log.Printf("Ошибка валидации данных: %+v\n", user)
-		return errors.New("все поля обязательны для заполнения")
+		log.Printf("Ошибка валидации данных: name=%q, email=%q\n", user.Name, user.Email)
+		return ErrMissingUserFields
 	}
 
+	if err := ValidateEmail(user.Email); err != nil {
+		return err
+	}
+
+	return passwords.Validate(user.Password, user.Email, user.Name)
+}
+
+// ValidateEmail проверяет формат адреса электронной почты
+func ValidateEmail(email string) error {
 	emailRegex := `^[^\s@]+@[^\s@]+\.[^\s@]+$`
-	matched, _ := regexp.MatchString(emailRegex, user.Email)
+	matched, _ := regexp.MatchString(emailRegex, email)
 	if !matched {
-		log.Printf("Некорректный email: %s\n", user.Email)
-		return errors.New("некорректный формат email")
+		log.Printf("Некорректный email: %s\n", email)
+		return ErrInvalidEmail
 	}
-
 	return nil
 }
 
 func RegisterUser(pool *pgxpool.Pool, user *models.User) error {
+	if err := ValidateUserData(user); err != nil {
+		return err
+	}
+
 	// Хеширование пароля
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := passwords.Hash(user.Password)
 	if err != nil {
 		log.Printf("Ошибка хеширования пароля: %v\n", err)
 		return errors.New("ошибка хеширования пароля")
 	}
-	user.Password = string(hashedPassword) // Сохраняем хешированный пароль
+	user.Password = hashedPassword // Сохраняем хешированный пароль
 
 	tx, err := pool.Begin(context.Background())
 	if err != nil {
@@ -58,6 +79,13 @@ func RegisterUser(pool *pgxpool.Pool, user *models.User) error {
 		return errors.New("ошибка создания дефолтных настроек")
 	}
 
+	// Назначение роли обычного пользователя
+	roleQuery := `INSERT INTO user_roles (user_id, role_id) SELECT $1, id FROM roles WHERE name = $2`
+	_, err = tx.Exec(context.Background(), roleQuery, user.ID, RoleUser)
+	if err != nil {
+		return errors.New("ошибка назначения роли пользователю")
+	}
+
 	// Коммит транзакции
 	if err := tx.Commit(context.Background()); err != nil {
 		return errors.New("ошибка коммита транзакции")
@@ -66,31 +94,79 @@ func RegisterUser(pool *pgxpool.Pool, user *models.User) error {
 	return nil
 }
 
+var ErrInvalidCredentials = errors.New("неверный email или пароль")
+
+// dummyPasswordHash сверяется с паролем, когда email не найден, чтобы время ответа
+// не выдавало существование аккаунта. Создаётся при первом входе: стоимость берётся из окружения.
+var (
+	dummyPasswordOnce sync.Once
+	dummyPasswordHash []byte
+)
+
+func dummyHash() []byte {
+	dummyPasswordOnce.Do(func() {
+		dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), passwords.Cost())
+	})
+	return dummyPasswordHash
+}
+
 func AuthenticateUser(pool *pgxpool.Pool, email, password string) (*models.User, error) {
 	var user models.User
-	query := `SELECT id, email, password, name, is_admin FROM users WHERE email = $1`
-
-	log.Printf("Authenticating user with email: %s\n", email) // Debug email
+	query := `SELECT id, email, password, name, is_admin, email_verified FROM users WHERE LOWER(email) = LOWER($1)`
 
-	err := pool.QueryRow(context.Background(), query, email).Scan(&user.ID, &user.Email, &user.Password, &user.Name, &user.IsAdmin)
+	err := pool.QueryRow(context.Background(), query, email).Scan(&user.ID, &user.Email, &user.Password, &user.Name, &user.IsAdmin, &user.EmailVerified)
 	if err != nil {
-		if err.Error() == "no rows in result set" {
-			log.Printf("Authentication failed: user with email %s not found.\n", email)
-			return nil, errors.New("пользователь не найден")
+		if errors.Is(err, pgx.ErrNoRows) {
+			bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+			return nil, ErrInvalidCredentials
 		}
 		log.Printf("Authentication query error: %v\n", err)
 		return nil, fmt.Errorf("ошибка при аутентификации: %v", err)
 	}
 
-	log.Printf("User found: ID=%d, Email=%s, Admin=%v\n", user.ID, user.Email, user.IsAdmin) // Log user details
-
 	// Verify hashed password
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
-		log.Printf("Authentication failed: invalid password for email %s.\n", email)
-		return nil, errors.New("неверный пароль")
+		return nil, ErrInvalidCredentials
+	}
+
+	// Пароль известен только сейчас, поэтому хеш с устаревшей стоимостью обновляем при входе
+	if passwords.NeedsRehash(user.Password) {
+		if err := rehashPassword(pool, user.ID, user.Password, password); err != nil {
+			log.Printf("Ошибка обновления хеша пароля пользователя %d: %v\n", user.ID, err)
+		}
 	}
 
 	user.Password = "" // Clear password for security
 	return &user, nil
 }
+
+// CheckUserPassword сверяет пароль с хешем пользователя; при несовпадении возвращает ErrInvalidCredentials
+func CheckUserPassword(pool *pgxpool.Pool, userID int, password string) error {
+	var hash string
+	err := pool.QueryRow(context.Background(), `SELECT password FROM users WHERE id = $1`, userID).Scan(&hash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return fmt.Errorf("ошибка при проверке пароля: %v", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// rehashPassword перехеширует пароль с текущей стоимостью.
+// Условие на старый хеш не даёт затереть пароль, сменённый параллельно.
+func rehashPassword(pool *pgxpool.Pool, userID int, oldHash, password string) error {
+	newHash, err := passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE users SET password = $1 WHERE id = $2 AND password = $3`
+	if _, err := pool.Exec(context.Background(), query, newHash, userID, oldHash); err != nil {
+		return fmt.Errorf("ошибка обновления хеша пароля: %v", err)
+	}
+	return nil
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/valeriaulyamaeva/personal-finance-app/models"
 )
 
+var ErrUserNotFound = errors.New("пользователь не найден")
+
 // CreateUser создает нового пользователя в базе данных
 func CreateUser(pool *pgxpool.Pool, user *models.User) error {
 	query := `
@@ -29,6 +31,14 @@ func CreateUser(pool *pgxpool.Pool, user *models.User) error {
 		return fmt.Errorf("ошибка при добавлении настроек пользователя: %v", err)
 	}
 
+	roleQuery := `
+		INSERT INTO user_roles (user_id, role_id)
+		SELECT $1, id FROM roles WHERE name = $2`
+	_, err = pool.Exec(context.Background(), roleQuery, user.ID, RoleUser)
+	if err != nil {
+		return fmt.Errorf("ошибка при назначении роли пользователю: %v", err)
+	}
+
 	// Создаем уведомление для нового пользователя
 	notificationQuery := `
 		INSERT INTO notifications (user_id, message, is_read) 
@@ -43,15 +53,15 @@ func CreateUser(pool *pgxpool.Pool, user *models.User) error {
 
 // GetUserByID получает пользователя по ID
 func GetUserByID(pool *pgxpool.Pool, id int) (*models.User, error) {
-	query := `SELECT id, name, email FROM users WHERE id = $1`
+	query := `SELECT id, name, email, is_admin, email_verified FROM users WHERE id = $1`
 	fmt.Printf("Executing query: %s with ID: %d\n", query, id)
 	row := pool.QueryRow(context.Background(), query, id)
 
 	var user models.User
-	err := row.Scan(&user.ID, &user.Name, &user.Email)
+	err := row.Scan(&user.ID, &user.Name, &user.Email, &user.IsAdmin, &user.EmailVerified)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, errors.New("пользователь не найден")
+			return nil, ErrUserNotFound
 		}
 		return nil, fmt.Errorf("ошибка получения пользователя по id: %v", err)
 	}
@@ -59,13 +69,43 @@ func GetUserByID(pool *pgxpool.Pool, id int) (*models.User, error) {
 	return &user, nil
 }
 
-// UpdateUser обновляет данные пользователя
+// UpdateUser обновляет данные пользователя; пустой пароль оставляет прежний хеш.
+// При смене email подтверждение снимается, а неиспользованные ссылки подтверждения, отправленные
+// на прежний адрес, гасятся: новый адрес нужно подтвердить заново.
 func UpdateUser(pool *pgxpool.Pool, user *models.User) error {
-	query := `UPDATE users SET name = $1, email = $2, password = $3 WHERE id = $4`
-	_, err := pool.Exec(context.Background(), query, user.Name, user.Email, user.Password, user.ID)
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	query := `
+		UPDATE users u
+		SET name = $1, email = $2, password = COALESCE(NULLIF($3, ''), u.password),
+			email_verified = u.email_verified AND LOWER(old.email) = LOWER($2)
+		FROM (SELECT email FROM users WHERE id = $4 FOR UPDATE) AS old
+		WHERE u.id = $4
+		RETURNING LOWER(old.email) <> LOWER(u.email), u.email_verified`
+	var emailChanged bool
+	err = tx.QueryRow(context.Background(), query, user.Name, user.Email, user.Password, user.ID).Scan(&emailChanged, &user.EmailVerified)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUserNotFound
+		}
 		return fmt.Errorf("ошибка обновления пользователя: %v", err)
 	}
+	if emailChanged {
+		_, err := tx.Exec(context.Background(), `
+			UPDATE user_tokens SET used_at = NOW()
+			WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`, user.ID, TokenPurposeEmailVerification)
+		if err != nil {
+			return fmt.Errorf("ошибка при отмене ссылок подтверждения email: %v", err)
+		}
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
 	return nil
 }
 
@@ -108,3 +148,19 @@ func GetAllUsers(pool *pgxpool.Pool) ([]models.User, error) {
 
 	return users, nil
 }
+
+// GetUserByEmail получает пользователя по email
+func GetUserByEmail(pool *pgxpool.Pool, email string) (*models.User, error) {
+	query := `SELECT id, name, email, is_admin, email_verified FROM users WHERE LOWER(email) = LOWER($1)`
+
+	var user models.User
+	err := pool.QueryRow(context.Background(), query, email).Scan(&user.ID, &user.Name, &user.Email, &user.IsAdmin, &user.EmailVerified)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("ошибка получения пользователя по email: %v", err)
+	}
+
+	return &user, nil
+}
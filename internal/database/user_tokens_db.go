@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Назначения одноразовых токенов, отправляемых пользователю по почте
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposePasswordReset     = "password_reset"
+)
+
+var ErrUserTokenInvalid = errors.New("ссылка недействительна или устарела")
+
+// CreateUserToken сохраняет одноразовый токен, отменяя ранее выданные токены того же назначения
+func CreateUserToken(pool *pgxpool.Pool, userID int, purpose, tokenHash string, expiresAt time.Time) error {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	invalidateQuery := `
+		UPDATE user_tokens
+		SET used_at = NOW()
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`
+	if _, err := tx.Exec(context.Background(), invalidateQuery, userID, purpose); err != nil {
+		return fmt.Errorf("ошибка при отмене предыдущих токенов: %v", err)
+	}
+
+	insertQuery := `
+		INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)`
+	if _, err := tx.Exec(context.Background(), insertQuery, userID, purpose, tokenHash, expiresAt); err != nil {
+		return fmt.Errorf("ошибка при создании токена: %v", err)
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return nil
+}
+
+// consumeUserToken гасит действующий токен и возвращает ID его владельца
+func consumeUserToken(tx pgx.Tx, purpose, tokenHash string) (int, error) {
+	query := `
+		UPDATE user_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id`
+
+	var userID int
+	err := tx.QueryRow(context.Background(), query, tokenHash, purpose).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrUserTokenInvalid
+		}
+		return 0, fmt.Errorf("ошибка при проверке токена: %v", err)
+	}
+	return userID, nil
+}
+
+// VerifyEmailWithToken подтверждает email владельца токена
+func VerifyEmailWithToken(pool *pgxpool.Pool, tokenHash string) (int, error) {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	userID, err := consumeUserToken(tx, TokenPurposeEmailVerification, tokenHash)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(context.Background(), `UPDATE users SET email_verified = TRUE WHERE id = $1`, userID); err != nil {
+		return 0, fmt.Errorf("ошибка подтверждения email: %v", err)
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return 0, fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return userID, nil
+}
+
+// ResetPasswordWithToken меняет пароль владельца токена и завершает все его сессии
+func ResetPasswordWithToken(pool *pgxpool.Pool, tokenHash, passwordHash string) (int, error) {
+	tx, err := pool.Begin(context.Background())
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при начале транзакции: %v", err)
+	}
+	defer tx.Rollback(context.Background())
+
+	userID, err := consumeUserToken(tx, TokenPurposePasswordReset, tokenHash)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(context.Background(), `UPDATE users SET password = $1 WHERE id = $2`, passwordHash, userID); err != nil {
+		return 0, fmt.Errorf("ошибка обновления пароля: %v", err)
+	}
+
+	// Письмо пришло на почту владельца, значит адрес заодно подтверждён
+	if _, err := tx.Exec(context.Background(), `UPDATE users SET email_verified = TRUE WHERE id = $1`, userID); err != nil {
+		return 0, fmt.Errorf("ошибка подтверждения email: %v", err)
+	}
+
+	revokeQuery := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.Exec(context.Background(), revokeQuery, userID); err != nil {
+		return 0, fmt.Errorf("ошибка завершения сессий: %v", err)
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return 0, fmt.Errorf("ошибка при завершении транзакции: %v", err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,252 @@
+// Package dataexport собирает архив со всеми персональными данными пользователя.
+package dataexport
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/blobstore"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/database"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+const (
+	// FormatVersion меняется при несовместимых изменениях структуры архива
+	FormatVersion = 1
+	// ArchiveTTL — сколько готовый архив доступен для скачивания
+	ArchiveTTL = 7 * 24 * time.Hour
+)
+
+// Manifest описывает содержимое архива
+type Manifest struct {
+	FormatVersion int            `json:"format_version"`
+	UserID        int            `json:"user_id"`
+	GeneratedAt   time.Time      `json:"generated_at"`
+	Files         []ManifestFile `json:"files"`
+	Attachments   []ManifestFile `json:"attachments"`
+}
+
+// ManifestFile — один файл архива с числом записей и контрольной суммой. У файла вложения указаны
+// также ID вложения и размер; Missing означает, что в хранилище файла не оказалось
+type ManifestFile struct {
+	Name         string `json:"name"`
+	Table        string `json:"table"`
+	Records      int    `json:"records"`
+	SHA256       string `json:"sha256,omitempty"`
+	AttachmentID int    `json:"attachment_id,omitempty"`
+	Size         int64  `json:"size_bytes,omitempty"`
+	Missing      bool   `json:"missing,omitempty"`
+}
+
+// Dir возвращает каталог для готовых архивов
+func Dir() string {
+	if dir := os.Getenv("EXPORT_DIR"); dir != "" {
+		return dir
+	}
+	return "exports"
+}
+
+// WriteArchive записывает zip-архив: по JSON-файлу на таблицу, файлы вложений из store
+// в attachments/<id>/<имя файла> и manifest.json
+func WriteArchive(w io.Writer, userID int, sections []database.ExportSection, attachments []models.Attachment,
+	store blobstore.Store, generatedAt time.Time) error {
+	archive := zip.NewWriter(w)
+
+	manifest := Manifest{
+		FormatVersion: FormatVersion,
+		UserID:        userID,
+		GeneratedAt:   generatedAt.UTC(),
+	}
+	for _, section := range sections {
+		name := section.Name + ".json"
+		file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: generatedAt})
+		if err != nil {
+			return fmt.Errorf("ошибка записи %s в архив: %v", name, err)
+		}
+		if _, err := file.Write(section.Data); err != nil {
+			return fmt.Errorf("ошибка записи %s в архив: %v", name, err)
+		}
+
+		sum := sha256.Sum256(section.Data)
+		manifest.Files = append(manifest.Files, ManifestFile{
+			Name:    name,
+			Table:   section.Table,
+			Records: section.Records,
+			SHA256:  hex.EncodeToString(sum[:]),
+		})
+	}
+
+	manifest.Attachments = make([]ManifestFile, 0, len(attachments))
+	for _, attachment := range attachments {
+		entry, err := writeAttachment(archive, store, attachment, generatedAt)
+		if err != nil {
+			return err
+		}
+		manifest.Attachments = append(manifest.Attachments, entry)
+	}
+
+	file, err := archive.CreateHeader(&zip.FileHeader{Name: "manifest.json", Method: zip.Deflate, Modified: generatedAt})
+	if err != nil {
+		return fmt.Errorf("ошибка записи манифеста: %v", err)
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return fmt.Errorf("ошибка записи манифеста: %v", err)
+	}
+
+	return archive.Close()
+}
+
+// writeAttachment копирует файл вложения из хранилища в архив потоком, не держа его в памяти целиком.
+// Файл, которого нет в хранилище, попадает в манифест с отметкой missing, а не срывает выгрузку
+func writeAttachment(archive *zip.Writer, store blobstore.Store, attachment models.Attachment, generatedAt time.Time) (ManifestFile, error) {
+	name := fmt.Sprintf("attachments/%d/%s", attachment.ID, archiveFileName(attachment.FileName))
+	entry := ManifestFile{Name: name, Table: "transaction_attachments", AttachmentID: attachment.ID}
+
+	reader, err := store.Get(context.Background(), attachment.StorageKey)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrNotFound) {
+			log.Printf("Файл вложения %d не найден в хранилище, в выгрузку не попал", attachment.ID)
+			entry.Missing = true
+			return entry, nil
+		}
+		return entry, fmt.Errorf("ошибка чтения вложения %d: %v", attachment.ID, err)
+	}
+	defer reader.Close()
+
+	file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: generatedAt})
+	if err != nil {
+		return entry, fmt.Errorf("ошибка записи %s в архив: %v", name, err)
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), reader)
+	if err != nil {
+		return entry, fmt.Errorf("ошибка записи %s в архив: %v", name, err)
+	}
+
+	entry.Records = 1
+	entry.Size = size
+	entry.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return entry, nil
+}
+
+// archiveFileName не даёт имени вложения выйти за пределы его каталога в архиве
+func archiveFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == ".." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
+
+// build собирает архив выгрузки в файл и возвращает его путь и размер
+func build(pool *pgxpool.Pool, store blobstore.Store, export *models.DataExport) (string, int64, error) {
+	sections, attachments, err := database.ExportUserData(pool, export.UserID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := os.MkdirAll(Dir(), 0o700); err != nil {
+		return "", 0, fmt.Errorf("ошибка создания каталога выгрузок: %v", err)
+	}
+
+	// Случайная часть имени не даёт угадать путь к чужому архиву
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", 0, fmt.Errorf("ошибка генерации имени архива: %v", err)
+	}
+	path := filepath.Join(Dir(), fmt.Sprintf("user-%d-export-%d-%s.zip", export.UserID, export.ID, hex.EncodeToString(suffix)))
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", 0, fmt.Errorf("ошибка создания архива: %v", err)
+	}
+	if err := WriteArchive(file, export.UserID, sections, attachments, store, time.Now()); err != nil {
+		file.Close()
+		os.Remove(path)
+		return "", 0, err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return "", 0, fmt.Errorf("ошибка сохранения архива: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("ошибка сохранения архива: %v", err)
+	}
+	return path, info.Size(), nil
+}
+
+// ProcessPending собирает все выгрузки из очереди и уведомляет владельцев о готовности;
+// файлы вложений берутся из store
+func ProcessPending(pool *pgxpool.Pool, store blobstore.Store) {
+	for {
+		export, err := database.ClaimDataExport(pool)
+		if err != nil {
+			if !errors.Is(err, database.ErrDataExportNotFound) {
+				log.Printf("Ошибка получения выгрузки из очереди: %v", err)
+			}
+			return
+		}
+
+		path, size, err := build(pool, store, export)
+		if err != nil {
+			log.Printf("Ошибка выгрузки данных пользователя %d: %v", export.UserID, err)
+			if err := database.FailDataExport(pool, export.ID, "Не удалось собрать архив"); err != nil {
+				log.Printf("Ошибка обновления выгрузки %d: %v", export.ID, err)
+			}
+			notify(pool, export.UserID, "Не удалось подготовить архив с вашими данными. Попробуйте запросить выгрузку ещё раз.")
+			continue
+		}
+
+		expiresAt := time.Now().Add(ArchiveTTL)
+		if err := database.CompleteDataExport(pool, export.ID, path, size, expiresAt); err != nil {
+			log.Printf("Ошибка завершения выгрузки %d: %v", export.ID, err)
+			os.Remove(path)
+			continue
+		}
+		notify(pool, export.UserID, fmt.Sprintf(
+			"Архив с вашими данными готов. Скачать его можно до %s.", expiresAt.Format("02.01.2006 15:04")))
+	}
+}
+
+// RemoveExpired удаляет файлы архивов, срок хранения которых истёк
+func RemoveExpired(pool *pgxpool.Pool) {
+	paths, err := database.ExpireDataExports(pool)
+	if err != nil {
+		log.Printf("Ошибка очистки выгрузок данных: %v", err)
+		return
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("Ошибка удаления архива %s: %v", path, err)
+		}
+	}
+}
+
+func notify(pool *pgxpool.Pool, userID int, message string) {
+	notification := models.Notification{
+		UserID:   userID,
+		Message:  message,
+		DateWhen: time.Now(),
+	}
+	if err := database.CreateNotification(pool, &notification); err != nil {
+		log.Printf("Ошибка создания уведомления о выгрузке для пользователя %d: %v", userID, err)
+	}
+}
@@ -0,0 +1,82 @@
+package dataexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/blobstore"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/database"
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+func readArchiveFile(t *testing.T, archive *zip.Reader, name string) []byte {
+	t.Helper()
+	file, err := archive.Open(name)
+	if err != nil {
+		t.Fatalf("в архиве нет %s: %v", name, err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestWriteArchiveIncludesAttachments(t *testing.T) {
+	store := &blobstore.LocalStore{Dir: t.TempDir()}
+	receipt := []byte("%PDF-1.4 чек")
+	if err := store.Put(context.Background(), "7/receipt", receipt, "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+
+	sections := []database.ExportSection{
+		{Name: "transaction_attachments", Table: "transaction_attachments", Records: 2, Data: []byte(`[{"id":3},{"id":4}]`)},
+	}
+	attachments := []models.Attachment{
+		{ID: 3, FileName: "чек.pdf", StorageKey: "7/receipt"},
+		{ID: 4, FileName: "../../etc/passwd", StorageKey: "7/lost"},
+	}
+	var buf bytes.Buffer
+	if err := WriteArchive(&buf, 7, sections, attachments, store, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data := readArchiveFile(t, archive, "attachments/3/чек.pdf"); !bytes.Equal(data, receipt) {
+		t.Errorf("вложение в архиве %q", data)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(readArchiveFile(t, archive, "manifest.json"), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 1 || len(manifest.Attachments) != 2 {
+		t.Fatalf("в манифесте %+v", manifest)
+	}
+	sum := sha256.Sum256(receipt)
+	want := ManifestFile{Name: "attachments/3/чек.pdf", Table: "transaction_attachments", Records: 1,
+		SHA256: hex.EncodeToString(sum[:]), AttachmentID: 3, Size: int64(len(receipt))}
+	if manifest.Attachments[0] != want {
+		t.Errorf("вложение в манифесте %+v, ожидалось %+v", manifest.Attachments[0], want)
+	}
+
+	// Файла нет в хранилище: выгрузка не срывается, вложение отмечено в манифесте; путь не выходит из своего каталога
+	missing := manifest.Attachments[1]
+	if !missing.Missing || missing.Name != "attachments/4/passwd" {
+		t.Errorf("отсутствующее вложение в манифесте %+v", missing)
+	}
+	if _, err := archive.Open(missing.Name); err == nil {
+		t.Errorf("в архиве есть файл отсутствующего вложения")
+	}
+}
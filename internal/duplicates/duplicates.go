@@ -0,0 +1,138 @@
+// Package duplicates оценивает, насколько две транзакции похожи на одну и ту же операцию,
+// внесённую дважды: вручную и из выписки или из двух пересекающихся выписок.
+package duplicates
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+const (
+	// WindowDays — на сколько дней могут разойтись даты: банк проводит покупку через день-два после неё
+	WindowDays = 3
+	// Threshold — оценка, начиная с которой пара попадает в очередь проверки
+	Threshold = 0.6
+
+	dateWeight        = 0.6
+	descriptionWeight = 0.4
+)
+
+// Score оценивает сходство транзакций от 0 до 1. Пары с разной суммой, типом или валютой
+// и пары, разнесённые больше чем на WindowDays дней, получают 0.
+// Совпадение суммы в тот же день даёт порог уже при совершенно разных описаниях:
+// вручную покупку подписывают иначе, чем банк.
+func Score(a, b models.Transaction) float64 {
+	if math.Abs(a.Amount-b.Amount) >= 0.005 || a.Type != b.Type {
+		return 0
+	}
+	if a.Currency != "" && b.Currency != "" && !strings.EqualFold(a.Currency, b.Currency) {
+		return 0
+	}
+	days := daysApart(a.Date, b.Date)
+	if days > WindowDays {
+		return 0
+	}
+
+	dateScore := 1 - float64(days)/float64(WindowDays+1)
+	descriptionScore := 0.5 // пустое описание ни за, ни против
+	if normalize(a.Description) != "" && normalize(b.Description) != "" {
+		descriptionScore = Similarity(a.Description, b.Description)
+	}
+	return dateWeight*dateScore + descriptionWeight*descriptionScore
+}
+
+// IsLikely сообщает, что пара похожа на дубликат, и возвращает оценку
+func IsLikely(a, b models.Transaction) (float64, bool) {
+	score := Score(a, b)
+	return score, score >= Threshold
+}
+
+// Similarity сравнивает описания от 0 до 1: берётся лучшее из сходства по триграммам
+// и доли слов короткого описания, которые есть в длинном («Пятёрочка» и «ПЯТЁРОЧКА 1234 МОСКВА»).
+func Similarity(a, b string) float64 {
+	a, b = normalize(a), normalize(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	return math.Max(trigramSimilarity(a, b), wordContainment(a, b))
+}
+
+func daysApart(a, b time.Time) int {
+	dayA := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	dayB := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	days := int(dayA.Sub(dayB).Hours() / 24)
+	if days < 0 {
+		return -days
+	}
+	return days
+}
+
+// normalize приводит описание к нижнему регистру и оставляет только буквы и цифры, разделённые пробелом
+func normalize(value string) string {
+	value = strings.ReplaceAll(strings.ToLower(value), "ё", "е")
+	return strings.Join(strings.FieldsFunc(value, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+func trigrams(value string) map[string]struct{} {
+	set := map[string]struct{}{}
+	for _, word := range strings.Fields(value) {
+		runes := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			set[string(runes[i:i+3])] = struct{}{}
+		}
+	}
+	return set
+}
+
+func trigramSimilarity(a, b string) float64 {
+	setA, setB := trigrams(a), trigrams(b)
+	common := 0
+	for trigram := range setA {
+		if _, ok := setB[trigram]; ok {
+			common++
+		}
+	}
+	union := len(setA) + len(setB) - common
+	if union == 0 {
+		return 0
+	}
+	return float64(common) / float64(union)
+}
+
+// wordContainment — доля слов короткого описания, встречающихся в длинном; числа не учитываются,
+// потому что банк добавляет к названию номера терминалов и карт
+func wordContainment(a, b string) float64 {
+	wordsA, wordsB := meaningfulWords(a), meaningfulWords(b)
+	if len(wordsA) > len(wordsB) {
+		wordsA, wordsB = wordsB, wordsA
+	}
+	if len(wordsA) == 0 {
+		return 0
+	}
+	contained := 0
+	for word := range wordsA {
+		if _, ok := wordsB[word]; ok {
+			contained++
+		}
+	}
+	return float64(contained) / float64(len(wordsA))
+}
+
+func meaningfulWords(value string) map[string]struct{} {
+	words := map[string]struct{}{}
+	for _, word := range strings.Fields(value) {
+		if strings.IndexFunc(word, unicode.IsLetter) >= 0 {
+			words[word] = struct{}{}
+		}
+	}
+	return words
+}
@@ -18,9 +18,9 @@ func CreateTransactionHandler(pool *pgxpool.Pool) http.HandlerFunc {
 			return
 		}
 
-		// Проверка бюджета перед добавлением транзакции
+		// Проверка бюджета перед добавлением транзакции; разделённая транзакция списывается по частям
 		if transaction.Type == "expense" {
-			err := database.DeductFromBudget(pool, transaction.CategoryID, transaction.Amount, transaction.Date)
+			err := database.DeductTransactionFromBudgets(pool, transaction)
 			if err != nil {
 				http.Error(w, "Failed to deduct from budget: "+err.Error(), http.StatusBadRequest)
 				return
@@ -41,13 +41,13 @@ func CreateTransactionHandler(pool *pgxpool.Pool) http.HandlerFunc {
 // Получение всех транзакций
 func GetTransactionsHandler(pool *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		transactions, err := database.GetAllTransactions(pool)
+		page, err := database.GetAllTransactions(pool, database.TransactionFilter{})
 		if err != nil {
 			http.Error(w, "Failed to get transactions", http.StatusInternalServerError)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(transactions)
+		json.NewEncoder(w).Encode(page)
 	}
 }
 
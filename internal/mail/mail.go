@@ -0,0 +1,85 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message — письмо пользователю в виде простого текста
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender доставляет письма; реализация выбирается конфигурацией
+type Sender interface {
+	Send(msg Message) error
+}
+
+// NewSenderFromEnv выбирает способ доставки по переменной MAIL_DRIVER: smtp, file или log
+func NewSenderFromEnv() Sender {
+	switch strings.ToLower(os.Getenv("MAIL_DRIVER")) {
+	case "smtp":
+		port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+		if err != nil {
+			port = 587
+		}
+		return &SMTPSender{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("MAIL_FROM"),
+		}
+	case "file":
+		return &FileSender{Dir: os.Getenv("MAIL_DIR")}
+	default:
+		return LogSender{}
+	}
+}
+
+// LogSender пишет письма в лог; удобно при локальной разработке
+type LogSender struct{}
+
+func (LogSender) Send(msg Message) error {
+	log.Printf("Письмо для %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileSender сохраняет каждое письмо в отдельный .eml файл каталога Dir
+type FileSender struct {
+	Dir string
+}
+
+func (s *FileSender) Send(msg Message) error {
+	dir := s.Dir
+	if dir == "" {
+		dir = "mail_outbox"
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("ошибка создания каталога для писем: %v", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"), sanitizeFileName(msg.To))
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buildMessage("noreply@localhost", msg), 0o644); err != nil {
+		return fmt.Errorf("ошибка сохранения письма: %v", err)
+	}
+	log.Printf("Письмо для %s сохранено в %s", msg.To, path)
+	return nil
+}
+
+func sanitizeFileName(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, value)
+}
@@ -0,0 +1,56 @@
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTPSender отправляет письма через SMTP-сервер; авторизация выполняется, если задан Username
+type SMTPSender struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPSender) Send(msg Message) error {
+	if s.Host == "" || s.From == "" {
+		return errors.New("SMTP не настроен: укажите SMTP_HOST и MAIL_FROM")
+	}
+	if strings.ContainsAny(msg.To, "\r\n") {
+		return errors.New("некорректный адрес получателя")
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	if err := smtp.SendMail(addr, auth, s.From, []string{msg.To}, buildMessage(s.From, msg)); err != nil {
+		return fmt.Errorf("ошибка отправки письма: %v", err)
+	}
+	return nil
+}
+
+// buildMessage собирает письмо в формате RFC 5322 с телом в UTF-8
+func buildMessage(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return buf.Bytes()
+}
@@ -0,0 +1,160 @@
+package ofx
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// element — узел дерева OFX. У листа есть текст, у агрегата — дочерние элементы.
+type element struct {
+	name     string
+	text     string
+	children []*element
+}
+
+// value возвращает текст непосредственного дочернего элемента
+func (e *element) value(name string) string {
+	for _, child := range e.children {
+		if child.name == name {
+			return child.text
+		}
+	}
+	return ""
+}
+
+// first возвращает первый элемент с одним из имён среди потомков
+func (e *element) first(names ...string) *element {
+	for _, child := range e.children {
+		for _, name := range names {
+			if child.name == name {
+				return child
+			}
+		}
+		if found := child.first(names...); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findAll возвращает все элементы с одним из имён среди потомков, не заходя внутрь найденных
+func (e *element) findAll(names ...string) []*element {
+	var found []*element
+	for _, child := range e.children {
+		matched := false
+		for _, name := range names {
+			if child.name == name {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			found = append(found, child)
+			continue
+		}
+		found = append(found, child.findAll(names...)...)
+	}
+	return found
+}
+
+// parseElements строит дерево по телу OFX. Разбор общий для обеих версий:
+// в SGML (1.x) у листовых элементов нет закрывающих тегов, в XML (2.x) они есть.
+// Элемент, за которым сразу идёт текст, считается листом и закрывается сам.
+// Элемент без текста до закрывающего тега неизвестен: агрегат это или пустой лист вроде <MEMO>,
+// выясняется, только когда закрывается его родитель, — тогда пустой лист возвращает родителю
+// элементы, которые по ошибке попали внутрь него.
+func parseElements(body string) (*element, error) {
+	root := &element{}
+	stack := []*element{root}
+
+	for pos := 0; pos < len(body); {
+		open := strings.IndexByte(body[pos:], '<')
+		if open < 0 {
+			break
+		}
+		open += pos
+
+		switch {
+		case strings.HasPrefix(body[open:], "<!--"):
+			end := strings.Index(body[open:], "-->")
+			if end < 0 {
+				return nil, fmt.Errorf("%w: незакрытый комментарий", ErrNotOFX)
+			}
+			pos = open + end + len("-->")
+			continue
+		case strings.HasPrefix(body[open:], "<?"):
+			end := strings.Index(body[open:], "?>")
+			if end < 0 {
+				return nil, fmt.Errorf("%w: незакрытая инструкция", ErrNotOFX)
+			}
+			pos = open + end + len("?>")
+			continue
+		}
+
+		end := strings.IndexByte(body[open:], '>')
+		if end < 0 {
+			return nil, fmt.Errorf("%w: незакрытый тег", ErrNotOFX)
+		}
+		end += open
+		tag := strings.TrimSpace(body[open+1 : end])
+		pos = end + 1
+
+		if strings.HasPrefix(tag, "/") {
+			closeElement(&stack, strings.ToUpper(strings.TrimSpace(tag[1:])))
+			continue
+		}
+
+		selfClosing := strings.HasSuffix(tag, "/")
+		name := strings.TrimSuffix(tag, "/")
+		if i := strings.IndexAny(name, " \t\r\n"); i >= 0 {
+			name = name[:i] // атрибутов в OFX нет, но XML их допускает
+		}
+		current := &element{name: strings.ToUpper(name)}
+		parent := stack[len(stack)-1]
+		parent.children = append(parent.children, current)
+		if selfClosing {
+			continue
+		}
+
+		next := strings.IndexByte(body[pos:], '<')
+		if next < 0 {
+			next = len(body) - pos
+		}
+		if text := strings.TrimSpace(body[pos : pos+next]); text != "" {
+			current.text = html.UnescapeString(text)
+			pos += next
+			continue
+		}
+		stack = append(stack, current)
+	}
+
+	if root.first("OFX") == nil {
+		return nil, ErrNotOFX
+	}
+	return root, nil
+}
+
+// closeElement снимает со стека элементы до ближайшего с таким именем.
+// Закрывающий тег листа, который уже закрыт, ничего не меняет.
+func closeElement(stack *[]*element, name string) {
+	for i := len(*stack) - 1; i > 0; i-- {
+		if (*stack)[i].name == name {
+			releaseUnclosed((*stack)[i:])
+			*stack = (*stack)[:i]
+			return
+		}
+	}
+}
+
+// releaseUnclosed разбирает стек над закрываемым элементом stack[0]: элементы выше него
+// так и не получили закрывающего тега, значит это пустые листья. Их дочерние элементы
+// на самом деле следуют за ними на том же уровне. Каждый элемент стека — последний дочерний
+// у предыдущего, поэтому перенос в конец родителя сохраняет порядок.
+func releaseUnclosed(stack []*element) {
+	for i := len(stack) - 1; i > 0; i-- {
+		leaf, parent := stack[i], stack[i-1]
+		parent.children = append(parent.children, leaf.children...)
+		leaf.children = nil
+	}
+}
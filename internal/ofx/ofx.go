@@ -0,0 +1,224 @@
+// Package ofx разбирает банковские выписки в форматах OFX 1.x (SGML) и OFX 2.x (XML), а также QFX
+package ofx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+	"golang.org/x/text/encoding/charmap"
+)
+
+var ErrNotOFX = errors.New("файл не похож на выписку OFX")
+
+// Transaction — операция выписки (агрегат STMTTRN)
+type Transaction struct {
+	FITID    string    `json:"fitid"`
+	Type     string    `json:"type"` // TRNTYPE: DEBIT, CREDIT, POS, ATM и т. д.
+	Posted   time.Time `json:"posted"`
+	Amount   float64   `json:"amount"` // со знаком: отрицательная сумма — списание
+	Name     string    `json:"name"`
+	Memo     string    `json:"memo"`
+	Currency string    `json:"currency"`
+}
+
+// Description возвращает описание операции для пользователя
+func (t Transaction) Description() string {
+	switch {
+	case t.Name == "":
+		return t.Memo
+	case t.Memo == "" || strings.Contains(t.Name, t.Memo):
+		return t.Name
+	default:
+		return t.Name + " — " + t.Memo
+	}
+}
+
+// Model переводит операцию в транзакцию приложения: сумма без знака, направление — в типе
+func (t Transaction) Model(categoryID int) models.Transaction {
+	transaction := models.Transaction{
+		CategoryID:  categoryID,
+		Amount:      math.Abs(t.Amount),
+		Date:        t.Posted,
+		Type:        "income",
+		Description: t.Description(),
+		Currency:    t.Currency,
+	}
+	if t.Amount < 0 {
+		transaction.Type = "expense"
+	}
+	return transaction
+}
+
+// TransactionError — операция, которую не удалось разобрать
+type TransactionError struct {
+	FITID   string `json:"fitid,omitempty"`
+	Message string `json:"error"`
+}
+
+// Statement — выписка по одному счёту (STMTRS или CCSTMTRS)
+type Statement struct {
+	AccountID    string             `json:"account_id"` // BANKID/ACCTID, однозначно определяет счёт
+	Currency     string             `json:"currency"`   // CURDEF
+	Transactions []Transaction      `json:"transactions"`
+	Errors       []TransactionError `json:"errors"`
+}
+
+// Parse читает файл OFX и возвращает выписки по всем счетам в нём
+func Parse(r io.Reader) ([]Statement, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла: %v", err)
+	}
+
+	start := ofxRoot.FindIndex(data)
+	if start == nil {
+		return nil, ErrNotOFX
+	}
+	// В OFX 1.x кодировка указана в заголовке до тела: CHARSET:1251
+	if isCP1251(data[:start[0]]) {
+		if data, err = charmap.Windows1251.NewDecoder().Bytes(data); err != nil {
+			return nil, fmt.Errorf("ошибка перекодирования файла: %v", err)
+		}
+		if start = ofxRoot.FindIndex(data); start == nil {
+			return nil, ErrNotOFX
+		}
+	}
+
+	root, err := parseElements(string(data[start[0]:]))
+	if err != nil {
+		return nil, err
+	}
+
+	var statements []Statement
+	for _, aggregate := range root.findAll("STMTRS", "CCSTMTRS") {
+		statements = append(statements, readStatement(aggregate))
+	}
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("%w: нет ни одной выписки по счёту", ErrNotOFX)
+	}
+	return statements, nil
+}
+
+var ofxRoot = regexp.MustCompile(`(?i)<OFX[\s>]`)
+
+var charsetHeader = regexp.MustCompile(`(?i)CHARSET:\s*(1251|windows-1251)|encoding="windows-1251"`)
+
+func isCP1251(header []byte) bool {
+	return charsetHeader.Match(header)
+}
+
+func readStatement(aggregate *element) Statement {
+	statement := Statement{
+		Currency:     strings.ToUpper(aggregate.value("CURDEF")),
+		Transactions: []Transaction{},
+		Errors:       []TransactionError{},
+	}
+
+	if account := aggregate.first("BANKACCTFROM", "CCACCTFROM"); account != nil {
+		statement.AccountID = strings.Trim(account.value("BANKID")+"/"+account.value("ACCTID"), "/")
+	}
+
+	for _, trn := range aggregate.findAll("STMTTRN") {
+		transaction, err := readTransaction(trn, statement.Currency)
+		if err != nil {
+			statement.Errors = append(statement.Errors, TransactionError{FITID: trn.value("FITID"), Message: err.Error()})
+			continue
+		}
+		statement.Transactions = append(statement.Transactions, transaction)
+	}
+	return statement
+}
+
+func readTransaction(trn *element, defaultCurrency string) (Transaction, error) {
+	transaction := Transaction{
+		FITID:    trn.value("FITID"),
+		Type:     strings.ToUpper(trn.value("TRNTYPE")),
+		Name:     trn.value("NAME"),
+		Memo:     trn.value("MEMO"),
+		Currency: defaultCurrency,
+	}
+	if transaction.FITID == "" {
+		return transaction, errors.New("у операции нет FITID")
+	}
+
+	posted, err := ParseDateTime(trn.value("DTPOSTED"))
+	if err != nil {
+		return transaction, err
+	}
+	transaction.Posted = posted
+
+	raw := trn.value("TRNAMT")
+	amount, err := parseAmount(raw)
+	if err != nil {
+		return transaction, fmt.Errorf("некорректная сумма «%s»", raw)
+	}
+	if amount == 0 {
+		return transaction, errors.New("нулевая сумма")
+	}
+	transaction.Amount = amount
+
+	// Операция в другой валюте: CURRENCY или ORIGCURRENCY с кодом в CURSYM
+	if currency := trn.first("CURRENCY", "ORIGCURRENCY"); currency != nil {
+		if symbol := currency.value("CURSYM"); symbol != "" {
+			transaction.Currency = strings.ToUpper(symbol)
+		}
+	}
+	return transaction, nil
+}
+
+// parseAmount разбирает сумму TRNAMT. Некоторые банки пишут десятичную запятую (-1234,56),
+// другие — запятую или точку как разделитель тысяч (1,234.56 или 1.234,56):
+// десятичным считается тот из разделителей, что стоит последним.
+func parseAmount(raw string) (float64, error) {
+	value := strings.TrimPrefix(strings.TrimSpace(raw), "+")
+	comma, dot := strings.LastIndex(value, ","), strings.LastIndex(value, ".")
+	switch {
+	case comma >= 0 && dot > comma:
+		value = strings.ReplaceAll(value, ",", "")
+	case comma >= 0 && dot >= 0:
+		value = strings.ReplaceAll(strings.ReplaceAll(value, ".", ""), ",", ".")
+	case comma >= 0:
+		value = strings.ReplaceAll(value, ",", ".")
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+var dateTimeLayouts = []string{"20060102150405", "200601021504", "20060102"}
+
+// ParseDateTime разбирает дату OFX вида 20240301120000.000[-5:EST]; без зоны время считается UTC
+func ParseDateTime(value string) (time.Time, error) {
+	original := value
+	location := time.UTC
+	if i := strings.Index(value, "["); i >= 0 {
+		zone := strings.TrimSuffix(value[i+1:], "]")
+		value = value[:i]
+		offset := zone
+		if j := strings.Index(zone, ":"); j >= 0 {
+			offset = zone[:j]
+		}
+		hours, err := strconv.ParseFloat(offset, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("некорректная дата «%s»", original)
+		}
+		location = time.FixedZone(zone, int(hours*3600))
+	}
+	if i := strings.Index(value, "."); i >= 0 {
+		value = value[:i]
+	}
+
+	for _, layout := range dateTimeLayouts {
+		if len(value) == len(layout) {
+			if t, err := time.ParseInLocation(layout, value, location); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("некорректная дата «%s»", original)
+}
@@ -0,0 +1,231 @@
+package ofx
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseFile(t *testing.T, name string) []Statement {
+	t.Helper()
+	file, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	statements, err := Parse(file)
+	if err != nil {
+		t.Fatalf("Parse(%s): %v", name, err)
+	}
+	return statements
+}
+
+func TestParseSGML(t *testing.T) {
+	statements := parseFile(t, "statement_v1.ofx")
+	if len(statements) != 1 {
+		t.Fatalf("выписок: %d, ожидалась 1", len(statements))
+	}
+	statement := statements[0]
+	if statement.AccountID != "044525225/40817810000000000001" || statement.Currency != "RUB" {
+		t.Errorf("счёт %q, валюта %q", statement.AccountID, statement.Currency)
+	}
+
+	want := []Transaction{
+		{
+			FITID:    "202403020001",
+			Type:     "POS",
+			Posted:   time.Date(2024, 3, 2, 7, 30, 0, 0, time.UTC),
+			Amount:   -350,
+			Name:     "Пятёрочка",
+			Currency: "RUB",
+		},
+		{
+			FITID:    "202403050001",
+			Type:     "CREDIT",
+			Posted:   time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC),
+			Amount:   85000,
+			Name:     "Зарплата",
+			Memo:     "Аванс за март",
+			Currency: "RUB",
+		},
+		{
+			FITID:    "202403120001",
+			Type:     "ATM",
+			Posted:   time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC),
+			Amount:   -50,
+			Name:     "Снятие наличных",
+			Currency: "USD",
+		},
+	}
+	checkTransactions(t, statement.Transactions, want)
+
+	// У операции с пустым <FITID> идентификатора нет, но следующие за ним поля на месте
+	if len(statement.Errors) != 1 || statement.Errors[0].FITID != "" {
+		t.Fatalf("ошибки: %+v", statement.Errors)
+	}
+	if got := statement.Transactions[1].Description(); got != "Зарплата — Аванс за март" {
+		t.Errorf("описание: %q", got)
+	}
+}
+
+func TestParseXML(t *testing.T) {
+	statements := parseFile(t, "statement_v2.ofx")
+	if len(statements) != 2 {
+		t.Fatalf("выписок: %d, ожидалось 2", len(statements))
+	}
+
+	bank, card := statements[0], statements[1]
+	if bank.AccountID != "121000358/000123456789" || card.AccountID != "4111111111111111" {
+		t.Errorf("счета: %q, %q", bank.AccountID, card.AccountID)
+	}
+
+	est := time.FixedZone("-5:EST", -5*3600)
+	checkTransactions(t, bank.Transactions, []Transaction{
+		{
+			FITID:    "CHK-0301-1",
+			Type:     "DEBIT",
+			Posted:   time.Date(2024, 3, 1, 12, 0, 0, 0, est),
+			Amount:   -1234.56,
+			Name:     "Rent & Utilities",
+			Currency: "USD",
+		},
+		{
+			FITID:    "CHK-0315-1",
+			Type:     "CREDIT",
+			Posted:   time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC),
+			Amount:   2500,
+			Name:     "ACME PAYROLL",
+			Memo:     "Salary March",
+			Currency: "USD",
+		},
+	})
+	if len(bank.Errors) != 1 || bank.Errors[0].FITID != "CHK-0331-1" {
+		t.Errorf("ошибки: %+v", bank.Errors)
+	}
+
+	checkTransactions(t, card.Transactions, []Transaction{
+		{
+			FITID:    "CC-0320-1",
+			Type:     "POS",
+			Posted:   time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC),
+			Amount:   -42.10,
+			Name:     "CAFE PARIS",
+			Currency: "EUR",
+		},
+	})
+}
+
+func checkTransactions(t *testing.T, got, want []Transaction) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("операций: %d, ожидалось %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if !g.Posted.Equal(w.Posted) {
+			t.Errorf("операция %s: дата %v, ожидалась %v", w.FITID, g.Posted, w.Posted)
+		}
+		g.Posted, w.Posted = time.Time{}, time.Time{}
+		if g != w {
+			t.Errorf("операция %d:\n получено  %+v\n ожидалось %+v", i, g, w)
+		}
+	}
+}
+
+// Пустой лист SGML без закрывающего тега не должен забирать в себя следующие элементы
+func TestParseElementsEmptyLeaf(t *testing.T) {
+	body := "<OFX>\n<STMTTRN>\n<MEMO>\n<NAME>Магазин\n<TRNAMT>-10.00\n</STMTTRN>\n<STMTTRN>\n<NAME>Кафе\n<MEMO>\n</STMTTRN>\n</OFX>"
+	root, err := parseElements(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trns := root.findAll("STMTTRN")
+	if len(trns) != 2 {
+		t.Fatalf("STMTTRN: %d, ожидалось 2", len(trns))
+	}
+	first := trns[0]
+	if len(first.children) != 3 {
+		t.Fatalf("у первой операции %d дочерних элементов, ожидалось 3", len(first.children))
+	}
+	for i, name := range []string{"MEMO", "NAME", "TRNAMT"} {
+		if first.children[i].name != name {
+			t.Errorf("элемент %d: %s, ожидался %s", i, first.children[i].name, name)
+		}
+	}
+	if first.value("NAME") != "Магазин" || first.value("TRNAMT") != "-10.00" || first.value("MEMO") != "" {
+		t.Errorf("значения первой операции: %q %q %q", first.value("NAME"), first.value("TRNAMT"), first.value("MEMO"))
+	}
+	if trns[1].value("NAME") != "Кафе" {
+		t.Errorf("вторая операция: %q", trns[1].value("NAME"))
+	}
+
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want float64
+	}{
+		{"-350.00", -350},
+		{"+2500", 2500},
+		{"-350,00", -350},
+		{"1,234.56", 1234.56},
+		{"-1,234,567.89", -1234567.89},
+		{"1.234,56", 1234.56},
+		{" 42.5 ", 42.5},
+	}
+	for _, tt := range tests {
+		got, err := parseAmount(tt.raw)
+		if err != nil || got != tt.want {
+			t.Errorf("parseAmount(%q) = %v, %v; ожидалось %v", tt.raw, got, err, tt.want)
+		}
+	}
+
+	for _, raw := range []string{"", "abc", "1.234.56", "1,2,3"} {
+		if _, err := parseAmount(raw); err == nil {
+			t.Errorf("parseAmount(%q): ожидалась ошибка", raw)
+		}
+	}
+}
+
+func TestParseDateTime(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"20240301", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"202403011530", time.Date(2024, 3, 1, 15, 30, 0, 0, time.UTC)},
+		{"20240301153045.123", time.Date(2024, 3, 1, 15, 30, 45, 0, time.UTC)},
+		{"20240301120000[+3:MSK]", time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)},
+		{"20240301120000.000[-5:EST]", time.Date(2024, 3, 1, 17, 0, 0, 0, time.UTC)},
+		{"20240301000000[5.5:IST]", time.Date(2024, 2, 29, 18, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := ParseDateTime(tt.value)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseDateTime(%q) = %v, %v; ожидалось %v", tt.value, got, err, tt.want)
+		}
+	}
+
+	for _, value := range []string{"", "2024-03-01", "20241301", "20240301[abc]"} {
+		if _, err := ParseDateTime(value); err == nil {
+			t.Errorf("ParseDateTime(%q): ожидалась ошибка", value)
+		}
+	}
+}
+
+func TestParseNotOFX(t *testing.T) {
+	for _, body := range []string{
+		"Date,Amount\n2024-03-01,-10\n",
+		"<OFX><SIGNONMSGSRSV1></SIGNONMSGSRSV1></OFX>",
+		"<OFX><STMTRS><!-- не закрыт",
+	} {
+		if _, err := Parse(strings.NewReader(body)); !errors.Is(err, ErrNotOFX) {
+			t.Errorf("Parse(%q): %v, ожидалась ErrNotOFX", body, err)
+		}
+	}
+}
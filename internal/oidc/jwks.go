@@ -0,0 +1,184 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+)
+
+// jsonWebKey — открытый ключ провайдера из JWKS
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(raw) == 0 {
+		return nil, errors.New("некорректное число в ключе")
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
+
+// publicKey разбирает ключ RSA или EC P-256; остальные типы не поддерживаются
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("некорректная экспонента RSA")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("кривая %s не поддерживается", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !key.Curve.IsOnCurve(x, y) {
+			return nil, errors.New("точка не лежит на кривой")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("тип ключа %s не поддерживается", k.Kty)
+	}
+}
+
+// fetchKeys загружает ключи подписи провайдера
+func (p *Provider) fetchKeys(ctx context.Context, uri string) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, uri, &set); err != nil {
+		return nil, fmt.Errorf("ошибка загрузки ключей провайдера: %v", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("провайдер не опубликовал пригодных ключей подписи")
+	}
+	return keys, nil
+}
+
+// signingKey возвращает ключ по kid, перечитывая JWKS, если ключ не найден (провайдер мог сменить ключи)
+func (p *Provider) signingKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := lookupKey(p.keys, kid); key != nil {
+		return key, nil
+	}
+	keys, err := p.fetchKeys(ctx, meta.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	if key := lookupKey(keys, kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: неизвестный ключ подписи %q", ErrInvalidIDToken, kid)
+}
+
+// lookupKey ищет ключ по kid; без kid подходит единственный опубликованный ключ
+func lookupKey(keys map[string]crypto.PublicKey, kid string) crypto.PublicKey {
+	if key, ok := keys[kid]; ok {
+		return key
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key
+		}
+	}
+	return nil
+}
+
+// verifySignature проверяет подпись JWS для алгоритмов RS256 и ES256
+func verifySignature(alg string, key crypto.PublicKey, signingInput string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidIDToken
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature); err != nil {
+			return ErrInvalidIDToken
+		}
+		return nil
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return ErrInvalidIDToken
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return ErrInvalidIDToken
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: алгоритм %s не поддерживается", ErrInvalidIDToken, alg)
+	}
+}
+
+func (p *Provider) getJSON(ctx context.Context, uri string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ответ %d от %s", resp.StatusCode, uri)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
@@ -0,0 +1,285 @@
+// Package oidc реализует вход через OpenID Connect: authorization code с PKCE и проверку ID-токена.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockSkew — допустимое расхождение часов с провайдером
+const clockSkew = time.Minute
+
+var ErrInvalidIDToken = errors.New("недействительный ID-токен")
+
+// Config — параметры клиента, зарегистрированного у провайдера
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // пустой для публичного клиента, PKCE защищает обмен кода и без него
+	RedirectURL  string
+	Scopes       []string
+}
+
+// ConfigFromEnv читает настройки провайдера; false — вход через OIDC не настроен
+func ConfigFromEnv() (Config, bool) {
+	config := Config{
+		Issuer:       strings.TrimRight(os.Getenv("OIDC_ISSUER"), "/"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:       []string{"openid", "email", "profile"},
+	}
+	if scopes := os.Getenv("OIDC_SCOPES"); scopes != "" {
+		config.Scopes = strings.Fields(scopes)
+	}
+	if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return Config{}, false
+	}
+	return config, true
+}
+
+// metadata — нужная часть документа /.well-known/openid-configuration
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider — клиент провайдера; метаданные и ключи загружаются при первом обращении и кэшируются
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *metadata
+	keys     map[string]crypto.PublicKey
+}
+
+// NewProvider создаёт клиента провайдера; nil client означает http.Client с таймаутом 10 секунд
+func NewProvider(config Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Provider{config: config, client: client}
+}
+
+// discover загружает метаданные провайдера
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var meta metadata
+	if err := p.getJSON(ctx, p.config.Issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("ошибка получения настроек провайдера: %v", err)
+	}
+	if strings.TrimRight(meta.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("провайдер представился как %q вместо %q", meta.Issuer, p.config.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("в настройках провайдера не хватает адресов")
+	}
+	p.metadata = &meta
+	return p.metadata, nil
+}
+
+// AuthCodeURL возвращает адрес страницы входа провайдера
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {CodeChallengeS256(codeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return meta.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Claims — данные пользователя из проверенного ID-токена
+type Claims struct {
+	Issuer        string       `json:"iss"`
+	Subject       string       `json:"sub"`
+	Audience      audience     `json:"aud"`
+	ExpiresAt     int64        `json:"exp"`
+	IssuedAt      int64        `json:"iat"`
+	Nonce         string       `json:"nonce"`
+	Email         string       `json:"email"`
+	EmailVerified flexibleBool `json:"email_verified"`
+	Name          string       `json:"name"`
+}
+
+// audience принимает aud как строку или как массив строк
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// flexibleBool принимает email_verified и как true, и как "true" — некоторые провайдеры отдают строку
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// Exchange обменивает код авторизации на токены и возвращает данные из проверенного ID-токена
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string, now time.Time) (*Claims, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса токена: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка запроса токена: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("некорректный ответ провайдера (%d): %v", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return nil, fmt.Errorf("провайдер отклонил код авторизации: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return nil, errors.New("провайдер не вернул ID-токен")
+	}
+
+	return p.verifyIDToken(ctx, body.IDToken, nonce, now)
+}
+
+// verifyIDToken проверяет подпись, издателя, получателя, срок действия и nonce ID-токена
+func (p *Provider) verifyIDToken(ctx context.Context, token, nonce string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidIDToken
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	key, err := p.signingKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidIDToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidIDToken
+	}
+
+	switch {
+	case strings.TrimRight(claims.Issuer, "/") != p.config.Issuer:
+		return nil, fmt.Errorf("%w: чужой издатель", ErrInvalidIDToken)
+	case !claims.Audience.contains(p.config.ClientID):
+		return nil, fmt.Errorf("%w: токен выдан другому клиенту", ErrInvalidIDToken)
+	case now.After(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)):
+		return nil, fmt.Errorf("%w: срок действия истёк", ErrInvalidIDToken)
+	case time.Unix(claims.IssuedAt, 0).After(now.Add(clockSkew)):
+		return nil, fmt.Errorf("%w: токен выпущен в будущем", ErrInvalidIDToken)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce не совпадает", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: нет идентификатора пользователя", ErrInvalidIDToken)
+	}
+	return &claims, nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, value := range a {
+		if value == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// Issuer возвращает адрес провайдера, под которым хранятся привязки аккаунтов
+func (p *Provider) Issuer() string {
+	return p.config.Issuer
+}
@@ -0,0 +1,142 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/oidc"
+	"github.com/valeriaulyamaeva/personal-finance-app/internal/oidc/oidctest"
+)
+
+const clientID = "finance-test"
+
+func startIssuer(t *testing.T, identity oidctest.Identity) (*oidctest.Issuer, *oidc.Provider) {
+	t.Helper()
+	issuer, err := oidctest.NewIssuer(clientID, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := issuer.Start()
+	t.Cleanup(server.Close)
+
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:      issuer.URL,
+		ClientID:    clientID,
+		RedirectURL: "http://app.example/oidc/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+	}, server.Client())
+	return issuer, provider
+}
+
+// authorize проходит страницу входа провайдера так, как это сделал бы браузер, и возвращает code и state
+func authorize(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("страница входа вернула %d", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), "http://app.example/oidc/callback?") {
+		t.Fatalf("возврат на %s", location)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestCodeFlowWithPKCE(t *testing.T) {
+	identity := oidctest.Identity{Subject: "user-1", Email: "anna@example.com", EmailVerified: true, Name: "Анна"}
+	_, provider := startIssuer(t, identity)
+	ctx := context.Background()
+
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := query.Query().Get("code_challenge"); got != oidc.CodeChallengeS256("verifier-1") {
+		t.Errorf("code_challenge %q", got)
+	}
+
+	code, state := authorize(t, authURL)
+	if state != "state-1" {
+		t.Errorf("state %q", state)
+	}
+
+	claims, err := provider.Exchange(ctx, code, "verifier-1", "nonce-1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != identity.Subject || claims.Email != identity.Email || !bool(claims.EmailVerified) || claims.Name != identity.Name {
+		t.Errorf("claims %+v", claims)
+	}
+
+	// Код одноразовый
+	if _, err := provider.Exchange(ctx, code, "verifier-1", "nonce-1", time.Now()); err == nil {
+		t.Error("повторный обмен кода прошёл")
+	}
+}
+
+func TestExchangeRejects(t *testing.T) {
+	_, provider := startIssuer(t, oidctest.Identity{Subject: "user-1", Email: "anna@example.com", EmailVerified: true})
+	ctx := context.Background()
+
+	start := func() string {
+		authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", "verifier")
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, _ := authorize(t, authURL)
+		return code
+	}
+
+	// Чужой code_verifier: перехваченный код без него бесполезен
+	if _, err := provider.Exchange(ctx, start(), "other-verifier", "nonce", time.Now()); err == nil || !strings.Contains(err.Error(), "PKCE") {
+		t.Errorf("чужой verifier: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		nonce string
+		now   time.Time
+	}{
+		{"чужой nonce", "other-nonce", time.Now()},
+		{"истёкший токен", "nonce", time.Now().Add(10 * time.Minute)},
+		{"токен из будущего", "nonce", time.Now().Add(-10 * time.Minute)},
+	}
+	for _, tt := range tests {
+		if _, err := provider.Exchange(ctx, start(), "verifier", tt.nonce, tt.now); !errors.Is(err, oidc.ErrInvalidIDToken) {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
+
+func TestProviderRejectsForeignIssuer(t *testing.T) {
+	issuer, _ := startIssuer(t, oidctest.Identity{Subject: "user-1"})
+
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:      issuer.URL + "/other",
+		ClientID:    clientID,
+		RedirectURL: "http://app.example/oidc/callback",
+	}, nil)
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); err == nil {
+		t.Error("принят провайдер с чужим issuer")
+	}
+}
@@ -0,0 +1,34 @@
+package passwords
+
+import (
+	_ "embed"
+	"strings"
+	"sync"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+var (
+	commonPasswordsOnce sync.Once
+	commonPasswords     map[string]struct{}
+)
+
+// loadCommonPasswords разбирает встроенный список при первом обращении
+func loadCommonPasswords() {
+	commonPasswords = make(map[string]struct{})
+	for _, line := range strings.Split(commonPasswordsFile, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		commonPasswords[strings.ToLower(line)] = struct{}{}
+	}
+}
+
+// IsCommon сообщает, входит ли пароль в список распространённых (без учёта регистра)
+func IsCommon(password string) bool {
+	commonPasswordsOnce.Do(loadCommonPasswords)
+	_, found := commonPasswords[strings.ToLower(strings.TrimSpace(password))]
+	return found
+}
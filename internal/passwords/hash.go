@@ -0,0 +1,37 @@
+package passwords
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cost возвращает стоимость bcrypt из BCRYPT_COST или bcrypt.DefaultCost.
+// После повышения стоимости старые хеши обновляются при ближайшем успешном входе.
+func Cost() int {
+	cost, err := strconv.Atoi(os.Getenv("BCRYPT_COST"))
+	if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return bcrypt.DefaultCost
+	}
+	return cost
+}
+
+// Hash хеширует пароль с текущей стоимостью
+func Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), Cost())
+	if err != nil {
+		return "", fmt.Errorf("ошибка хеширования пароля: %v", err)
+	}
+	return string(hash), nil
+}
+
+// NeedsRehash сообщает, что хеш создан с меньшей стоимостью, чем настроена сейчас
+func NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false
+	}
+	return cost < Cost()
+}
@@ -0,0 +1,132 @@
+package passwords
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bcrypt учитывает только первые 72 байта, остальное молча отбрасывается
+const maxPasswordBytes = 72
+
+var ErrWeakPassword = errors.New("пароль не соответствует требованиям")
+
+// PolicyError перечисляет все нарушенные требования, чтобы пользователь исправил их за один раз
+type PolicyError struct {
+	Problems []string
+}
+
+func (e *PolicyError) Error() string {
+	return ErrWeakPassword.Error() + ": " + strings.Join(e.Problems, "; ")
+}
+
+func (e *PolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// Policy — требования к новому паролю
+type Policy struct {
+	MinLength     int
+	RequireLower  bool
+	RequireUpper  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+// DefaultPolicy действует, если требования не заданы в окружении
+var DefaultPolicy = Policy{
+	MinLength:    10,
+	RequireLower: true,
+	RequireDigit: true,
+}
+
+// PolicyFromEnv читает требования из PASSWORD_MIN_LENGTH и PASSWORD_REQUIRE_LOWER/UPPER/DIGIT/SYMBOL
+func PolicyFromEnv() Policy {
+	policy := DefaultPolicy
+	if value, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil && value > 0 {
+		policy.MinLength = value
+	}
+	for name, target := range map[string]*bool{
+		"PASSWORD_REQUIRE_LOWER":  &policy.RequireLower,
+		"PASSWORD_REQUIRE_UPPER":  &policy.RequireUpper,
+		"PASSWORD_REQUIRE_DIGIT":  &policy.RequireDigit,
+		"PASSWORD_REQUIRE_SYMBOL": &policy.RequireSymbol,
+	} {
+		if value, err := strconv.ParseBool(os.Getenv(name)); err == nil {
+			*target = value
+		}
+	}
+	return policy
+}
+
+// Validate проверяет пароль по требованиям и по списку распространённых паролей.
+// personal — данные пользователя (email, имя), которые нельзя использовать как пароль.
+func (p Policy) Validate(password string, personal ...string) error {
+	var problems []string
+
+	if length := utf8.RuneCountInString(password); length < p.MinLength {
+		problems = append(problems, fmt.Sprintf("не короче %d символов", p.MinLength))
+	}
+	if len(password) > maxPasswordBytes {
+		problems = append(problems, fmt.Sprintf("не длиннее %d байт", maxPasswordBytes))
+	}
+
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireLower && !hasLower {
+		problems = append(problems, "хотя бы одна строчная буква")
+	}
+	if p.RequireUpper && !hasUpper {
+		problems = append(problems, "хотя бы одна заглавная буква")
+	}
+	if p.RequireDigit && !hasDigit {
+		problems = append(problems, "хотя бы одна цифра")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		problems = append(problems, "хотя бы один спецсимвол")
+	}
+
+	if IsCommon(password) {
+		problems = append(problems, "пароль слишком распространён")
+	}
+	normalized := strings.ToLower(password)
+	for _, value := range personal {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			continue
+		}
+		// Для email сравниваем и с частью до @: её легко угадать
+		if local, _, found := strings.Cut(value, "@"); found && normalized == local {
+			value = local
+		}
+		if normalized == value {
+			problems = append(problems, "пароль не должен совпадать с именем или email")
+			break
+		}
+	}
+
+	if len(problems) > 0 {
+		return &PolicyError{Problems: problems}
+	}
+	return nil
+}
+
+// Validate проверяет пароль по требованиям из окружения
+func Validate(password string, personal ...string) error {
+	return PolicyFromEnv().Validate(password, personal...)
+}
@@ -0,0 +1,183 @@
+// Package recurrence вычисляет даты повторяющихся транзакций: каждый месяц 5-го числа,
+// раз в две недели, в последний рабочий день месяца и т. п.
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+var ErrInvalidSchedule = errors.New("некорректное расписание")
+
+// Периодичность
+const (
+	Daily   = "daily"
+	Weekly  = "weekly"
+	Monthly = "monthly"
+	Yearly  = "yearly"
+)
+
+// Перенос даты, выпавшей на выходной
+const (
+	WorkingDayNone     = ""
+	WorkingDayPrevious = "previous" // на пятницу
+	WorkingDayNext     = "next"     // на понедельник
+)
+
+// LastDayOfMonth в DayOfMonth означает последний день месяца
+const LastDayOfMonth = -1
+
+// maxInterval ограничивает шаг расписания, чтобы перебор дат оставался дешёвым
+const maxInterval = 366
+
+// Validate проверяет и нормализует расписание шаблона: даты без времени, интервал по умолчанию 1
+func Validate(template *models.RecurringTransaction) error {
+	template.Frequency = strings.ToLower(strings.TrimSpace(template.Frequency))
+	template.WorkingDay = strings.ToLower(strings.TrimSpace(template.WorkingDay))
+	if template.Interval == 0 {
+		template.Interval = 1
+	}
+
+	switch template.Frequency {
+	case Daily, Weekly, Monthly, Yearly:
+	default:
+		return fmt.Errorf("%w: периодичность должна быть daily, weekly, monthly или yearly", ErrInvalidSchedule)
+	}
+	if template.Interval < 1 || template.Interval > maxInterval {
+		return fmt.Errorf("%w: интервал должен быть от 1 до %d", ErrInvalidSchedule, maxInterval)
+	}
+	if template.DayOfMonth != 0 && template.Frequency != Monthly {
+		return fmt.Errorf("%w: день месяца задаётся только для ежемесячного расписания", ErrInvalidSchedule)
+	}
+	if template.DayOfMonth < LastDayOfMonth || template.DayOfMonth > 31 {
+		return fmt.Errorf("%w: день месяца должен быть от 1 до 31 или -1 — последний день", ErrInvalidSchedule)
+	}
+	switch template.WorkingDay {
+	case WorkingDayNone, WorkingDayPrevious, WorkingDayNext:
+	default:
+		return fmt.Errorf("%w: перенос с выходных должен быть previous или next", ErrInvalidSchedule)
+	}
+	if template.StartDate.IsZero() {
+		return fmt.Errorf("%w: укажите дату начала", ErrInvalidSchedule)
+	}
+	template.StartDate = Day(template.StartDate)
+	if template.EndDate != nil {
+		end := Day(*template.EndDate)
+		if end.Before(template.StartDate) {
+			return fmt.Errorf("%w: дата окончания раньше даты начала", ErrInvalidSchedule)
+		}
+		template.EndDate = &end
+	}
+	return nil
+}
+
+// Day отбрасывает время: даты расписания сравниваются по календарным дням
+func Day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// nominal возвращает n-ю дату расписания без переноса с выходных
+func nominal(template models.RecurringTransaction, n int) time.Time {
+	start := template.StartDate
+	step := n * template.Interval
+	switch template.Frequency {
+	case Daily:
+		return start.AddDate(0, 0, step)
+	case Weekly:
+		return start.AddDate(0, 0, 7*step)
+	case Monthly:
+		day := template.DayOfMonth
+		if day == 0 {
+			day = start.Day()
+		}
+		return dayOfMonth(start.Year(), start.Month()+time.Month(step), day)
+	default:
+		return dayOfMonth(start.Year()+step, start.Month(), start.Day())
+	}
+}
+
+// dayOfMonth возвращает день месяца, не выходя за его конец: 31-е в феврале — это 28-е или 29-е
+func dayOfMonth(year int, month time.Month, day int) time.Time {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	if day == LastDayOfMonth || day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// adjust переносит дату с выходного на рабочий день. Праздники не учитываются.
+func adjust(date time.Time, workingDay string) time.Time {
+	switch workingDay {
+	case WorkingDayPrevious:
+		for date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+			date = date.AddDate(0, 0, -1)
+		}
+	case WorkingDayNext:
+		for date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+			date = date.AddDate(0, 0, 1)
+		}
+	}
+	return date
+}
+
+// firstIndex оценивает номер даты расписания, с которого стоит начинать поиск после after,
+// чтобы не перебирать все даты с начала расписания
+func firstIndex(template models.RecurringTransaction, after time.Time) int {
+	var n int
+	switch template.Frequency {
+	case Daily:
+		n = int(after.Sub(template.StartDate).Hours()/24) / template.Interval
+	case Weekly:
+		n = int(after.Sub(template.StartDate).Hours()/24/7) / template.Interval
+	case Monthly:
+		months := (after.Year()-template.StartDate.Year())*12 + int(after.Month()-template.StartDate.Month())
+		n = months / template.Interval
+	default:
+		n = (after.Year() - template.StartDate.Year()) / template.Interval
+	}
+	// Перенос с выходных сдвигает дату не больше чем на пару дней, запаса в две даты достаточно
+	n -= 2
+	if n < 0 {
+		n = 0
+	}
+	return n
+}
+
+// Next возвращает первую дату расписания строго после after; nil, если расписание закончилось.
+// Даты раньше начала расписания (после переноса на пятницу) пропускаются.
+func Next(template models.RecurringTransaction, after time.Time) *time.Time {
+	after = Day(after)
+	for n := firstIndex(template, after); ; n++ {
+		raw := nominal(template, n)
+		if template.EndDate != nil && raw.After(*template.EndDate) {
+			return nil
+		}
+		date := adjust(raw, template.WorkingDay)
+		if date.After(after) && !date.Before(template.StartDate) &&
+			(template.EndDate == nil || !date.After(*template.EndDate)) {
+			return &date
+		}
+	}
+}
+
+// Between возвращает даты расписания с from по to включительно, не больше limit
+func Between(template models.RecurringTransaction, from, to time.Time, limit int) []time.Time {
+	dates := []time.Time{}
+	to = Day(to)
+	for date := Next(template, Day(from).AddDate(0, 0, -1)); date != nil && !date.After(to) && len(dates) < limit; date = Next(template, *date) {
+		dates = append(dates, *date)
+	}
+	return dates
+}
+
+// Occurs сообщает, приходится ли на date одна из дат расписания
+func Occurs(template models.RecurringTransaction, date time.Time) bool {
+	date = Day(date)
+	next := Next(template, date.AddDate(0, 0, -1))
+	return next != nil && next.Equal(date)
+}
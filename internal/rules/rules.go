@@ -0,0 +1,168 @@
+// Package rules применяет правила автокатегоризации к транзакциям
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+var ErrInvalidRule = errors.New("некорректное правило")
+
+// maxRegexLength ограничивает размер выражения, которое пользователь может сохранить
+const maxRegexLength = 500
+
+// Validate проверяет условия и действия правила
+func Validate(rule *models.CategorizationRule) error {
+	rule.DescriptionContains = strings.TrimSpace(rule.DescriptionContains)
+	rule.DescriptionRegex = strings.TrimSpace(rule.DescriptionRegex)
+	rule.SetDescription = strings.TrimSpace(rule.SetDescription)
+
+	if rule.DescriptionContains == "" && rule.DescriptionRegex == "" && rule.MinAmount == nil && rule.MaxAmount == nil && rule.Type == "" {
+		return fmt.Errorf("%w: задайте хотя бы одно условие", ErrInvalidRule)
+	}
+	if rule.SetCategoryID == nil && rule.SetDescription == "" && rule.SetGoalID == nil {
+		return fmt.Errorf("%w: задайте хотя бы одно действие", ErrInvalidRule)
+	}
+	switch rule.Type {
+	case "", "income", "expense", "goal":
+	default:
+		return fmt.Errorf("%w: тип должен быть income, expense или goal", ErrInvalidRule)
+	}
+	if rule.MinAmount != nil && rule.MaxAmount != nil && *rule.MinAmount > *rule.MaxAmount {
+		return fmt.Errorf("%w: минимальная сумма больше максимальной", ErrInvalidRule)
+	}
+	if len(rule.DescriptionRegex) > maxRegexLength {
+		return fmt.Errorf("%w: регулярное выражение длиннее %d символов", ErrInvalidRule, maxRegexLength)
+	}
+	if _, err := compileRegex(rule.DescriptionRegex); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRule, err)
+	}
+	return nil
+}
+
+// compileRegex компилирует выражение без учёта регистра: описания в выписках бывают ЗАГЛАВНЫМИ
+func compileRegex(expression string) (*regexp.Regexp, error) {
+	if expression == "" {
+		return nil, nil
+	}
+	compiled, err := regexp.Compile("(?i)" + expression)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка в регулярном выражении: %v", err)
+	}
+	return compiled, nil
+}
+
+type compiledRule struct {
+	rule     models.CategorizationRule
+	contains string
+	regex    *regexp.Regexp
+}
+
+// Engine — скомпилированный упорядоченный набор правил пользователя
+type Engine struct {
+	rules []compiledRule
+}
+
+// NewEngine готовит правила к применению; выключенные правила пропускаются.
+// Правила должны быть упорядочены по position.
+func NewEngine(rules []models.CategorizationRule) (*Engine, error) {
+	engine := &Engine{}
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		regex, err := compileRegex(rule.DescriptionRegex)
+		if err != nil {
+			return nil, fmt.Errorf("правило %d: %v", rule.ID, err)
+		}
+		engine.rules = append(engine.rules, compiledRule{
+			rule:     rule,
+			contains: strings.ToLower(rule.DescriptionContains),
+			regex:    regex,
+		})
+	}
+	return engine, nil
+}
+
+// Empty сообщает, что применять нечего
+func (e *Engine) Empty() bool {
+	return e == nil || len(e.rules) == 0
+}
+
+// Result — что правила меняют в транзакции. Пустые поля правила не затрагивают.
+type Result struct {
+	CategoryID  *int   `json:"category_id,omitempty"`
+	Description string `json:"description,omitempty"`
+	GoalID      *int   `json:"goal_id,omitempty"`
+	RuleIDs     []int  `json:"rule_ids"` // сработавшие правила по порядку
+}
+
+// Evaluate проверяет транзакцию всеми правилами. Условия проверяются по исходному описанию;
+// каждое поле задаёт первое сработавшее правило, в котором есть такое действие.
+func (e *Engine) Evaluate(transaction models.Transaction) Result {
+	result := Result{RuleIDs: []int{}}
+	if e == nil {
+		return result
+	}
+	description := strings.ToLower(transaction.Description)
+	for _, compiled := range e.rules {
+		rule := compiled.rule
+		if rule.Type != "" && rule.Type != transaction.Type {
+			continue
+		}
+		if rule.MinAmount != nil && transaction.Amount < *rule.MinAmount {
+			continue
+		}
+		if rule.MaxAmount != nil && transaction.Amount > *rule.MaxAmount {
+			continue
+		}
+		if compiled.contains != "" && !strings.Contains(description, compiled.contains) {
+			continue
+		}
+		if compiled.regex != nil && !compiled.regex.MatchString(transaction.Description) {
+			continue
+		}
+
+		result.RuleIDs = append(result.RuleIDs, rule.ID)
+		if result.CategoryID == nil && rule.SetCategoryID != nil {
+			result.CategoryID = rule.SetCategoryID
+		}
+		if result.Description == "" && rule.SetDescription != "" {
+			result.Description = rule.SetDescription
+		}
+		if result.GoalID == nil && rule.SetGoalID != nil {
+			result.GoalID = rule.SetGoalID
+		}
+	}
+	return result
+}
+
+// Apply применяет правила к транзакции. При onlyMissing меняются только незаполненные категория и цель,
+// а описание остаётся прежним — так правила не спорят с тем, что пользователь ввёл вручную.
+// Возвращает true, если транзакция изменилась.
+func (e *Engine) Apply(transaction *models.Transaction, onlyMissing bool) bool {
+	return e.Evaluate(*transaction).ApplyTo(transaction, onlyMissing)
+}
+
+// ApplyTo переносит результат в транзакцию по тем же правилам, что и Engine.Apply
+func (r Result) ApplyTo(transaction *models.Transaction, onlyMissing bool) bool {
+	changed := false
+	if r.CategoryID != nil && *r.CategoryID != transaction.CategoryID && (!onlyMissing || transaction.CategoryID == 0) {
+		transaction.CategoryID = *r.CategoryID
+		changed = true
+	}
+	if r.Description != "" && r.Description != transaction.Description && !onlyMissing {
+		transaction.Description = r.Description
+		changed = true
+	}
+	if r.GoalID != nil && (transaction.GoalID == nil || *transaction.GoalID != *r.GoalID) && (!onlyMissing || transaction.GoalID == nil) {
+		goalID := *r.GoalID
+		transaction.GoalID = &goalID
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,165 @@
+// Package suggest подсказывает категорию транзакции по истории пользователя:
+// наивный байесовский классификатор по словам описания, порядку суммы и типу операции.
+package suggest
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/valeriaulyamaeva/personal-finance-app/models"
+)
+
+// smoothing — сглаживание Лапласа: признак, не встречавшийся в категории, не обнуляет её вероятность
+const smoothing = 1.0
+
+// Suggestion — категория и уверенность классификатора от 0 до 1
+type Suggestion struct {
+	CategoryID int     `json:"category_id"`
+	Confidence float64 `json:"confidence"`
+}
+
+type categoryStats struct {
+	documents int
+	total     int // сумма счётчиков признаков
+	features  map[string]int
+}
+
+// Model — модель одного пользователя. Обучается и дообучается по одной транзакции,
+// поэтому смена категории обходится без полного переобучения. Безопасна для параллельного использования.
+type Model struct {
+	mu         sync.RWMutex
+	documents  int
+	categories map[int]*categoryStats
+	vocabulary map[string]int // в скольких обучающих транзакциях встретился признак
+}
+
+// NewModel создаёт пустую модель
+func NewModel() *Model {
+	return &Model{categories: map[int]*categoryStats{}, vocabulary: map[string]int{}}
+}
+
+// Learn учитывает транзакцию с её категорией
+func (m *Model) Learn(transaction models.Transaction) {
+	m.update(transaction, 1)
+}
+
+// Unlearn убирает ранее учтённую транзакцию, например перед сменой её категории
+func (m *Model) Unlearn(transaction models.Transaction) {
+	m.update(transaction, -1)
+}
+
+func (m *Model) update(transaction models.Transaction, delta int) {
+	if transaction.CategoryID <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.categories[transaction.CategoryID]
+	if stats == nil {
+		if delta < 0 {
+			return
+		}
+		stats = &categoryStats{features: map[string]int{}}
+		m.categories[transaction.CategoryID] = stats
+	}
+
+	stats.documents += delta
+	m.documents += delta
+	for _, feature := range Features(transaction) {
+		stats.features[feature] += delta
+		stats.total += delta
+		m.vocabulary[feature] += delta
+		if stats.features[feature] <= 0 {
+			delete(stats.features, feature)
+		}
+		if m.vocabulary[feature] <= 0 {
+			delete(m.vocabulary, feature)
+		}
+	}
+	if stats.documents <= 0 {
+		m.documents -= stats.documents
+		delete(m.categories, transaction.CategoryID)
+	}
+}
+
+// Suggest возвращает до limit наиболее вероятных категорий для транзакции.
+// allowed ограничивает выбор существующими категориями пользователя; nil — без ограничения.
+func (m *Model) Suggest(transaction models.Transaction, limit int, allowed map[int]bool) []Suggestion {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	suggestions := []Suggestion{}
+	if m.documents <= 0 || limit <= 0 {
+		return suggestions
+	}
+
+	features := Features(transaction)
+	vocabulary := float64(len(m.vocabulary))
+	categories := float64(len(m.categories))
+	scores := map[int]float64{}
+	best := math.Inf(-1)
+	for categoryID, stats := range m.categories {
+		if allowed != nil && !allowed[categoryID] {
+			continue
+		}
+		score := math.Log((float64(stats.documents) + smoothing) / (float64(m.documents) + smoothing*categories))
+		denominator := float64(stats.total) + smoothing*vocabulary
+		for _, feature := range features {
+			score += math.Log((float64(stats.features[feature]) + smoothing) / denominator)
+		}
+		scores[categoryID] = score
+		if score > best {
+			best = score
+		}
+	}
+
+	// Уверенность — нормированные вероятности (softmax по логарифмам)
+	var sum float64
+	for _, score := range scores {
+		sum += math.Exp(score - best)
+	}
+	for categoryID, score := range scores {
+		suggestions = append(suggestions, Suggestion{CategoryID: categoryID, Confidence: math.Exp(score-best) / sum})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Confidence != suggestions[j].Confidence {
+			return suggestions[i].Confidence > suggestions[j].Confidence
+		}
+		return suggestions[i].CategoryID < suggestions[j].CategoryID
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// Features возвращает признаки транзакции: слова описания без чисел и коротких обрывков,
+// порядок суммы (степень двойки) и тип. Каждое слово учитывается один раз.
+func Features(transaction models.Transaction) []string {
+	seen := map[string]bool{}
+	var features []string
+	description := strings.ReplaceAll(strings.ToLower(transaction.Description), "ё", "е")
+	words := strings.FieldsFunc(description, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if utf8.RuneCountInString(word) < 2 || strings.IndexFunc(word, unicode.IsLetter) < 0 || seen[word] {
+			continue
+		}
+		seen[word] = true
+		features = append(features, "w:"+word)
+	}
+	if transaction.Amount > 0 {
+		features = append(features, "a:"+strconv.Itoa(int(math.Log2(transaction.Amount+1))))
+	}
+	if transaction.Type != "" {
+		features = append(features, "t:"+transaction.Type)
+	}
+	return features
+}
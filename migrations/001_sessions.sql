@@ -0,0 +1,16 @@
+-- Сессии пользователей с долгоживущими refresh-токенами
+CREATE TABLE IF NOT EXISTS sessions (
+    id                  SERIAL PRIMARY KEY,
+    user_id             INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    refresh_token_hash  TEXT      NOT NULL UNIQUE,
+    previous_token_hash TEXT,
+    device              TEXT      NOT NULL DEFAULT '',
+    ip_address          TEXT      NOT NULL DEFAULT '',
+    created_at          TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_seen_at        TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at          TIMESTAMP NOT NULL,
+    revoked_at          TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_previous_token_hash ON sessions (previous_token_hash);
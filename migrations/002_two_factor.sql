@@ -0,0 +1,29 @@
+-- Второй фактор (TOTP) и коды восстановления
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id        INTEGER   PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    secret         TEXT      NOT NULL,
+    enabled        BOOLEAN   NOT NULL DEFAULT FALSE,
+    last_used_step BIGINT    NOT NULL DEFAULT 0,
+    created_at     TIMESTAMP NOT NULL DEFAULT NOW(),
+    confirmed_at   TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS totp_recovery_codes (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash  TEXT      NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    used_at    TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_totp_recovery_codes_user_id ON totp_recovery_codes (user_id);
+
+-- Незавершённые входы, ожидающие второго фактора
+CREATE TABLE IF NOT EXISTS login_challenges (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash TEXT      NOT NULL UNIQUE,
+    attempts   INTEGER   NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL
+);
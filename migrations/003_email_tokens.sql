@@ -0,0 +1,22 @@
+-- Подтверждение email и сброс пароля
+-- Уже существующие аккаунты считаем подтверждёнными
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+                   WHERE table_name = 'users' AND column_name = 'email_verified') THEN
+        ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+        UPDATE users SET email_verified = TRUE;
+    END IF;
+END $$;
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    purpose    TEXT      NOT NULL,
+    token_hash TEXT      NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    used_at    TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_tokens_user_purpose ON user_tokens (user_id, purpose);
@@ -0,0 +1,12 @@
+-- Счётчики неудачных входов по аккаунту (email) и по IP-адресу
+CREATE TABLE IF NOT EXISTS login_throttle (
+    scope           TEXT      NOT NULL,
+    key             TEXT      NOT NULL,
+    failures        INTEGER   NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    locked_until    TIMESTAMP,
+    lockout         BOOLEAN   NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (scope, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_throttle_lockout ON login_throttle (locked_until) WHERE lockout;
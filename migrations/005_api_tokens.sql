@@ -0,0 +1,15 @@
+-- Персональные токены доступа к API для скриптов
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id           SERIAL PRIMARY KEY,
+    user_id      INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name         TEXT      NOT NULL,
+    token_hash   TEXT      NOT NULL UNIQUE,
+    token_prefix TEXT      NOT NULL,
+    scopes       TEXT[]    NOT NULL DEFAULT '{}',
+    created_at   TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMP,
+    expires_at   TIMESTAMP,
+    revoked_at   TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens (user_id);
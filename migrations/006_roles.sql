@@ -0,0 +1,68 @@
+-- Роли и права доступа вместо одного флага is_admin.
+-- Флаг users.is_admin сохраняется и поддерживается в соответствии с ролью admin.
+CREATE TABLE IF NOT EXISTS roles (
+    id          SERIAL PRIMARY KEY,
+    name        TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    name        TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id    INTEGER NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission TEXT    NOT NULL REFERENCES permissions (name) ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id    INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role_id    INTEGER   NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    granted_by INTEGER   REFERENCES users (id) ON DELETE SET NULL,
+    granted_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('admin', 'Полный доступ к администрированию'),
+    ('support', 'Поддержка: просмотр и редактирование пользователей'),
+    ('auditor', 'Аудитор: только просмотр'),
+    ('user', 'Обычный пользователь')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO permissions (name, description) VALUES
+    ('users.read', 'Просмотр списка пользователей'),
+    ('users.write', 'Создание и изменение пользователей'),
+    ('users.delete', 'Удаление пользователей'),
+    ('roles.manage', 'Выдача и отзыв ролей'),
+    ('stats.read', 'Просмотр статистики администратора')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT r.id, p.permission
+FROM roles r
+JOIN (VALUES
+    ('admin', 'users.read'),
+    ('admin', 'users.write'),
+    ('admin', 'users.delete'),
+    ('admin', 'roles.manage'),
+    ('admin', 'stats.read'),
+    ('support', 'users.read'),
+    ('support', 'users.write'),
+    ('support', 'stats.read'),
+    ('auditor', 'users.read'),
+    ('auditor', 'stats.read')
+) AS p (role, permission) ON p.role = r.name
+ON CONFLICT DO NOTHING;
+
+-- Существующие пользователи получают роль user, администраторы — ещё и admin
+INSERT INTO user_roles (user_id, role_id)
+SELECT u.id, r.id FROM users u JOIN roles r ON r.name = 'user'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO user_roles (user_id, role_id)
+SELECT u.id, r.id FROM users u JOIN roles r ON r.name = 'admin'
+WHERE u.is_admin = TRUE
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,23 @@
+-- Вход через OpenID Connect
+-- Привязка аккаунта к пользователю провайдера
+CREATE TABLE IF NOT EXISTS user_identities (
+    id            SERIAL PRIMARY KEY,
+    user_id       INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    issuer        TEXT      NOT NULL,
+    subject       TEXT      NOT NULL,
+    email         TEXT      NOT NULL DEFAULT '',
+    created_at    TIMESTAMP NOT NULL DEFAULT NOW(),
+    last_login_at TIMESTAMP,
+    UNIQUE (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
+
+-- Незавершённые входы: state, nonce и code_verifier между переходом к провайдеру и возвратом
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state_hash    TEXT PRIMARY KEY,
+    nonce         TEXT      NOT NULL,
+    code_verifier TEXT      NOT NULL,
+    created_at    TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at    TIMESTAMP NOT NULL
+);
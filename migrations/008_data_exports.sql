@@ -0,0 +1,16 @@
+-- Выгрузки персональных данных пользователя; архив собирается фоновой задачей
+CREATE TABLE IF NOT EXISTS data_exports (
+    id           SERIAL PRIMARY KEY,
+    user_id      INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    status       TEXT      NOT NULL DEFAULT 'pending',
+    file_path    TEXT      NOT NULL DEFAULT '',
+    size_bytes   BIGINT    NOT NULL DEFAULT 0,
+    error        TEXT      NOT NULL DEFAULT '',
+    created_at   TIMESTAMP NOT NULL DEFAULT NOW(),
+    started_at   TIMESTAMP,
+    completed_at TIMESTAMP,
+    expires_at   TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_exports_user_id ON data_exports (user_id);
+CREATE INDEX IF NOT EXISTS idx_data_exports_status ON data_exports (status);
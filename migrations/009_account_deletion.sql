@@ -0,0 +1,11 @@
+-- Запланированное удаление аккаунтов; до scheduled_for удаление можно отменить
+CREATE TABLE IF NOT EXISTS account_deletions (
+    user_id             INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    requested_at        TIMESTAMP NOT NULL DEFAULT NOW(),
+    requested_by        INTEGER   REFERENCES users (id) ON DELETE SET NULL,
+    scheduled_for       TIMESTAMP NOT NULL,
+    family_action       TEXT      NOT NULL DEFAULT 'transfer',
+    transfer_to_user_id INTEGER   REFERENCES users (id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_deletions_scheduled_for ON account_deletions (scheduled_for);
@@ -0,0 +1,39 @@
+-- Журнал событий безопасности. Записи только добавляются: изменение запрещено,
+-- удаление разрешено лишь при полном удалении аккаунта (app.allow_audit_purge = 'on').
+CREATE TABLE IF NOT EXISTS audit_events (
+    id          BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    event_type  TEXT      NOT NULL,
+    user_id     INTEGER,
+    actor_id    INTEGER,
+    ip_address  TEXT      NOT NULL DEFAULT '',
+    user_agent  TEXT      NOT NULL DEFAULT '',
+    details     JSONB     NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_user_id ON audit_events (user_id, id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id, id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_type ON audit_events (event_type, id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_occurred_at ON audit_events (occurred_at);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' AND current_setting('app.allow_audit_purge', true) = 'on' THEN
+        RETURN OLD;
+    END IF;
+    RAISE EXCEPTION 'audit_events допускает только добавление записей';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events;
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+INSERT INTO permissions (name, description) VALUES
+    ('audit.read', 'Просмотр журнала безопасности всех пользователей')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, 'audit.read' FROM roles WHERE name IN ('admin', 'auditor')
+ON CONFLICT DO NOTHING;
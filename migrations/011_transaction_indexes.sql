@@ -0,0 +1,4 @@
+-- Индексы для постраничного списка транзакций: фильтр по пользователю и сортировка по дате или сумме с id для стабильности
+CREATE INDEX IF NOT EXISTS idx_transactions_user_date ON transactions (user_id, transaction_date, id);
+CREATE INDEX IF NOT EXISTS idx_transactions_user_amount ON transactions (user_id, amount, id);
+CREATE INDEX IF NOT EXISTS idx_transactions_user_category ON transactions (user_id, category_id);
@@ -0,0 +1,9 @@
+-- Полнотекстовый поиск по описаниям транзакций, в том числе архивных.
+-- Выражение должно совпадать с transactionSearchVector в internal/database/transaction_search_db.go.
+CREATE INDEX IF NOT EXISTS idx_transactions_search ON transactions USING GIN (
+    (to_tsvector('russian', COALESCE(description, '')) || to_tsvector('english', COALESCE(description, '')))
+);
+
+CREATE INDEX IF NOT EXISTS idx_transactionhistory_search ON transactionhistory USING GIN (
+    (to_tsvector('russian', COALESCE(description, '')) || to_tsvector('english', COALESCE(description, '')))
+);
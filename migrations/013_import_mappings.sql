@@ -0,0 +1,25 @@
+-- Сохранённые настройки разбора CSV-выписок: одна запись на банк у каждого пользователя
+CREATE TABLE IF NOT EXISTS import_mappings (
+    id                  SERIAL PRIMARY KEY,
+    user_id             INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    bank_name           TEXT      NOT NULL,
+    delimiter           TEXT      NOT NULL DEFAULT '',
+    encoding            TEXT      NOT NULL DEFAULT 'utf-8',
+    has_header          BOOLEAN   NOT NULL DEFAULT TRUE,
+    skip_rows           INTEGER   NOT NULL DEFAULT 0,
+    date_column         TEXT      NOT NULL,
+    date_format         TEXT      NOT NULL DEFAULT '',
+    amount_column       TEXT      NOT NULL DEFAULT '',
+    debit_column        TEXT      NOT NULL DEFAULT '',
+    credit_column       TEXT      NOT NULL DEFAULT '',
+    sign_convention     TEXT      NOT NULL DEFAULT 'signed',
+    decimal_separator   TEXT      NOT NULL DEFAULT '.',
+    description_column  TEXT      NOT NULL DEFAULT '',
+    currency_column     TEXT      NOT NULL DEFAULT '',
+    default_currency    TEXT      NOT NULL DEFAULT '',
+    category_column     TEXT      NOT NULL DEFAULT '',
+    default_category_id INTEGER   REFERENCES categories (id) ON DELETE SET NULL,
+    created_at          TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at          TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, bank_name)
+);
@@ -0,0 +1,11 @@
+-- Идентификаторы операций из банковских выписок (FITID в OFX), уже загруженных пользователем.
+-- Таблица отдельная от transactions, чтобы повторный импорт узнавал операции и после переноса в архив.
+CREATE TABLE IF NOT EXISTS transaction_imports (
+    user_id        INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    source         TEXT      NOT NULL,
+    account_id     TEXT      NOT NULL DEFAULT '',
+    external_id    TEXT      NOT NULL,
+    transaction_id INTEGER,
+    imported_at    TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, source, account_id, external_id)
+);
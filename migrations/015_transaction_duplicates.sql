@@ -0,0 +1,15 @@
+-- Очередь проверки вероятных дубликатов: transaction_id добавлена позже и похожа на duplicate_of_id.
+-- Пара, которую пользователь оставил (kept), повторно не предлагается; при слиянии лишняя транзакция удаляется вместе с записью.
+CREATE TABLE IF NOT EXISTS transaction_duplicates (
+    id              SERIAL PRIMARY KEY,
+    user_id         INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    transaction_id  INTEGER   NOT NULL REFERENCES transactions (id) ON DELETE CASCADE,
+    duplicate_of_id INTEGER   NOT NULL REFERENCES transactions (id) ON DELETE CASCADE,
+    score           REAL      NOT NULL,
+    status          TEXT      NOT NULL DEFAULT 'pending',
+    created_at      TIMESTAMP NOT NULL DEFAULT NOW(),
+    resolved_at     TIMESTAMP,
+    UNIQUE (transaction_id, duplicate_of_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_transaction_duplicates_user_status ON transaction_duplicates (user_id, status);
@@ -0,0 +1,20 @@
+-- Правила автокатегоризации: применяются по возрастанию position при создании и импорте транзакций
+CREATE TABLE IF NOT EXISTS categorization_rules (
+    id                   SERIAL PRIMARY KEY,
+    user_id              INTEGER        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    position             INTEGER        NOT NULL,
+    name                 TEXT           NOT NULL DEFAULT '',
+    enabled              BOOLEAN        NOT NULL DEFAULT TRUE,
+    description_contains TEXT           NOT NULL DEFAULT '',
+    description_regex    TEXT           NOT NULL DEFAULT '',
+    min_amount           NUMERIC(12, 2),
+    max_amount           NUMERIC(12, 2),
+    type                 TEXT           NOT NULL DEFAULT '',
+    set_category_id      INTEGER        REFERENCES categories (id) ON DELETE SET NULL,
+    set_description      TEXT           NOT NULL DEFAULT '',
+    set_goal_id          INTEGER        REFERENCES goals (id) ON DELETE SET NULL,
+    created_at           TIMESTAMP      NOT NULL DEFAULT NOW(),
+    updated_at           TIMESTAMP      NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_categorization_rules_user_position ON categorization_rules (user_id, position);
@@ -0,0 +1,17 @@
+-- Части разделённой транзакции: один чек на несколько категорий. Сумма частей равна сумме транзакции.
+-- При переносе в архив часть перепривязывается с transaction_id на history_id, поэтому ровно одна из ссылок заполнена.
+ALTER TABLE transactionhistory ADD COLUMN IF NOT EXISTS transaction_id INTEGER;
+
+CREATE TABLE IF NOT EXISTS transaction_splits (
+    id             SERIAL PRIMARY KEY,
+    user_id        INTEGER        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    transaction_id INTEGER        REFERENCES transactions (id) ON DELETE CASCADE,
+    history_id     INTEGER        REFERENCES transactionhistory (id) ON DELETE CASCADE,
+    category_id    INTEGER        NOT NULL REFERENCES categories (id),
+    amount         NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+    note           TEXT           NOT NULL DEFAULT '',
+    CHECK ((transaction_id IS NULL) <> (history_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_transaction_splits_transaction_id ON transaction_splits (transaction_id);
+CREATE INDEX IF NOT EXISTS idx_transaction_splits_history_id ON transaction_splits (history_id);
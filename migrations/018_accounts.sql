@@ -0,0 +1,46 @@
+-- Счета пользователя: наличные, карты, сбережения и вклады. У каждого счёта своя валюта и начальный остаток.
+CREATE TABLE IF NOT EXISTS accounts (
+    id              SERIAL PRIMARY KEY,
+    user_id         INTEGER        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name            TEXT           NOT NULL,
+    type            TEXT           NOT NULL CHECK (type IN ('cash', 'debit_card', 'credit_card', 'savings', 'deposit')),
+    currency        TEXT           NOT NULL,
+    opening_balance NUMERIC(12, 2) NOT NULL DEFAULT 0,
+    created_at      TIMESTAMP      NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMP      NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_accounts_user_id ON accounts (user_id);
+
+-- Каждая транзакция принадлежит счёту. Перевод (type = 'transfer') списывает amount со счёта account_id
+-- и зачисляет transfer_amount в валюте счёта transfer_account_id; категория у перевода не обязательна.
+ALTER TABLE transactions
+    ADD COLUMN IF NOT EXISTS account_id INTEGER REFERENCES accounts (id),
+    ADD COLUMN IF NOT EXISTS transfer_account_id INTEGER REFERENCES accounts (id),
+    ADD COLUMN IF NOT EXISTS transfer_amount NUMERIC(12, 2),
+    ALTER COLUMN category_id DROP NOT NULL;
+
+ALTER TABLE transactionhistory
+    ADD COLUMN IF NOT EXISTS account_id INTEGER REFERENCES accounts (id),
+    ADD COLUMN IF NOT EXISTS transfer_account_id INTEGER REFERENCES accounts (id),
+    ADD COLUMN IF NOT EXISTS transfer_amount NUMERIC(12, 2),
+    ALTER COLUMN category_id DROP NOT NULL;
+
+-- Существующие транзакции переходят на основной счёт пользователя в валюте из его настроек.
+-- Выражение валюты должно совпадать с defaultAccountID в internal/database/accounts_db.go.
+INSERT INTO accounts (user_id, name, type, currency)
+SELECT u.id, 'Основной счёт', 'cash',
+    COALESCE((SELECT NULLIF(s.currency, '') FROM usersettings s WHERE s.user_id = u.id LIMIT 1), 'USD')
+FROM users u
+WHERE NOT EXISTS (SELECT 1 FROM accounts a WHERE a.user_id = u.id);
+
+UPDATE transactions t SET account_id = (SELECT MIN(a.id) FROM accounts a WHERE a.user_id = t.user_id)
+WHERE t.account_id IS NULL;
+
+UPDATE transactionhistory h SET account_id = (SELECT MIN(a.id) FROM accounts a WHERE a.user_id = h.user_id)
+WHERE h.account_id IS NULL;
+
+ALTER TABLE transactions ALTER COLUMN account_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_transactions_account_id ON transactions (account_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_transfer_account_id ON transactions (transfer_account_id);
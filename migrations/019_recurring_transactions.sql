@@ -0,0 +1,47 @@
+-- Шаблоны повторяющихся транзакций. next_date — ближайшее необработанное повторение,
+-- по нему планировщик находит шаблоны, для которых пора создать транзакции.
+CREATE TABLE IF NOT EXISTS recurring_transactions (
+    id                  SERIAL PRIMARY KEY,
+    user_id             INTEGER        NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name                TEXT           NOT NULL,
+    type                TEXT           NOT NULL CHECK (type IN ('income', 'expense', 'goal', 'transfer')),
+    amount              NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+    currency            TEXT           NOT NULL DEFAULT '',
+    description         TEXT           NOT NULL DEFAULT '',
+    category_id         INTEGER REFERENCES categories (id) ON DELETE SET NULL,
+    account_id          INTEGER        NOT NULL REFERENCES accounts (id),
+    transfer_account_id INTEGER REFERENCES accounts (id),
+    transfer_amount     NUMERIC(12, 2),
+    goal_id             INTEGER REFERENCES goals (id) ON DELETE SET NULL,
+    frequency           TEXT           NOT NULL CHECK (frequency IN ('daily', 'weekly', 'monthly', 'yearly')),
+    repeat_interval     INTEGER        NOT NULL DEFAULT 1 CHECK (repeat_interval > 0),
+    day_of_month        INTEGER        NOT NULL DEFAULT 0 CHECK (day_of_month BETWEEN -1 AND 31),
+    working_day         TEXT           NOT NULL DEFAULT '' CHECK (working_day IN ('', 'previous', 'next')),
+    start_date          DATE           NOT NULL,
+    end_date            DATE,
+    enabled             BOOLEAN        NOT NULL DEFAULT TRUE,
+    next_date           DATE,
+    last_date           DATE,
+    last_error          TEXT           NOT NULL DEFAULT '',
+    created_at          TIMESTAMP      NOT NULL DEFAULT NOW(),
+    updated_at          TIMESTAMP      NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_recurring_transactions_user_id ON recurring_transactions (user_id);
+CREATE INDEX IF NOT EXISTS idx_recurring_transactions_due ON recurring_transactions (next_date) WHERE enabled;
+
+-- Повторения с пропуском или изменениями и уже созданные. Уникальность даты в шаблоне
+-- не даёт создать транзакцию за одно повторение дважды.
+CREATE TABLE IF NOT EXISTS recurring_occurrences (
+    id              SERIAL PRIMARY KEY,
+    user_id         INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    recurring_id    INTEGER   NOT NULL REFERENCES recurring_transactions (id) ON DELETE CASCADE,
+    occurrence_date DATE      NOT NULL,
+    status          TEXT      NOT NULL CHECK (status IN ('scheduled', 'skipped', 'created')),
+    transaction_id  INTEGER REFERENCES transactions (id) ON DELETE SET NULL,
+    amount          NUMERIC(12, 2) CHECK (amount > 0),
+    description     TEXT,
+    category_id     INTEGER REFERENCES categories (id) ON DELETE SET NULL,
+    created_at      TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (recurring_id, occurrence_date)
+);
@@ -0,0 +1,42 @@
+-- Вложения транзакций: чеки, PDF, гарантийные талоны. Сами файлы лежат в хранилище (internal/blobstore),
+-- здесь — их описание и ключи. Как и части транзакции, вложение ссылается либо на текущую
+-- транзакцию, либо на архивную: при архивировании ссылка переносится.
+CREATE TABLE IF NOT EXISTS transaction_attachments (
+    id             SERIAL PRIMARY KEY,
+    user_id        INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    transaction_id INTEGER REFERENCES transactions (id) ON DELETE CASCADE,
+    history_id     INTEGER REFERENCES transactionhistory (id) ON DELETE CASCADE,
+    file_name      TEXT      NOT NULL,
+    content_type   TEXT      NOT NULL,
+    size_bytes     BIGINT    NOT NULL CHECK (size_bytes > 0),
+    storage_key    TEXT      NOT NULL UNIQUE,
+    thumbnail_key  TEXT,
+    created_at     TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK ((transaction_id IS NULL) <> (history_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_transaction_attachments_transaction_id ON transaction_attachments (transaction_id);
+CREATE INDEX IF NOT EXISTS idx_transaction_attachments_history_id ON transaction_attachments (history_id);
+
+-- Очередь файлов на удаление из хранилища. Запись вложения может исчезнуть по многим причинам
+-- (удаление транзакции, объединение дубликатов, удаление аккаунта), поэтому ключи ставит в очередь триггер,
+-- а файлы удаляет фоновая задача.
+CREATE TABLE IF NOT EXISTS blob_deletions (
+    storage_key TEXT PRIMARY KEY,
+    created_at  TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE OR REPLACE FUNCTION enqueue_attachment_blobs() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO blob_deletions (storage_key) VALUES (OLD.storage_key) ON CONFLICT DO NOTHING;
+    IF OLD.thumbnail_key IS NOT NULL THEN
+        INSERT INTO blob_deletions (storage_key) VALUES (OLD.thumbnail_key) ON CONFLICT DO NOTHING;
+    END IF;
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS transaction_attachments_enqueue_blobs ON transaction_attachments;
+CREATE TRIGGER transaction_attachments_enqueue_blobs
+    AFTER DELETE ON transaction_attachments
+    FOR EACH ROW EXECUTE FUNCTION enqueue_attachment_blobs();
@@ -0,0 +1,25 @@
+-- Свободные теги транзакций («отпуск-2026», «к-возмещению», «дети»). В отличие от категории
+-- у транзакции может быть сколько угодно тегов. Имена уникальны у пользователя без учёта регистра.
+CREATE TABLE IF NOT EXISTS tags (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER   NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name       TEXT      NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_user_name ON tags (user_id, LOWER(name));
+
+-- Как части и вложения, тег ссылается либо на текущую транзакцию, либо на архивную:
+-- при архивировании ссылка переносится.
+CREATE TABLE IF NOT EXISTS transaction_tags (
+    user_id        INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    tag_id         INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    transaction_id INTEGER REFERENCES transactions (id) ON DELETE CASCADE,
+    history_id     INTEGER REFERENCES transactionhistory (id) ON DELETE CASCADE,
+    CHECK ((transaction_id IS NULL) <> (history_id IS NULL)),
+    UNIQUE (tag_id, transaction_id),
+    UNIQUE (tag_id, history_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_transaction_tags_transaction_id ON transaction_tags (transaction_id);
+CREATE INDEX IF NOT EXISTS idx_transaction_tags_history_id ON transaction_tags (history_id);
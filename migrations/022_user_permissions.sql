@@ -0,0 +1,13 @@
+-- Права на чужие учётные данные и личные данные выделены из users.write: поддержка может править
+-- профили, но сменить чужой пароль или email, а значит войти под этим пользователем, может только admin.
+-- Доступ к финансовым данным, настройкам и выгрузкам других пользователей раньше давал флаг is_admin.
+INSERT INTO permissions (name, description) VALUES
+    ('users.credentials', 'Смена пароля и email других пользователей'),
+    ('users.data', 'Доступ к данным, настройкам и выгрузкам других пользователей')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission)
+SELECT id, p.permission FROM roles
+CROSS JOIN (VALUES ('users.credentials'), ('users.data')) AS p (permission)
+WHERE name = 'admin'
+ON CONFLICT DO NOTHING;
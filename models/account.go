@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// Account — счёт пользователя, на котором лежат деньги: наличные, карта, сбережения или вклад
+type Account struct {
+	ID             int       `json:"id" db:"id"`
+	UserID         int       `json:"user_id" db:"user_id"`
+	Name           string    `json:"name" db:"name"`
+	Type           string    `json:"type" db:"type"` // cash, debit_card, credit_card, savings, deposit
+	Currency       string    `json:"currency" db:"currency"`
+	OpeningBalance float64   `json:"opening_balance" db:"opening_balance"` // у кредитной карты с долгом — отрицательный
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type AccountDeletion struct {
+	UserID           int       `json:"user_id" db:"user_id"`
+	RequestedAt      time.Time `json:"requested_at" db:"requested_at"`
+	RequestedBy      *int      `json:"requested_by,omitempty" db:"requested_by"`
+	ScheduledFor     time.Time `json:"scheduled_for" db:"scheduled_for"`
+	FamilyAction     string    `json:"family_action" db:"family_action"`
+	TransferToUserID *int      `json:"transfer_to_user_id,omitempty" db:"transfer_to_user_id"`
+}
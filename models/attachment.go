@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Attachment — файл, приложенный к транзакции: фото чека, PDF, гарантийный талон.
+// Содержимое хранится в хранилище файлов по StorageKey.
+type Attachment struct {
+	ID            int       `json:"id" db:"id"`
+	UserID        int       `json:"user_id" db:"user_id"`
+	TransactionID *int      `json:"transaction_id,omitempty" db:"transaction_id"`
+	HistoryID     *int      `json:"history_id,omitempty" db:"history_id"` // после архивирования транзакции
+	FileName      string    `json:"file_name" db:"file_name"`
+	ContentType   string    `json:"content_type" db:"content_type"`
+	Size          int64     `json:"size" db:"size_bytes"`
+	StorageKey    string    `json:"-" db:"storage_key"`
+	ThumbnailKey  *string   `json:"-" db:"thumbnail_key"` // только у изображений
+	HasThumbnail  bool      `json:"has_thumbnail" db:"-"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type AuditEvent struct {
+	ID         int64                  `json:"id" db:"id"`
+	OccurredAt time.Time              `json:"occurred_at" db:"occurred_at"`
+	EventType  string                 `json:"event_type" db:"event_type"`
+	UserID     *int                   `json:"user_id,omitempty" db:"user_id"`
+	ActorID    *int                   `json:"actor_id,omitempty" db:"actor_id"`
+	IPAddress  string                 `json:"ip_address" db:"ip_address"`
+	UserAgent  string                 `json:"user_agent" db:"user_agent"`
+	Details    map[string]interface{} `json:"details" db:"details"`
+}
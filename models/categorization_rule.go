@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// CategorizationRule — правило автокатегоризации. Условия объединяются по «И», пустое условие не проверяется.
+// Правила применяются по порядку position; поле, которое уже задало более раннее правило, не перезаписывается.
+type CategorizationRule struct {
+	ID                  int       `json:"id" db:"id"`
+	UserID              int       `json:"user_id" db:"user_id"`
+	Position            int       `json:"position" db:"position"`
+	Name                string    `json:"name" db:"name"`
+	Enabled             bool      `json:"enabled" db:"enabled"`
+	DescriptionContains string    `json:"description_contains" db:"description_contains"` // подстрока без учёта регистра
+	DescriptionRegex    string    `json:"description_regex" db:"description_regex"`
+	MinAmount           *float64  `json:"min_amount,omitempty" db:"min_amount"`
+	MaxAmount           *float64  `json:"max_amount,omitempty" db:"max_amount"`
+	Type                string    `json:"type" db:"type"` // income, expense, goal или пусто — любой
+	SetCategoryID       *int      `json:"set_category_id,omitempty" db:"set_category_id"`
+	SetDescription      string    `json:"set_description" db:"set_description"` // пусто — описание не меняется
+	SetGoalID           *int      `json:"set_goal_id,omitempty" db:"set_goal_id"`
+	CreatedAt           time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at" db:"updated_at"`
+}
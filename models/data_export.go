@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type DataExport struct {
+	ID          int        `json:"id" db:"id"`
+	UserID      int        `json:"user_id" db:"user_id"`
+	Status      string     `json:"status" db:"status"`
+	FilePath    string     `json:"-" db:"file_path"`
+	SizeBytes   int64      `json:"size_bytes" db:"size_bytes"`
+	Error       string     `json:"error,omitempty" db:"error"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// ImportMapping описывает, как читать выписку конкретного банка.
+// Колонки задаются названием из заголовка или номером, начиная с 1.
+type ImportMapping struct {
+	ID                int       `json:"id" db:"id"`
+	UserID            int       `json:"user_id" db:"user_id"`
+	BankName          string    `json:"bank_name" db:"bank_name"`
+	Delimiter         string    `json:"delimiter" db:"delimiter"` // пусто — определяется по первой строке
+	Encoding          string    `json:"encoding" db:"encoding"`   // utf-8 или windows-1251
+	HasHeader         bool      `json:"has_header" db:"has_header"`
+	SkipRows          int       `json:"skip_rows" db:"skip_rows"` // строки перед заголовком
+	DateColumn        string    `json:"date_column" db:"date_column"`
+	DateFormat        string    `json:"date_format" db:"date_format"` // например DD.MM.YYYY; пусто — распространённые форматы
+	AmountColumn      string    `json:"amount_column" db:"amount_column"`
+	DebitColumn       string    `json:"debit_column" db:"debit_column"`
+	CreditColumn      string    `json:"credit_column" db:"credit_column"`
+	SignConvention    string    `json:"sign_convention" db:"sign_convention"` // signed, inverted или split
+	DecimalSeparator  string    `json:"decimal_separator" db:"decimal_separator"`
+	DescriptionColumn string    `json:"description_column" db:"description_column"`
+	CurrencyColumn    string    `json:"currency_column" db:"currency_column"`
+	DefaultCurrency   string    `json:"default_currency" db:"default_currency"`
+	CategoryColumn    string    `json:"category_column" db:"category_column"`
+	DefaultCategoryID *int      `json:"default_category_id,omitempty" db:"default_category_id"`
+	CreatedAt         time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
+}
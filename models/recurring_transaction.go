@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// RecurringTransaction — шаблон повторяющейся транзакции (зарплата, подписка) и её расписание.
+// По расписанию из шаблона создаются обычные транзакции с датой очередного повторения.
+type RecurringTransaction struct {
+	ID     int    `json:"id" db:"id"`
+	UserID int    `json:"user_id" db:"user_id"`
+	Name   string `json:"name" db:"name"`
+
+	// Шаблон транзакции; поля имеют тот же смысл, что и у Transaction
+	Type              string   `json:"type" db:"type"`
+	Amount            float64  `json:"amount" db:"amount"`
+	Currency          string   `json:"currency" db:"currency"` // пусто — валюта счёта
+	Description       string   `json:"description" db:"description"`
+	CategoryID        int      `json:"category_id" db:"category_id"` // 0 — категорию выберут правила автокатегоризации
+	AccountID         int      `json:"account_id" db:"account_id"`
+	TransferAccountID *int     `json:"transfer_account_id,omitempty" db:"transfer_account_id"`
+	TransferAmount    *float64 `json:"transfer_amount,omitempty" db:"transfer_amount"`
+	GoalID            *int     `json:"goal_id,omitempty" db:"goal_id"`
+
+	// Расписание: раз в Interval дней, недель, месяцев или лет начиная со StartDate
+	Frequency  string     `json:"frequency" db:"frequency"` // daily, weekly, monthly, yearly
+	Interval   int        `json:"interval" db:"repeat_interval"`
+	DayOfMonth int        `json:"day_of_month" db:"day_of_month"` // для monthly: 1–31, -1 — последний день, 0 — день StartDate
+	WorkingDay string     `json:"working_day" db:"working_day"`   // перенос с выходных: previous, next или пусто
+	StartDate  time.Time  `json:"start_date" db:"start_date"`
+	EndDate    *time.Time `json:"end_date,omitempty" db:"end_date"`
+
+	Enabled bool `json:"enabled" db:"enabled"`
+	// Ближайшее необработанное повторение; nil — расписание закончилось
+	NextDate *time.Time `json:"next_date,omitempty" db:"next_date"`
+	// Последнее обработанное (созданное или пропущенное) повторение
+	LastDate *time.Time `json:"last_date,omitempty" db:"last_date"`
+	// Почему шаблон был приостановлен при создании транзакции
+	LastError string    `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// RecurringOccurrence — одно повторение шаблона. Пропуск или изменения задаются заранее;
+// после создания транзакции повторение хранит её ID.
+type RecurringOccurrence struct {
+	Date          time.Time `json:"date" db:"occurrence_date"`
+	Status        string    `json:"status" db:"status"` // scheduled, skipped, created
+	TransactionID *int      `json:"transaction_id,omitempty" db:"transaction_id"`
+	// Изменения только этого повторения; nil — значение из шаблона
+	Amount      *float64 `json:"amount,omitempty" db:"amount"`
+	Description *string  `json:"description,omitempty" db:"description"`
+	CategoryID  *int     `json:"category_id,omitempty" db:"category_id"`
+}
@@ -0,0 +1,8 @@
+package models
+
+type Role struct {
+	ID          int      `json:"id" db:"id"`
+	Name        string   `json:"name" db:"name"`
+	Description string   `json:"description" db:"description"`
+	Permissions []string `json:"permissions"`
+}
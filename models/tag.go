@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Tag — свободная метка транзакций, например «отпуск-2026» или «к-возмещению»
+type Tag struct {
+	ID     int    `json:"id" db:"id"`
+	UserID int    `json:"user_id" db:"user_id"`
+	Name   string `json:"name" db:"name"`
+	// Число текущих и архивных транзакций с этим тегом
+	TransactionCount int       `json:"transaction_count" db:"-"`
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// TransactionDuplicate — пара похожих транзакций в очереди на проверку
+type TransactionDuplicate struct {
+	ID          int         `json:"id" db:"id"`
+	UserID      int         `json:"user_id" db:"user_id"`
+	Transaction Transaction `json:"transaction"`  // добавленная позже
+	DuplicateOf Transaction `json:"duplicate_of"` // уже существовавшая
+	Score       float64     `json:"score" db:"score"`
+	Status      string      `json:"status" db:"status"` // pending или kept
+	CreatedAt   time.Time   `json:"created_at" db:"created_at"`
+	ResolvedAt  *time.Time  `json:"resolved_at,omitempty" db:"resolved_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "math"
+
+// TransactionSplit — часть разделённой транзакции со своей категорией, например продукты из общего чека
+type TransactionSplit struct {
+	ID         int     `json:"id" db:"id"`
+	CategoryID int     `json:"category_id" db:"category_id"`
+	Amount     float64 `json:"amount" db:"amount"`
+	Note       string  `json:"note" db:"note"`
+}
+
+// ScaleSplits пересчитывает части по курсу после пересчёта суммы транзакции, например при смене валюты.
+// Части округляются до копеек, остаток округления достаётся последней части, чтобы сумма сошлась.
+func (t *Transaction) ScaleSplits(rate float64) {
+	if len(t.Splits) == 0 {
+		return
+	}
+	remaining := math.Round(t.Amount * 100)
+	last := len(t.Splits) - 1
+	for i := range t.Splits[:last] {
+		cents := math.Round(t.Splits[i].Amount * rate * 100)
+		t.Splits[i].Amount = cents / 100
+		remaining -= cents
+	}
+	t.Splits[last].Amount = remaining / 100
+}
@@ -8,9 +8,20 @@ type Transaction struct {
 	CategoryID  int       `json:"category_id" db:"category_id"`
 	Amount      float64   `json:"amount" db:"amount"`
 	Date        time.Time `json:"date" db:"date"`
-	Type        string    `json:"type" db:"type"` // Возможные значения: "income", "expense", "goal"
+	Type        string    `json:"type" db:"type"` // Возможные значения: "income", "expense", "goal", "transfer"
 	Description string    `json:"description" db:"description"`
 	GoalID      *int      `json:"goal_id,omitempty" db:"goal_id"` // Привязка к цели
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	Currency    string    `json:"currency" db:"currency"`
+	// Счёт, с которым связана операция; для перевода — счёт списания. 0 при создании — основной счёт пользователя
+	AccountID int `json:"account_id" db:"account_id"`
+	// Счёт зачисления и сумма в его валюте; заполняются только у переводов
+	TransferAccountID *int     `json:"transfer_account_id,omitempty" db:"transfer_account_id"`
+	TransferAmount    *float64 `json:"transfer_amount,omitempty" db:"transfer_amount"`
+	// Выставляется при создании, если транзакция похожа на уже существующую и попала в очередь проверки дубликатов
+	PossibleDuplicate bool `json:"possible_duplicate,omitempty" db:"-"`
+	// Части транзакции по категориям; пусто — вся сумма относится к CategoryID
+	Splits []TransactionSplit `json:"splits,omitempty" db:"-"`
+	// Имена тегов; при изменении транзакции nil оставляет прежние теги, пустой список снимает все
+	Tags []string `json:"tags,omitempty" db:"-"`
 }
@@ -1,9 +1,10 @@
 package models
 
 type User struct {
-	ID       int    `json:"id" db:"id"`
-	Name     string `json:"name" db:"name"`
-	Email    string `json:"email" db:"email"`
-	Password string `json:"-" db:"password"`
-	IsAdmin  bool   `json:"is_admin" db:"is_admin"`
+	ID            int    `json:"id" db:"id"`
+	Name          string `json:"name" db:"name"`
+	Email         string `json:"email" db:"email"`
+	Password      string `json:"-" db:"password"`
+	IsAdmin       bool   `json:"is_admin" db:"is_admin"`
+	EmailVerified bool   `json:"email_verified" db:"email_verified"`
 }